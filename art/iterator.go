@@ -0,0 +1,97 @@
+package art
+
+import (
+	"cmp"
+	"main/tree_api"
+)
+
+// IteratorOf walks the keys of an ART in order. It holds no locks: it keeps
+// the leaf it is on, which never changes, and moves by seeking the next leaf
+// past that leaf's key. It sees every key that is present throughout the
+// walk.
+type IteratorOf[K cmp.Ordered, V any] struct {
+	tree      *ARTOf[K, V]
+	leaf      *NodeOf[K, V]
+	started   bool
+	exhausted bool
+	closed    bool
+}
+
+func (t *ARTOf[K, V]) NewIterator() tree_api.IteratorOf[K, V] {
+	return &IteratorOf[K, V]{tree: t}
+}
+
+func (it *IteratorOf[K, V]) Seek(key K) bool {
+	if it.closed {
+		return false
+	}
+	it.started = true
+	return it.settle(it.tree.seek(encode(key), true, true))
+}
+
+func (it *IteratorOf[K, V]) Next() bool {
+	return it.step(true)
+}
+
+func (it *IteratorOf[K, V]) Prev() bool {
+	return it.step(false)
+}
+
+func (it *IteratorOf[K, V]) step(forward bool) bool {
+	if it.closed || it.exhausted {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		var leaf *NodeOf[K, V]
+		retry(func() bool {
+			v, ok := it.tree.root.readLock()
+			if !ok {
+				return false
+			}
+			leaf, ok = it.tree.edge(it.tree.root, v, forward)
+			return ok
+		})
+		return it.settle(leaf)
+	}
+	return it.settle(it.tree.seek(it.leaf.path, forward, false))
+}
+
+// settle moves the iterator to leaf, or exhausts it if leaf is nil.
+func (it *IteratorOf[K, V]) settle(leaf *NodeOf[K, V]) bool {
+	it.leaf = leaf
+	it.exhausted = leaf == nil
+	return !it.exhausted
+}
+
+func (it *IteratorOf[K, V]) Key() K {
+	if !it.valid() {
+		var zero K
+		return zero
+	}
+	return it.leaf.key
+}
+
+func (it *IteratorOf[K, V]) Value() *tree_api.RecordOf[V] {
+	if !it.valid() {
+		return nil
+	}
+	return it.leaf.record
+}
+
+func (it *IteratorOf[K, V]) Err() error {
+	if it.closed {
+		return tree_api.ErrIteratorClosed
+	}
+	return nil
+}
+
+func (it *IteratorOf[K, V]) Close() error {
+	it.closed = true
+	it.leaf = nil
+	return nil
+}
+
+func (it *IteratorOf[K, V]) valid() bool {
+	return !it.closed && !it.exhausted && it.leaf != nil
+}
@@ -0,0 +1,50 @@
+package art
+
+import (
+	"cmp"
+	"encoding/binary"
+	"math"
+	"reflect"
+)
+
+// encode turns key into bytes whose lexicographic order is the order of the
+// keys, and no key's bytes are a prefix of another's, which the tree needs to
+// tell keys apart by their bytes alone. Integers become eight big-endian bytes
+// with the sign bit flipped, floats their IEEE bits with negative values
+// inverted, and strings their bytes with 0x00 escaped as 0x00 0xff and
+// 0x00 0x00 appended. NaN has no place in the order and is not supported.
+func encode[K cmp.Ordered](key K) []byte {
+	if k, ok := any(key).(int); ok {
+		return binary.BigEndian.AppendUint64(make([]byte, 0, 8), uint64(k)^(1<<63))
+	}
+	v := reflect.ValueOf(key)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.BigEndian.AppendUint64(make([]byte, 0, 8), uint64(v.Int())^(1<<63))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return binary.BigEndian.AppendUint64(make([]byte, 0, 8), v.Uint())
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if f == 0 {
+			f = 0 // -0 sorts with +0
+		}
+		bits := math.Float64bits(f)
+		if bits&(1<<63) != 0 {
+			bits = ^bits
+		} else {
+			bits |= 1 << 63
+		}
+		return binary.BigEndian.AppendUint64(make([]byte, 0, 8), bits)
+	case reflect.String:
+		s := v.String()
+		b := make([]byte, 0, len(s)+2)
+		for i := 0; i < len(s); i++ {
+			b = append(b, s[i])
+			if s[i] == 0 {
+				b = append(b, 0xff)
+			}
+		}
+		return append(b, 0, 0)
+	}
+	panic("art: unsupported key type " + v.Type().String())
+}
@@ -0,0 +1,280 @@
+package art
+
+import (
+	"cmp"
+	"main/tree_api"
+	"runtime"
+	"sync/atomic"
+)
+
+// The version word of a node counts its modifications in steps of four and
+// keeps two flags in the low bits: lockedBit while a writer holds the node,
+// and obsoleteBit once the node has been replaced in its parent. Locking adds
+// lockedBit and unlocking adds it again, so the carry clears the flag and
+// bumps the count in one step.
+const (
+	obsoleteBit = 1
+	lockedBit   = 2
+)
+
+type nodeKind uint8
+
+const (
+	leafNode nodeKind = iota
+	node4
+	node16
+	node48
+	node256
+)
+
+var capacities = [...]int{node4: 4, node16: 16, node48: 48, node256: 256}
+
+// Below these counts a node shrinks to the next smaller kind. The gap to the
+// smaller kind's capacity keeps a node that sits at a boundary from growing
+// and shrinking on every other write.
+var shrinkBelow = [...]int{node16: 4, node48: 13, node256: 38}
+
+// NodeOf is a node of an ART: a leaf, or an inner node of one of four sizes.
+//
+// Leaves never change; a new value gets a new leaf. Inner nodes are changed in
+// place by a writer holding the node's lock, while readers read them without
+// locking and check the version afterwards. Every field a reader can see
+// change is therefore an atomic: the compressed prefix, the child count, the
+// child slots and the key bytes, which are packed eight to a word. Node4 and
+// Node16 keep their key bytes sorted, with the child for key i in slot i;
+// Node48 keeps, for each of the 256 possible bytes, one more than the slot of
+// its child, or zero; Node256 keeps its child for byte b in slot b. A node
+// that fills up or empties out is replaced by a copy of another size.
+type NodeOf[K cmp.Ordered, V any] struct {
+	version  atomic.Uint64
+	kind     nodeKind
+	prefix   atomic.Pointer[[]byte]
+	count    atomic.Uint32
+	keys     []atomic.Uint64
+	children []atomic.Pointer[NodeOf[K, V]]
+
+	// Leaves.
+	key    K
+	path   []byte // the encoded key
+	record *tree_api.RecordOf[V]
+}
+
+type Node = NodeOf[int, []byte]
+
+func newLeaf[K cmp.Ordered, V any](key K, path []byte, record *tree_api.RecordOf[V]) *NodeOf[K, V] {
+	return &NodeOf[K, V]{kind: leafNode, key: key, path: path, record: record}
+}
+
+func newInner[K cmp.Ordered, V any](kind nodeKind, prefix []byte) *NodeOf[K, V] {
+	n := &NodeOf[K, V]{kind: kind, children: make([]atomic.Pointer[NodeOf[K, V]], capacities[kind])}
+	switch kind {
+	case node4, node16:
+		n.keys = make([]atomic.Uint64, (capacities[kind]+7)/8)
+	case node48:
+		n.keys = make([]atomic.Uint64, 256/8)
+	}
+	n.prefix.Store(&prefix)
+	return n
+}
+
+func (n *NodeOf[K, V]) isLeaf() bool {
+	return n.kind == leafNode
+}
+
+// readLock waits until no writer holds n and returns its version. It reports
+// false if n is obsolete, and the reader must restart from the root.
+func (n *NodeOf[K, V]) readLock() (uint64, bool) {
+	for {
+		v := n.version.Load()
+		if v&lockedBit == 0 {
+			return v, v&obsoleteBit == 0
+		}
+		runtime.Gosched()
+	}
+}
+
+// validate reports whether n is unchanged since readLock returned v.
+func (n *NodeOf[K, V]) validate(v uint64) bool {
+	return n.version.Load() == v
+}
+
+// upgrade locks n if it is unchanged since readLock returned v.
+func (n *NodeOf[K, V]) upgrade(v uint64) bool {
+	return n.version.CompareAndSwap(v, v+lockedBit)
+}
+
+// tryLock locks n if it is neither locked nor obsolete. Writers never wait for
+// a lock while holding one, so locks can be taken in any order.
+func (n *NodeOf[K, V]) tryLock() bool {
+	v := n.version.Load()
+	return v&(lockedBit|obsoleteBit) == 0 && n.upgrade(v)
+}
+
+func (n *NodeOf[K, V]) unlock() {
+	n.version.Add(lockedBit)
+}
+
+func (n *NodeOf[K, V]) unlockObsolete() {
+	n.version.Add(lockedBit + obsoleteBit)
+}
+
+func (n *NodeOf[K, V]) loadPrefix() []byte {
+	return *n.prefix.Load()
+}
+
+func (n *NodeOf[K, V]) keyAt(i int) byte {
+	return byte(n.keys[i/8].Load() >> (8 * (i % 8)))
+}
+
+// setKey is only called with n locked, so the read and the store of the word
+// cannot interleave with another writer's.
+func (n *NodeOf[K, V]) setKey(i int, b byte) {
+	w, shift := &n.keys[i/8], 8*(i%8)
+	w.Store(w.Load()&^(0xff<<shift) | uint64(b)<<shift)
+}
+
+func (n *NodeOf[K, V]) isFull() bool {
+	return n.kind != node256 && int(n.count.Load()) == capacities[n.kind]
+}
+
+// findChild returns the child for byte b, or nil. A reader may see n halfway
+// through a change and must validate n before trusting the result.
+func (n *NodeOf[K, V]) findChild(b byte) *NodeOf[K, V] {
+	switch n.kind {
+	case node4, node16:
+		count := min(int(n.count.Load()), len(n.children))
+		for i := 0; i < count; i++ {
+			if n.keyAt(i) == b {
+				return n.children[i].Load()
+			}
+		}
+	case node48:
+		if s := n.keyAt(int(b)); s != 0 {
+			return n.children[s-1].Load()
+		}
+	case node256:
+		return n.children[b].Load()
+	}
+	return nil
+}
+
+// nextChild returns the child with the smallest byte above from, or with
+// forward unset the largest byte below it, and that byte. from may be -1 or
+// 256 to find the first or last child. It returns nil if there is none.
+func (n *NodeOf[K, V]) nextChild(from int, forward bool) (byte, *NodeOf[K, V]) {
+	switch n.kind {
+	case node4, node16:
+		count := min(int(n.count.Load()), len(n.children))
+		if forward {
+			for i := 0; i < count; i++ {
+				if b := n.keyAt(i); int(b) > from {
+					return b, n.children[i].Load()
+				}
+			}
+		} else {
+			for i := count - 1; i >= 0; i-- {
+				if b := n.keyAt(i); int(b) < from {
+					return b, n.children[i].Load()
+				}
+			}
+		}
+		return 0, nil
+	}
+	step := 1
+	if !forward {
+		step = -1
+	}
+	for b := from + step; b >= 0 && b < 256; b += step {
+		if c := n.findChild(byte(b)); c != nil {
+			return byte(b), c
+		}
+	}
+	return 0, nil
+}
+
+// each calls f for every child in byte order. n must be locked or otherwise
+// not changing.
+func (n *NodeOf[K, V]) each(f func(b byte, c *NodeOf[K, V])) {
+	for b, c := n.nextChild(-1, true); c != nil; b, c = n.nextChild(int(b), true) {
+		f(b, c)
+	}
+}
+
+// insert adds child under byte b to n, which is locked, not full and has no
+// child under b.
+func (n *NodeOf[K, V]) insert(b byte, child *NodeOf[K, V]) {
+	count := int(n.count.Load())
+	switch n.kind {
+	case node4, node16:
+		i := count
+		for ; i > 0 && n.keyAt(i-1) > b; i-- {
+			n.setKey(i, n.keyAt(i-1))
+			n.children[i].Store(n.children[i-1].Load())
+		}
+		n.setKey(i, b)
+		n.children[i].Store(child)
+	case node48:
+		s := 0
+		for n.children[s].Load() != nil {
+			s++
+		}
+		n.children[s].Store(child)
+		n.setKey(int(b), byte(s+1))
+	case node256:
+		n.children[b].Store(child)
+	}
+	n.count.Store(uint32(count + 1))
+}
+
+// replace swaps the child under byte b of n, which is locked, for child.
+func (n *NodeOf[K, V]) replace(b byte, child *NodeOf[K, V]) {
+	switch n.kind {
+	case node4, node16:
+		for i := 0; ; i++ {
+			if n.keyAt(i) == b {
+				n.children[i].Store(child)
+				return
+			}
+		}
+	case node48:
+		n.children[n.keyAt(int(b))-1].Store(child)
+	case node256:
+		n.children[b].Store(child)
+	}
+}
+
+// remove drops the child under byte b from n, which is locked.
+func (n *NodeOf[K, V]) remove(b byte) {
+	count := int(n.count.Load())
+	switch n.kind {
+	case node4, node16:
+		i := 0
+		for n.keyAt(i) != b {
+			i++
+		}
+		for ; i+1 < count; i++ {
+			n.setKey(i, n.keyAt(i+1))
+			n.children[i].Store(n.children[i+1].Load())
+		}
+		n.setKey(count-1, 0)
+		n.children[count-1].Store(nil)
+	case node48:
+		n.children[n.keyAt(int(b))-1].Store(nil)
+		n.setKey(int(b), 0)
+	case node256:
+		n.children[b].Store(nil)
+	}
+	n.count.Store(uint32(count - 1))
+}
+
+// resized returns a copy of n, which is locked, as a node of the given kind,
+// leaving out the child under skip if hasSkip is set.
+func (n *NodeOf[K, V]) resized(kind nodeKind, skip byte, hasSkip bool) *NodeOf[K, V] {
+	m := newInner[K, V](kind, n.loadPrefix())
+	n.each(func(b byte, c *NodeOf[K, V]) {
+		if !hasSkip || b != skip {
+			m.insert(b, c)
+		}
+	})
+	return m
+}
@@ -0,0 +1,571 @@
+package art
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"main/tree_api"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// ART nodes have no fixed fan-out, so the order a tree is built with is only
+// checked, to keep the constructor interchangeable with the B+ trees'.
+const (
+	defaultOrder = 4
+	minOrder     = 3
+	maxOrder     = 512
+)
+
+// ARTOf is an adaptive radix tree after Leis, Kemper and Neumann, with
+// optimistic lock coupling for concurrency. Keys are encoded into bytes that
+// sort like the keys, and each inner node branches on one byte, holding
+// between 4 and 256 children depending on how many it needs. Runs of bytes
+// that every key below a node shares are stored once, as the node's prefix,
+// and a leaf hangs as high in the tree as the bytes that tell it apart allow.
+//
+// Readers lock nothing. They check each node's version after reading it and
+// restart from the root if a writer got in between. Writers lock only the
+// node they change, and its parent when the node is replaced by a copy of
+// another size, gets a new node above it to split its prefix, or is folded
+// into its only remaining child.
+type ARTOf[K cmp.Ordered, V any] struct {
+	// root is a Node256 that is never replaced, so that every other node has
+	// a parent to be replaced in.
+	root *NodeOf[K, V]
+}
+
+type ART = ARTOf[int, []byte]
+
+func NewTree(opts ...tree_api.Option) tree_api.BPTree {
+	return NewTreeOf[int, []byte](opts...)
+}
+
+// NewTreeOf accepts the options every tree does, but an ART sizes each node
+// by the children it holds, so WithOrder is checked against the usual bounds
+// and otherwise ignored: trees built with different orders are the same.
+// Order sweeps leave the ART out for that reason.
+func NewTreeOf[K cmp.Ordered, V any](opts ...tree_api.Option) tree_api.TreeOf[K, V] {
+	if _, err := tree_api.BuildOptions(defaultOrder, minOrder, maxOrder, opts); err != nil {
+		panic(err)
+	}
+	return &ARTOf[K, V]{root: newInner[K, V](node256, nil)}
+}
+
+// retry runs attempt until it reports that it is done, yielding between tries
+// so that the writer it collided with can finish.
+func retry(attempt func() bool) {
+	for !attempt() {
+		runtime.Gosched()
+	}
+}
+
+// mismatch returns how many leading bytes of prefix path matches.
+func mismatch(prefix, path []byte) int {
+	i := 0
+	for i < len(prefix) && i < len(path) && prefix[i] == path[i] {
+		i++
+	}
+	return i
+}
+
+// lookupOf is where findLeaf ended for a key: the inner node the key's leaf
+// would hang from, the version it had, the byte the key branches on there and
+// the child under that byte. child is nil if the key is absent; node is nil
+// too if the key parts from a node's prefix.
+type lookupOf[K cmp.Ordered, V any] struct {
+	node    *NodeOf[K, V]
+	version uint64
+	b       byte
+	child   *NodeOf[K, V]
+}
+
+// findLeaf makes one optimistic descent for path. It reports false if a
+// writer got in the way and the descent must restart. On success the
+// child, if it is a leaf, may still hold a different key.
+func (t *ARTOf[K, V]) findLeaf(path []byte) (lookupOf[K, V], bool) {
+	n := t.root
+	v, ok := n.readLock()
+	if !ok {
+		return lookupOf[K, V]{}, false
+	}
+	depth := 0
+	for {
+		prefix := n.loadPrefix()
+		if mismatch(prefix, path[depth:]) < len(prefix) {
+			return lookupOf[K, V]{}, n.validate(v)
+		}
+		depth += len(prefix)
+		b := path[depth]
+		child := n.findChild(b)
+		if !n.validate(v) {
+			return lookupOf[K, V]{}, false
+		}
+		if child == nil || child.isLeaf() {
+			return lookupOf[K, V]{node: n, version: v, b: b, child: child}, true
+		}
+		cv, ok := child.readLock()
+		if !ok || !n.validate(v) {
+			return lookupOf[K, V]{}, false
+		}
+		n, v = child, cv
+		depth++
+	}
+}
+
+func (t *ARTOf[K, V]) Find(key K, verbose bool) (*tree_api.RecordOf[V], error) {
+	path := encode(key)
+	var l lookupOf[K, V]
+	retry(func() bool {
+		var ok bool
+		l, ok = t.findLeaf(path)
+		return ok
+	})
+	if l.child == nil || l.child.key != key {
+		return nil, tree_api.ErrKeyNotFound
+	}
+	return l.child.record, nil
+}
+
+func (t *ARTOf[K, V]) FindAndPrint(key K, verbose bool) {
+	r, err := t.Find(key, verbose)
+
+	if err != nil || r == nil {
+		fmt.Printf("Record not found under key %v.\n", key)
+	} else {
+		fmt.Printf("Record at %p -- key %v, value %s.\n", r, key, tree_api.FormatValue(r.Value))
+	}
+}
+
+func (t *ARTOf[K, V]) FindAndPrintRange(key_start, key_end K, verbose bool) {
+	results, _ := t.Range(key_start, key_end)
+	if len(results) == 0 {
+		fmt.Println("None found,")
+	} else {
+		for _, kr := range results {
+			fmt.Printf("Key: %v  Location: %p  Value: %s\n",
+				kr.Key,
+				kr.Record,
+				tree_api.FormatValue(kr.Record.Value))
+		}
+	}
+}
+
+func (t *ARTOf[K, V]) Insert(key K, value V) error {
+	return t.insert(key, &tree_api.RecordOf[V]{Value: value}, false)
+}
+
+// Upsert inserts key, or replaces its record if it is already present.
+func (t *ARTOf[K, V]) Upsert(key K, value V) error {
+	return t.insert(key, &tree_api.RecordOf[V]{Value: value}, true)
+}
+
+func (t *ARTOf[K, V]) insert(key K, record *tree_api.RecordOf[V], replace bool) error {
+	leaf := newLeaf(key, encode(key), record)
+	var err error
+	retry(func() bool {
+		var done bool
+		done, err = t.tryInsert(leaf, replace)
+		return done
+	})
+	return err
+}
+
+// tryInsert makes one attempt at adding leaf. It reports whether it finished,
+// or ran into another writer and must try again.
+func (t *ARTOf[K, V]) tryInsert(leaf *NodeOf[K, V], replace bool) (bool, error) {
+	path := leaf.path
+	var parent *NodeOf[K, V]
+	var pv uint64
+	var parentByte byte
+	n := t.root
+	v, ok := n.readLock()
+	if !ok {
+		return false, nil
+	}
+	depth := 0
+	for {
+		prefix := n.loadPrefix()
+		if m := mismatch(prefix, path[depth:]); m < len(prefix) {
+			// The key leaves n's prefix part way: a Node4 holding the shared
+			// part takes n's place, with n and the new leaf below it.
+			if !parent.upgrade(pv) {
+				return false, nil
+			}
+			if !n.upgrade(v) {
+				parent.unlock()
+				return false, nil
+			}
+			branch := newInner[K, V](node4, prefix[:m])
+			branch.insert(prefix[m], n)
+			branch.insert(path[depth+m], leaf)
+			rest := prefix[m+1:]
+			n.prefix.Store(&rest)
+			parent.replace(parentByte, branch)
+			n.unlock()
+			parent.unlock()
+			return true, nil
+		}
+		depth += len(prefix)
+		b := path[depth]
+		child := n.findChild(b)
+		if !n.validate(v) {
+			return false, nil
+		}
+
+		if child == nil {
+			if n.isFull() {
+				if !parent.upgrade(pv) {
+					return false, nil
+				}
+				if !n.upgrade(v) {
+					parent.unlock()
+					return false, nil
+				}
+				bigger := n.resized(n.kind+1, 0, false)
+				bigger.insert(b, leaf)
+				parent.replace(parentByte, bigger)
+				n.unlockObsolete()
+				parent.unlock()
+				return true, nil
+			}
+			if !n.upgrade(v) {
+				return false, nil
+			}
+			n.insert(b, leaf)
+			n.unlock()
+			return true, nil
+		}
+
+		if child.isLeaf() {
+			if child.key == leaf.key {
+				if !replace {
+					return true, tree_api.ErrKeyExists
+				}
+				if !n.upgrade(v) {
+					return false, nil
+				}
+				n.replace(b, leaf)
+				n.unlock()
+				return true, nil
+			}
+			// Two keys now share the byte: a Node4 holding the rest of the
+			// bytes they have in common takes the old leaf's place.
+			if !n.upgrade(v) {
+				return false, nil
+			}
+			m := depth + 1
+			for child.path[m] == path[m] {
+				m++
+			}
+			branch := newInner[K, V](node4, path[depth+1:m])
+			branch.insert(child.path[m], child)
+			branch.insert(path[m], leaf)
+			n.replace(b, branch)
+			n.unlock()
+			return true, nil
+		}
+
+		cv, ok := child.readLock()
+		if !ok || !n.validate(v) {
+			return false, nil
+		}
+		parent, pv, parentByte = n, v, b
+		n, v = child, cv
+		depth++
+	}
+}
+
+// Update replaces the record of an existing key.
+func (t *ARTOf[K, V]) Update(key K, value V) error {
+	_, err := t.swap(key, nil, value, false)
+	return err
+}
+
+// CompareAndSwap replaces the record of key if it is still old.
+func (t *ARTOf[K, V]) CompareAndSwap(key K, old *tree_api.RecordOf[V], new V) (bool, error) {
+	return t.swap(key, old, new, true)
+}
+
+// swap gives an existing key a new leaf, locking only the leaf's parent. With
+// compare set it only does so if the current record is old.
+func (t *ARTOf[K, V]) swap(key K, old *tree_api.RecordOf[V], value V, compare bool) (bool, error) {
+	path := encode(key)
+	leaf := newLeaf(key, path, &tree_api.RecordOf[V]{Value: value})
+	var swapped bool
+	var err error
+	retry(func() bool {
+		l, ok := t.findLeaf(path)
+		if !ok {
+			return false
+		}
+		if l.child == nil || l.child.key != key {
+			swapped, err = false, tree_api.ErrKeyNotFound
+			return true
+		}
+		if compare && l.child.record != old {
+			swapped, err = false, nil
+			return true
+		}
+		if !l.node.upgrade(l.version) {
+			return false
+		}
+		l.node.replace(l.b, leaf)
+		l.node.unlock()
+		swapped, err = true, nil
+		return true
+	})
+	return swapped, err
+}
+
+func (t *ARTOf[K, V]) Delete(key K) error {
+	path := encode(key)
+	var err error
+	retry(func() bool {
+		var done bool
+		done, err = t.tryDelete(key, path)
+		return done
+	})
+	return err
+}
+
+// tryDelete makes one attempt at removing key. A node left below its kind's
+// minimum is replaced by a smaller copy, and a Node4 left with one child is
+// replaced by that child, which takes over the node's prefix. It reports
+// whether it finished.
+func (t *ARTOf[K, V]) tryDelete(key K, path []byte) (bool, error) {
+	var parent *NodeOf[K, V]
+	var pv uint64
+	var parentByte byte
+	n := t.root
+	v, ok := n.readLock()
+	if !ok {
+		return false, nil
+	}
+	depth := 0
+	for {
+		prefix := n.loadPrefix()
+		if mismatch(prefix, path[depth:]) < len(prefix) {
+			return n.validate(v), tree_api.ErrKeyNotFound
+		}
+		depth += len(prefix)
+		b := path[depth]
+		child := n.findChild(b)
+		count := int(n.count.Load())
+		if !n.validate(v) {
+			return false, nil
+		}
+		if child == nil || (child.isLeaf() && child.key != key) {
+			return true, tree_api.ErrKeyNotFound
+		}
+
+		if child.isLeaf() {
+			switch {
+			case n == t.root || (n.kind == node4 && count > 2) ||
+				(n.kind != node4 && count > shrinkBelow[n.kind]):
+				if !n.upgrade(v) {
+					return false, nil
+				}
+				n.remove(b)
+				n.unlock()
+				return true, nil
+
+			case n.kind == node4:
+				if !parent.upgrade(pv) {
+					return false, nil
+				}
+				if !n.upgrade(v) {
+					parent.unlock()
+					return false, nil
+				}
+				ob, other := n.nextChild(int(b), true)
+				if other == nil {
+					ob, other = n.nextChild(int(b), false)
+				}
+				if !other.isLeaf() {
+					if !other.tryLock() {
+						n.unlock()
+						parent.unlock()
+						return false, nil
+					}
+					merged := append(append(slices.Clone(prefix), ob), other.loadPrefix()...)
+					other.prefix.Store(&merged)
+					other.unlock()
+				}
+				parent.replace(parentByte, other)
+				n.unlockObsolete()
+				parent.unlock()
+				return true, nil
+
+			default:
+				if !parent.upgrade(pv) {
+					return false, nil
+				}
+				if !n.upgrade(v) {
+					parent.unlock()
+					return false, nil
+				}
+				parent.replace(parentByte, n.resized(n.kind-1, b, true))
+				n.unlockObsolete()
+				parent.unlock()
+				return true, nil
+			}
+		}
+
+		cv, ok := child.readLock()
+		if !ok || !n.validate(v) {
+			return false, nil
+		}
+		parent, pv, parentByte = n, v, b
+		n, v = child, cv
+		depth++
+	}
+}
+
+// seek returns the leaf with the smallest encoded key above bound, or with
+// forward unset the largest below it, including bound itself if inclusive is
+// set. It returns nil if there is no such leaf.
+func (t *ARTOf[K, V]) seek(bound []byte, forward, inclusive bool) *NodeOf[K, V] {
+	var leaf *NodeOf[K, V]
+	retry(func() bool {
+		v, ok := t.root.readLock()
+		if !ok {
+			return false
+		}
+		leaf, ok = t.seekIn(t.root, v, 0, bound, forward, inclusive)
+		return ok
+	})
+	return leaf
+}
+
+// seekIn is one optimistic attempt at seek in the subtree under n, which had
+// version v and whose keys share bound's first depth bytes. It reports false
+// if a writer got in the way and the seek must restart.
+func (t *ARTOf[K, V]) seekIn(n *NodeOf[K, V], v uint64, depth int, bound []byte, forward, inclusive bool) (*NodeOf[K, V], bool) {
+	prefix := n.loadPrefix()
+	rest := bound[depth:]
+	c := bytes.Compare(prefix, rest[:min(len(prefix), len(rest))])
+	if c == 0 && len(rest) <= len(prefix) {
+		c = 1
+	}
+	if c != 0 {
+		// The whole subtree lies on one side of bound.
+		if !n.validate(v) {
+			return nil, false
+		}
+		if (c > 0) == forward {
+			return t.edge(n, v, forward)
+		}
+		return nil, true
+	}
+	depth += len(prefix)
+	b := bound[depth]
+	child := n.findChild(b)
+	if !n.validate(v) {
+		return nil, false
+	}
+	if child != nil && child.isLeaf() {
+		c := bytes.Compare(child.path, bound)
+		if (c == 0 && inclusive) || (c != 0 && (c > 0) == forward) {
+			return child, true
+		}
+	} else if child != nil {
+		cv, ok := child.readLock()
+		if !ok || !n.validate(v) {
+			return nil, false
+		}
+		leaf, ok := t.seekIn(child, cv, depth+1, bound, forward, inclusive)
+		if !ok || leaf != nil {
+			return leaf, ok
+		}
+	}
+
+	_, next := n.nextChild(int(b), forward)
+	if !n.validate(v) {
+		return nil, false
+	}
+	if next == nil || next.isLeaf() {
+		return next, true
+	}
+	nv, ok := next.readLock()
+	if !ok || !n.validate(v) {
+		return nil, false
+	}
+	return t.edge(next, nv, forward)
+}
+
+// edge returns the first leaf under n, which had version v, or with forward
+// unset the last. It reports false if a writer got in the way.
+func (t *ARTOf[K, V]) edge(n *NodeOf[K, V], v uint64, forward bool) (*NodeOf[K, V], bool) {
+	from := -1
+	if !forward {
+		from = 256
+	}
+	for {
+		_, child := n.nextChild(from, forward)
+		if !n.validate(v) {
+			return nil, false
+		}
+		if child == nil || child.isLeaf() {
+			return child, true
+		}
+		cv, ok := child.readLock()
+		if !ok || !n.validate(v) {
+			return nil, false
+		}
+		n, v = child, cv
+	}
+}
+
+func (t *ARTOf[K, V]) Range(key_start, key_end K) ([]tree_api.KeyRecordOf[K, V], error) {
+	return t.RangeLimit(key_start, key_end, 0, false)
+}
+
+// RangeLimit finds one leaf at a time, each by seeking past the last one
+// found. The result is sorted and holds every key that was present
+// throughout the call, but is not a snapshot of the whole range.
+func (t *ARTOf[K, V]) RangeLimit(key_start, key_end K, limit int, reverse bool) ([]tree_api.KeyRecordOf[K, V], error) {
+	if key_start > key_end {
+		return nil, tree_api.ErrInvalidRange
+	}
+	results := []tree_api.KeyRecordOf[K, V]{}
+	bound := encode(key_start)
+	if reverse {
+		bound = encode(key_end)
+	}
+	leaf := t.seek(bound, !reverse, true)
+	for leaf != nil && (limit <= 0 || len(results) < limit) {
+		if (!reverse && leaf.key > key_end) || (reverse && leaf.key < key_start) {
+			break
+		}
+		results = append(results, tree_api.KeyRecordOf[K, V]{Key: leaf.key, Record: leaf.record})
+		leaf = t.seek(leaf.path, !reverse, false)
+	}
+	return results, nil
+}
+
+// PrintTree prints one node per line, indented by depth, with inner nodes
+// showing their kind and prefix and leaves their key.
+func (t *ARTOf[K, V]) PrintTree() {
+	var print func(n *NodeOf[K, V], b byte, indent int)
+	print = func(n *NodeOf[K, V], b byte, indent int) {
+		pad := strings.Repeat("  ", indent)
+		if n.isLeaf() {
+			fmt.Printf("%s%02x: %v\n", pad, b, n.key)
+			return
+		}
+		kinds := [...]string{node4: "Node4", node16: "Node16", node48: "Node48", node256: "Node256"}
+		fmt.Printf("%s%02x: %s prefix %x\n", pad, b, kinds[n.kind], n.loadPrefix())
+		n.each(func(b byte, c *NodeOf[K, V]) { print(c, b, indent+1) })
+	}
+	t.root.each(func(b byte, c *NodeOf[K, V]) { print(c, b, 0) })
+}
+
+func (t *ARTOf[K, V]) PalmBasic(key_count int, num_threads int) {
+	panic("not implemented for ART")
+}
+
+func (t *ARTOf[K, V]) Palm(queries []tree_api.QueryOf[K, V], num_threads int) []tree_api.ResultOf[V] {
+	panic("not implemented for ART")
+}
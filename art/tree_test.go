@@ -0,0 +1,213 @@
+package art
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"main/tree_testing"
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestEncodeKeepsOrder(t *testing.T) {
+	ints := []int{math.MinInt, -1 << 40, -256, -1, 0, 1, 255, 256, 1 << 40, math.MaxInt}
+	floats := []float64{math.Inf(-1), -1e300, -1.5, -0.25, 0, 1e-300, 0.25, 1.5, math.Inf(1)}
+	strs := []string{"", "\x00", "\x00\x00", "\x00a", "a", "a\x00", "a\x00b", "ab", "b"}
+	checkOrder(t, ints)
+	checkOrder(t, floats)
+	checkOrder(t, strs)
+	if !bytes.Equal(encode(-0.0), encode(0.0)) {
+		t.Errorf("expected -0 and +0 to encode alike")
+	}
+}
+
+// checkOrder checks that keys, which are sorted, encode to bytes in the same
+// order, none of them a prefix of another.
+func checkOrder[K cmp.Ordered](t *testing.T, keys []K) {
+	t.Helper()
+	for i := range keys {
+		for j := i + 1; j < len(keys); j++ {
+			a, b := encode(keys[i]), encode(keys[j])
+			if bytes.Compare(a, b) >= 0 {
+				t.Errorf("%v encodes to %x, not below %x for %v", keys[i], a, b, keys[j])
+			}
+			if bytes.HasPrefix(b, a) {
+				t.Errorf("%v encodes to %x, a prefix of %x for %v", keys[i], a, b, keys[j])
+			}
+		}
+	}
+}
+
+func onlyChild(tree *ART) *Node {
+	_, c := tree.root.nextChild(-1, true)
+	return c
+}
+
+// TestGrowAndShrink fills one node through every kind and empties it again.
+// It checks after each step that the node is of the kind its child count
+// calls for: growing past 4, 16 and 48 children moves it up a size, and
+// shrinking waits until it is well below the smaller size's capacity.
+func TestGrowAndShrink(t *testing.T) {
+	tree := NewTreeOf[int, []byte]().(*ART)
+	want := make(map[int]string)
+	// Keys 0 to 255 differ only in their last byte, so they end up in one
+	// node below the root, with the six zero bytes between as its prefix.
+	for i := 0; i < 256; i++ {
+		tree.Insert(i, []byte(fmt.Sprint(i)))
+		want[i] = fmt.Sprint(i)
+		if err := tree.Validate(); err != nil {
+			t.Fatalf("after inserting %d: %s", i, err)
+		}
+		if i == 0 {
+			continue
+		}
+		n := onlyChild(tree)
+		kind := node4
+		for kind < node256 && i+1 > capacities[kind] {
+			kind++
+		}
+		if n.kind != kind || int(n.count.Load()) != i+1 || len(n.loadPrefix()) != 6 {
+			t.Fatalf("with %d keys expected a node of kind %d and a prefix of 6 bytes, got kind %d with %d children and prefix %x", i+1, kind, n.kind, n.count.Load(), n.loadPrefix())
+		}
+	}
+	tree_testing.CheckContents(t, tree, want)
+
+	kind := node256
+	for i := 255; i >= 0; i-- {
+		if kind != node4 && i+1 <= shrinkBelow[kind] {
+			kind--
+		}
+		if err := tree.Delete(i); err != nil {
+			t.Fatalf("delete %d: %s", i, err)
+		}
+		delete(want, i)
+		if err := tree.Validate(); err != nil {
+			t.Fatalf("after deleting %d: %s", i, err)
+		}
+		switch n := onlyChild(tree); {
+		case i == 0:
+			if n != nil {
+				t.Fatalf("expected an empty tree after deleting every key")
+			}
+		case i == 1:
+			// A Node4 left with one child is replaced by it.
+			if !n.isLeaf() || n.key != 0 {
+				t.Fatalf("expected the last key to hang from the root as a leaf")
+			}
+		case n.kind != kind || int(n.count.Load()) != i:
+			t.Fatalf("with %d keys expected a node of kind %d, got kind %d with %d children", i, kind, n.kind, n.count.Load())
+		}
+	}
+	tree_testing.CheckContents(t, tree, want)
+}
+
+// TestPrefixSplitAndMerge inserts a key that leaves a node's prefix part way,
+// which puts a Node4 holding the shared bytes above the node, and deletes it
+// again, which folds the node back into one with the whole prefix.
+func TestPrefixSplitAndMerge(t *testing.T) {
+	tree := NewTreeOf[string, []byte]().(*ARTOf[string, []byte])
+	find := func(keys ...string) {
+		t.Helper()
+		for _, key := range keys {
+			if r, err := tree.Find(key, false); err != nil || string(r.Value) != key {
+				t.Errorf("find %q: %v %v", key, r, err)
+			}
+		}
+		if err := tree.Validate(); err != nil {
+			t.Error(err)
+		}
+	}
+	prefixOf := func(n *NodeOf[string, []byte]) string {
+		if n == nil || n.isLeaf() {
+			return "<leaf>"
+		}
+		return string(n.loadPrefix())
+	}
+	for _, key := range []string{"abcdef1", "abcdef2"} {
+		tree.Insert(key, []byte(key))
+	}
+	a := tree.root.findChild('a')
+	if got := prefixOf(a); got != "bcdef" {
+		t.Fatalf("expected the node below 'a' to have prefix bcdef, got %s", got)
+	}
+	find("abcdef1", "abcdef2")
+
+	tree.Insert("abcxyz", []byte("abcxyz"))
+	branch := tree.root.findChild('a')
+	if got := prefixOf(branch); got != "bc" || branch.kind != node4 {
+		t.Fatalf("expected a Node4 with prefix bc to take the node's place, got %s", got)
+	}
+	if branch.findChild('d') != a || prefixOf(a) != "ef" {
+		t.Errorf("expected the old node below d with prefix ef, got prefix %s", prefixOf(branch.findChild('d')))
+	}
+	find("abcdef1", "abcdef2", "abcxyz")
+
+	// A split at the very first byte of a prefix leaves the branch with none.
+	tree.Insert("abz", []byte("abz"))
+	if got := prefixOf(tree.root.findChild('a')); got != "b" {
+		t.Errorf("expected the new branch to keep only b as its prefix, got %s", got)
+	}
+	find("abcdef1", "abcdef2", "abcxyz", "abz")
+
+	for _, key := range []string{"abz", "abcxyz"} {
+		if err := tree.Delete(key); err != nil {
+			t.Fatalf("delete %q: %s", key, err)
+		}
+	}
+	if got := prefixOf(tree.root.findChild('a')); got != "bcdef" {
+		t.Errorf("expected the branches to fold back into prefix bcdef, got %s", got)
+	}
+	find("abcdef1", "abcdef2")
+}
+
+// TestFindDuringPrefixSplits keeps finding keys that are present throughout
+// while writers insert keys that share ever shorter prefixes with them,
+// splitting leaves and then the prefixes of the nodes that replaced them.
+func TestFindDuringPrefixSplits(t *testing.T) {
+	tree := NewTreeOf[int, []byte]().(*ART)
+	want := make(map[int]string)
+	for k := 1; k <= 64; k++ {
+		tree.Insert(k<<32, []byte(fmt.Sprint(k<<32)))
+		want[k<<32] = fmt.Sprint(k << 32)
+	}
+	var wg sync.WaitGroup
+	for _, shift := range []int{8, 16, 24} {
+		wg.Add(1)
+		go func(shift int) {
+			defer wg.Done()
+			for k := 1; k <= 64; k++ {
+				for j := 1; j <= 3; j++ {
+					tree.Insert(k<<32|j<<shift, []byte(fmt.Sprint(k<<32|j<<shift)))
+				}
+			}
+		}(shift)
+		for k := 1; k <= 64; k++ {
+			for j := 1; j <= 3; j++ {
+				want[k<<32|j<<shift] = fmt.Sprint(k<<32 | j<<shift)
+			}
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		for k := 1; k <= 64; k++ {
+			if r, err := tree.Find(k<<32, false); err != nil || string(r.Value) != fmt.Sprint(k<<32) {
+				t.Fatalf("find %d during prefix splits: %v %v", k<<32, r, err)
+			}
+		}
+	}
+	tree_testing.CheckContents(t, tree, want)
+}
+
+func TestConcurrentPointOps(t *testing.T) {
+	tree_testing.ConcurrentPointOps(t, NewTreeOf[int, []byte]())
+}
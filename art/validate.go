@@ -0,0 +1,144 @@
+package art
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"main/tree_api"
+	"strings"
+)
+
+// Validate checks that the tree is well formed: every node is of a known kind
+// and holds as many children as its count says, within its kind's capacity
+// and, below the root, no fewer than its kind's minimum; Node4 and Node16 keep
+// their bytes sorted and Node48's index and slots agree; every leaf's encoded
+// key is its key's encoding and starts with the bytes that lead to it; leaves
+// come in ascending key order; and no node is left locked or obsolete. It
+// returns an error wrapping tree_api.ErrInvalidTree that names the bytes
+// leading from the root to the first node found to be broken, or nil if the
+// tree is well formed.
+//
+// Validate reads each node once but does not check versions, so operations
+// under way must have finished.
+func (t *ARTOf[K, V]) Validate() error {
+	if t.root == nil || t.root.kind != node256 || len(t.root.loadPrefix()) != 0 {
+		return fmt.Errorf("%w: root is not an empty-prefixed Node256", tree_api.ErrInvalidTree)
+	}
+	v := &validatorOf[K, V]{tree: t}
+	return v.check(t.root, []byte{})
+}
+
+type validatorOf[K cmp.Ordered, V any] struct {
+	tree    *ARTOf[K, V]
+	last    K
+	hasLast bool
+}
+
+// check validates the subtree under n, which the bytes in path lead to.
+func (v *validatorOf[K, V]) check(n *NodeOf[K, V], path []byte) error {
+	fail := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s: %s", tree_api.ErrInvalidTree, formatPath(path), fmt.Sprintf(format, args...))
+	}
+	if version := n.version.Load(); version&lockedBit != 0 {
+		return fail("is still locked")
+	} else if version&obsoleteBit != 0 {
+		return fail("is obsolete")
+	}
+
+	if n.isLeaf() {
+		if !bytes.Equal(n.path, encode(n.key)) {
+			return fail("leaf for key %v has encoded key %x", n.key, n.path)
+		}
+		if !bytes.HasPrefix(n.path, path) {
+			return fail("leaf for key %v is not under its bytes", n.key)
+		}
+		if n.record == nil {
+			return fail("leaf for key %v has no record", n.key)
+		}
+		if v.hasLast && v.last >= n.key {
+			return fail("key %v comes after key %v", n.key, v.last)
+		}
+		v.last, v.hasLast = n.key, true
+		return nil
+	}
+
+	if n.kind < node4 || n.kind > node256 {
+		return fail("has unknown kind %d", n.kind)
+	}
+	if len(n.children) != capacities[n.kind] {
+		return fail("has %d slots, expected %d", len(n.children), capacities[n.kind])
+	}
+	count := int(n.count.Load())
+	if count > capacities[n.kind] {
+		return fail("counts %d children, more than the capacity of %d", count, capacities[n.kind])
+	}
+	if n != v.tree.root {
+		minimum := 2
+		if n.kind != node4 {
+			minimum = shrinkBelow[n.kind]
+		}
+		if count < minimum {
+			return fail("holds %d children, fewer than the minimum of %d", count, minimum)
+		}
+	}
+
+	held := 0
+	for i := range n.children {
+		if n.children[i].Load() != nil {
+			held++
+		}
+	}
+	if held != count {
+		return fail("counts %d children but holds %d", count, held)
+	}
+	switch n.kind {
+	case node4, node16:
+		for i := 1; i < count; i++ {
+			if n.keyAt(i-1) >= n.keyAt(i) {
+				return fail("byte %02x at %d is not above byte %02x before it", n.keyAt(i), i, n.keyAt(i-1))
+			}
+		}
+		for i := count; i < len(n.children); i++ {
+			if n.children[i].Load() != nil {
+				return fail("slot %d beyond the count is in use", i)
+			}
+		}
+	case node48:
+		used := make(map[int]bool)
+		for b := 0; b < 256; b++ {
+			s := int(n.keyAt(b))
+			if s == 0 {
+				continue
+			}
+			if s > len(n.children) || n.children[s-1].Load() == nil {
+				return fail("byte %02x points to empty slot %d", b, s-1)
+			}
+			if used[s] {
+				return fail("byte %02x shares slot %d", b, s-1)
+			}
+			used[s] = true
+		}
+		if len(used) != count {
+			return fail("indexes %d slots but holds %d children", len(used), count)
+		}
+	}
+
+	below := append(path, n.loadPrefix()...)
+	var err error
+	n.each(func(b byte, c *NodeOf[K, V]) {
+		if err == nil {
+			err = v.check(c, append(below[:len(below):len(below)], b))
+		}
+	})
+	return err
+}
+
+// formatPath describes a node by the bytes leading to it from the root, e.g.
+// "root -> 80 -> 00 -> 1f".
+func formatPath(path []byte) string {
+	parts := []string{"root"}
+	for _, b := range path {
+		parts = append(parts, fmt.Sprintf("%02x", b))
+	}
+	return strings.Join(parts, " -> ")
+}
@@ -0,0 +1,194 @@
+package blink_tree
+
+import (
+	"cmp"
+	"main/tree_api"
+	"slices"
+)
+
+// IteratorOf walks the keys of a BLinkTree in order. It holds no latches
+// between calls: it copies the keys and records of the leaf it is on under a
+// shared latch, and to move on latches that leaf again and follows
+// right-links to the leaf covering the old leaf's high key, skipping any keys
+// that a split has moved in between. Moving back descends again to the leaf
+// below the low key. It sees every key that is present throughout the walk.
+type IteratorOf[K cmp.Ordered, V any] struct {
+	tree      *BLinkTreeOf[K, V]
+	leaf      leafOf[K, V]
+	index     int
+	started   bool
+	exhausted bool
+	closed    bool
+}
+
+// leafOf is a copy of a leaf's keys and records, with the high key it had at
+// the time.
+type leafOf[K cmp.Ordered, V any] struct {
+	node    *NodeOf[K, V]
+	keys    []K
+	records []*tree_api.RecordOf[V]
+	high    K
+	hasHigh bool
+}
+
+// snapshot copies n, which is latched, and releases it.
+func snapshot[K cmp.Ordered, V any](n *NodeOf[K, V]) leafOf[K, V] {
+	defer n.unlatch(false)
+	return leafOf[K, V]{
+		node:    n,
+		keys:    slices.Clone(n.keys),
+		records: slices.Clone(n.records),
+		high:    n.high,
+		hasHigh: n.hasHigh,
+	}
+}
+
+func (t *BLinkTreeOf[K, V]) NewIterator() tree_api.IteratorOf[K, V] {
+	return &IteratorOf[K, V]{tree: t}
+}
+
+func (it *IteratorOf[K, V]) Seek(key K) bool {
+	if it.closed {
+		return false
+	}
+	it.started = true
+	it.leaf = snapshot(it.tree.descend(key, 0, false, false, nil))
+	it.index, _ = slices.BinarySearch(it.leaf.keys, key)
+	return it.settleForward()
+}
+
+func (it *IteratorOf[K, V]) Next() bool {
+	if it.closed || it.exhausted {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		it.leaf = snapshot(it.tree.leftmostLeaf())
+		it.index = 0
+		return it.settleForward()
+	}
+	it.index += 1
+	return it.settleForward()
+}
+
+func (it *IteratorOf[K, V]) Prev() bool {
+	if it.closed || it.exhausted {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		it.leaf = snapshot(it.tree.rightmostLeaf())
+		it.index = len(it.leaf.keys) - 1
+		return it.settleBackward()
+	}
+	it.index -= 1
+	return it.settleBackward()
+}
+
+func (it *IteratorOf[K, V]) Key() K {
+	if !it.valid() {
+		var zero K
+		return zero
+	}
+	return it.leaf.keys[it.index]
+}
+
+func (it *IteratorOf[K, V]) Value() *tree_api.RecordOf[V] {
+	if !it.valid() {
+		return nil
+	}
+	return it.leaf.records[it.index]
+}
+
+func (it *IteratorOf[K, V]) Err() error {
+	if it.closed {
+		return tree_api.ErrIteratorClosed
+	}
+	return nil
+}
+
+func (it *IteratorOf[K, V]) Close() error {
+	it.closed = true
+	it.leaf = leafOf[K, V]{}
+	return nil
+}
+
+func (it *IteratorOf[K, V]) valid() bool {
+	return !it.closed && !it.exhausted && it.leaf.node != nil &&
+		it.index >= 0 && it.index < len(it.leaf.keys)
+}
+
+func (it *IteratorOf[K, V]) exhaust() bool {
+	it.exhausted = true
+	return false
+}
+
+// settleForward moves on to the following leaves while the iterator is past
+// the end of the one it is on.
+func (it *IteratorOf[K, V]) settleForward() bool {
+	for it.index >= len(it.leaf.keys) {
+		if !it.leaf.hasHigh {
+			return it.exhaust()
+		}
+		bound := it.leaf.high
+		n := it.leaf.node
+		n.latch(false)
+		it.leaf = snapshot(moveRight(n, bound, false, false))
+		it.index, _ = slices.BinarySearch(it.leaf.keys, bound)
+	}
+	it.exhausted = false
+	return true
+}
+
+// settleBackward moves back to the preceding leaves while the iterator is
+// before the start of the one it is on.
+func (it *IteratorOf[K, V]) settleBackward() bool {
+	for it.index < 0 {
+		n := it.leaf.node
+		if !n.hasLow {
+			return it.exhaust()
+		}
+		bound := n.low
+		it.leaf = snapshot(it.tree.descend(bound, 0, true, false, nil))
+		it.index, _ = slices.BinarySearch(it.leaf.keys, bound)
+		it.index -= 1
+	}
+	it.exhausted = false
+	return true
+}
+
+// leftmostLeaf returns the first leaf, latched shared. Splits only add nodes
+// to the right, so the first child of the leftmost node is always the
+// leftmost node of the level below.
+func (t *BLinkTreeOf[K, V]) leftmostLeaf() *NodeOf[K, V] {
+	n := t.root.Load()
+	for {
+		n.latch(false)
+		if n.isLeaf() {
+			return n
+		}
+		child := n.children[0]
+		n.unlatch(false)
+		n = child
+	}
+}
+
+// rightmostLeaf returns the last leaf, latched shared.
+func (t *BLinkTreeOf[K, V]) rightmostLeaf() *NodeOf[K, V] {
+	n := t.root.Load()
+	for {
+		n.latch(false)
+		for n.right != nil {
+			next := n.right
+			n.unlatch(false)
+			next.latch(false)
+			n = next
+		}
+		if n.isLeaf() {
+			return n
+		}
+		child := n.children[len(n.children)-1]
+		n.unlatch(false)
+		n = child
+	}
+}
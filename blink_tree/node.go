@@ -0,0 +1,120 @@
+package blink_tree
+
+import (
+	"cmp"
+	"main/tree_api"
+	"slices"
+	"sync"
+)
+
+// NodeOf is a node of a BLinkTree. Besides its keys it records the range
+// of keys it covers, [low, high), and a right-link to the next node on the
+// same level; an unset bound is open. A split only ever hands the upper part
+// of a node's range to a new right sibling, so level and low never change and
+// may be read without the latch, while high and right are read under it.
+type NodeOf[K cmp.Ordered, V any] struct {
+	lock     sync.RWMutex
+	level    int // 0 for leaves
+	low      K
+	hasLow   bool
+	high     K
+	hasHigh  bool
+	right    *NodeOf[K, V]
+	keys     []K
+	children []*NodeOf[K, V]
+	records  []*tree_api.RecordOf[V]
+}
+
+type Node = NodeOf[int, []byte]
+
+func (n *NodeOf[K, V]) isLeaf() bool {
+	return n.level == 0
+}
+
+func (n *NodeOf[K, V]) latch(exclusive bool) {
+	if exclusive {
+		n.lock.Lock()
+	} else {
+		n.lock.RLock()
+	}
+}
+
+func (n *NodeOf[K, V]) unlatch(exclusive bool) {
+	if exclusive {
+		n.lock.Unlock()
+	} else {
+		n.lock.RUnlock()
+	}
+}
+
+// covers reports whether key belongs to n rather than to a node further
+// right, or with below set whether the keys of n could include the largest
+// key less than key.
+func (n *NodeOf[K, V]) covers(key K, below bool) bool {
+	if !n.hasHigh {
+		return true
+	}
+	if below {
+		return key <= n.high
+	}
+	return key < n.high
+}
+
+// pick returns the child of an internal node to descend into for key, or
+// with below set for the largest key less than key. Keys equal to a separator
+// belong to its right.
+func (n *NodeOf[K, V]) pick(key K, below bool) int {
+	i, found := slices.BinarySearch(n.keys, key)
+	if found && !below {
+		i++
+	}
+	return i
+}
+
+// moveRight follows right-links from n, which is latched, to the node that
+// covers key, taking each node's latch only after releasing the previous one,
+// and returns it latched in the same mode. Nodes are never removed, so the
+// right-link read under one latch is still a node of the level once the next
+// latch is taken, though it may have split in between.
+func moveRight[K cmp.Ordered, V any](n *NodeOf[K, V], key K, below, exclusive bool) *NodeOf[K, V] {
+	for !n.covers(key, below) {
+		next := n.right
+		n.unlatch(exclusive)
+		next.latch(exclusive)
+		n = next
+	}
+	return n
+}
+
+// split moves the upper half of n, which is latched exclusively and holds
+// more keys than it may, into a new right sibling and returns the sibling
+// and the separator between them. A leaf's separator is the first key of the
+// sibling; an internal node's moves up and is in neither half. The sibling is
+// reachable through n's right-link once n's latch is released.
+func (n *NodeOf[K, V]) split() (*NodeOf[K, V], K) {
+	mid := len(n.keys) / 2
+	separator := n.keys[mid]
+	sibling := &NodeOf[K, V]{
+		level:   n.level,
+		low:     separator,
+		hasLow:  true,
+		high:    n.high,
+		hasHigh: n.hasHigh,
+		right:   n.right,
+	}
+	if n.isLeaf() {
+		sibling.keys = slices.Clone(n.keys[mid:])
+		sibling.records = slices.Clone(n.records[mid:])
+		clear(n.records[mid:])
+		n.records = n.records[:mid]
+	} else {
+		sibling.keys = slices.Clone(n.keys[mid+1:])
+		sibling.children = slices.Clone(n.children[mid+1:])
+		clear(n.children[mid+1:])
+		n.children = n.children[:mid+1]
+	}
+	n.keys = n.keys[:mid]
+	n.high, n.hasHigh = separator, true
+	n.right = sibling
+	return sibling, separator
+}
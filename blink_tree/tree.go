@@ -0,0 +1,305 @@
+package blink_tree
+
+import (
+	"cmp"
+	"fmt"
+	"main/tree_api"
+	"slices"
+	"sync/atomic"
+)
+
+const (
+	defaultOrder = 4
+	minOrder     = 3
+	maxOrder     = 512
+)
+
+// BLinkTreeOf is a B+ tree in the style of Lehman and Yao. Every node knows
+// the upper bound of its keys, its high key, and links to its right
+// neighbour, so a node that splits stays whole as far as anyone looking for a
+// key is concerned: the keys that moved are one right-link away until the
+// parent learns of the new node. Operations therefore hold at most one latch
+// at a time. Searches take shared latches on the way down; writers latch only
+// the leaf, and a split releases the node before latching its parent to post
+// the separator there.
+//
+// Deletes remove keys from leaves without merging or rebalancing, as in
+// Lehman and Yao's scheme, so leaves may be left underfull or empty. Nodes are
+// never removed, which is what makes it safe to step to a right neighbour
+// after letting go of the node that pointed to it.
+type BLinkTreeOf[K cmp.Ordered, V any] struct {
+	root  atomic.Pointer[NodeOf[K, V]]
+	order int
+}
+
+type BLinkTree = BLinkTreeOf[int, []byte]
+
+func NewTree(opts ...tree_api.Option) tree_api.BPTree {
+	return NewTreeOf[int, []byte](opts...)
+}
+
+func NewTreeOf[K cmp.Ordered, V any](opts ...tree_api.Option) tree_api.TreeOf[K, V] {
+	o, err := tree_api.BuildOptions(defaultOrder, minOrder, maxOrder, opts)
+	if err != nil {
+		panic(err)
+	}
+	t := &BLinkTreeOf[K, V]{order: o.Order}
+	t.root.Store(&NodeOf[K, V]{})
+	return t
+}
+
+func (t *BLinkTreeOf[K, V]) Order() int {
+	return t.order
+}
+
+// descend goes down from the root to the node at level that covers key, or
+// with below set the largest key less than key, moving right past nodes that
+// split after their parent was read. It returns the node latched, exclusively
+// if exclusive is set; the nodes above it are latched shared one at a time.
+// If path is not nil the internal nodes passed on the way are appended to it,
+// from the top down.
+//
+// A root that has been replaced is still the leftmost node of its level, so
+// a descent that starts from a stale root finds its way by moving right.
+func (t *BLinkTreeOf[K, V]) descend(key K, level int, below, exclusive bool, path *[]*NodeOf[K, V]) *NodeOf[K, V] {
+	n := t.root.Load()
+	for {
+		mode := exclusive && n.level == level
+		n.latch(mode)
+		n = moveRight(n, key, below, mode)
+		if n.level == level {
+			return n
+		}
+		child := n.children[n.pick(key, below)]
+		if path != nil {
+			*path = append(*path, n)
+		}
+		n.unlatch(false)
+		n = child
+	}
+}
+
+func (t *BLinkTreeOf[K, V]) Find(key K, verbose bool) (*tree_api.RecordOf[V], error) {
+	leaf := t.descend(key, 0, false, false, nil)
+	defer leaf.unlatch(false)
+	if i, found := slices.BinarySearch(leaf.keys, key); found {
+		return leaf.records[i], nil
+	}
+	return nil, tree_api.ErrKeyNotFound
+}
+
+func (t *BLinkTreeOf[K, V]) FindAndPrint(key K, verbose bool) {
+	r, err := t.Find(key, verbose)
+
+	if err != nil || r == nil {
+		fmt.Printf("Record not found under key %v.\n", key)
+	} else {
+		fmt.Printf("Record at %p -- key %v, value %s.\n", r, key, tree_api.FormatValue(r.Value))
+	}
+}
+
+func (t *BLinkTreeOf[K, V]) FindAndPrintRange(key_start, key_end K, verbose bool) {
+	results, _ := t.Range(key_start, key_end)
+	if len(results) == 0 {
+		fmt.Println("None found,")
+	} else {
+		for _, kr := range results {
+			fmt.Printf("Key: %v  Location: %p  Value: %s\n",
+				kr.Key,
+				kr.Record,
+				tree_api.FormatValue(kr.Record.Value))
+		}
+	}
+}
+
+func (t *BLinkTreeOf[K, V]) Insert(key K, value V) error {
+	return t.insert(key, &tree_api.RecordOf[V]{Value: value}, false)
+}
+
+// Upsert inserts key, or replaces its record if it is already present.
+func (t *BLinkTreeOf[K, V]) Upsert(key K, value V) error {
+	return t.insert(key, &tree_api.RecordOf[V]{Value: value}, true)
+}
+
+func (t *BLinkTreeOf[K, V]) insert(key K, record *tree_api.RecordOf[V], replace bool) error {
+	path := []*NodeOf[K, V]{}
+	leaf := t.descend(key, 0, false, true, &path)
+	i, found := slices.BinarySearch(leaf.keys, key)
+	if found {
+		defer leaf.unlatch(true)
+		if !replace {
+			return tree_api.ErrKeyExists
+		}
+		leaf.records[i] = record
+		return nil
+	}
+	leaf.keys = slices.Insert(leaf.keys, i, key)
+	leaf.records = slices.Insert(leaf.records, i, record)
+	t.splitUp(leaf, path)
+	return nil
+}
+
+// splitUp releases n, which is latched exclusively, after splitting it if it
+// has overflowed. The separator of a split is posted to the parent, which may
+// overflow and split in turn. Each node is released before its parent is
+// latched, and the parent is taken from path, the nodes the descent passed
+// through, or found by descending again if the tree has grown above the old
+// root since. Only the holder of the root's latch can replace it, so n is
+// still the root if it was the root when it was latched.
+func (t *BLinkTreeOf[K, V]) splitUp(n *NodeOf[K, V], path []*NodeOf[K, V]) {
+	for len(n.keys) > t.order-1 {
+		sibling, separator := n.split()
+		if t.root.Load() == n {
+			t.root.Store(&NodeOf[K, V]{
+				level:    n.level + 1,
+				keys:     []K{separator},
+				children: []*NodeOf[K, V]{n, sibling},
+			})
+			break
+		}
+		n.unlatch(true)
+
+		var parent *NodeOf[K, V]
+		if len(path) > 0 {
+			parent = path[len(path)-1]
+			path = path[:len(path)-1]
+			parent.latch(true)
+			parent = moveRight(parent, separator, false, true)
+		} else {
+			parent = t.descend(separator, n.level+1, false, true, nil)
+		}
+		i := parent.pick(separator, false)
+		parent.keys = slices.Insert(parent.keys, i, separator)
+		parent.children = slices.Insert(parent.children, i+1, sibling)
+		n = parent
+	}
+	n.unlatch(true)
+}
+
+// Update replaces the record of an existing key.
+func (t *BLinkTreeOf[K, V]) Update(key K, value V) error {
+	_, err := t.swap(key, nil, value, false)
+	return err
+}
+
+// CompareAndSwap replaces the record of key if it is still old.
+func (t *BLinkTreeOf[K, V]) CompareAndSwap(key K, old *tree_api.RecordOf[V], new V) (bool, error) {
+	return t.swap(key, old, new, true)
+}
+
+// swap gives an existing key a new record under its leaf's latch. With
+// compare set it only does so if the current record is old.
+func (t *BLinkTreeOf[K, V]) swap(key K, old *tree_api.RecordOf[V], value V, compare bool) (bool, error) {
+	leaf := t.descend(key, 0, false, true, nil)
+	defer leaf.unlatch(true)
+	i, found := slices.BinarySearch(leaf.keys, key)
+	if !found {
+		return false, tree_api.ErrKeyNotFound
+	}
+	if compare && leaf.records[i] != old {
+		return false, nil
+	}
+	leaf.records[i] = &tree_api.RecordOf[V]{Value: value}
+	return true, nil
+}
+
+func (t *BLinkTreeOf[K, V]) Delete(key K) error {
+	leaf := t.descend(key, 0, false, true, nil)
+	defer leaf.unlatch(true)
+	i, found := slices.BinarySearch(leaf.keys, key)
+	if !found {
+		return tree_api.ErrKeyNotFound
+	}
+	leaf.keys = slices.Delete(leaf.keys, i, i+1)
+	leaf.records = slices.Delete(leaf.records, i, i+1)
+	return nil
+}
+
+func (t *BLinkTreeOf[K, V]) Range(key_start, key_end K) ([]tree_api.KeyRecordOf[K, V], error) {
+	return t.RangeLimit(key_start, key_end, 0, false)
+}
+
+// RangeLimit reads one leaf at a time under a shared latch. Forward scans
+// walk the leaves' right-links, releasing each leaf before latching the next.
+// Leaves have no left-links, so reverse scans descend again to the leaf below
+// the low key of the last one. The result is sorted and holds every key that
+// was present throughout the call, but is not a snapshot of the whole range.
+func (t *BLinkTreeOf[K, V]) RangeLimit(key_start, key_end K, limit int, reverse bool) ([]tree_api.KeyRecordOf[K, V], error) {
+	if key_start > key_end {
+		return nil, tree_api.ErrInvalidRange
+	}
+	results := []tree_api.KeyRecordOf[K, V]{}
+	full := func() bool { return limit > 0 && len(results) == limit }
+
+	if !reverse {
+		leaf := t.descend(key_start, 0, false, false, nil)
+		for {
+			i, _ := slices.BinarySearch(leaf.keys, key_start)
+			for ; i < len(leaf.keys); i++ {
+				if leaf.keys[i] > key_end || full() {
+					leaf.unlatch(false)
+					return results, nil
+				}
+				results = append(results, tree_api.KeyRecordOf[K, V]{Key: leaf.keys[i], Record: leaf.records[i]})
+			}
+			if !leaf.hasHigh || leaf.high > key_end {
+				leaf.unlatch(false)
+				return results, nil
+			}
+			next := leaf.right
+			leaf.unlatch(false)
+			next.latch(false)
+			leaf = next
+		}
+	}
+
+	leaf := t.descend(key_end, 0, false, false, nil)
+	i, found := slices.BinarySearch(leaf.keys, key_end)
+	if found {
+		i++
+	}
+	for {
+		for i--; i >= 0; i-- {
+			if leaf.keys[i] < key_start || full() {
+				leaf.unlatch(false)
+				return results, nil
+			}
+			results = append(results, tree_api.KeyRecordOf[K, V]{Key: leaf.keys[i], Record: leaf.records[i]})
+		}
+		leaf.unlatch(false)
+		if !leaf.hasLow || leaf.low <= key_start {
+			return results, nil
+		}
+		bound := leaf.low
+		leaf = t.descend(bound, 0, true, false, nil)
+		i, _ = slices.BinarySearch(leaf.keys, bound)
+	}
+}
+
+// PrintTree prints one level per line, walking each level along its
+// right-links from its leftmost node.
+func (t *BLinkTreeOf[K, V]) PrintTree() {
+	first := t.root.Load()
+	for first != nil {
+		var below *NodeOf[K, V]
+		for n := first; n != nil; n = n.right {
+			for _, k := range n.keys {
+				fmt.Printf("%v ", k)
+			}
+			fmt.Printf(" | ")
+			if below == nil && !n.isLeaf() {
+				below = n.children[0]
+			}
+		}
+		fmt.Printf("\n")
+		first = below
+	}
+}
+
+func (t *BLinkTreeOf[K, V]) PalmBasic(key_count int, num_threads int) {
+	panic("not implemented for BLinkTree")
+}
+
+func (t *BLinkTreeOf[K, V]) Palm(queries []tree_api.QueryOf[K, V], num_threads int) []tree_api.ResultOf[V] {
+	panic("not implemented for BLinkTree")
+}
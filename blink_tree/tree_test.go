@@ -0,0 +1,153 @@
+package blink_tree
+
+import (
+	"errors"
+	"fmt"
+	"main/tree_api"
+	"main/tree_testing"
+	"math"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// TestFindFollowsRightLinks splits a leaf without posting the separator to
+// its parent, which is the state a concurrent search sees between the two
+// steps of a split, and checks that every key is still found and scanned.
+func TestFindFollowsRightLinks(t *testing.T) {
+	tree := NewTreeOf[int, []byte](tree_api.WithOrder(8)).(*BLinkTree)
+	want := make(map[int]string)
+	for i := 0; i < 40; i++ {
+		tree.Insert(i, []byte(fmt.Sprint(i)))
+		want[i] = fmt.Sprint(i)
+	}
+	leaf := tree.descend(0, 0, false, true, nil)
+	if len(leaf.keys) < 2 {
+		t.Fatalf("expected the first leaf to hold at least two keys, it holds %d", len(leaf.keys))
+	}
+	sibling, separator := leaf.split()
+	leaf.unlatch(true)
+
+	if err := tree.Validate(); !errors.Is(err, tree_api.ErrInvalidTree) {
+		t.Errorf("expected the unposted split to be reported and got %v", err)
+	}
+	for key, value := range want {
+		r, err := tree.Find(key, false)
+		if err != nil {
+			t.Errorf("key %d: %s", key, err)
+		} else if string(r.Value) != value {
+			t.Errorf("key %d: expected %s and got %s", key, value, r.Value)
+		}
+	}
+	if res, _ := tree.RangeLimit(math.MinInt, math.MaxInt, 0, false); len(res) != len(want) {
+		t.Errorf("expected a forward scan to see %d keys and got %d", len(want), len(res))
+	}
+	if res, _ := tree.RangeLimit(math.MinInt, math.MaxInt, 0, true); len(res) != len(want) {
+		t.Errorf("expected a reverse scan to see %d keys and got %d", len(want), len(res))
+	}
+
+	// Finish the split the way splitUp would, and the tree is whole again.
+	parent := tree.descend(separator, 1, false, true, nil)
+	i := parent.pick(separator, false)
+	parent.keys = slices.Insert(parent.keys, i, separator)
+	parent.children = slices.Insert(parent.children, i+1, sibling)
+	tree.splitUp(parent, nil)
+	tree_testing.CheckContents(t, tree, want)
+}
+
+func TestConcurrentPointOps(t *testing.T) {
+	for _, order := range []int{3, 4, 16} {
+		t.Run(fmt.Sprintf("order=%d", order), func(t *testing.T) {
+			tree_testing.ConcurrentPointOps(t, NewTreeOf[int, []byte](tree_api.WithOrder(order)))
+		})
+	}
+}
+
+// TestReadCrossesConcurrentSplit has a search read the child pointer from a
+// parent and let go of the parent, as every descent does, and then has
+// writers split that child before the search latches it. The key the search
+// is after has moved to the new sibling, which it reaches by the right-link.
+func TestReadCrossesConcurrentSplit(t *testing.T) {
+	tree := NewTreeOf[int, []byte](tree_api.WithOrder(4)).(*BLinkTree)
+	want := make(map[int]string)
+	for key := 0; key < 2000; key += 100 {
+		tree.Insert(key, []byte(fmt.Sprint(key)))
+		want[key] = fmt.Sprint(key)
+	}
+	parent := tree.descend(1000, 1, false, false, nil)
+	leaf := parent.children[parent.pick(1000, false)]
+	parent.unlatch(false)
+	leaf.latch(false)
+	if len(leaf.keys) < 2 {
+		t.Fatalf("expected the leaf to hold at least two keys, it holds %v", leaf.keys)
+	}
+	first, key := leaf.keys[0], leaf.keys[len(leaf.keys)-1]
+	leaf.unlatch(false)
+
+	// A split moves the upper half of the leaf, and so its last key, into a
+	// new sibling.
+	for k := first + 1; k < first+tree.order; k++ {
+		tree.Insert(k, []byte(fmt.Sprint(k)))
+		want[k] = fmt.Sprint(k)
+	}
+	leaf.latch(false)
+	n := moveRight(leaf, key, false, false)
+	if n == leaf {
+		t.Errorf("expected %d to have moved right of the leaf the search picked", key)
+	}
+	if _, found := slices.BinarySearch(n.keys, key); !found {
+		t.Errorf("moving right for %d reached a leaf holding %v", key, n.keys)
+	}
+	n.unlatch(false)
+	tree_testing.CheckContents(t, tree, want)
+}
+
+// Keys that are present throughout are always found and scanned while other
+// inserts keep splitting the leaves that hold them, so searches are forever
+// crossing splits that their parent has not heard of yet.
+func TestReadsDuringSplits(t *testing.T) {
+	tree := NewTreeOf[int, []byte](tree_api.WithOrder(4)).(*BLinkTree)
+	for key := 0; key < 4000; key += 10 {
+		tree.Insert(key, []byte(fmt.Sprint(key)))
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for key := w + 1; key < 4000; key += 10 {
+				tree.Insert(key, []byte(fmt.Sprint(key)))
+			}
+		}(w)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		for key := 0; key < 4000; key += 10 {
+			if r, err := tree.Find(key, false); err != nil || string(r.Value) != fmt.Sprint(key) {
+				t.Fatalf("find %d during splits: %v %v", key, r, err)
+			}
+		}
+		res, _ := tree.RangeLimit(0, 4000, 0, false)
+		seen := 0
+		for _, kr := range res {
+			if kr.Key%10 == 0 {
+				seen++
+			}
+		}
+		if seen != 400 {
+			t.Fatalf("scan during splits saw %d of the 400 keys present throughout", seen)
+		}
+	}
+	if err := tree.Validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,135 @@
+package blink_tree
+
+import (
+	"cmp"
+	"fmt"
+	"main/tree_api"
+	"slices"
+)
+
+// Validate checks that the tree is well formed: keys are sorted within every
+// node and fall between the separators above them, each node's low and high
+// keys match those separators, the right-links of every level join its nodes
+// in key order, every internal node has one more child than keys and every
+// leaf one record per key, no node is overfull or left latched, and all
+// leaves are at level 0. Deletes never merge nodes, so only internal nodes,
+// which never lose keys, are checked for a minimum. It returns an error
+// wrapping tree_api.ErrInvalidTree that names the path from the root to the
+// first node found to be broken, or nil if the tree is well formed.
+//
+// Validate does not take latches, and every split must have been posted to
+// its parent, so operations under way must have finished.
+func (t *BLinkTreeOf[K, V]) Validate() error {
+	if t.order < minOrder || t.order > maxOrder {
+		return fmt.Errorf("%w: order %d is outside [%d, %d]", tree_api.ErrInvalidTree, t.order, minOrder, maxOrder)
+	}
+	root := t.root.Load()
+	if root == nil {
+		return fmt.Errorf("%w: root is missing", tree_api.ErrInvalidTree)
+	}
+	v := &validatorOf[K, V]{tree: t, root: root, levels: make([][]visitOf[K, V], root.level+1)}
+	if err := v.check(root, []int{}, nil, nil, root.level); err != nil {
+		return err
+	}
+	for level, nodes := range v.levels {
+		for i, visit := range nodes {
+			var next *NodeOf[K, V]
+			if i+1 < len(nodes) {
+				next = nodes[i+1].node
+			}
+			if visit.node.right != next {
+				return fmt.Errorf("%w: %s: right-link does not lead to the next node of level %d", tree_api.ErrInvalidTree, tree_api.FormatPath(visit.path), level)
+			}
+		}
+	}
+	return nil
+}
+
+type validatorOf[K cmp.Ordered, V any] struct {
+	tree   *BLinkTreeOf[K, V]
+	root   *NodeOf[K, V]
+	levels [][]visitOf[K, V] // the nodes of each level in key order
+}
+
+type visitOf[K cmp.Ordered, V any] struct {
+	node *NodeOf[K, V]
+	path []int
+}
+
+// check validates the subtree under n, which should be at level and whose
+// keys must lie in [low, high); a nil bound is open.
+func (v *validatorOf[K, V]) check(n *NodeOf[K, V], path []int, low, high *K, level int) error {
+	t := v.tree
+	fail := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s: %s", tree_api.ErrInvalidTree, tree_api.FormatPath(path), fmt.Sprintf(format, args...))
+	}
+	if n.level != level {
+		return fail("is at level %d, expected %d", n.level, level)
+	}
+	if !n.lock.TryLock() {
+		return fail("is still latched")
+	}
+	n.lock.Unlock()
+	if n.hasLow != (low != nil) || (low != nil && n.low != *low) {
+		return fail("low key does not match the separator above it")
+	}
+	if n.hasHigh != (high != nil) || (high != nil && n.high != *high) {
+		return fail("high key does not match the separator above it")
+	}
+	v.levels[level] = append(v.levels[level], visitOf[K, V]{node: n, path: slices.Clone(path)})
+
+	if len(n.keys) > t.order-1 {
+		return fail("holds %d keys, more than the maximum of %d", len(n.keys), t.order-1)
+	}
+	if !n.isLeaf() {
+		if n == v.root && len(n.keys) == 0 {
+			return fail("root is an internal node without keys")
+		}
+		if n != v.root && len(n.keys) < (t.order-1)/2 {
+			return fail("holds %d keys, fewer than the minimum of %d", len(n.keys), (t.order-1)/2)
+		}
+	}
+	for i, key := range n.keys {
+		if i > 0 && n.keys[i-1] >= key {
+			return fail("key %v at %d is not above key %v before it", key, i, n.keys[i-1])
+		}
+		if low != nil && key < *low {
+			return fail("key %v at %d is below the separator %v", key, i, *low)
+		}
+		if high != nil && key >= *high {
+			return fail("key %v at %d is not below the separator %v", key, i, *high)
+		}
+	}
+
+	if n.isLeaf() {
+		if len(n.records) != len(n.keys) || len(n.children) != 0 {
+			return fail("leaf has %d keys, %d records and %d children", len(n.keys), len(n.records), len(n.children))
+		}
+		for i, r := range n.records {
+			if r == nil {
+				return fail("record %d is missing", i)
+			}
+		}
+		return nil
+	}
+
+	if len(n.children) != len(n.keys)+1 || len(n.records) != 0 {
+		return fail("internal node has %d keys, %d children and %d records", len(n.keys), len(n.children), len(n.records))
+	}
+	for i, child := range n.children {
+		if child == nil {
+			return fail("child %d is missing", i)
+		}
+		childLow, childHigh := low, high
+		if i > 0 {
+			childLow = &n.keys[i-1]
+		}
+		if i < len(n.keys) {
+			childHigh = &n.keys[i]
+		}
+		if err := v.check(child, append(path, i), childLow, childHigh, level-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package bw_tree
+
+import (
+	"cmp"
+	"main/tree_api"
+	"slices"
+)
+
+// IteratorOf walks the keys of a BwTree in order. It keeps a consolidated
+// copy of the leaf it is on, made when it arrived there, moves on along the
+// copy's right-link and moves back by descending again to the leaf below the
+// copy's low key. It sees every key that is present throughout the walk.
+type IteratorOf[K cmp.Ordered, V any] struct {
+	tree      *BwTreeOf[K, V]
+	leaf      *pageOf[K, V] // a consolidated copy
+	index     int
+	started   bool
+	exhausted bool
+	closed    bool
+}
+
+func (t *BwTreeOf[K, V]) NewIterator() tree_api.IteratorOf[K, V] {
+	return &IteratorOf[K, V]{tree: t}
+}
+
+func (it *IteratorOf[K, V]) Seek(key K) bool {
+	if it.closed {
+		return false
+	}
+	it.started = true
+	_, p := it.tree.descend(key, 0, false, nil)
+	it.leaf = p.consolidate()
+	it.index, _ = slices.BinarySearch(it.leaf.keys, key)
+	return it.settleForward()
+}
+
+func (it *IteratorOf[K, V]) Next() bool {
+	if it.closed || it.exhausted {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		it.leaf = it.tree.edgeLeaf(false)
+		it.index = 0
+		return it.settleForward()
+	}
+	it.index += 1
+	return it.settleForward()
+}
+
+func (it *IteratorOf[K, V]) Prev() bool {
+	if it.closed || it.exhausted {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		it.leaf = it.tree.edgeLeaf(true)
+		it.index = len(it.leaf.keys) - 1
+		return it.settleBackward()
+	}
+	it.index -= 1
+	return it.settleBackward()
+}
+
+func (it *IteratorOf[K, V]) Key() K {
+	if !it.valid() {
+		var zero K
+		return zero
+	}
+	return it.leaf.keys[it.index]
+}
+
+func (it *IteratorOf[K, V]) Value() *tree_api.RecordOf[V] {
+	if !it.valid() {
+		return nil
+	}
+	return it.leaf.records[it.index]
+}
+
+func (it *IteratorOf[K, V]) Err() error {
+	if it.closed {
+		return tree_api.ErrIteratorClosed
+	}
+	return nil
+}
+
+func (it *IteratorOf[K, V]) Close() error {
+	it.closed = true
+	it.leaf = nil
+	return nil
+}
+
+func (it *IteratorOf[K, V]) valid() bool {
+	return !it.closed && !it.exhausted && it.leaf != nil &&
+		it.index >= 0 && it.index < len(it.leaf.keys)
+}
+
+func (it *IteratorOf[K, V]) exhaust() bool {
+	it.exhausted = true
+	return false
+}
+
+// settleForward moves on to the following leaves while the iterator is past
+// the end of the one it is on.
+func (it *IteratorOf[K, V]) settleForward() bool {
+	for it.index >= len(it.leaf.keys) {
+		if !it.leaf.hasHigh {
+			return it.exhaust()
+		}
+		bound := it.leaf.high
+		_, p := it.tree.moveRight(it.leaf.right, bound, false)
+		it.leaf = p.consolidate()
+		it.index, _ = slices.BinarySearch(it.leaf.keys, bound)
+	}
+	it.exhausted = false
+	return true
+}
+
+// settleBackward moves back to the preceding leaves while the iterator is
+// before the start of the one it is on.
+func (it *IteratorOf[K, V]) settleBackward() bool {
+	for it.index < 0 {
+		if !it.leaf.hasLow {
+			return it.exhaust()
+		}
+		bound := it.leaf.low
+		_, p := it.tree.descend(bound, 0, true, nil)
+		it.leaf = p.consolidate()
+		it.index, _ = slices.BinarySearch(it.leaf.keys, bound)
+		it.index -= 1
+	}
+	it.exhausted = false
+	return true
+}
+
+// edgeLeaf returns a consolidated copy of the first leaf, or with last set
+// of the last one. Splits only add nodes to the right, so the first child of
+// a level's leftmost node is the leftmost node of the level below.
+func (t *BwTreeOf[K, V]) edgeLeaf(last bool) *pageOf[K, V] {
+	id := pageID(t.root.Load())
+	for {
+		c := t.mapping.load(id).consolidate()
+		for last && c.hasHigh {
+			c = t.mapping.load(c.right).consolidate()
+		}
+		if c.isLeaf() {
+			return c
+		}
+		id = c.children[0]
+		if last {
+			id = c.children[len(c.children)-1]
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package bw_tree
+
+import (
+	"cmp"
+	"sync/atomic"
+)
+
+// pageID names a logical node. Nodes refer to each other only by ID, and the
+// mapping table turns an ID into the node's current chain of pages, so a
+// node changes by swapping one table entry.
+type pageID uint64
+
+const (
+	chunkBits = 14
+	chunkSize = 1 << chunkBits
+	maxChunks = 1 << 14
+)
+
+// mappingOf is the mapping table. It is split into chunks that are allocated
+// as IDs reach them, so that a small tree does not pay for a large table.
+// IDs are handed out in order and never reused; an ID whose node was never
+// published is left empty.
+type mappingOf[K cmp.Ordered, V any] struct {
+	chunks [maxChunks]atomic.Pointer[[chunkSize]atomic.Pointer[pageOf[K, V]]]
+	next   atomic.Uint64
+}
+
+func (m *mappingOf[K, V]) slot(id pageID) *atomic.Pointer[pageOf[K, V]] {
+	c := m.chunks[id>>chunkBits].Load()
+	if c == nil {
+		m.chunks[id>>chunkBits].CompareAndSwap(nil, new([chunkSize]atomic.Pointer[pageOf[K, V]]))
+		c = m.chunks[id>>chunkBits].Load()
+	}
+	return &c[id&(chunkSize-1)]
+}
+
+// allocate gives p a new ID.
+func (m *mappingOf[K, V]) allocate(p *pageOf[K, V]) pageID {
+	id := pageID(m.next.Add(1) - 1)
+	if id>>chunkBits >= maxChunks {
+		panic("bw_tree: mapping table is full")
+	}
+	m.slot(id).Store(p)
+	return id
+}
+
+// release empties the entry of an ID whose node was never published.
+func (m *mappingOf[K, V]) release(id pageID) {
+	m.slot(id).Store(nil)
+}
+
+func (m *mappingOf[K, V]) load(id pageID) *pageOf[K, V] {
+	return m.slot(id).Load()
+}
+
+// cas installs p as the chain of id if the chain still starts at old.
+func (m *mappingOf[K, V]) cas(id pageID, old, p *pageOf[K, V]) bool {
+	return m.slot(id).CompareAndSwap(old, p)
+}
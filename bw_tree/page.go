@@ -0,0 +1,185 @@
+package bw_tree
+
+import (
+	"cmp"
+	"main/tree_api"
+	"slices"
+)
+
+type pageKind int
+
+const (
+	baseLeaf pageKind = iota
+	baseInner
+	insertDelta // key has record, added or replaced
+	deleteDelta // key is gone
+	splitDelta  // keys from key up moved to the node child
+	indexDelta  // keys from key up, to the next separator, are under child
+)
+
+// pageOf is one page of a node's chain: a delta describing a change to the
+// pages below it, or the base page at the bottom. Pages are immutable once
+// installed. Every page also carries the state of the whole node as of that
+// page: the range [low, high) its keys lie in, with open bounds unset, the
+// node to its right on the same level, how many entries it has and how many
+// pages deep the chain is, so that none of these need a walk to the base.
+type pageOf[K cmp.Ordered, V any] struct {
+	kind  pageKind
+	next  *pageOf[K, V] // the page below, nil for a base page
+	level int           // 0 for leaves
+	depth int           // pages below this one
+
+	low     K
+	hasLow  bool
+	high    K
+	hasHigh bool
+	right   pageID
+	size    int // keys in a leaf, separators in an inner node
+
+	// Base pages.
+	keys     []K
+	records  []*tree_api.RecordOf[V]
+	children []pageID
+
+	// Deltas.
+	key    K
+	record *tree_api.RecordOf[V]
+	child  pageID
+}
+
+func (p *pageOf[K, V]) isLeaf() bool {
+	return p.level == 0
+}
+
+// delta starts a page of the given kind on top of p, with p's node state.
+func (p *pageOf[K, V]) delta(kind pageKind, key K) *pageOf[K, V] {
+	return &pageOf[K, V]{
+		kind:    kind,
+		next:    p,
+		level:   p.level,
+		depth:   p.depth + 1,
+		low:     p.low,
+		hasLow:  p.hasLow,
+		high:    p.high,
+		hasHigh: p.hasHigh,
+		right:   p.right,
+		size:    p.size,
+		key:     key,
+	}
+}
+
+// covers reports whether key belongs to the node rather than to one further
+// right, or with below set whether the node could hold the largest key less
+// than key.
+func (p *pageOf[K, V]) covers(key K, below bool) bool {
+	if !p.hasHigh {
+		return true
+	}
+	if below {
+		return key <= p.high
+	}
+	return key < p.high
+}
+
+// lookup finds key in a leaf chain. The newest page that mentions key
+// decides.
+func (p *pageOf[K, V]) lookup(key K) (*tree_api.RecordOf[V], bool) {
+	for q := p; ; q = q.next {
+		switch q.kind {
+		case insertDelta:
+			if q.key == key {
+				return q.record, true
+			}
+		case deleteDelta:
+			if q.key == key {
+				return nil, false
+			}
+		case baseLeaf:
+			if i, found := slices.BinarySearch(q.keys, key); found {
+				return q.records[i], true
+			}
+			return nil, false
+		}
+	}
+}
+
+// childFor returns the child of an inner chain to descend into for key, or
+// with below set for the largest key less than key. That is the child after
+// the greatest separator at most key, or less than key, whether it is in an
+// index delta or the base page. The node covers key, so separators that a
+// split has moved out of the node are all above it.
+func (p *pageOf[K, V]) childFor(key K, below bool) pageID {
+	var best pageID
+	var bestKey K
+	found := false
+	for q := p; ; q = q.next {
+		switch q.kind {
+		case indexDelta:
+			if (q.key < key || (!below && q.key == key)) && (!found || q.key > bestKey) {
+				best, bestKey, found = q.child, q.key, true
+			}
+		case baseInner:
+			i, exact := slices.BinarySearch(q.keys, key)
+			if exact && !below {
+				i++
+			}
+			if found && (i == 0 || q.keys[i-1] < bestKey) {
+				return best
+			}
+			return q.children[i]
+		}
+	}
+}
+
+// consolidate returns a base page holding the node that the chain starting
+// at p describes, with p's node state. Entries at or above p's high key
+// belong to nodes split off to the right and are dropped.
+func (p *pageOf[K, V]) consolidate() *pageOf[K, V] {
+	deltas := []*pageOf[K, V]{}
+	base := p
+	for ; base.kind != baseLeaf && base.kind != baseInner; base = base.next {
+		deltas = append(deltas, base)
+	}
+	keys := slices.Clone(base.keys)
+	records := slices.Clone(base.records)
+	children := slices.Clone(base.children)
+	for i := len(deltas) - 1; i >= 0; i-- {
+		d := deltas[i]
+		j, found := slices.BinarySearch(keys, d.key)
+		switch {
+		case d.kind == insertDelta && found:
+			records[j] = d.record
+		case d.kind == insertDelta:
+			keys = slices.Insert(keys, j, d.key)
+			records = slices.Insert(records, j, d.record)
+		case d.kind == deleteDelta && found:
+			keys = slices.Delete(keys, j, j+1)
+			records = slices.Delete(records, j, j+1)
+		case d.kind == indexDelta:
+			keys = slices.Insert(keys, j, d.key)
+			children = slices.Insert(children, j+1, d.child)
+		}
+	}
+	if p.hasHigh {
+		n, _ := slices.BinarySearch(keys, p.high)
+		keys = keys[:n]
+		if base.kind == baseLeaf {
+			records = records[:n]
+		} else {
+			children = children[:n+1]
+		}
+	}
+	return &pageOf[K, V]{
+		kind:     base.kind,
+		level:    p.level,
+		low:      p.low,
+		hasLow:   p.hasLow,
+		high:     p.high,
+		hasHigh:  p.hasHigh,
+		right:    p.right,
+		size:     len(keys),
+		keys:     keys,
+		records:  records,
+		children: children,
+	}
+}
@@ -0,0 +1,436 @@
+package bw_tree
+
+import (
+	"cmp"
+	"fmt"
+	"main/tree_api"
+	"slices"
+	"sync/atomic"
+)
+
+const (
+	defaultOrder = 4
+	minOrder     = 3
+	maxOrder     = 512
+
+	// maxChainLength is how many deltas a node collects before the writer
+	// that added the last one folds the chain into a new base page.
+	maxChainLength = 8
+)
+
+// BwTreeOf is a latch-free B+ tree after Levandoski, Lomet and Sengupta's
+// Bw-tree. Nodes live in a mapping table under logical IDs, and a node is
+// changed by building a delta page that describes the change, on top of the
+// node's current chain, and installing it with one compare-and-swap on the
+// node's table entry. Nothing is ever updated in place, and no operation
+// waits for another: a writer whose swap fails reads the chain again and
+// retries. Long chains are consolidated into a new base page the same way.
+//
+// A split is two steps, each one swap: a split delta on the node hands its
+// upper half to a new node to its right, and an index delta on the parent
+// then points to the new node. In between, searches reach the new node
+// through the split node's right-link, as in a B-link tree. Any thread that
+// finds the root split finishes the job by installing a new root, so a
+// split of the root never leaves the tree waiting on one writer.
+//
+// Deletes add delete deltas and never merge nodes, so leaves may be left
+// underfull or empty. Pages that drop out of the mapping table are reclaimed
+// by the garbage collector once no reader holds them, which takes the place
+// of the epochs the Bw-tree paper uses.
+type BwTreeOf[K cmp.Ordered, V any] struct {
+	mapping mappingOf[K, V]
+	root    atomic.Uint64 // a pageID
+	order   int
+}
+
+type BwTree = BwTreeOf[int, []byte]
+
+func NewTree(opts ...tree_api.Option) tree_api.BPTree {
+	return NewTreeOf[int, []byte](opts...)
+}
+
+func NewTreeOf[K cmp.Ordered, V any](opts ...tree_api.Option) tree_api.TreeOf[K, V] {
+	o, err := tree_api.BuildOptions(defaultOrder, minOrder, maxOrder, opts)
+	if err != nil {
+		panic(err)
+	}
+	t := &BwTreeOf[K, V]{order: o.Order}
+	t.root.Store(uint64(t.mapping.allocate(&pageOf[K, V]{kind: baseLeaf})))
+	return t
+}
+
+func (t *BwTreeOf[K, V]) Order() int {
+	return t.order
+}
+
+// moveRight follows right-links from the node id to the node that covers
+// key, or with below set the largest key less than key, and returns it with
+// its chain.
+func (t *BwTreeOf[K, V]) moveRight(id pageID, key K, below bool) (pageID, *pageOf[K, V]) {
+	p := t.mapping.load(id)
+	for !p.covers(key, below) {
+		id = p.right
+		p = t.mapping.load(id)
+	}
+	return id, p
+}
+
+// descend goes down from the root to the node at level that covers key, or
+// with below set the largest key less than key, and returns it with its
+// chain. If path is not nil the inner nodes passed on the way are appended
+// to it, from the top down. A root that has been replaced is still the
+// leftmost node of its level, so a descent from a stale root finds its way
+// by moving right.
+func (t *BwTreeOf[K, V]) descend(key K, level int, below bool, path *[]pageID) (pageID, *pageOf[K, V]) {
+	id := pageID(t.root.Load())
+	for {
+		var p *pageOf[K, V]
+		id, p = t.moveRight(id, key, below)
+		if p.level == level {
+			return id, p
+		}
+		if path != nil {
+			*path = append(*path, id)
+		}
+		id = p.childFor(key, below)
+	}
+}
+
+func (t *BwTreeOf[K, V]) Find(key K, verbose bool) (*tree_api.RecordOf[V], error) {
+	_, p := t.descend(key, 0, false, nil)
+	if r, found := p.lookup(key); found {
+		return r, nil
+	}
+	return nil, tree_api.ErrKeyNotFound
+}
+
+func (t *BwTreeOf[K, V]) FindAndPrint(key K, verbose bool) {
+	r, err := t.Find(key, verbose)
+
+	if err != nil || r == nil {
+		fmt.Printf("Record not found under key %v.\n", key)
+	} else {
+		fmt.Printf("Record at %p -- key %v, value %s.\n", r, key, tree_api.FormatValue(r.Value))
+	}
+}
+
+func (t *BwTreeOf[K, V]) FindAndPrintRange(key_start, key_end K, verbose bool) {
+	results, _ := t.Range(key_start, key_end)
+	if len(results) == 0 {
+		fmt.Println("None found,")
+	} else {
+		for _, kr := range results {
+			fmt.Printf("Key: %v  Location: %p  Value: %s\n",
+				kr.Key,
+				kr.Record,
+				tree_api.FormatValue(kr.Record.Value))
+		}
+	}
+}
+
+// modify installs on the leaf covering key the delta that change builds on
+// the leaf's current chain, retrying with the new chain if another delta
+// gets in first. change returns nil to leave the leaf as it is. Afterwards
+// the leaf is split or consolidated if it needs to be.
+func (t *BwTreeOf[K, V]) modify(key K, change func(p *pageOf[K, V]) *pageOf[K, V]) {
+	path := []pageID{}
+	id, p := t.descend(key, 0, false, &path)
+	for {
+		d := change(p)
+		if d == nil {
+			return
+		}
+		if t.mapping.cas(id, p, d) {
+			t.maintain(id, path)
+			return
+		}
+		id, p = t.moveRight(id, key, false)
+	}
+}
+
+func (t *BwTreeOf[K, V]) Insert(key K, value V) error {
+	return t.insert(key, &tree_api.RecordOf[V]{Value: value}, false)
+}
+
+// Upsert inserts key, or replaces its record if it is already present.
+func (t *BwTreeOf[K, V]) Upsert(key K, value V) error {
+	return t.insert(key, &tree_api.RecordOf[V]{Value: value}, true)
+}
+
+func (t *BwTreeOf[K, V]) insert(key K, record *tree_api.RecordOf[V], replace bool) error {
+	var err error
+	t.modify(key, func(p *pageOf[K, V]) *pageOf[K, V] {
+		_, found := p.lookup(key)
+		if found && !replace {
+			err = tree_api.ErrKeyExists
+			return nil
+		}
+		d := p.delta(insertDelta, key)
+		d.record = record
+		if !found {
+			d.size++
+		}
+		return d
+	})
+	return err
+}
+
+// Update replaces the record of an existing key.
+func (t *BwTreeOf[K, V]) Update(key K, value V) error {
+	_, err := t.swap(key, nil, value, false)
+	return err
+}
+
+// CompareAndSwap replaces the record of key if it is still old.
+func (t *BwTreeOf[K, V]) CompareAndSwap(key K, old *tree_api.RecordOf[V], new V) (bool, error) {
+	return t.swap(key, old, new, true)
+}
+
+// swap gives an existing key a new record. With compare set it only does so
+// if the current record is old.
+func (t *BwTreeOf[K, V]) swap(key K, old *tree_api.RecordOf[V], value V, compare bool) (bool, error) {
+	record := &tree_api.RecordOf[V]{Value: value}
+	var swapped bool
+	var err error
+	t.modify(key, func(p *pageOf[K, V]) *pageOf[K, V] {
+		r, found := p.lookup(key)
+		if !found {
+			swapped, err = false, tree_api.ErrKeyNotFound
+			return nil
+		}
+		if compare && r != old {
+			swapped, err = false, nil
+			return nil
+		}
+		swapped, err = true, nil
+		d := p.delta(insertDelta, key)
+		d.record = record
+		return d
+	})
+	return swapped, err
+}
+
+func (t *BwTreeOf[K, V]) Delete(key K) error {
+	var err error
+	t.modify(key, func(p *pageOf[K, V]) *pageOf[K, V] {
+		if _, found := p.lookup(key); !found {
+			err = tree_api.ErrKeyNotFound
+			return nil
+		}
+		err = nil
+		d := p.delta(deleteDelta, key)
+		d.size--
+		return d
+	})
+	return err
+}
+
+// maintain splits the node id if it has more entries than it may, and
+// consolidates its chain if it has grown too long. path holds the inner
+// nodes above it, from the top down. Both are best effort: if another delta
+// gets in first, maintain looks at the node again, and a consolidation that
+// loses the race is left to the next writer.
+func (t *BwTreeOf[K, V]) maintain(id pageID, path []pageID) {
+	for {
+		p := t.mapping.load(id)
+		if p.size > t.order-1 {
+			t.split(id, p, path)
+			continue
+		}
+		if p.depth > maxChainLength {
+			t.mapping.cas(id, p, p.consolidate())
+		}
+		return
+	}
+}
+
+// split moves the upper half of the node id, whose chain starts at p, to a
+// new node, and posts the new node to the parent. It does nothing if the
+// chain has moved on from p.
+func (t *BwTreeOf[K, V]) split(id pageID, p *pageOf[K, V], path []pageID) {
+	c := p.consolidate()
+	mid := len(c.keys) / 2
+	separator := c.keys[mid]
+	sibling := &pageOf[K, V]{
+		kind:    c.kind,
+		level:   c.level,
+		low:     separator,
+		hasLow:  true,
+		high:    c.high,
+		hasHigh: c.hasHigh,
+		right:   c.right,
+	}
+	if c.isLeaf() {
+		sibling.keys = c.keys[mid:]
+		sibling.records = c.records[mid:]
+	} else {
+		sibling.keys = c.keys[mid+1:]
+		sibling.children = c.children[mid+1:]
+	}
+	sibling.size = len(sibling.keys)
+	siblingID := t.mapping.allocate(sibling)
+
+	d := p.delta(splitDelta, separator)
+	d.child = siblingID
+	d.high, d.hasHigh = separator, true
+	d.right = siblingID
+	d.size = mid
+	if !t.mapping.cas(id, p, d) {
+		t.mapping.release(siblingID)
+		return
+	}
+	t.post(p.level, separator, siblingID, path)
+	t.maintain(siblingID, path)
+}
+
+// post adds to the level above level an index delta for the node child,
+// split off to the right at separator, and then maintains the parent. The
+// parent is the last node of path, or is found by descending again if the
+// tree has grown since path was taken. If the split node's level is still
+// the root's, post first installs a new root; that root may already hold the
+// separator, as may one installed by another thread, so post checks before
+// adding it.
+func (t *BwTreeOf[K, V]) post(level int, separator K, child pageID, path []pageID) {
+	var parentID pageID
+	hasParent := len(path) > 0
+	if hasParent {
+		parentID = path[len(path)-1]
+		path = path[:len(path)-1]
+	}
+	for {
+		var parent *pageOf[K, V]
+		if hasParent {
+			parentID, parent = t.moveRight(parentID, separator, false)
+		} else {
+			rootID := pageID(t.root.Load())
+			if root := t.mapping.load(rootID); root.level == level {
+				t.growRoot(rootID, root)
+				continue
+			}
+			parentID, parent = t.descend(separator, level+1, false, nil)
+			hasParent = true
+		}
+		if parent.childFor(separator, false) == child {
+			return
+		}
+		d := parent.delta(indexDelta, separator)
+		d.child = child
+		d.size++
+		if t.mapping.cas(parentID, parent, d) {
+			t.maintain(parentID, path)
+			return
+		}
+	}
+}
+
+// growRoot puts a new root above the root rootID, whose chain starts at p,
+// once it has split. The new root has one separator, p's high key, between
+// the old root and the node to its right; nodes split off further right are
+// posted to the new root by their own splitters.
+func (t *BwTreeOf[K, V]) growRoot(rootID pageID, p *pageOf[K, V]) {
+	if !p.hasHigh {
+		return
+	}
+	root := &pageOf[K, V]{
+		kind:     baseInner,
+		level:    p.level + 1,
+		size:     1,
+		keys:     []K{p.high},
+		children: []pageID{rootID, p.right},
+	}
+	id := t.mapping.allocate(root)
+	if !t.root.CompareAndSwap(uint64(rootID), uint64(id)) {
+		t.mapping.release(id)
+	}
+}
+
+func (t *BwTreeOf[K, V]) Range(key_start, key_end K) ([]tree_api.KeyRecordOf[K, V], error) {
+	return t.RangeLimit(key_start, key_end, 0, false)
+}
+
+// RangeLimit consolidates one leaf at a time into a private copy, as it was
+// at some moment during the call. Forward scans follow the leaves'
+// right-links; reverse scans descend again to the leaf below the low key of
+// the last one. The result is sorted and holds every key that was present
+// throughout the call, but is not a snapshot of the whole range.
+func (t *BwTreeOf[K, V]) RangeLimit(key_start, key_end K, limit int, reverse bool) ([]tree_api.KeyRecordOf[K, V], error) {
+	if key_start > key_end {
+		return nil, tree_api.ErrInvalidRange
+	}
+	results := []tree_api.KeyRecordOf[K, V]{}
+	full := func() bool { return limit > 0 && len(results) == limit }
+
+	if !reverse {
+		_, p := t.descend(key_start, 0, false, nil)
+		for {
+			c := p.consolidate()
+			i, _ := slices.BinarySearch(c.keys, key_start)
+			for ; i < len(c.keys); i++ {
+				if c.keys[i] > key_end || full() {
+					return results, nil
+				}
+				results = append(results, tree_api.KeyRecordOf[K, V]{Key: c.keys[i], Record: c.records[i]})
+			}
+			if !c.hasHigh || c.high > key_end {
+				return results, nil
+			}
+			_, p = t.moveRight(c.right, c.high, false)
+		}
+	}
+
+	_, p := t.descend(key_end, 0, false, nil)
+	c := p.consolidate()
+	i, found := slices.BinarySearch(c.keys, key_end)
+	if found {
+		i++
+	}
+	for {
+		for i--; i >= 0; i-- {
+			if c.keys[i] < key_start || full() {
+				return results, nil
+			}
+			results = append(results, tree_api.KeyRecordOf[K, V]{Key: c.keys[i], Record: c.records[i]})
+		}
+		if !c.hasLow || c.low <= key_start {
+			return results, nil
+		}
+		bound := c.low
+		_, p = t.descend(bound, 0, true, nil)
+		c = p.consolidate()
+		i, _ = slices.BinarySearch(c.keys, bound)
+	}
+}
+
+// PrintTree prints one level per line, walking each level along its
+// right-links from its leftmost node.
+func (t *BwTreeOf[K, V]) PrintTree() {
+	first := pageID(t.root.Load())
+	for {
+		var below pageID
+		hasBelow := false
+		for id, more := first, true; more; {
+			c := t.mapping.load(id).consolidate()
+			for _, k := range c.keys {
+				fmt.Printf("%v ", k)
+			}
+			fmt.Printf(" | ")
+			if !hasBelow && !c.isLeaf() {
+				below, hasBelow = c.children[0], true
+			}
+			id, more = c.right, c.hasHigh
+		}
+		fmt.Printf("\n")
+		if !hasBelow {
+			return
+		}
+		first = below
+	}
+}
+
+func (t *BwTreeOf[K, V]) PalmBasic(key_count int, num_threads int) {
+	panic("not implemented for BwTree")
+}
+
+func (t *BwTreeOf[K, V]) Palm(queries []tree_api.QueryOf[K, V], num_threads int) []tree_api.ResultOf[V] {
+	panic("not implemented for BwTree")
+}
@@ -0,0 +1,235 @@
+package bw_tree
+
+import (
+	"errors"
+	"fmt"
+	"main/tree_api"
+	"main/tree_testing"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// TestChainsStayShort rewrites a few keys over and over, and checks that
+// the leaves' delta chains are folded away instead of growing without bound.
+func TestChainsStayShort(t *testing.T) {
+	tree := NewTreeOf[int, []byte](tree_api.WithOrder(64)).(*BwTree)
+	want := make(map[int]string)
+	for round := 0; round < 100; round++ {
+		for key := 0; key < 10; key++ {
+			value := fmt.Sprint(key, "/", round)
+			if err := tree.Upsert(key, []byte(value)); err != nil {
+				t.Fatalf("upsert %d: %s", key, err)
+			}
+			want[key] = value
+		}
+	}
+	root := tree.mapping.load(pageID(tree.root.Load()))
+	if depth := root.depth; depth > maxChainLength {
+		t.Errorf("root chain is %d deltas deep, expected at most %d", depth, maxChainLength)
+	}
+	tree_testing.CheckContents(t, tree, want)
+}
+
+func TestConcurrentPointOps(t *testing.T) {
+	for _, order := range []int{3, 4, 16} {
+		t.Run(fmt.Sprintf("order=%d", order), func(t *testing.T) {
+			tree_testing.ConcurrentPointOps(t, NewTreeOf[int, []byte](tree_api.WithOrder(order)))
+		})
+	}
+}
+
+// TestConsolidateAppliesDeltas folds a chain of every kind of leaf delta into
+// a base page: the newest delta for a key wins, and keys a split delta has
+// handed to the right are dropped.
+func TestConsolidateAppliesDeltas(t *testing.T) {
+	record := func(s string) *tree_api.Record { return &tree_api.Record{Value: []byte(s)} }
+	p := &pageOf[int, []byte]{
+		kind:    baseLeaf,
+		keys:    []int{10, 20, 30, 40},
+		records: []*tree_api.Record{record("10"), record("20"), record("30"), record("40")},
+		size:    4,
+	}
+	for _, d := range []struct {
+		kind   pageKind
+		key    int
+		record *tree_api.Record
+	}{
+		{insertDelta, 15, record("15")},
+		{insertDelta, 20, record("20b")},
+		{deleteDelta, 10, nil},
+		{insertDelta, 10, record("10b")},
+		{deleteDelta, 15, nil},
+		{insertDelta, 35, record("35")},
+		{splitDelta, 30, nil},
+		{deleteDelta, 25, nil},
+	} {
+		p = p.delta(d.kind, d.key)
+		p.record = d.record
+		if d.kind == splitDelta {
+			p.high, p.hasHigh = d.key, true
+		}
+	}
+	c := p.consolidate()
+	if c.kind != baseLeaf || c.next != nil || !c.hasHigh || c.high != 30 {
+		t.Fatalf("expected a base leaf below 30, got kind %d high %v %d", c.kind, c.hasHigh, c.high)
+	}
+	got := map[int]string{}
+	for i, key := range c.keys {
+		got[key] = string(c.records[i].Value)
+	}
+	if want := map[int]string{10: "10b", 20: "20b"}; !maps.Equal(got, want) {
+		t.Errorf("consolidated to %v, expected %v", got, want)
+	}
+	if c.size != len(c.keys) {
+		t.Errorf("consolidated page counts %d entries and holds %d", c.size, len(c.keys))
+	}
+}
+
+// TestConsolidationKeepsRacingDeltas has writers pile deltas onto one leaf,
+// so that its chain is consolidated over and over while other writers add to
+// it. A consolidation that lost a delta that raced with it would show up as a
+// value going back in time.
+func TestConsolidationKeepsRacingDeltas(t *testing.T) {
+	const writers = 4
+	const keysPerWriter = 8
+	const rounds = 300
+	tree := NewTreeOf[int, []byte](tree_api.WithOrder(64)).(*BwTree)
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for round := 0; round < rounds; round++ {
+				for i := 0; i < keysPerWriter; i++ {
+					tree.Upsert(i*writers+w, []byte(fmt.Sprintf("%04d", round)))
+				}
+			}
+		}(w)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	last := make(map[int]string)
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		for key := 0; key < writers*keysPerWriter; key++ {
+			r, err := tree.Find(key, false)
+			if err != nil {
+				continue
+			}
+			if value := string(r.Value); value < last[key] {
+				t.Fatalf("key %d went back from %s to %s", key, last[key], value)
+			} else {
+				last[key] = value
+			}
+		}
+	}
+	want := make(map[int]string)
+	for key := 0; key < writers*keysPerWriter; key++ {
+		want[key] = fmt.Sprintf("%04d", rounds-1)
+	}
+	if depth := tree.mapping.load(pageID(tree.root.Load())).depth; depth > maxChainLength {
+		t.Errorf("chain is %d deltas deep, expected at most %d", depth, maxChainLength)
+	}
+	tree_testing.CheckContents(t, tree, want)
+}
+
+// TestSplitBeforeIndexDelta installs a split delta on a leaf without the
+// index delta that tells its parent, the state other threads see between the
+// two steps of a split. Reads reach the moved keys by the right-link, writes
+// to them land in the new node, and two threads that both finish the split
+// post it only once.
+func TestSplitBeforeIndexDelta(t *testing.T) {
+	tree := NewTreeOf[int, []byte](tree_api.WithOrder(8)).(*BwTree)
+	want := make(map[int]string)
+	for key := 0; key < 80; key += 2 {
+		tree.Insert(key, []byte(fmt.Sprint(key)))
+		want[key] = fmt.Sprint(key)
+	}
+	path := []pageID{}
+	id, p := tree.descend(0, 0, false, &path)
+	c := p.consolidate()
+	if len(c.keys) < 2 {
+		t.Fatalf("expected the first leaf to hold at least two keys, it holds %v", c.keys)
+	}
+	mid := len(c.keys) / 2
+	separator := c.keys[mid]
+	siblingID := tree.mapping.allocate(&pageOf[int, []byte]{
+		kind:    baseLeaf,
+		low:     separator,
+		hasLow:  true,
+		high:    c.high,
+		hasHigh: c.hasHigh,
+		right:   c.right,
+		keys:    c.keys[mid:],
+		records: c.records[mid:],
+		size:    len(c.keys) - mid,
+	})
+	d := p.delta(splitDelta, separator)
+	d.child, d.right, d.size = siblingID, siblingID, mid
+	d.high, d.hasHigh = separator, true
+	if !tree.mapping.cas(id, p, d) {
+		t.Fatalf("could not install the split delta")
+	}
+
+	if err := tree.Validate(); !errors.Is(err, tree_api.ErrInvalidTree) {
+		t.Errorf("expected the unposted split to be reported and got %v", err)
+	}
+	for key, value := range want {
+		if r, err := tree.Find(key, false); err != nil || string(r.Value) != value {
+			t.Errorf("key %d: %v %v", key, r, err)
+		}
+	}
+	tree.Upsert(separator, []byte("moved"))
+	tree.Insert(separator+1, []byte("new"))
+	want[separator], want[separator+1] = "moved", "new"
+	if r, _ := tree.mapping.load(siblingID).lookup(separator + 1); r == nil {
+		t.Errorf("expected an insert above the separator to land in the new node")
+	}
+	if res, _ := tree.RangeLimit(math.MinInt, math.MaxInt, 0, true); len(res) != len(want) {
+		t.Errorf("expected a reverse scan to see %d keys and got %d", len(want), len(res))
+	}
+
+	tree.post(0, separator, siblingID, slices.Clone(path))
+	tree.post(0, separator, siblingID, slices.Clone(path))
+	tree_testing.CheckContents(t, tree, want)
+}
+
+// TestRacingSplitsOfOneNode has two threads split the same leaf from the same
+// chain. The second split delta finds the chain moved on and is dropped,
+// together with the node it would have split off.
+func TestRacingSplitsOfOneNode(t *testing.T) {
+	tree := NewTreeOf[int, []byte](tree_api.WithOrder(8)).(*BwTree)
+	want := make(map[int]string)
+	for key := 0; key < 80; key += 2 {
+		tree.Insert(key, []byte(fmt.Sprint(key)))
+		want[key] = fmt.Sprint(key)
+	}
+	path := []pageID{}
+	id, p := tree.descend(40, 0, false, &path)
+	next := tree.mapping.next.Load()
+	tree.split(id, p, slices.Clone(path))
+	tree.split(id, p, slices.Clone(path))
+	if q := tree.mapping.load(id); q.next != p || q.kind != splitDelta {
+		t.Errorf("expected one split delta on the leaf")
+	}
+	released := 0
+	for i := next; i < tree.mapping.next.Load(); i++ {
+		if tree.mapping.load(pageID(i)) == nil {
+			released++
+		}
+	}
+	if released != 1 {
+		t.Errorf("expected the losing split to release its new node, %d were released", released)
+	}
+	tree_testing.CheckContents(t, tree, want)
+}
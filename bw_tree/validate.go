@@ -0,0 +1,136 @@
+package bw_tree
+
+import (
+	"cmp"
+	"fmt"
+	"main/tree_api"
+	"slices"
+)
+
+// Validate checks that the tree is well formed: keys are sorted within every
+// node and fall between the separators above them, each node's low and high
+// keys match those separators, the right-links of every level join its nodes
+// in key order, the entry count kept on each chain matches the entries the
+// chain holds, every inner node has one more child than keys and every leaf
+// one record per key, no node is overfull, and all leaves are at level 0.
+// Deletes never merge nodes, so only inner nodes, which never lose entries,
+// are checked for a minimum. It returns an error wrapping
+// tree_api.ErrInvalidTree that names the path from the root to the first node
+// found to be broken, or nil if the tree is well formed.
+//
+// Every split must have been posted to its parent, so operations under way
+// must have finished.
+func (t *BwTreeOf[K, V]) Validate() error {
+	if t.order < minOrder || t.order > maxOrder {
+		return fmt.Errorf("%w: order %d is outside [%d, %d]", tree_api.ErrInvalidTree, t.order, minOrder, maxOrder)
+	}
+	rootID := pageID(t.root.Load())
+	root := t.mapping.load(rootID)
+	if root == nil {
+		return fmt.Errorf("%w: root is missing", tree_api.ErrInvalidTree)
+	}
+	v := &validatorOf[K, V]{tree: t, root: rootID, levels: make([][]visitOf[K, V], root.level+1)}
+	if err := v.check(rootID, []int{}, nil, nil, root.level); err != nil {
+		return err
+	}
+	for level, nodes := range v.levels {
+		for i, visit := range nodes {
+			hasNext := i+1 < len(nodes)
+			if visit.page.hasHigh != hasNext || (hasNext && visit.page.right != nodes[i+1].id) {
+				return fmt.Errorf("%w: %s: right-link does not lead to the next node of level %d", tree_api.ErrInvalidTree, tree_api.FormatPath(visit.path), level)
+			}
+		}
+	}
+	return nil
+}
+
+type validatorOf[K cmp.Ordered, V any] struct {
+	tree   *BwTreeOf[K, V]
+	root   pageID
+	levels [][]visitOf[K, V] // the nodes of each level in key order
+}
+
+type visitOf[K cmp.Ordered, V any] struct {
+	id   pageID
+	page *pageOf[K, V]
+	path []int
+}
+
+// check validates the subtree under the node id, which should be at level
+// and whose keys must lie in [low, high); a nil bound is open.
+func (v *validatorOf[K, V]) check(id pageID, path []int, low, high *K, level int) error {
+	t := v.tree
+	fail := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s: %s", tree_api.ErrInvalidTree, tree_api.FormatPath(path), fmt.Sprintf(format, args...))
+	}
+	p := t.mapping.load(id)
+	if p == nil {
+		return fail("page %d is not in the mapping table", id)
+	}
+	if p.level != level {
+		return fail("is at level %d, expected %d", p.level, level)
+	}
+	if p.hasLow != (low != nil) || (low != nil && p.low != *low) {
+		return fail("low key does not match the separator above it")
+	}
+	if p.hasHigh != (high != nil) || (high != nil && p.high != *high) {
+		return fail("high key does not match the separator above it")
+	}
+	v.levels[level] = append(v.levels[level], visitOf[K, V]{id: id, page: p, path: slices.Clone(path)})
+
+	c := p.consolidate()
+	if p.size != len(c.keys) {
+		return fail("chain counts %d entries but holds %d", p.size, len(c.keys))
+	}
+	if len(c.keys) > t.order-1 {
+		return fail("holds %d keys, more than the maximum of %d", len(c.keys), t.order-1)
+	}
+	if !c.isLeaf() {
+		if id == v.root && len(c.keys) == 0 {
+			return fail("root is an inner node without keys")
+		}
+		if id != v.root && len(c.keys) < (t.order-1)/2 {
+			return fail("holds %d keys, fewer than the minimum of %d", len(c.keys), (t.order-1)/2)
+		}
+	}
+	for i, key := range c.keys {
+		if i > 0 && c.keys[i-1] >= key {
+			return fail("key %v at %d is not above key %v before it", key, i, c.keys[i-1])
+		}
+		if low != nil && key < *low {
+			return fail("key %v at %d is below the separator %v", key, i, *low)
+		}
+		if high != nil && key >= *high {
+			return fail("key %v at %d is not below the separator %v", key, i, *high)
+		}
+	}
+
+	if c.isLeaf() {
+		if len(c.records) != len(c.keys) || len(c.children) != 0 {
+			return fail("leaf has %d keys, %d records and %d children", len(c.keys), len(c.records), len(c.children))
+		}
+		for i, r := range c.records {
+			if r == nil {
+				return fail("record %d is missing", i)
+			}
+		}
+		return nil
+	}
+
+	if len(c.children) != len(c.keys)+1 || len(c.records) != 0 {
+		return fail("inner node has %d keys, %d children and %d records", len(c.keys), len(c.children), len(c.records))
+	}
+	for i, child := range c.children {
+		childLow, childHigh := low, high
+		if i > 0 {
+			childLow = &c.keys[i-1]
+		}
+		if i < len(c.keys) {
+			childHigh = &c.keys[i]
+		}
+		if err := v.check(child, append(path, i), childLow, childHigh, level-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package crab
+
+import (
+	"cmp"
+	"main/tree_api"
+)
+
+// IteratorOf walks the leaves of a CrabTree through the sibling pointer in
+// Pointers[order-1]. While positioned it keeps a shared latch on the current
+// leaf, and moving to the next leaf latches the sibling before releasing the
+// current one, so it never holds more than two leaf latches. Other readers
+// pass freely, but writers that need the latched leaf wait until the iterator
+// moves on or is closed, so the goroutine driving an iterator must not use the
+// tree until it has closed it.
+type IteratorOf[K cmp.Ordered, V any] struct {
+	tree      *CrabTreeOf[K, V]
+	leaf      *NodeOf[K, V] // latched while non-nil
+	index     int
+	started   bool
+	exhausted bool
+	closed    bool
+}
+
+func (t *CrabTreeOf[K, V]) NewIterator() tree_api.IteratorOf[K, V] {
+	return &IteratorOf[K, V]{tree: t}
+}
+
+func (it *IteratorOf[K, V]) Seek(key K) bool {
+	if it.closed {
+		return false
+	}
+	it.release()
+	it.started = true
+	it.tree.rlockTree()
+	if it.tree.Root == nil {
+		it.tree.runlockTree()
+		return it.exhaust()
+	}
+	it.leaf = it.tree.findLeaf(key, false, false)
+	it.index = 0
+	for it.index < it.leaf.NumKeys && it.leaf.Keys[it.index] < key {
+		it.index += 1
+	}
+	return it.settleForward()
+}
+
+func (it *IteratorOf[K, V]) Next() bool {
+	if it.closed || it.exhausted {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		it.leaf = it.tree.descend(func(c *NodeOf[K, V]) int { return 0 })
+		it.index = 0
+		if it.leaf == nil {
+			return it.exhaust()
+		}
+		return it.settleForward()
+	}
+	it.index += 1
+	return it.settleForward()
+}
+
+func (it *IteratorOf[K, V]) Prev() bool {
+	if it.closed || it.exhausted {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		it.leaf = it.tree.descend(func(c *NodeOf[K, V]) int { return c.NumKeys })
+		if it.leaf == nil || it.leaf.NumKeys == 0 {
+			return it.exhaust()
+		}
+		it.index = it.leaf.NumKeys - 1
+		return true
+	}
+	if it.index > 0 {
+		it.index -= 1
+		return true
+	}
+	// There are no back pointers between leaves, and latching leftwards could
+	// deadlock with a scan going the other way, so let go of the leaf and
+	// descend from the root again.
+	key := it.leaf.Keys[0]
+	it.release()
+	it.leaf, it.index = it.tree.findLast(key, false)
+	if it.leaf == nil {
+		return it.exhaust()
+	}
+	return true
+}
+
+func (it *IteratorOf[K, V]) Key() K {
+	if !it.valid() {
+		var zero K
+		return zero
+	}
+	return it.leaf.Keys[it.index]
+}
+
+func (it *IteratorOf[K, V]) Value() *tree_api.RecordOf[V] {
+	if !it.valid() {
+		return nil
+	}
+	r, _ := it.leaf.Pointers[it.index].(*tree_api.RecordOf[V])
+	return r
+}
+
+func (it *IteratorOf[K, V]) Err() error {
+	if it.closed {
+		return tree_api.ErrIteratorClosed
+	}
+	return nil
+}
+
+func (it *IteratorOf[K, V]) Close() error {
+	it.release()
+	it.closed = true
+	return nil
+}
+
+func (it *IteratorOf[K, V]) valid() bool {
+	return !it.closed && !it.exhausted && it.leaf != nil && it.index < it.leaf.NumKeys
+}
+
+func (it *IteratorOf[K, V]) release() {
+	if it.leaf != nil {
+		it.tree.runlatch(it.leaf)
+		it.leaf = nil
+	}
+}
+
+func (it *IteratorOf[K, V]) exhaust() bool {
+	it.release()
+	it.exhausted = true
+	return false
+}
+
+// settleForward moves past the end of exhausted leaves until the iterator
+// points at a key or runs off the end of the chain.
+func (it *IteratorOf[K, V]) settleForward() bool {
+	for it.index >= it.leaf.NumKeys {
+		next, _ := it.leaf.Pointers[it.tree.order-1].(*NodeOf[K, V])
+		if next == nil {
+			return it.exhaust()
+		}
+		it.tree.rlatch(next)
+		it.tree.runlatch(it.leaf)
+		it.leaf = next
+		it.index = 0
+	}
+	it.exhausted = false
+	return true
+}
@@ -0,0 +1,98 @@
+package crab
+
+import "sync"
+
+// scheduler takes control of how goroutines interleave inside a tree, so that
+// tests can drive the latching protocol through chosen or seeded schedules.
+// Yield is called by the goroutine that is running at every latch acquire and
+// release, and may run other goroutines before it returns.
+type scheduler interface {
+	Yield()
+}
+
+// Every latch in the tree is taken and dropped through these, so that a
+// scheduler and, in crabdebug builds, the latch checker see all of them.
+// Writers take latches exclusively; finds, range scans and iterators crab down
+// with shared ones, so they only wait for writers and never for each other.
+
+func (t *CrabTreeOf[K, V]) lockTree() {
+	t.take(nil, &t.lock, false)
+}
+
+func (t *CrabTreeOf[K, V]) unlockTree() {
+	t.drop(nil, &t.lock, false)
+}
+
+func (t *CrabTreeOf[K, V]) rlockTree() {
+	t.take(nil, &t.lock, true)
+}
+
+func (t *CrabTreeOf[K, V]) runlockTree() {
+	t.drop(nil, &t.lock, true)
+}
+
+func (t *CrabTreeOf[K, V]) latch(n *NodeOf[K, V]) {
+	t.take(n, &n.lock, false)
+}
+
+func (t *CrabTreeOf[K, V]) unlatch(n *NodeOf[K, V]) {
+	t.drop(n, &n.lock, false)
+}
+
+func (t *CrabTreeOf[K, V]) rlatch(n *NodeOf[K, V]) {
+	t.take(n, &n.lock, true)
+}
+
+func (t *CrabTreeOf[K, V]) runlatch(n *NodeOf[K, V]) {
+	t.drop(n, &n.lock, true)
+}
+
+// take acquires the latch m of node n, or of the tree when n is nil.
+func (t *CrabTreeOf[K, V]) take(n *NodeOf[K, V], m *sync.RWMutex, shared bool) {
+	t.debug.acquiring(n, shared, t.order)
+	t.acquire(m, shared && !t.exclusiveReads)
+	t.debug.acquired(n, shared)
+}
+
+func (t *CrabTreeOf[K, V]) drop(n *NodeOf[K, V], m *sync.RWMutex, shared bool) {
+	t.debug.releasing(n, shared)
+	t.release(m, shared && !t.exclusiveReads)
+}
+
+// acquire locks m. Under a scheduler a goroutine must not block inside Lock,
+// since the scheduler would be left waiting for it, so it yields until the
+// latch is free instead.
+func (t *CrabTreeOf[K, V]) acquire(m *sync.RWMutex, shared bool) {
+	if t.sched == nil {
+		if shared {
+			m.RLock()
+		} else {
+			m.Lock()
+		}
+		return
+	}
+	t.sched.Yield()
+	for !tryAcquire(m, shared) {
+		t.sched.Yield()
+	}
+}
+
+// release unlocks m, then gives a scheduler the chance to switch goroutines
+// while the latch is free.
+func (t *CrabTreeOf[K, V]) release(m *sync.RWMutex, shared bool) {
+	if shared {
+		m.RUnlock()
+	} else {
+		m.Unlock()
+	}
+	if t.sched != nil {
+		t.sched.Yield()
+	}
+}
+
+func tryAcquire(m *sync.RWMutex, shared bool) bool {
+	if shared {
+		return m.TryRLock()
+	}
+	return m.TryLock()
+}
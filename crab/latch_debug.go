@@ -0,0 +1,186 @@
+//go:build crabdebug
+
+package crab
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// latchDebugOf tracks which latches each goroutine holds, and panics as soon
+// as a goroutine
+//   - acquires a latch it already holds, shared or not, which can deadlock
+//     it,
+//   - acquires latches out of order: the tree latch while holding a node
+//     latch, or a node latch that is neither a child of a node it holds nor
+//     the leaf chain successor of a leaf it holds, or
+//   - releases a latch it does not hold, or holds in the other mode, or
+//   - still holds a latch taken during a public operation when that
+//     operation returns.
+//
+// The panic names the operation and the node involved. It is only compiled
+// into crabdebug builds:
+//
+//	go test -tags crabdebug ./crab
+type latchDebugOf[K cmp.Ordered, V any] struct {
+	lock       sync.Mutex
+	goroutines map[int64]*goroutineLatchesOf[K, V]
+}
+
+type goroutineLatchesOf[K cmp.Ordered, V any] struct {
+	held []heldLatchOf[K, V]
+	ops  []string // the public operations under way, innermost last
+}
+
+// heldLatchOf is a latch a goroutine holds. A nil node is the tree latch. op
+// is the index in ops of the operation that took it, or -1 outside of one.
+type heldLatchOf[K cmp.Ordered, V any] struct {
+	node   *NodeOf[K, V]
+	shared bool
+	op     int
+}
+
+func (d *latchDebugOf[K, V]) acquiring(n *NodeOf[K, V], shared bool, order int) {
+	g := d.current()
+	for _, h := range g.held {
+		if h.node == n {
+			g.fail("acquires the latch of %s, which it already holds", describe(n))
+		}
+	}
+	holdsNode := false
+	for _, h := range g.held {
+		if h.node != nil {
+			holdsNode = true
+		}
+	}
+	if n == nil {
+		if holdsNode {
+			g.fail("acquires the tree latch while holding a node latch")
+		}
+		return
+	}
+	if !holdsNode {
+		return
+	}
+	for _, h := range g.held {
+		if h.node == nil {
+			continue
+		}
+		if h.node.IsLeaf {
+			if next, _ := h.node.Pointers[order-1].(*NodeOf[K, V]); next == n {
+				return
+			}
+			continue
+		}
+		for i := 0; i <= h.node.NumKeys; i++ {
+			if child, _ := h.node.Pointers[i].(*NodeOf[K, V]); child == n {
+				return
+			}
+		}
+	}
+	g.fail("acquires the latch of node %p, which is neither a child nor the successor of a node it holds", n)
+}
+
+func (d *latchDebugOf[K, V]) acquired(n *NodeOf[K, V], shared bool) {
+	g := d.current()
+	g.held = append(g.held, heldLatchOf[K, V]{n, shared, len(g.ops) - 1})
+}
+
+func (d *latchDebugOf[K, V]) releasing(n *NodeOf[K, V], shared bool) {
+	g := d.current()
+	for i, h := range g.held {
+		if h.node != n {
+			continue
+		}
+		if h.shared != shared {
+			g.fail("releases the %s latch of %s, which it holds as %s", mode(shared), describe(n), mode(h.shared))
+		}
+		g.held = append(g.held[:i], g.held[i+1:]...)
+		return
+	}
+	g.fail("releases the latch of %s, which it does not hold", describe(n))
+}
+
+// operation marks the start of a public operation and returns the function
+// that checks, when it returns, that it left no latches behind. It must be
+// deferred directly, so that it can tell a panicking operation, which is
+// expected to leave latches held, from one that returned.
+func (d *latchDebugOf[K, V]) operation(name string) func() {
+	g := d.current()
+	g.ops = append(g.ops, name)
+	op := len(g.ops) - 1
+	return func() {
+		if r := recover(); r != nil {
+			g.ops = g.ops[:op]
+			panic(r)
+		}
+		for _, h := range g.held {
+			if h.op >= op {
+				g.fail("returns still holding the latch of %s", describe(h.node))
+			}
+		}
+		g.ops = g.ops[:op]
+	}
+}
+
+// current returns the calling goroutine's latches.
+func (d *latchDebugOf[K, V]) current() *goroutineLatchesOf[K, V] {
+	id := goroutineId()
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.goroutines == nil {
+		d.goroutines = make(map[int64]*goroutineLatchesOf[K, V])
+	}
+	g, ok := d.goroutines[id]
+	if !ok {
+		g = &goroutineLatchesOf[K, V]{}
+		d.goroutines[id] = g
+	}
+	return g
+}
+
+func (g *goroutineLatchesOf[K, V]) fail(format string, args ...any) {
+	op := "code outside any operation"
+	if len(g.ops) > 0 {
+		op = g.ops[len(g.ops)-1]
+	}
+	panic(fmt.Sprintf("crab latch check: %s %s", op, fmt.Sprintf(format, args...)))
+}
+
+func mode(shared bool) string {
+	if shared {
+		return "shared"
+	}
+	return "exclusive"
+}
+
+// describe names a latch the calling goroutine holds, so reading the node is
+// safe.
+func describe[K cmp.Ordered, V any](n *NodeOf[K, V]) string {
+	if n == nil {
+		return "the tree"
+	}
+	kind := "internal node"
+	if n.IsLeaf {
+		kind = "leaf"
+	}
+	return fmt.Sprintf("%s %p with keys %v", kind, n, n.Keys[:n.NumKeys])
+}
+
+// goroutineId reads the calling goroutine's id from the header of its stack
+// trace, "goroutine 42 [running]:".
+func goroutineId() int64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	b = b[:bytes.IndexByte(b, ' ')]
+	id, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		panic(fmt.Sprintf("crab latch check: cannot parse goroutine id: %s", err))
+	}
+	return id
+}
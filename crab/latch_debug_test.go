@@ -0,0 +1,89 @@
+//go:build crabdebug
+
+package crab
+
+import (
+	"fmt"
+	"main/tree_api"
+	"strings"
+	"testing"
+)
+
+// expectLatchPanic runs f and checks that the latch checker stops it with a
+// message containing want.
+func expectLatchPanic(t *testing.T, want string, f func()) {
+	t.Helper()
+	defer func() {
+		t.Helper()
+		r := recover()
+		if r == nil {
+			t.Fatalf("expected a latch check failure containing %q", want)
+		}
+		if msg := fmt.Sprint(r); !strings.Contains(msg, want) {
+			t.Fatalf("expected a latch check failure containing %q and got %q", want, msg)
+		}
+	}()
+	f()
+}
+
+func makeDebugTree(t *testing.T) *CrabTree {
+	tree := NewTreeOf[int, []byte](tree_api.WithOrder(3)).(*CrabTree)
+	for i := 0; i < 20; i++ {
+		tree.Insert(i, []byte(fmt.Sprint(i)))
+	}
+	if tree.Root.IsLeaf {
+		t.Fatalf("expected the tree to have more than one level")
+	}
+	return tree
+}
+
+func TestLatchCheckLeak(t *testing.T) {
+	tree := makeDebugTree(t)
+	leaf := tree.findLeafUnlatched(0)
+	expectLatchPanic(t, "Leaky returns still holding the latch of leaf", func() {
+		defer tree.debug.operation("Leaky")()
+		tree.latch(leaf)
+	})
+}
+
+func TestLatchCheckDoubleAcquire(t *testing.T) {
+	tree := makeDebugTree(t)
+	expectLatchPanic(t, "Twice acquires the latch of internal node", func() {
+		defer tree.debug.operation("Twice")()
+		tree.latch(tree.Root)
+		tree.latch(tree.Root)
+	})
+}
+
+func TestLatchCheckBottomUp(t *testing.T) {
+	tree := makeDebugTree(t)
+	leaf := tree.findLeafUnlatched(0)
+	expectLatchPanic(t, "BottomUp acquires the latch of node", func() {
+		defer tree.debug.operation("BottomUp")()
+		tree.latch(leaf)
+		tree.latch(tree.Root)
+	})
+}
+
+func TestLatchCheckTreeLatchLast(t *testing.T) {
+	tree := makeDebugTree(t)
+	expectLatchPanic(t, "acquires the tree latch while holding a node latch", func() {
+		defer tree.debug.operation("TreeLast")()
+		tree.latch(tree.Root)
+		tree.lockTree()
+	})
+}
+
+// findLeafUnlatched walks to the leaf for key without taking latches, for
+// tests that set up latch misuse by hand on a quiet tree.
+func (t *CrabTreeOf[K, V]) findLeafUnlatched(key K) *NodeOf[K, V] {
+	c := t.Root
+	for !c.IsLeaf {
+		i := 0
+		for i < c.NumKeys && key >= c.Keys[i] {
+			i += 1
+		}
+		c, _ = c.Pointers[i].(*NodeOf[K, V])
+	}
+	return c
+}
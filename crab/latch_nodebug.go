@@ -0,0 +1,19 @@
+//go:build !crabdebug
+
+package crab
+
+import "cmp"
+
+// latchDebugOf checks latch usage in crabdebug builds. In other builds it does
+// nothing and compiles away.
+type latchDebugOf[K cmp.Ordered, V any] struct{}
+
+func (d *latchDebugOf[K, V]) acquiring(n *NodeOf[K, V], shared bool, order int) {}
+
+func (d *latchDebugOf[K, V]) acquired(n *NodeOf[K, V], shared bool) {}
+
+func (d *latchDebugOf[K, V]) releasing(n *NodeOf[K, V], shared bool) {}
+
+func (d *latchDebugOf[K, V]) operation(name string) func() {
+	return func() {}
+}
@@ -0,0 +1,91 @@
+package crab
+
+import (
+	"main/tree_api"
+	"sync/atomic"
+)
+
+// Most inserts and deletes only change their leaf, so they first descend the
+// way a find does, with shared latches, and latch only the leaf exclusively.
+// If the leaf turns out to be unsafe, full for an insert or at its minimum for
+// a delete, they let go and restart on the pessimistic path, which latches
+// every node a split or merge could reach from the root down.
+
+// RestartStats counts the inserts and deletes that started optimistically and
+// how many of them had to restart on the pessimistic path.
+type RestartStats struct {
+	Inserts        int64
+	InsertRestarts int64
+	Deletes        int64
+	DeleteRestarts int64
+}
+
+type restartCounters struct {
+	inserts, insertRestarts atomic.Int64
+	deletes, deleteRestarts atomic.Int64
+}
+
+// RestartStats returns the restart counts since the tree was made.
+func (t *CrabTreeOf[K, V]) RestartStats() RestartStats {
+	return RestartStats{
+		Inserts:        t.stats.inserts.Load(),
+		InsertRestarts: t.stats.insertRestarts.Load(),
+		Deletes:        t.stats.deletes.Load(),
+		DeleteRestarts: t.stats.deleteRestarts.Load(),
+	}
+}
+
+// insertOptimistic inserts key into its leaf if that needs no split. It
+// reports whether it finished the insert, with the insert's error; if not,
+// nothing has changed and the caller must restart pessimistically.
+func (t *CrabTreeOf[K, V]) insertOptimistic(key K, pointer *tree_api.RecordOf[V], replace bool) (bool, error) {
+	t.stats.inserts.Add(1)
+	t.rlockTree()
+	if t.Root == nil {
+		t.runlockTree()
+		t.stats.insertRestarts.Add(1)
+		return false, nil
+	}
+	leaf := t.findLeaf(key, true, false)
+	defer t.unlatch(leaf)
+
+	if i := leafIndex(leaf, key); i >= 0 {
+		if !replace {
+			return true, tree_api.ErrKeyExists
+		}
+		leaf.Pointers[i] = pointer
+		return true, nil
+	}
+	if leaf.NumKeys == t.order-1 {
+		t.stats.insertRestarts.Add(1)
+		return false, nil
+	}
+	insertIntoLeaf(leaf, key, pointer)
+	return true, nil
+}
+
+// deleteOptimistic removes key from its leaf if that leaves it at least half
+// full, the same test findLeafForDelete uses to let go of a leaf's ancestors.
+// A root leaf passes only if it keeps a key, so the root never changes here.
+// It reports whether it finished the delete, with the delete's error.
+func (t *CrabTreeOf[K, V]) deleteOptimistic(key K) (bool, error) {
+	t.stats.deletes.Add(1)
+	t.rlockTree()
+	if t.Root == nil {
+		t.runlockTree()
+		return true, tree_api.ErrKeyNotFound
+	}
+	leaf := t.findLeaf(key, true, false)
+	defer t.unlatch(leaf)
+
+	i := leafIndex(leaf, key)
+	if i < 0 {
+		return true, tree_api.ErrKeyNotFound
+	}
+	if leaf.NumKeys <= cut(t.order-1) {
+		t.stats.deleteRestarts.Add(1)
+		return false, nil
+	}
+	t.removeEntryFromNode(leaf, key, leaf.Pointers[i])
+	return true, nil
+}
@@ -0,0 +1,49 @@
+package crab
+
+import (
+	"fmt"
+	"main/tree_api"
+	"math/rand"
+	"testing"
+)
+
+func TestRestartStats(t *testing.T) {
+	const numKeys = 1000
+	tree := NewTreeOf[int, []byte](tree_api.WithOrder(8)).(*CrabTree)
+	keys := rand.New(rand.NewSource(1)).Perm(numKeys)
+	for _, k := range keys {
+		if err := tree.Insert(k, []byte(fmt.Sprint(k))); err != nil {
+			t.Fatalf("insert %d: %s", k, err)
+		}
+	}
+	stats := tree.RestartStats()
+	if stats.Inserts != numKeys {
+		t.Errorf("counted %d inserts, expected %d", stats.Inserts, numKeys)
+	}
+	// Only inserts that split a leaf, and the first one, restart.
+	if stats.InsertRestarts == 0 || stats.InsertRestarts > numKeys/2 {
+		t.Errorf("%d of %d inserts restarted", stats.InsertRestarts, numKeys)
+	}
+	if err := tree.Validate(); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	for _, k := range keys {
+		if err := tree.Delete(k); err != nil {
+			t.Fatalf("delete %d: %s", k, err)
+		}
+		if err := tree.Validate(); err != nil {
+			t.Fatalf("after deleting %d: %s", k, err)
+		}
+	}
+	if err := tree.Delete(0); err != tree_api.ErrKeyNotFound {
+		t.Errorf("deleting from an empty tree gave %v", err)
+	}
+	stats = tree.RestartStats()
+	if stats.Deletes != numKeys+1 {
+		t.Errorf("counted %d deletes, expected %d", stats.Deletes, numKeys+1)
+	}
+	if stats.DeleteRestarts == 0 || stats.DeleteRestarts > numKeys/2 {
+		t.Errorf("%d of %d deletes restarted", stats.DeleteRestarts, numKeys)
+	}
+}
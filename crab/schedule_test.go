@@ -0,0 +1,258 @@
+package crab
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"main/tree_api"
+	"math"
+	"math/rand"
+	"slices"
+	"sync"
+	"testing"
+)
+
+var (
+	scheduleSeed  = flag.Int64("crab.seed", -1, "replay only the schedule with this seed")
+	scheduleCount = flag.Int("crab.schedules", 300, "number of seeded schedules to explore")
+)
+
+var errStalled = errors.New("schedule did not finish; a latch was probably never released")
+
+// randomScheduler runs one goroutine at a time and, at every yield point,
+// picks the goroutine to run next with a seeded random number generator.
+// Everything between two yield points is deterministic, so a seed always
+// reproduces the same interleaving.
+type randomScheduler struct {
+	rng      *rand.Rand
+	maxSteps int
+
+	mu      sync.Mutex
+	wake    []chan struct{}
+	live    []bool
+	current int
+	steps   int
+	trace   []int // the goroutine chosen at each step
+	stalled bool
+	done    chan struct{}
+}
+
+func newRandomScheduler(seed int64, maxSteps int) *randomScheduler {
+	return &randomScheduler{rng: rand.New(rand.NewSource(seed)), maxSteps: maxSteps, done: make(chan struct{})}
+}
+
+// Run runs fns under the scheduler and returns once all of them have
+// finished. If they are still going after maxSteps yields, which is what a
+// leaked latch looks like, it gives up and returns errStalled, leaving them
+// parked for good.
+func (s *randomScheduler) Run(fns ...func()) error {
+	s.wake = make([]chan struct{}, len(fns))
+	s.live = make([]bool, len(fns))
+	for i, fn := range fns {
+		s.wake[i] = make(chan struct{}, 1)
+		s.live[i] = true
+		go func(i int, fn func()) {
+			<-s.wake[i]
+			fn()
+			s.exit(i)
+		}(i, fn)
+	}
+	s.mu.Lock()
+	s.current = s.pick()
+	s.mu.Unlock()
+	s.wake[s.current] <- struct{}{}
+	<-s.done
+	if s.stalled {
+		return errStalled
+	}
+	return nil
+}
+
+func (s *randomScheduler) Yield() {
+	s.mu.Lock()
+	me := s.current
+	s.steps++
+	if s.steps > s.maxSteps {
+		if !s.stalled {
+			s.stalled = true
+			close(s.done)
+		}
+		s.mu.Unlock()
+		<-s.wake[me]
+		return
+	}
+	next := s.pick()
+	s.current = next
+	s.mu.Unlock()
+	if next == me {
+		return
+	}
+	s.wake[next] <- struct{}{}
+	<-s.wake[me]
+}
+
+func (s *randomScheduler) exit(i int) {
+	s.mu.Lock()
+	s.live[i] = false
+	if !slices.Contains(s.live, true) {
+		if !s.stalled {
+			close(s.done)
+		}
+		s.mu.Unlock()
+		return
+	}
+	next := s.pick()
+	s.current = next
+	s.mu.Unlock()
+	s.wake[next] <- struct{}{}
+}
+
+// pick chooses a live goroutine. The caller holds s.mu.
+func (s *randomScheduler) pick() int {
+	candidates := []int{}
+	for i, live := range s.live {
+		if live {
+			candidates = append(candidates, i)
+		}
+	}
+	next := candidates[s.rng.Intn(len(candidates))]
+	s.trace = append(s.trace, next)
+	return next
+}
+
+// seeds returns the schedules to run: the one given by -crab.seed, or the
+// first -crab.schedules seeds.
+func seeds() []int64 {
+	if *scheduleSeed >= 0 {
+		return []int64{*scheduleSeed}
+	}
+	seeds := make([]int64, *scheduleCount)
+	for i := range seeds {
+		seeds[i] = int64(i)
+	}
+	return seeds
+}
+
+// runSchedule starts from a small tree of order 3 and has three goroutines
+// insert, delete and find overlapping ranges of keys, so that their splits
+// and merges reach the same internal nodes, under the schedule for seed. It
+// then checks that the tree holds what it should, is well formed and has no
+// latches left held. It returns the schedule's trace.
+func runSchedule(seed int64) ([]int, error) {
+	const workers = 3
+	const keys = 48
+	tree := NewTreeOf[int, []byte](tree_api.WithOrder(3)).(*CrabTree)
+	want := make(map[int]bool)
+	for k := 0; k < keys; k += 2 {
+		tree.Insert(k, []byte(fmt.Sprint(k)))
+		want[k] = true
+	}
+
+	// Worker w owns the keys k with k%workers == w: it inserts the odd ones
+	// and deletes the even ones, and looks up the keys of the next worker.
+	fns := []func(){}
+	errs := make([]error, workers)
+	for w := 0; w < workers; w++ {
+		w := w
+		fns = append(fns, func() {
+			for k := w; k < keys; k += workers {
+				var err error
+				if k%2 == 1 {
+					err = tree.Insert(k, []byte(fmt.Sprint(k)))
+				} else {
+					err = tree.Delete(k)
+				}
+				if err != nil && errs[w] == nil {
+					errs[w] = fmt.Errorf("worker %d, key %d: %w", w, k, err)
+				}
+				tree.Find((k+1)%keys, false)
+			}
+		})
+		for k := w; k < keys; k += workers {
+			want[k] = k%2 == 1
+		}
+	}
+
+	sched := newRandomScheduler(seed, 100000)
+	tree.sched = sched
+	if err := sched.Run(fns...); err != nil {
+		return sched.trace, err
+	}
+	tree.sched = nil
+	if err := errors.Join(errs...); err != nil {
+		return sched.trace, err
+	}
+
+	if err := checkUnlatched(tree); err != nil {
+		return sched.trace, err
+	}
+	if err := tree.Validate(); err != nil {
+		return sched.trace, err
+	}
+	res, _ := tree.Range(math.MinInt, math.MaxInt)
+	got := []int{}
+	for _, kr := range res {
+		got = append(got, kr.Key)
+	}
+	expected := []int{}
+	for k := 0; k < keys; k++ {
+		if want[k] {
+			expected = append(expected, k)
+		}
+	}
+	if !slices.Equal(got, expected) {
+		return sched.trace, fmt.Errorf("tree holds %v, expected %v", got, expected)
+	}
+	return sched.trace, nil
+}
+
+// checkUnlatched fails if any latch in the tree is still held.
+func checkUnlatched(tree *CrabTree) error {
+	if !tree.lock.TryLock() {
+		return errors.New("the tree latch is still held")
+	}
+	tree.lock.Unlock()
+	var check func(n *Node, path string) error
+	check = func(n *Node, path string) error {
+		if !n.lock.TryLock() {
+			return fmt.Errorf("the latch of node %s is still held", path)
+		}
+		n.lock.Unlock()
+		if n.IsLeaf {
+			return nil
+		}
+		for i := 0; i <= n.NumKeys; i++ {
+			child, _ := n.Pointers[i].(*Node)
+			if err := check(child, fmt.Sprint(path, " -> ", i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if tree.Root == nil {
+		return nil
+	}
+	return check(tree.Root, "root")
+}
+
+func TestScheduledInsertDelete(t *testing.T) {
+	for _, seed := range seeds() {
+		if _, err := runSchedule(seed); err != nil {
+			t.Fatalf("seed %d: %s\nreplay with: go test ./crab -run TestScheduledInsertDelete -crab.seed=%d", seed, err, seed)
+		}
+	}
+}
+
+func TestScheduleReplays(t *testing.T) {
+	first, err := runSchedule(7)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	second, err := runSchedule(7)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if !slices.Equal(first, second) {
+		t.Errorf("the same seed gave two different schedules")
+	}
+}
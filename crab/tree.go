@@ -2,72 +2,114 @@ package crab
 
 // Modified from https://github.com/collinglass/bptree
 import (
+	"cmp"
 	"errors"
 	"fmt"
 	"main/tree_api"
-	"reflect"
 	"sync"
 )
 
-var (
-	err error
-
+const (
 	defaultOrder = 4
 	minOrder     = 3
-	maxOrder     = 20
+	maxOrder     = 512
+)
+
+var (
+	err error
 
-	order          = defaultOrder
-	queue          *Node
 	verbose_output = false
 	version        = 0.1
 )
 
-type CrabTree struct {
-	Root *Node
-	lock sync.Mutex
+type CrabTreeOf[K cmp.Ordered, V any] struct {
+	Root  *NodeOf[K, V]
+	lock  sync.RWMutex
+	order int
+	sched scheduler // nil outside of scheduled tests
+	debug latchDebugOf[K, V]
+	stats restartCounters
+
+	// exclusiveReads makes finds and scans take exclusive latches, as they
+	// did before shared latches, so that benchmarks can compare the two.
+	exclusiveReads bool
 }
 
-type Node struct {
+type CrabTree = CrabTreeOf[int, []byte]
+
+type NodeOf[K cmp.Ordered, V any] struct {
 	Pointers []interface{}
-	Keys     []int
-	Parent   *Node
+	Keys     []K
+	Parent   *NodeOf[K, V]
 	IsLeaf   bool
 	NumKeys  int
-	Next     *Node
-	lock     sync.Mutex
+	Next     *NodeOf[K, V]
+	lock     sync.RWMutex
 }
 
-func NewTree() tree_api.BPTree {
-	return &CrabTree{}
+type Node = NodeOf[int, []byte]
+
+func NewTree(opts ...tree_api.Option) tree_api.BPTree {
+	return NewTreeOf[int, []byte](opts...)
 }
 
-func (t *CrabTree) Insert(key int, value []byte) error {
-	// fmt.Println("Insert key", key, "value", value)
-	t.lock.Lock()
+func NewTreeOf[K cmp.Ordered, V any](opts ...tree_api.Option) tree_api.TreeOf[K, V] {
+	o, err := tree_api.BuildOptions(defaultOrder, minOrder, maxOrder, opts)
+	if err != nil {
+		panic(err)
+	}
+	return &CrabTreeOf[K, V]{order: o.Order}
+}
 
-	var pointer *tree_api.Record
-	var leaf *Node
+func (t *CrabTreeOf[K, V]) Order() int {
+	return t.order
+}
 
-	// Removed for benchmarking purposes – we assume there are no duplicates in
-	// the input
-	// if _, err := t.Find(key, false); err == nil {
-	// 	return errors.New("key already exists")
-	// }
+func (t *CrabTreeOf[K, V]) Insert(key K, value V) error {
+	defer t.debug.operation("Insert")()
+	return t.insert(key, value, false)
+}
+
+// Upsert inserts key, or replaces its record if it is already present.
+func (t *CrabTreeOf[K, V]) Upsert(key K, value V) error {
+	defer t.debug.operation("Upsert")()
+	return t.insert(key, value, true)
+}
+
+// insert first tries insertOptimistic, and if the leaf for key is full crabs
+// down again as for an insertion, holding exclusive latches on every node a
+// split could reach. The duplicate check happens on the latched leaf, so it
+// costs no extra traversal: an existing key is either rejected or, when
+// replace is set, given a new record.
+func (t *CrabTreeOf[K, V]) insert(key K, value V, replace bool) error {
+	var leaf *NodeOf[K, V]
 
 	pointer, err := makeRecord(value)
 	if err != nil {
-		defer t.lock.Unlock()
+		return err
+	}
+	if done, err := t.insertOptimistic(key, pointer, replace); done {
 		return err
 	}
 
+	t.lockTree()
 	if t.Root == nil {
-		defer t.lock.Unlock()
+		defer t.unlockTree()
 		return t.startNewTree(key, pointer)
 	}
 
 	leaf, treeLocked, lockList := t.findLeafForInsert(key, false)
 
-	if leaf.NumKeys < order-1 {
+	if i := leafIndex(leaf, key); i >= 0 {
+		defer t.clearLockList(treeLocked, lockList)
+		if !replace {
+			return tree_api.ErrKeyExists
+		}
+		leaf.Pointers[i] = pointer
+		return nil
+	}
+
+	if leaf.NumKeys < t.order-1 {
 		if treeLocked {
 			panic("tree is locked but child is safe")
 		}
@@ -75,18 +117,59 @@ func (t *CrabTree) Insert(key int, value []byte) error {
 			panic("lock list is not empty but child is safe")
 		}
 		insertIntoLeaf(leaf, key, pointer)
-		leaf.lock.Unlock()
+		t.unlatch(leaf)
 		return nil
 	}
 	defer t.clearLockList(treeLocked, lockList)
 	return t.insertIntoLeafAfterSplitting(leaf, key, pointer)
 }
 
-func (t *CrabTree) find(key int, verbose bool) (*tree_api.Record, error) {
+// Update replaces the record of an existing key.
+func (t *CrabTreeOf[K, V]) Update(key K, value V) error {
+	defer t.debug.operation("Update")()
+	_, err := t.swap(key, nil, value, false)
+	return err
+}
+
+// CompareAndSwap replaces the record of key if it is still old.
+func (t *CrabTreeOf[K, V]) CompareAndSwap(key K, old *tree_api.RecordOf[V], new V) (bool, error) {
+	defer t.debug.operation("CompareAndSwap")()
+	return t.swap(key, old, new, true)
+}
+
+// swap gives an existing key a new record while holding only its leaf latch
+// exclusively, since the shape of the tree doesn't change. With compare set it only does so
+// if the current record is old.
+func (t *CrabTreeOf[K, V]) swap(key K, old *tree_api.RecordOf[V], value V, compare bool) (bool, error) {
+	pointer, err := makeRecord(value)
+	if err != nil {
+		return false, err
+	}
+
+	t.rlockTree()
+	if t.Root == nil {
+		t.runlockTree()
+		return false, tree_api.ErrKeyNotFound
+	}
+	leaf := t.findLeaf(key, true, false)
+	defer t.unlatch(leaf)
+
+	i := leafIndex(leaf, key)
+	if i < 0 {
+		return false, tree_api.ErrKeyNotFound
+	}
+	if compare && leaf.Pointers[i] != old {
+		return false, nil
+	}
+	leaf.Pointers[i] = pointer
+	return true, nil
+}
+
+func (t *CrabTreeOf[K, V]) find(key K, verbose bool) (*tree_api.RecordOf[V], error) {
 	i := 0
-	c := t.findLeaf(key, verbose)
+	c := t.findLeaf(key, false, verbose)
 	if c == nil {
-		return nil, errors.New("key not found")
+		return nil, tree_api.ErrKeyNotFound
 	}
 	for i = 0; i < c.NumKeys; i++ {
 		if c.Keys[i] == key {
@@ -94,20 +177,21 @@ func (t *CrabTree) find(key int, verbose bool) (*tree_api.Record, error) {
 		}
 	}
 	if i == c.NumKeys {
-		return nil, errors.New("key not found")
+		t.runlatch(c)
+		return nil, tree_api.ErrKeyNotFound
 	}
 
-	r, _ := c.Pointers[i].(*tree_api.Record)
-	c.lock.Unlock()
+	r, _ := c.Pointers[i].(*tree_api.RecordOf[V])
+	t.runlatch(c)
 
 	return r, nil
 }
 
-func (t *CrabTree) findForDelete(key int, verbose bool) (*tree_api.Record, *Node, bool, []*Node, error) {
+func (t *CrabTreeOf[K, V]) findForDelete(key K, verbose bool) (*tree_api.RecordOf[V], *NodeOf[K, V], bool, []*NodeOf[K, V], error) {
 	i := 0
 	c, treeLocked, lockList := t.findLeafForDelete(key, verbose)
 	if c == nil {
-		return nil, nil, treeLocked, lockList, errors.New("key not found")
+		return nil, nil, treeLocked, lockList, tree_api.ErrKeyNotFound
 	}
 	for i = 0; i < c.NumKeys; i++ {
 		if c.Keys[i] == key {
@@ -115,17 +199,21 @@ func (t *CrabTree) findForDelete(key int, verbose bool) (*tree_api.Record, *Node
 		}
 	}
 	if i == c.NumKeys {
-		return nil, nil, treeLocked, lockList, errors.New("key not found")
+		return nil, nil, treeLocked, lockList, tree_api.ErrKeyNotFound
 	}
 
-	r, _ := c.Pointers[i].(*tree_api.Record)
+	r, _ := c.Pointers[i].(*tree_api.RecordOf[V])
 
 	return r, c, treeLocked, lockList, nil
 }
 
-func (t *CrabTree) Find(key int, verbose bool) (*tree_api.Record, error) {
-	t.lock.Lock()
-	// defer t.lock.Unlock()
+func (t *CrabTreeOf[K, V]) Find(key K, verbose bool) (*tree_api.RecordOf[V], error) {
+	defer t.debug.operation("Find")()
+	t.rlockTree()
+	if t.Root == nil {
+		t.runlockTree()
+		return nil, tree_api.ErrKeyNotFound
+	}
 	res, err := t.find(key, verbose)
 	// if err != nil {
 	// 	fmt.Println("Find key", key)
@@ -133,37 +221,50 @@ func (t *CrabTree) Find(key int, verbose bool) (*tree_api.Record, error) {
 	return res, err
 }
 
-func (t *CrabTree) FindAndPrint(key int, verbose bool) {
+func (t *CrabTreeOf[K, V]) FindAndPrint(key K, verbose bool) {
+	defer t.debug.operation("FindAndPrint")()
 	r, err := t.Find(key, verbose)
 
 	if err != nil || r == nil {
-		fmt.Printf("Record not found under key %d.\n", key)
+		fmt.Printf("Record not found under key %v.\n", key)
 	} else {
-		fmt.Printf("Record at %d -- key %d, value %s.\n", r, key, r.Value)
+		fmt.Printf("Record at %p -- key %v, value %s.\n", r, key, tree_api.FormatValue(r.Value))
 	}
 }
 
-func (t *CrabTree) FindAndPrintRange(key_start, key_end int, verbose bool) {
-	var i int
-	array_size := key_end - key_start + 1
-	returned_keys := make([]int, array_size)
-	returned_pointers := make([]interface{}, array_size)
-	num_found := t.findRange(key_start, key_end, verbose, returned_keys, returned_pointers)
-	if num_found == 0 {
+func (t *CrabTreeOf[K, V]) FindAndPrintRange(key_start, key_end K, verbose bool) {
+	defer t.debug.operation("FindAndPrintRange")()
+	results := t.findRange(key_start, key_end, 0, verbose)
+	if len(results) == 0 {
 		fmt.Println("None found,")
 	} else {
-		for i = 0; i < num_found; i++ {
-			c, _ := returned_pointers[i].(*tree_api.Record)
-			fmt.Printf("Key: %d  Location: %d  Value: %s\n",
-				returned_keys[i],
-				returned_pointers[i],
-				c.Value)
+		for _, kr := range results {
+			fmt.Printf("Key: %v  Location: %p  Value: %s\n",
+				kr.Key,
+				kr.Record,
+				tree_api.FormatValue(kr.Record.Value))
 		}
 	}
 }
 
-func (t *CrabTree) PrintTree() {
-	var n *Node
+func (t *CrabTreeOf[K, V]) Range(key_start, key_end K) ([]tree_api.KeyRecordOf[K, V], error) {
+	defer t.debug.operation("Range")()
+	return t.RangeLimit(key_start, key_end, 0, false)
+}
+
+func (t *CrabTreeOf[K, V]) RangeLimit(key_start, key_end K, limit int, reverse bool) ([]tree_api.KeyRecordOf[K, V], error) {
+	defer t.debug.operation("RangeLimit")()
+	if key_start > key_end {
+		return nil, tree_api.ErrInvalidRange
+	}
+	if reverse {
+		return t.findRangeReverse(key_start, key_end, limit), nil
+	}
+	return t.findRange(key_start, key_end, limit, false), nil
+}
+
+func (t *CrabTreeOf[K, V]) PrintTree() {
+	var n *NodeOf[K, V]
 	i := 0
 	rank := 0
 	new_rank := 0
@@ -172,10 +273,10 @@ func (t *CrabTree) PrintTree() {
 		fmt.Printf("Empty tree.\n")
 		return
 	}
-	queue = nil
-	enqueue(t.Root)
+	var queue *NodeOf[K, V]
+	enqueue(&queue, t.Root)
 	for queue != nil {
-		n = dequeue()
+		n = dequeue(&queue)
 		if n != nil {
 			if n.Parent != nil && n == n.Parent.Pointers[0] {
 				new_rank = t.pathToRoot(n)
@@ -190,17 +291,17 @@ func (t *CrabTree) PrintTree() {
 				if verbose_output {
 					fmt.Printf("%d ", n.Pointers[i])
 				}
-				fmt.Printf("%d ", n.Keys[i])
+				fmt.Printf("%v ", n.Keys[i])
 			}
 			if !n.IsLeaf {
 				for i = 0; i <= n.NumKeys; i++ {
-					c, _ := n.Pointers[i].(*Node)
-					enqueue(c)
+					c, _ := n.Pointers[i].(*NodeOf[K, V])
+					enqueue(&queue, c)
 				}
 			}
 			if verbose_output {
 				if n.IsLeaf {
-					fmt.Printf("%d ", n.Pointers[order-1])
+					fmt.Printf("%d ", n.Pointers[t.order-1])
 				} else {
 					fmt.Printf("%d ", n.Pointers[n.NumKeys])
 				}
@@ -211,7 +312,7 @@ func (t *CrabTree) PrintTree() {
 	fmt.Printf("\n")
 }
 
-func (t *CrabTree) PrintLeaves() {
+func (t *CrabTreeOf[K, V]) PrintLeaves() {
 	if t.Root == nil {
 		fmt.Printf("Empty tree.\n")
 		return
@@ -220,7 +321,7 @@ func (t *CrabTree) PrintLeaves() {
 	var i int
 	c := t.Root
 	for !c.IsLeaf {
-		c, _ = c.Pointers[0].(*Node)
+		c, _ = c.Pointers[0].(*NodeOf[K, V])
 	}
 
 	for {
@@ -228,14 +329,14 @@ func (t *CrabTree) PrintLeaves() {
 			if verbose_output {
 				fmt.Printf("%d ", c.Pointers[i])
 			}
-			fmt.Printf("%d ", c.Keys[i])
+			fmt.Printf("%v ", c.Keys[i])
 		}
 		if verbose_output {
-			fmt.Printf("%d ", c.Pointers[order-1])
+			fmt.Printf("%d ", c.Pointers[t.order-1])
 		}
-		if c.Pointers[order-1] != nil {
+		if c.Pointers[t.order-1] != nil {
 			fmt.Printf(" | ")
-			c, _ = c.Pointers[order-1].(*Node)
+			c, _ = c.Pointers[t.order-1].(*NodeOf[K, V])
 		} else {
 			break
 		}
@@ -243,12 +344,19 @@ func (t *CrabTree) PrintLeaves() {
 	fmt.Printf("\n")
 }
 
-func (t *CrabTree) Delete(key int) error {
-	t.lock.Lock()
+// Delete removes key. It first tries deleteOptimistic, and if the leaf would
+// underflow crabs down again holding exclusive latches on every node a merge
+// could reach.
+func (t *CrabTreeOf[K, V]) Delete(key K) error {
+	defer t.debug.operation("Delete")()
+	if done, err := t.deleteOptimistic(key); done {
+		return err
+	}
+	t.lockTree()
 	// defer t.lock.Unlock()
 	if t.Root == nil {
-		t.lock.Unlock()
-		return errors.New("empty tree")
+		t.unlockTree()
+		return tree_api.ErrKeyNotFound
 	}
 	key_record, key_leaf, treeLocked, lockList, err := t.findForDelete(key, false)
 
@@ -264,13 +372,13 @@ func (t *CrabTree) Delete(key int) error {
 }
 
 // Private Functions
-func enqueue(new_node *Node) {
-	var c *Node
-	if queue == nil {
-		queue = new_node
-		queue.Next = nil
+func enqueue[K cmp.Ordered, V any](queue **NodeOf[K, V], new_node *NodeOf[K, V]) {
+	var c *NodeOf[K, V]
+	if *queue == nil {
+		*queue = new_node
+		new_node.Next = nil
 	} else {
-		c = queue
+		c = *queue
 		for c.Next != nil {
 			c = c.Next
 		}
@@ -279,24 +387,24 @@ func enqueue(new_node *Node) {
 	}
 }
 
-func dequeue() *Node {
-	n := queue
-	queue = queue.Next
+func dequeue[K cmp.Ordered, V any](queue **NodeOf[K, V]) *NodeOf[K, V] {
+	n := *queue
+	*queue = n.Next
 	n.Next = nil
 	return n
 }
 
-func (t *CrabTree) height() int {
+func (t *CrabTreeOf[K, V]) height() int {
 	h := 0
 	c := t.Root
 	for !c.IsLeaf {
-		c, _ = c.Pointers[0].(*Node)
+		c, _ = c.Pointers[0].(*NodeOf[K, V])
 		h++
 	}
 	return h
 }
 
-func (t *CrabTree) pathToRoot(child *Node) int {
+func (t *CrabTreeOf[K, V]) pathToRoot(child *NodeOf[K, V]) int {
 	length := 0
 	c := child
 	for c != t.Root {
@@ -306,50 +414,151 @@ func (t *CrabTree) pathToRoot(child *Node) int {
 	return length
 }
 
-func (t *CrabTree) findRange(key_start, key_end int, verbose bool, returned_keys []int, returned_pointers []interface{}) int {
+func (t *CrabTreeOf[K, V]) findRange(key_start, key_end K, limit int, verbose bool) []tree_api.KeyRecordOf[K, V] {
 	var i int
-	num_found := 0
+	results := []tree_api.KeyRecordOf[K, V]{}
 
-	n := t.findLeaf(key_start, verbose)
-	if n == nil {
-		return 0
+	t.rlockTree()
+	if t.Root == nil {
+		t.runlockTree()
+		return results
 	}
+	// findLeaf releases the tree lock and hands back the leaf latched
+	n := t.findLeaf(key_start, false, verbose)
 	for i = 0; i < n.NumKeys && n.Keys[i] < key_start; i++ {
-		if i == n.NumKeys { // could be wrong
-			return 0
+	}
+	for {
+		for ; i < n.NumKeys; i++ {
+			if n.Keys[i] > key_end || (limit > 0 && len(results) == limit) {
+				t.runlatch(n)
+				return results
+			}
+			r, _ := n.Pointers[i].(*tree_api.RecordOf[V])
+			results = append(results, tree_api.KeyRecordOf[K, V]{Key: n.Keys[i], Record: r})
+		}
+		next, _ := n.Pointers[t.order-1].(*NodeOf[K, V])
+		if next == nil {
+			t.runlatch(n)
+			return results
 		}
+		// Latch coupling along the leaf chain: latch the sibling before letting
+		// go of the current leaf so a concurrent split or merge can't slip in
+		// between them.
+		t.rlatch(next)
+		t.runlatch(n)
+		n = next
+		i = 0
 	}
+}
+
+// findRangeReverse collects the keys in [key_start, key_end] from the top
+// down, stopping after limit of them. There are no back pointers between
+// leaves, and latching leftwards could deadlock with a forward scan, so each
+// step back to the previous leaf lets go of the current one and descends from
+// the root again.
+func (t *CrabTreeOf[K, V]) findRangeReverse(key_start, key_end K, limit int) []tree_api.KeyRecordOf[K, V] {
+	results := []tree_api.KeyRecordOf[K, V]{}
+
+	n, i := t.findLast(key_end, true)
 	for n != nil {
-		for i = i; i < n.NumKeys && n.Keys[i] <= key_end; i++ {
-			returned_keys[num_found] = n.Keys[i]
-			returned_pointers[num_found] = n.Pointers[i]
-			num_found += 1
+		if n.Keys[i] < key_start || (limit > 0 && len(results) == limit) {
+			t.runlatch(n)
+			return results
 		}
-		n, _ = n.Pointers[order-1].(*Node)
-		i = 0
+		r, _ := n.Pointers[i].(*tree_api.RecordOf[V])
+		results = append(results, tree_api.KeyRecordOf[K, V]{Key: n.Keys[i], Record: r})
+		if i > 0 {
+			i -= 1
+			continue
+		}
+		key := n.Keys[0]
+		t.runlatch(n)
+		n, i = t.findLast(key, false)
 	}
-	return num_found
+	return results
 }
 
-func (t *CrabTree) clearLockList(treeLocked bool, lockList []*Node) []*Node {
+// descend crabs from the root to a leaf with shared latches, taking the child
+// chosen by pick at each level, and returns the leaf latched (or nil for an
+// empty tree).
+func (t *CrabTreeOf[K, V]) descend(pick func(c *NodeOf[K, V]) int) *NodeOf[K, V] {
+	t.rlockTree()
+	c := t.Root
+	if c == nil {
+		t.runlockTree()
+		return nil
+	}
+	t.rlatch(c)
+	t.runlockTree()
+	for !c.IsLeaf {
+		child, _ := c.Pointers[pick(c)].(*NodeOf[K, V])
+		t.rlatch(child)
+		t.runlatch(c)
+		c = child
+	}
+	return c
+}
+
+// findLast returns the latched leaf and index holding the largest key
+// strictly less than key, or at most key if inclusive. The descent routes key
+// the same way, and if the leaf it lands on has nothing that qualifies the
+// predecessor must lie below the leaf's lower separator, so we retry from
+// there.
+func (t *CrabTreeOf[K, V]) findLast(key K, inclusive bool) (*NodeOf[K, V], int) {
+	var low K
+	var bounded bool
+
+	below := func(k K) bool {
+		return k < key || (inclusive && k == key)
+	}
+	for {
+		bounded = false
+		c := t.descend(func(c *NodeOf[K, V]) int {
+			i := 0
+			for i < c.NumKeys && below(c.Keys[i]) {
+				i += 1
+			}
+			if i > 0 {
+				low = c.Keys[i-1]
+				bounded = true
+			}
+			return i
+		})
+		if c == nil {
+			return nil, 0
+		}
+		for i := c.NumKeys - 1; i >= 0; i-- {
+			if below(c.Keys[i]) {
+				return c, i
+			}
+		}
+		t.runlatch(c)
+		if !bounded {
+			return nil, 0
+		}
+		key, inclusive = low, false
+	}
+}
+
+func (t *CrabTreeOf[K, V]) clearLockList(treeLocked bool, lockList []*NodeOf[K, V]) []*NodeOf[K, V] {
 	if treeLocked {
-		t.lock.Unlock()
+		t.unlockTree()
 	}
 	for _, node := range lockList {
-		node.lock.Unlock()
+		t.unlatch(node)
 	}
-	return []*Node{}
+	return []*NodeOf[K, V]{}
 }
 
-func (t *CrabTree) findLeafForInsert(key int, verbose bool) (*Node, bool, []*Node) {
+func (t *CrabTreeOf[K, V]) findLeafForInsert(key K, verbose bool) (*NodeOf[K, V], bool, []*NodeOf[K, V]) {
 	i := 0
 	c := t.Root
-	lockList := []*Node{}
-	c.lock.Lock()
+	lockList := []*NodeOf[K, V]{}
+	t.latch(c)
 	treeLocked := true
 	lockList = append(lockList, c)
-	if c.NumKeys < order-1 {
-		t.lock.Unlock()
+	if c.NumKeys < t.order-1 {
+		t.unlockTree()
 		treeLocked = false
 		// No need to maintain tree lock, the root will not split
 	}
@@ -357,9 +566,9 @@ func (t *CrabTree) findLeafForInsert(key int, verbose bool) (*Node, bool, []*Nod
 		if verbose {
 			fmt.Printf("[")
 			for i = 0; i < c.NumKeys-1; i++ {
-				fmt.Printf("%d ", c.Keys[i])
+				fmt.Printf("%v ", c.Keys[i])
 			}
-			fmt.Printf("%d]", c.Keys[i])
+			fmt.Printf("%v]", c.Keys[i])
 		}
 		i = 0
 		for i < c.NumKeys {
@@ -372,9 +581,9 @@ func (t *CrabTree) findLeafForInsert(key int, verbose bool) (*Node, bool, []*Nod
 		if verbose {
 			fmt.Printf("%d ->\n", i)
 		}
-		c, _ = c.Pointers[i].(*Node)
-		c.lock.Lock()
-		if c.NumKeys < order-1 {
+		c, _ = c.Pointers[i].(*NodeOf[K, V])
+		t.latch(c)
+		if c.NumKeys < t.order-1 {
 			lockList = t.clearLockList(treeLocked, lockList)
 			treeLocked = false
 		}
@@ -383,25 +592,29 @@ func (t *CrabTree) findLeafForInsert(key int, verbose bool) (*Node, bool, []*Nod
 	if verbose {
 		fmt.Printf("Leaf [")
 		for i = 0; i < c.NumKeys-1; i++ {
-			fmt.Printf("%d ", c.Keys[i])
+			fmt.Printf("%v ", c.Keys[i])
 		}
-		fmt.Printf("%d] ->\n", c.Keys[i])
+		fmt.Printf("%v] ->\n", c.Keys[i])
 	}
 	return c, treeLocked, lockList
 }
 
-func (t *CrabTree) findLeaf(key int, verbose bool) *Node {
+// findLeaf crabs down to the leaf for key with shared latches, starting from
+// the shared tree latch its caller holds, and returns the leaf latched. The
+// leaf's latch is exclusive if exclusiveLeaf is set, so that the caller can
+// change the records in it, and shared otherwise.
+func (t *CrabTreeOf[K, V]) findLeaf(key K, exclusiveLeaf bool, verbose bool) *NodeOf[K, V] {
 	i := 0
 	c := t.Root
-	c.lock.Lock()
-	t.lock.Unlock()
+	t.latchFor(c, exclusiveLeaf)
+	t.runlockTree()
 	for !c.IsLeaf {
 		if verbose {
 			fmt.Printf("[")
 			for i = 0; i < c.NumKeys-1; i++ {
-				fmt.Printf("%d ", c.Keys[i])
+				fmt.Printf("%v ", c.Keys[i])
 			}
-			fmt.Printf("%d]", c.Keys[i])
+			fmt.Printf("%v]", c.Keys[i])
 		}
 		i = 0
 		for i < c.NumKeys {
@@ -414,35 +627,49 @@ func (t *CrabTree) findLeaf(key int, verbose bool) *Node {
 		if verbose {
 			fmt.Printf("%d ->\n", i)
 		}
-		c, _ = c.Pointers[i].(*Node)
-		c.lock.Lock()
-		c.Parent.lock.Unlock()
+		// Release the node we latched rather than c.Parent: a split or
+		// merge elsewhere may already have given c a new parent.
+		parent := c
+		c, _ = c.Pointers[i].(*NodeOf[K, V])
+		t.latchFor(c, exclusiveLeaf)
+		t.runlatch(parent)
 	}
 	if verbose {
 		fmt.Printf("Leaf [")
 		for i = 0; i < c.NumKeys-1; i++ {
-			fmt.Printf("%d ", c.Keys[i])
+			fmt.Printf("%v ", c.Keys[i])
 		}
-		fmt.Printf("%d] ->\n", c.Keys[i])
+		fmt.Printf("%v] ->\n", c.Keys[i])
 	}
 	return c
 }
 
-func (t *CrabTree) findLeafForDelete(key int, verbose bool) (*Node, bool, []*Node) {
+// latchFor latches n on the way down findLeaf: exclusively if it is a leaf and
+// exclusiveLeaf is set, and shared otherwise. A node never changes between
+// leaf and internal, so IsLeaf can be read before its latch is held.
+func (t *CrabTreeOf[K, V]) latchFor(n *NodeOf[K, V], exclusiveLeaf bool) {
+	if n.IsLeaf && exclusiveLeaf {
+		t.latch(n)
+	} else {
+		t.rlatch(n)
+	}
+}
+
+func (t *CrabTreeOf[K, V]) findLeafForDelete(key K, verbose bool) (*NodeOf[K, V], bool, []*NodeOf[K, V]) {
 	i := 0
 	c := t.Root
-	lockList := []*Node{}
-	c.lock.Lock()
+	lockList := []*NodeOf[K, V]{}
+	t.latch(c)
 	treeLocked := true
 	lockList = append(lockList, c)
 	var min_keys int
 	if c.IsLeaf {
-		min_keys = cut(order - 1)
+		min_keys = cut(t.order - 1)
 	} else {
-		min_keys = cut(order) - 1
+		min_keys = cut(t.order) - 1
 	}
 	if c.NumKeys > min_keys {
-		t.lock.Unlock()
+		t.unlockTree()
 		treeLocked = false
 		// No need to maintain tree lock, the root will not merge
 
@@ -451,9 +678,9 @@ func (t *CrabTree) findLeafForDelete(key int, verbose bool) (*Node, bool, []*Nod
 		if verbose {
 			fmt.Printf("[")
 			for i = 0; i < c.NumKeys-1; i++ {
-				fmt.Printf("%d ", c.Keys[i])
+				fmt.Printf("%v ", c.Keys[i])
 			}
-			fmt.Printf("%d]", c.Keys[i])
+			fmt.Printf("%v]", c.Keys[i])
 		}
 		i = 0
 		for i < c.NumKeys {
@@ -466,25 +693,42 @@ func (t *CrabTree) findLeafForDelete(key int, verbose bool) (*Node, bool, []*Nod
 		if verbose {
 			fmt.Printf("%d ->\n", i)
 		}
-		c, _ = c.Pointers[i].(*Node)
-		c.lock.Lock()
+		parent := c
+		c, _ = c.Pointers[i].(*NodeOf[K, V])
+		t.latch(c)
 		if c.IsLeaf {
-			min_keys = cut(order - 1)
+			min_keys = cut(t.order - 1)
 		} else {
-			min_keys = cut(order) - 1
+			min_keys = cut(t.order) - 1
 		}
 		if c.NumKeys > min_keys {
 			lockList = t.clearLockList(treeLocked, lockList)
 			treeLocked = false
+			lockList = append(lockList, c)
+			continue
+		}
+		// c may underflow and then borrow from or merge with the sibling
+		// deleteEntry picks, so that sibling is latched as well. Latches on
+		// one level are taken left to right, as scans along the leaf chain
+		// take them, so a left sibling must be latched before c.
+		if i > 0 {
+			t.unlatch(c)
+			left, _ := parent.Pointers[i-1].(*NodeOf[K, V])
+			t.latch(left)
+			t.latch(c)
+			lockList = append(lockList, left, c)
+		} else {
+			right, _ := parent.Pointers[1].(*NodeOf[K, V])
+			t.latch(right)
+			lockList = append(lockList, c, right)
 		}
-		lockList = append(lockList, c)
 	}
 	if verbose {
 		fmt.Printf("Leaf [")
 		for i = 0; i < c.NumKeys-1; i++ {
-			fmt.Printf("%d ", c.Keys[i])
+			fmt.Printf("%v ", c.Keys[i])
 		}
-		fmt.Printf("%d] ->\n", c.Keys[i])
+		fmt.Printf("%v] ->\n", c.Keys[i])
 	}
 	return c, treeLocked, lockList
 }
@@ -498,8 +742,8 @@ func cut(length int) int {
 }
 
 // INSERTION
-func makeRecord(value []byte) (*tree_api.Record, error) {
-	new_record := new(tree_api.Record)
+func makeRecord[V any](value V) (*tree_api.RecordOf[V], error) {
+	new_record := new(tree_api.RecordOf[V])
 	if new_record == nil {
 		return nil, errors.New("Error: Record creation.")
 	} else {
@@ -508,16 +752,16 @@ func makeRecord(value []byte) (*tree_api.Record, error) {
 	return new_record, nil
 }
 
-func makeNode() (*Node, error) {
-	new_node := new(Node)
+func (t *CrabTreeOf[K, V]) makeNode() (*NodeOf[K, V], error) {
+	new_node := new(NodeOf[K, V])
 	if new_node == nil {
 		return nil, errors.New("Error: Node creation.")
 	}
-	new_node.Keys = make([]int, order-1)
+	new_node.Keys = make([]K, t.order-1)
 	if new_node.Keys == nil {
 		return nil, errors.New("Error: New node keys array.")
 	}
-	new_node.Pointers = make([]interface{}, order)
+	new_node.Pointers = make([]interface{}, t.order)
 	if new_node.Keys == nil {
 		return nil, errors.New("Error: New node pointers array.")
 	}
@@ -528,8 +772,8 @@ func makeNode() (*Node, error) {
 	return new_node, nil
 }
 
-func makeLeaf() (*Node, error) {
-	leaf, err := makeNode()
+func (t *CrabTreeOf[K, V]) makeLeaf() (*NodeOf[K, V], error) {
+	leaf, err := t.makeNode()
 	if err != nil {
 		return nil, err
 	}
@@ -537,7 +781,17 @@ func makeLeaf() (*Node, error) {
 	return leaf, nil
 }
 
-func getLeftIndex(parent, left *Node) int {
+// leafIndex returns the index of key in leaf, or -1 if it is absent.
+func leafIndex[K cmp.Ordered, V any](leaf *NodeOf[K, V], key K) int {
+	for i := 0; i < leaf.NumKeys; i++ {
+		if leaf.Keys[i] == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func getLeftIndex[K cmp.Ordered, V any](parent, left *NodeOf[K, V]) int {
 	left_index := 0
 	for left_index <= parent.NumKeys && parent.Pointers[left_index] != left {
 		left_index += 1
@@ -545,7 +799,7 @@ func getLeftIndex(parent, left *Node) int {
 	return left_index
 }
 
-func insertIntoLeaf(leaf *Node, key int, pointer *tree_api.Record) {
+func insertIntoLeaf[K cmp.Ordered, V any](leaf *NodeOf[K, V], key K, pointer *tree_api.RecordOf[V]) {
 	var i, insertion_point int
 
 	for insertion_point < leaf.NumKeys && leaf.Keys[insertion_point] < key {
@@ -562,27 +816,28 @@ func insertIntoLeaf(leaf *Node, key int, pointer *tree_api.Record) {
 	return
 }
 
-func (t *CrabTree) insertIntoLeafAfterSplitting(leaf *Node, key int, pointer *tree_api.Record) error {
-	var new_leaf *Node
-	var insertion_index, split, new_key, i, j int
+func (t *CrabTreeOf[K, V]) insertIntoLeafAfterSplitting(leaf *NodeOf[K, V], key K, pointer *tree_api.RecordOf[V]) error {
+	var new_leaf *NodeOf[K, V]
+	var insertion_index, split, i, j int
+	var new_key K
 	var err error
 
-	new_leaf, err = makeLeaf()
+	new_leaf, err = t.makeLeaf()
 	if err != nil {
 		return nil
 	}
 
-	temp_keys := make([]int, order)
+	temp_keys := make([]K, t.order)
 	if temp_keys == nil {
 		return errors.New("Error: Temporary keys array.")
 	}
 
-	temp_pointers := make([]interface{}, order)
+	temp_pointers := make([]interface{}, t.order)
 	if temp_pointers == nil {
 		return errors.New("Error: Temporary pointers array.")
 	}
 
-	for insertion_index < order-1 && leaf.Keys[insertion_index] < key {
+	for insertion_index < t.order-1 && leaf.Keys[insertion_index] < key {
 		insertion_index += 1
 	}
 
@@ -600,7 +855,7 @@ func (t *CrabTree) insertIntoLeafAfterSplitting(leaf *Node, key int, pointer *tr
 
 	leaf.NumKeys = 0
 
-	split = cut(order - 1)
+	split = cut(t.order - 1)
 
 	for i = 0; i < split; i++ {
 		leaf.Pointers[i] = temp_pointers[i]
@@ -609,20 +864,20 @@ func (t *CrabTree) insertIntoLeafAfterSplitting(leaf *Node, key int, pointer *tr
 	}
 
 	j = 0
-	for i = split; i < order; i++ {
+	for i = split; i < t.order; i++ {
 		new_leaf.Pointers[j] = temp_pointers[i]
 		new_leaf.Keys[j] = temp_keys[i]
 		new_leaf.NumKeys += 1
 		j += 1
 	}
 
-	new_leaf.Pointers[order-1] = leaf.Pointers[order-1]
-	leaf.Pointers[order-1] = new_leaf
+	new_leaf.Pointers[t.order-1] = leaf.Pointers[t.order-1]
+	leaf.Pointers[t.order-1] = new_leaf
 
-	for i = leaf.NumKeys; i < order-1; i++ {
+	for i = leaf.NumKeys; i < t.order-1; i++ {
 		leaf.Pointers[i] = nil
 	}
-	for i = new_leaf.NumKeys; i < order-1; i++ {
+	for i = new_leaf.NumKeys; i < t.order-1; i++ {
 		new_leaf.Pointers[i] = nil
 	}
 
@@ -632,7 +887,7 @@ func (t *CrabTree) insertIntoLeafAfterSplitting(leaf *Node, key int, pointer *tr
 	return t.insertIntoParent(leaf, new_key, new_leaf)
 }
 
-func insertIntoNode(n *Node, left_index, key int, right *Node) {
+func insertIntoNode[K cmp.Ordered, V any](n *NodeOf[K, V], left_index int, key K, right *NodeOf[K, V]) {
 	var i int
 	for i = n.NumKeys; i > left_index; i-- {
 		n.Pointers[i+1] = n.Pointers[i]
@@ -643,19 +898,20 @@ func insertIntoNode(n *Node, left_index, key int, right *Node) {
 	n.NumKeys += 1
 }
 
-func (t *CrabTree) insertIntoNodeAfterSplitting(old_node *Node, left_index, key int, right *Node) error {
-	var i, j, split, k_prime int
-	var new_node, child *Node
-	var temp_keys []int
+func (t *CrabTreeOf[K, V]) insertIntoNodeAfterSplitting(old_node *NodeOf[K, V], left_index int, key K, right *NodeOf[K, V]) error {
+	var i, j, split int
+	var k_prime K
+	var new_node, child *NodeOf[K, V]
+	var temp_keys []K
 	var temp_pointers []interface{}
 	var err error
 
-	temp_pointers = make([]interface{}, order+1)
+	temp_pointers = make([]interface{}, t.order+1)
 	if temp_pointers == nil {
 		return errors.New("Error: Temporary pointers array for splitting nodes.")
 	}
 
-	temp_keys = make([]int, order)
+	temp_keys = make([]K, t.order)
 	if temp_keys == nil {
 		return errors.New("Error: Temporary keys array for splitting nodes.")
 	}
@@ -680,8 +936,8 @@ func (t *CrabTree) insertIntoNodeAfterSplitting(old_node *Node, left_index, key
 	temp_pointers[left_index+1] = right
 	temp_keys[left_index] = key
 
-	split = cut(order)
-	new_node, err = makeNode()
+	split = cut(t.order)
+	new_node, err = t.makeNode()
 	if err != nil {
 		return err
 	}
@@ -694,7 +950,7 @@ func (t *CrabTree) insertIntoNodeAfterSplitting(old_node *Node, left_index, key
 	old_node.Pointers[i] = temp_pointers[i]
 	k_prime = temp_keys[split-1]
 	j = 0
-	for i += 1; i < order; i++ {
+	for i += 1; i < t.order; i++ {
 		new_node.Pointers[j] = temp_pointers[i]
 		new_node.Keys[j] = temp_keys[i]
 		new_node.NumKeys += 1
@@ -703,14 +959,14 @@ func (t *CrabTree) insertIntoNodeAfterSplitting(old_node *Node, left_index, key
 	new_node.Pointers[j] = temp_pointers[i]
 	new_node.Parent = old_node.Parent
 	for i = 0; i <= new_node.NumKeys; i++ {
-		child, _ = new_node.Pointers[i].(*Node)
+		child, _ = new_node.Pointers[i].(*NodeOf[K, V])
 		child.Parent = new_node
 	}
 
 	return t.insertIntoParent(old_node, k_prime, new_node)
 }
 
-func (t *CrabTree) insertIntoParent(left *Node, key int, right *Node) error {
+func (t *CrabTreeOf[K, V]) insertIntoParent(left *NodeOf[K, V], key K, right *NodeOf[K, V]) error {
 	var left_index int
 	parent := left.Parent
 
@@ -719,7 +975,7 @@ func (t *CrabTree) insertIntoParent(left *Node, key int, right *Node) error {
 	}
 	left_index = getLeftIndex(parent, left)
 
-	if parent.NumKeys < order-1 {
+	if parent.NumKeys < t.order-1 {
 		insertIntoNode(parent, left_index, key, right)
 		return nil
 	}
@@ -727,11 +983,12 @@ func (t *CrabTree) insertIntoParent(left *Node, key int, right *Node) error {
 	return t.insertIntoNodeAfterSplitting(parent, left_index, key, right)
 }
 
-func (t *CrabTree) insertIntoNewRoot(left *Node, key int, right *Node) error {
-	t.Root, err = makeNode()
+func (t *CrabTreeOf[K, V]) insertIntoNewRoot(left *NodeOf[K, V], key K, right *NodeOf[K, V]) error {
+	root, err := t.makeNode()
 	if err != nil {
 		return err
 	}
+	t.Root = root
 	t.Root.Keys[0] = key
 	t.Root.Pointers[0] = left
 	t.Root.Pointers[1] = right
@@ -742,24 +999,25 @@ func (t *CrabTree) insertIntoNewRoot(left *Node, key int, right *Node) error {
 	return nil
 }
 
-func (t *CrabTree) startNewTree(key int, pointer *tree_api.Record) error {
-	t.Root, err = makeLeaf()
+func (t *CrabTreeOf[K, V]) startNewTree(key K, pointer *tree_api.RecordOf[V]) error {
+	root, err := t.makeLeaf()
 	if err != nil {
 		return err
 	}
+	t.Root = root
 	t.Root.Keys[0] = key
 	t.Root.Pointers[0] = pointer
-	t.Root.Pointers[order-1] = nil
+	t.Root.Pointers[t.order-1] = nil
 	t.Root.Parent = nil
 	t.Root.NumKeys += 1
 	return nil
 }
 
-func getNeighbourIndex(n *Node) int {
+func getNeighbourIndex[K cmp.Ordered, V any](n *NodeOf[K, V]) int {
 	var i int
 
 	for i = 0; i <= n.Parent.NumKeys; i++ {
-		if reflect.DeepEqual(n.Parent.Pointers[i], n) {
+		if n.Parent.Pointers[i] == interface{}(n) {
 			return i - 1
 		}
 	}
@@ -767,7 +1025,7 @@ func getNeighbourIndex(n *Node) int {
 	return i
 }
 
-func removeEntryFromNode(n *Node, key int, pointer interface{}) *Node {
+func (t *CrabTreeOf[K, V]) removeEntryFromNode(n *NodeOf[K, V], key K, pointer interface{}) *NodeOf[K, V] {
 	var i, num_pointers int
 
 	for n.Keys[i] != key {
@@ -794,11 +1052,11 @@ func removeEntryFromNode(n *Node, key int, pointer interface{}) *Node {
 	n.NumKeys -= 1
 
 	if n.IsLeaf {
-		for i = n.NumKeys; i < order-1; i++ {
+		for i = n.NumKeys; i < t.order-1; i++ {
 			n.Pointers[i] = nil
 		}
 	} else {
-		for i = n.NumKeys + 1; i < order; i++ {
+		for i = n.NumKeys + 1; i < t.order; i++ {
 			n.Pointers[i] = nil
 		}
 	}
@@ -806,15 +1064,15 @@ func removeEntryFromNode(n *Node, key int, pointer interface{}) *Node {
 	return n
 }
 
-func (t *CrabTree) adjustRoot() {
-	var new_root *Node
+func (t *CrabTreeOf[K, V]) adjustRoot() {
+	var new_root *NodeOf[K, V]
 
 	if t.Root.NumKeys > 0 {
 		return
 	}
 
 	if !t.Root.IsLeaf {
-		new_root, _ = t.Root.Pointers[0].(*Node)
+		new_root, _ = t.Root.Pointers[0].(*NodeOf[K, V])
 		new_root.Parent = nil
 	} else {
 		new_root = nil
@@ -824,9 +1082,9 @@ func (t *CrabTree) adjustRoot() {
 	return
 }
 
-func (t *CrabTree) coalesceNodes(n, neighbour *Node, neighbour_index, k_prime int) {
+func (t *CrabTreeOf[K, V]) coalesceNodes(n, neighbour *NodeOf[K, V], neighbour_index int, k_prime K) {
 	var i, j, neighbour_insertion_index, n_end int
-	var tmp *Node
+	var tmp *NodeOf[K, V]
 
 	if neighbour_index == -1 {
 		tmp = n
@@ -852,25 +1110,26 @@ func (t *CrabTree) coalesceNodes(n, neighbour *Node, neighbour_index, k_prime in
 		neighbour.Pointers[i] = n.Pointers[j]
 
 		for i = 0; i < neighbour.NumKeys+1; i++ {
-			tmp, _ = neighbour.Pointers[i].(*Node)
+			tmp, _ = neighbour.Pointers[i].(*NodeOf[K, V])
 			tmp.Parent = neighbour
 		}
 	} else {
 		i = neighbour_insertion_index
 		for j = 0; j < n.NumKeys; j++ {
 			neighbour.Keys[i] = n.Keys[j]
-			n.Pointers[i] = n.Pointers[j]
+			neighbour.Pointers[i] = n.Pointers[j]
 			neighbour.NumKeys += 1
+			i += 1
 		}
-		neighbour.Pointers[order-1] = n.Pointers[order-1]
+		neighbour.Pointers[t.order-1] = n.Pointers[t.order-1]
 	}
 
 	t.deleteEntry(n.Parent, k_prime, n)
 }
 
-func (t *CrabTree) redistributeNodes(n, neighbour *Node, neighbour_index, k_prime_index, k_prime int) {
+func (t *CrabTreeOf[K, V]) redistributeNodes(n, neighbour *NodeOf[K, V], neighbour_index, k_prime_index int, k_prime K) {
 	var i int
-	var tmp *Node
+	var tmp *NodeOf[K, V]
 
 	if neighbour_index != -1 {
 		if !n.IsLeaf {
@@ -882,7 +1141,7 @@ func (t *CrabTree) redistributeNodes(n, neighbour *Node, neighbour_index, k_prim
 		}
 		if !n.IsLeaf { // why the second if !n.IsLeaf
 			n.Pointers[0] = neighbour.Pointers[neighbour.NumKeys]
-			tmp, _ = n.Pointers[0].(*Node)
+			tmp, _ = n.Pointers[0].(*NodeOf[K, V])
 			tmp.Parent = n
 			neighbour.Pointers[neighbour.NumKeys] = nil
 			n.Keys[0] = k_prime
@@ -901,7 +1160,7 @@ func (t *CrabTree) redistributeNodes(n, neighbour *Node, neighbour_index, k_prim
 		} else {
 			n.Keys[n.NumKeys] = k_prime
 			n.Pointers[n.NumKeys+1] = neighbour.Pointers[0]
-			tmp, _ = n.Pointers[n.NumKeys+1].(*Node)
+			tmp, _ = n.Pointers[n.NumKeys+1].(*NodeOf[K, V])
 			tmp.Parent = n
 			n.Parent.Keys[k_prime_index] = neighbour.Keys[0]
 		}
@@ -919,24 +1178,29 @@ func (t *CrabTree) redistributeNodes(n, neighbour *Node, neighbour_index, k_prim
 	return
 }
 
-func (t *CrabTree) deleteEntry(n *Node, key int, pointer interface{}) {
-	var min_keys, neighbour_index, k_prime_index, k_prime, capacity int
-	var neighbour *Node
+func (t *CrabTreeOf[K, V]) deleteEntry(n *NodeOf[K, V], key K, pointer interface{}) {
+	var min_keys, neighbour_index, k_prime_index, capacity int
+	var k_prime K
+	var neighbour *NodeOf[K, V]
 
-	n = removeEntryFromNode(n, key, pointer)
-
-	if n == t.Root {
-		t.adjustRoot()
-		return
-	}
+	n = t.removeEntryFromNode(n, key, pointer)
 
 	if n.IsLeaf {
-		min_keys = cut(order - 1)
+		min_keys = cut(t.order - 1)
 	} else {
-		min_keys = cut(order) - 1
+		min_keys = cut(t.order) - 1
+	}
+
+	// A node left with enough keys needs nothing more, root or not. Any other
+	// node is either the root or has its parent latched by this delete, so only
+	// now can its Parent be read, and t.Root can't be: the root may have been
+	// let go of and be splitting under another insert.
+	if n.NumKeys >= min_keys && n.NumKeys > 0 {
+		return
 	}
 
-	if n.NumKeys >= min_keys {
+	if n.Parent == nil {
+		t.adjustRoot()
 		return
 	}
 
@@ -951,15 +1215,15 @@ func (t *CrabTree) deleteEntry(n *Node, key int, pointer interface{}) {
 	k_prime = n.Parent.Keys[k_prime_index]
 
 	if neighbour_index == -1 {
-		neighbour, _ = n.Parent.Pointers[1].(*Node)
+		neighbour, _ = n.Parent.Pointers[1].(*NodeOf[K, V])
 	} else {
-		neighbour, _ = n.Parent.Pointers[neighbour_index].(*Node)
+		neighbour, _ = n.Parent.Pointers[neighbour_index].(*NodeOf[K, V])
 	}
 
 	if n.IsLeaf {
-		capacity = order
+		capacity = t.order
 	} else {
-		capacity = order - 1
+		capacity = t.order - 1
 	}
 
 	if neighbour.NumKeys+n.NumKeys < capacity {
@@ -972,10 +1236,10 @@ func (t *CrabTree) deleteEntry(n *Node, key int, pointer interface{}) {
 
 }
 
-func (t *CrabTree) PalmBasic(key_count int, num_threads int) {
+func (t *CrabTreeOf[K, V]) PalmBasic(key_count int, num_threads int) {
 	panic("not implemented for CrabTree")
 }
 
-func (t *CrabTree) Palm(queries []tree_api.Query, num_threads int) [][]*tree_api.Record {
+func (t *CrabTreeOf[K, V]) Palm(queries []tree_api.QueryOf[K, V], num_threads int) []tree_api.ResultOf[V] {
 	panic("not implemented for CrabTree")
 }
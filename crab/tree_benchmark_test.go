@@ -0,0 +1,57 @@
+package crab
+
+import (
+	"fmt"
+	"main/tree_api"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// BenchmarkFind runs concurrent finds against a tree of 100000 keys, once
+// with the shared latches readers take now and once with the exclusive
+// latches they used to take, which make readers queue at the root:
+//
+//	go test ./crab -run NONE -bench Find
+func BenchmarkFind(b *testing.B) {
+	const numKeys = 100000
+	for _, exclusive := range []bool{true, false} {
+		tree := NewTreeOf[int, []byte](tree_api.WithOrder(16)).(*CrabTree)
+		for _, k := range rand.Perm(numKeys) {
+			tree.Insert(k, []byte(fmt.Sprint(k)))
+		}
+		tree.exclusiveReads = exclusive
+		latches := "shared"
+		if exclusive {
+			latches = "exclusive"
+		}
+		for _, goroutines := range []int{1, 2, 4, 8, 16} {
+			b.Run(fmt.Sprintf("%s/goroutines=%d", latches, goroutines), func(b *testing.B) {
+				benchmarkFind(b, tree, numKeys, goroutines)
+			})
+		}
+	}
+}
+
+// benchmarkFind splits b.N finds of random keys between goroutines.
+func benchmarkFind(b *testing.B, tree *CrabTree, numKeys, goroutines int) {
+	var wg sync.WaitGroup
+	b.ResetTimer()
+	for g := 0; g < goroutines; g++ {
+		n := b.N / goroutines
+		if g < b.N%goroutines {
+			n++
+		}
+		wg.Add(1)
+		go func(seed int64, n int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for i := 0; i < n; i++ {
+				if _, err := tree.Find(rng.Intn(numKeys), false); err != nil {
+					panic(err)
+				}
+			}
+		}(int64(g), n)
+	}
+	wg.Wait()
+}
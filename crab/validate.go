@@ -0,0 +1,127 @@
+package crab
+
+import (
+	"cmp"
+	"fmt"
+	"main/tree_api"
+)
+
+// Validate checks that the tree is well formed: keys are sorted within every
+// node and fall between the separators above them, every node has as many
+// keys and children as NumKeys says and is neither over- nor underfull, Parent
+// points back at the node holding each child, all leaves are at the same depth
+// and the sibling chain links every leaf from left to right. It returns an
+// error wrapping tree_api.ErrInvalidTree that names the path from the root to
+// the first node found to be broken, or nil if the tree is well formed.
+//
+// Validate holds the tree latch, so no operation can start while it runs, but
+// it does not latch nodes: operations already under way must have finished.
+func (t *CrabTreeOf[K, V]) Validate() error {
+	defer t.debug.operation("Validate")()
+	t.lockTree()
+	defer t.unlockTree()
+
+	if t.order < minOrder || t.order > maxOrder {
+		return fmt.Errorf("%w: order %d is outside [%d, %d]", tree_api.ErrInvalidTree, t.order, minOrder, maxOrder)
+	}
+	if t.Root == nil {
+		return nil
+	}
+	if t.Root.Parent != nil {
+		return fmt.Errorf("%w: root: has a parent", tree_api.ErrInvalidTree)
+	}
+	v := &validatorOf[K, V]{tree: t, leafDepth: -1}
+	if err := v.check(t.Root, []int{}, nil, nil); err != nil {
+		return err
+	}
+	for i, leaf := range v.leaves {
+		var want *NodeOf[K, V]
+		if i+1 < len(v.leaves) {
+			want = v.leaves[i+1]
+		}
+		if next, _ := leaf.Pointers[t.order-1].(*NodeOf[K, V]); next != want {
+			return fmt.Errorf("%w: leaf %d of %d: sibling pointer skips or leaves the chain", tree_api.ErrInvalidTree, i, len(v.leaves))
+		}
+	}
+	return nil
+}
+
+type validatorOf[K cmp.Ordered, V any] struct {
+	tree      *CrabTreeOf[K, V]
+	leafDepth int
+	leaves    []*NodeOf[K, V]
+}
+
+// check validates the subtree under n, whose keys must lie in [low, high); a
+// nil bound is open.
+func (v *validatorOf[K, V]) check(n *NodeOf[K, V], path []int, low, high *K) error {
+	t := v.tree
+	fail := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s: %s", tree_api.ErrInvalidTree, tree_api.FormatPath(path), fmt.Sprintf(format, args...))
+	}
+	if len(n.Keys) != t.order-1 || len(n.Pointers) != t.order {
+		return fail("has %d key and %d pointer slots, expected %d and %d", len(n.Keys), len(n.Pointers), t.order-1, t.order)
+	}
+	if n.NumKeys < 0 || n.NumKeys > t.order-1 {
+		return fail("NumKeys is %d, outside [0, %d]", n.NumKeys, t.order-1)
+	}
+	if n != t.Root {
+		minKeys := cut(t.order) - 1
+		if n.IsLeaf {
+			minKeys = cut(t.order - 1)
+		}
+		if n.NumKeys < minKeys {
+			return fail("holds %d keys, fewer than the minimum of %d", n.NumKeys, minKeys)
+		}
+	} else if n.NumKeys == 0 {
+		return fail("root is empty")
+	}
+	for i := 0; i < n.NumKeys; i++ {
+		if i > 0 && n.Keys[i-1] >= n.Keys[i] {
+			return fail("key %v at %d is not above key %v before it", n.Keys[i], i, n.Keys[i-1])
+		}
+		if low != nil && n.Keys[i] < *low {
+			return fail("key %v at %d is below the separator %v", n.Keys[i], i, *low)
+		}
+		if high != nil && n.Keys[i] >= *high {
+			return fail("key %v at %d is not below the separator %v", n.Keys[i], i, *high)
+		}
+	}
+
+	if n.IsLeaf {
+		for i := 0; i < n.NumKeys; i++ {
+			if _, ok := n.Pointers[i].(*tree_api.RecordOf[V]); !ok {
+				return fail("pointer %d is not a record", i)
+			}
+		}
+		depth := len(path)
+		if v.leafDepth < 0 {
+			v.leafDepth = depth
+		} else if depth != v.leafDepth {
+			return fail("leaf is at depth %d, other leaves are at %d", depth, v.leafDepth)
+		}
+		v.leaves = append(v.leaves, n)
+		return nil
+	}
+
+	for i := 0; i <= n.NumKeys; i++ {
+		child, ok := n.Pointers[i].(*NodeOf[K, V])
+		if !ok || child == nil {
+			return fail("child %d is missing", i)
+		}
+		if child.Parent != n {
+			return fail("child %d does not point back at its parent", i)
+		}
+		childLow, childHigh := low, high
+		if i > 0 {
+			childLow = &n.Keys[i-1]
+		}
+		if i < n.NumKeys {
+			childHigh = &n.Keys[i]
+		}
+		if err := v.check(child, append(path, i), childLow, childHigh); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package flat_combining_tree
+
+import (
+	"cmp"
+	"main/seq_tree"
+	"main/tree_api"
+)
+
+// IteratorOf walks the keys of a FlatCombiningTree in order. It keeps the key
+// and record it is on, and each move is one more operation for the combiner:
+// a fresh seq_tree iterator seeks from that key, since the leaf the key was in
+// may have been split or merged away since.
+type IteratorOf[K cmp.Ordered, V any] struct {
+	tree      *FlatCombiningTreeOf[K, V]
+	key       K
+	record    *tree_api.RecordOf[V]
+	started   bool
+	exhausted bool
+	closed    bool
+}
+
+func (t *FlatCombiningTreeOf[K, V]) NewIterator() tree_api.IteratorOf[K, V] {
+	return &IteratorOf[K, V]{tree: t}
+}
+
+func (it *IteratorOf[K, V]) Seek(key K) bool {
+	if it.closed {
+		return false
+	}
+	it.started = true
+	return it.move(func(tree *seq_tree.TreeOf[K, V]) tree_api.IteratorOf[K, V] {
+		inner := tree.NewIterator()
+		return positioned(inner, inner.Seek(key))
+	})
+}
+
+func (it *IteratorOf[K, V]) Next() bool {
+	if it.closed || it.exhausted {
+		return false
+	}
+	started, key := it.started, it.key
+	it.started = true
+	return it.move(func(tree *seq_tree.TreeOf[K, V]) tree_api.IteratorOf[K, V] {
+		inner := tree.NewIterator()
+		if !started {
+			return positioned(inner, inner.Next())
+		}
+		ok := inner.Seek(key)
+		if ok && inner.Key() == key {
+			ok = inner.Next()
+		}
+		return positioned(inner, ok)
+	})
+}
+
+func (it *IteratorOf[K, V]) Prev() bool {
+	if it.closed || it.exhausted {
+		return false
+	}
+	started, key := it.started, it.key
+	it.started = true
+	return it.move(func(tree *seq_tree.TreeOf[K, V]) tree_api.IteratorOf[K, V] {
+		inner := tree.NewIterator()
+		if started && !inner.Seek(key) {
+			// Seek ran off the end and exhausted inner: every key is below
+			// key, so the last one is the one before it.
+			inner.Close()
+			inner = tree.NewIterator()
+		}
+		return positioned(inner, inner.Prev())
+	})
+}
+
+// positioned returns inner if ok, or closes it and returns nil.
+func positioned[K cmp.Ordered, V any](inner tree_api.IteratorOf[K, V], ok bool) tree_api.IteratorOf[K, V] {
+	if !ok {
+		inner.Close()
+		return nil
+	}
+	return inner
+}
+
+// move runs step as one operation and moves the iterator to where the
+// seq_tree iterator step returns is, or exhausts it if step returns nil.
+func (it *IteratorOf[K, V]) move(step func(*seq_tree.TreeOf[K, V]) tree_api.IteratorOf[K, V]) bool {
+	var ok bool
+	it.tree.run(func(tree *seq_tree.TreeOf[K, V]) {
+		if inner := step(tree); inner != nil {
+			it.key, it.record = inner.Key(), inner.Value()
+			inner.Close()
+			ok = true
+		}
+	})
+	it.exhausted = !ok
+	if !ok {
+		it.record = nil
+	}
+	return ok
+}
+
+func (it *IteratorOf[K, V]) Key() K {
+	if !it.valid() {
+		var zero K
+		return zero
+	}
+	return it.key
+}
+
+func (it *IteratorOf[K, V]) Value() *tree_api.RecordOf[V] {
+	if !it.valid() {
+		return nil
+	}
+	return it.record
+}
+
+func (it *IteratorOf[K, V]) Err() error {
+	if it.closed {
+		return tree_api.ErrIteratorClosed
+	}
+	return nil
+}
+
+func (it *IteratorOf[K, V]) Close() error {
+	it.closed = true
+	it.record = nil
+	return nil
+}
+
+func (it *IteratorOf[K, V]) valid() bool {
+	return !it.closed && !it.exhausted && it.record != nil
+}
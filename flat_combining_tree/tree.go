@@ -0,0 +1,184 @@
+package flat_combining_tree
+
+import (
+	"cmp"
+	"main/seq_tree"
+	"main/tree_api"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// The states of a slot. A goroutine claims a free slot, publishes its
+// operation by making it pending, and frees the slot again once a combiner
+// has marked it done.
+const (
+	slotFree uint32 = iota
+	slotClaimed
+	slotPending
+	slotDone
+)
+
+// slotOf is where one goroutine publishes one operation for the combiner.
+type slotOf[K cmp.Ordered, V any] struct {
+	state atomic.Uint32
+	op    func(*seq_tree.TreeOf[K, V])
+	_     [112]byte // keeps each waiter polling a cache line of its own
+}
+
+// FlatCombiningTreeOf is a sequential tree behind flat combining. Rather than
+// every goroutine taking a lock in turn, each publishes its operation in a
+// slot, and whichever goroutine wins the combiner lock applies every pending
+// operation in one pass, while the others wait on their own slots. The tree
+// is only touched by one goroutine at a time, and without handing a lock
+// around once per operation.
+//
+// Slots are claimed per operation rather than held by each goroutine, as Go
+// has no thread identity to key them by. There are two per processor; a
+// goroutine that finds none free takes the combiner lock and applies its own
+// operation along with the pending ones.
+type FlatCombiningTreeOf[K cmp.Ordered, V any] struct {
+	tree     *seq_tree.TreeOf[K, V]
+	combiner sync.Mutex
+	slots    []slotOf[K, V]
+}
+
+type FlatCombiningTree = FlatCombiningTreeOf[int, []byte]
+
+func NewTree(opts ...tree_api.Option) tree_api.BPTree {
+	return NewTreeOf[int, []byte](opts...)
+}
+
+func NewTreeOf[K cmp.Ordered, V any](opts ...tree_api.Option) tree_api.TreeOf[K, V] {
+	return &FlatCombiningTreeOf[K, V]{
+		tree:  seq_tree.NewTreeOf[K, V](opts...),
+		slots: make([]slotOf[K, V], 2*runtime.GOMAXPROCS(0)),
+	}
+}
+
+// run has op applied to the tree by a combiner, which may be this goroutine,
+// and returns once it has been.
+func (t *FlatCombiningTreeOf[K, V]) run(op func(*seq_tree.TreeOf[K, V])) {
+	s := t.claim()
+	if s == nil {
+		t.combiner.Lock()
+		op(t.tree)
+		t.combine()
+		t.combiner.Unlock()
+		return
+	}
+	s.op = op
+	s.state.Store(slotPending)
+	for s.state.Load() != slotDone {
+		if t.combiner.TryLock() {
+			t.combine()
+			t.combiner.Unlock()
+		} else {
+			runtime.Gosched()
+		}
+	}
+	s.state.Store(slotFree)
+}
+
+// claim returns a free slot, now claimed, or nil if every slot is taken. It
+// starts looking at a random slot so that goroutines spread out.
+func (t *FlatCombiningTreeOf[K, V]) claim() *slotOf[K, V] {
+	start := rand.Intn(len(t.slots))
+	for i := range t.slots {
+		s := &t.slots[(start+i)%len(t.slots)]
+		if s.state.Load() == slotFree && s.state.CompareAndSwap(slotFree, slotClaimed) {
+			return s
+		}
+	}
+	return nil
+}
+
+// combine applies every pending operation. The caller holds the combiner lock.
+func (t *FlatCombiningTreeOf[K, V]) combine() {
+	for i := range t.slots {
+		s := &t.slots[i]
+		if s.state.Load() == slotPending {
+			s.op(t.tree)
+			s.op = nil
+			s.state.Store(slotDone)
+		}
+	}
+}
+
+func (t *FlatCombiningTreeOf[K, V]) Insert(key K, value V) error {
+	var err error
+	t.run(func(tree *seq_tree.TreeOf[K, V]) { err = tree.Insert(key, value) })
+	return err
+}
+
+func (t *FlatCombiningTreeOf[K, V]) Upsert(key K, value V) error {
+	var err error
+	t.run(func(tree *seq_tree.TreeOf[K, V]) { err = tree.Upsert(key, value) })
+	return err
+}
+
+func (t *FlatCombiningTreeOf[K, V]) Update(key K, value V) error {
+	var err error
+	t.run(func(tree *seq_tree.TreeOf[K, V]) { err = tree.Update(key, value) })
+	return err
+}
+
+func (t *FlatCombiningTreeOf[K, V]) CompareAndSwap(key K, old *tree_api.RecordOf[V], new V) (bool, error) {
+	var swapped bool
+	var err error
+	t.run(func(tree *seq_tree.TreeOf[K, V]) { swapped, err = tree.CompareAndSwap(key, old, new) })
+	return swapped, err
+}
+
+func (t *FlatCombiningTreeOf[K, V]) Delete(key K) error {
+	var err error
+	t.run(func(tree *seq_tree.TreeOf[K, V]) { err = tree.Delete(key) })
+	return err
+}
+
+func (t *FlatCombiningTreeOf[K, V]) Find(key K, verbose bool) (*tree_api.RecordOf[V], error) {
+	var r *tree_api.RecordOf[V]
+	var err error
+	t.run(func(tree *seq_tree.TreeOf[K, V]) { r, err = tree.Find(key, verbose) })
+	return r, err
+}
+
+func (t *FlatCombiningTreeOf[K, V]) PrintTree() {
+	t.run(func(tree *seq_tree.TreeOf[K, V]) { tree.PrintTree() })
+}
+
+func (t *FlatCombiningTreeOf[K, V]) FindAndPrint(key K, verbose bool) {
+	t.run(func(tree *seq_tree.TreeOf[K, V]) { tree.FindAndPrint(key, verbose) })
+}
+
+func (t *FlatCombiningTreeOf[K, V]) FindAndPrintRange(key_start, key_end K, verbose bool) {
+	t.run(func(tree *seq_tree.TreeOf[K, V]) { tree.FindAndPrintRange(key_start, key_end, verbose) })
+}
+
+func (t *FlatCombiningTreeOf[K, V]) Range(key_start, key_end K) ([]tree_api.KeyRecordOf[K, V], error) {
+	return t.RangeLimit(key_start, key_end, 0, false)
+}
+
+func (t *FlatCombiningTreeOf[K, V]) RangeLimit(key_start, key_end K, limit int, reverse bool) ([]tree_api.KeyRecordOf[K, V], error) {
+	var res []tree_api.KeyRecordOf[K, V]
+	var err error
+	t.run(func(tree *seq_tree.TreeOf[K, V]) { res, err = tree.RangeLimit(key_start, key_end, limit, reverse) })
+	return res, err
+}
+
+// Validate checks the underlying tree as one more operation, so it may run
+// alongside other operations.
+func (t *FlatCombiningTreeOf[K, V]) Validate() error {
+	var err error
+	t.run(func(tree *seq_tree.TreeOf[K, V]) { err = tree.Validate() })
+	return err
+}
+
+func (t *FlatCombiningTreeOf[K, V]) PalmBasic(key_count int, num_threads int) {
+	panic("Not implemented for flat combining tree")
+}
+
+func (t *FlatCombiningTreeOf[K, V]) Palm(query []tree_api.QueryOf[K, V], num_threads int) []tree_api.ResultOf[V] {
+	panic("Not implemented for flat combining tree")
+}
@@ -0,0 +1,171 @@
+package flat_combining_tree
+
+import (
+	"fmt"
+	"main/seq_tree"
+	"main/tree_api"
+	"main/tree_testing"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCombinerAppliesPublishedOperations(t *testing.T) {
+	tree := NewTreeOf[int, []byte]().(*FlatCombiningTree)
+	const writers = 4
+	tree.slots = make([]slotOf[int, []byte], writers)
+
+	// Hold the combiner lock so that every writer has to publish and wait.
+	tree.combiner.Lock()
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			if err := tree.Insert(w, []byte(fmt.Sprint(w))); err != nil {
+				t.Errorf("insert %d: %s", w, err)
+			}
+		}(w)
+	}
+	for pending := 0; pending < writers; {
+		pending = 0
+		for i := range tree.slots {
+			if tree.slots[i].state.Load() == slotPending {
+				pending++
+			}
+		}
+	}
+	if r, _ := tree.tree.Find(0, false); r != nil {
+		t.Errorf("expected nothing to be applied before combining")
+	}
+
+	// One pass applies them all. A waiter frees its slot as soon as it sees
+	// it done.
+	tree.combine()
+	for i := range tree.slots {
+		if state := tree.slots[i].state.Load(); state != slotDone && state != slotFree {
+			t.Errorf("slot %d is in state %d after combining", i, state)
+		}
+	}
+	tree.combiner.Unlock()
+	wg.Wait()
+
+	want := make(map[int]string)
+	for w := 0; w < writers; w++ {
+		want[w] = fmt.Sprint(w)
+	}
+	tree_testing.CheckContents(t, tree, want)
+	for i := range tree.slots {
+		if state := tree.slots[i].state.Load(); state != slotFree {
+			t.Errorf("slot %d is in state %d once its writer returned", i, state)
+		}
+	}
+}
+
+func TestConcurrentPointOps(t *testing.T) {
+	// With a single slot most operations find none free and combine on
+	// their own.
+	for _, slots := range []int{1, 4, 64} {
+		t.Run(fmt.Sprintf("slots=%d", slots), func(t *testing.T) {
+			tree := NewTreeOf[int, []byte](tree_api.WithOrder(4)).(*FlatCombiningTree)
+			tree.slots = make([]slotOf[int, []byte], slots)
+			tree_testing.ConcurrentPointOps(t, tree)
+		})
+	}
+}
+
+// TestWaiterTakesOverAsCombiner has a goroutine publish its operation while
+// another holds the combiner lock, and the holder let go without combining.
+// The waiter must notice the lock is free and apply its operation itself.
+func TestWaiterTakesOverAsCombiner(t *testing.T) {
+	tree := NewTreeOf[int, []byte]().(*FlatCombiningTree)
+	tree.slots = make([]slotOf[int, []byte], 2)
+	tree.combiner.Lock()
+	done := make(chan error)
+	go func() { done <- tree.Insert(1, []byte("1")) }()
+	for tree.slots[0].state.Load() != slotPending && tree.slots[1].state.Load() != slotPending {
+		runtime.Gosched()
+	}
+	tree.combiner.Unlock()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("insert 1: %s", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("the waiter did not take over once the combiner lock was free")
+	}
+	tree_testing.CheckContents(t, tree, map[int]string{1: "1"})
+}
+
+// TestCombinerWithoutSlotServesOthers fills the only slot with a pending
+// operation. The next operation finds no free slot, takes the combiner lock
+// for its own operation, and applies the pending one on the way.
+func TestCombinerWithoutSlotServesOthers(t *testing.T) {
+	tree := NewTreeOf[int, []byte]().(*FlatCombiningTree)
+	tree.slots = make([]slotOf[int, []byte], 1)
+	s := &tree.slots[0]
+	var err error
+	s.op = func(tree *seq_tree.Tree) { err = tree.Insert(1, []byte("published")) }
+	s.state.Store(slotPending)
+
+	if err := tree.Insert(2, []byte("own")); err != nil {
+		t.Fatalf("insert 2: %s", err)
+	}
+	if state := s.state.Load(); state != slotDone || err != nil {
+		t.Errorf("expected the published insert to be applied, slot is in state %d with error %v", state, err)
+	}
+	s.state.Store(slotFree)
+	tree_testing.CheckContents(t, tree, map[int]string{1: "published", 2: "own"})
+}
+
+// TestEveryWaiterIsServed keeps several goroutines publishing back to back,
+// so that the combiner lock changes hands constantly and there is always
+// more work pending, and checks that every one of them gets its operations
+// through rather than some being passed over while others are served.
+func TestEveryWaiterIsServed(t *testing.T) {
+	const goroutines = 8
+	const opsEach = 300
+	tree := NewTreeOf[int, []byte]().(*FlatCombiningTree)
+	tree.slots = make([]slotOf[int, []byte], goroutines/2)
+	var stop atomic.Bool
+	counts := make([]atomic.Int64, goroutines)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; !stop.Load(); i++ {
+				tree.Upsert(g*opsEach+i%opsEach, []byte(fmt.Sprint(g)))
+				counts[g].Add(1)
+			}
+		}(g)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		slowest := int64(opsEach)
+		for g := range counts {
+			slowest = min(slowest, counts[g].Load())
+		}
+		if slowest >= opsEach {
+			break
+		}
+		if time.Now().After(deadline) {
+			stop.Store(true)
+			wg.Wait()
+			got := make([]int64, goroutines)
+			for g := range counts {
+				got[g] = counts[g].Load()
+			}
+			t.Fatalf("not every goroutine got %d operations through: %v", opsEach, got)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	stop.Store(true)
+	wg.Wait()
+	if err := tree.Validate(); err != nil {
+		t.Error(err)
+	}
+}
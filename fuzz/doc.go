@@ -0,0 +1,6 @@
+// Package fuzz holds fuzz targets that run random operation sequences against
+// every tree implementation and a map, and fail on the first difference or
+// broken structural invariant. Run one with, for example,
+//
+//	go test ./fuzz -fuzz FuzzCrabTree
+package fuzz
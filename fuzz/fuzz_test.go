@@ -0,0 +1,433 @@
+package fuzz
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"main/art"
+	"main/blink_tree"
+	"main/bw_tree"
+	"main/crab"
+	"main/flat_combining_tree"
+	"main/global_lock_tree"
+	"main/lock_free"
+	"main/olc_tree"
+	"main/seq_tree"
+	"main/shard_tree"
+	"main/skip_list"
+	"main/tree_api"
+	"math"
+	"slices"
+	"testing"
+)
+
+// keySpace is kept small so that operations often hit keys that are already
+// present, and the tree splits and merges nodes all the time.
+const keySpace = 64
+
+type opKind int
+
+const (
+	opInsert opKind = iota
+	opUpsert
+	opUpdate
+	opDelete
+	opFind
+	opRange
+	opBatch
+	opRangeLimit
+	opCompareAndSwap
+	opSeek
+	opKinds
+)
+
+// op is one decoded step. A batch carries the queries it hands to Palm.
+type op struct {
+	kind    opKind
+	key     int
+	end     int
+	value   []byte
+	threads int
+	batch   []tree_api.Query
+	limit   int  // results for RangeLimit, steps after a Seek
+	reverse bool // RangeLimit descending; a CompareAndSwap with a stale record
+}
+
+// decode turns data into a tree order and a sequence of operations. The first
+// byte picks the order, from minOrder up; after that each operation takes a byte for its kind
+// and one for its key, and a batch a byte for its size and thread count
+// followed by a kind byte and key byte per query. A RangeLimit takes one more
+// pair for its limit and direction. Values are derived from the operation's
+// position so that every write stores something distinct.
+func decode(data []byte, minOrder int, palm bool) (int, []op) {
+	if len(data) == 0 {
+		return minOrder, nil
+	}
+	order := minOrder + int(data[0])%14
+	ops := []op{}
+	for i := 1; i+1 < len(data); i += 2 {
+		kind := opKind(data[i]) % opKinds
+		key := int(data[i+1]) % keySpace
+		value := []byte(fmt.Sprint("v", i))
+		switch kind {
+		case opRange:
+			ops = append(ops, op{kind: kind, key: key, end: key + int(data[i])%keySpace})
+		case opRangeLimit:
+			rangeLimit := op{kind: kind, key: key, end: key + int(data[i])%keySpace}
+			if i+3 < len(data) {
+				i += 2
+				rangeLimit.limit = int(data[i]) % 8
+				rangeLimit.reverse = data[i+1]%2 == 1
+			}
+			ops = append(ops, rangeLimit)
+		case opCompareAndSwap:
+			ops = append(ops, op{kind: kind, key: key, value: value, reverse: data[i]/byte(opKinds)%2 == 1})
+		case opSeek:
+			ops = append(ops, op{kind: kind, key: key, limit: int(data[i]/byte(opKinds)) % 8})
+		case opBatch:
+			if !palm {
+				continue
+			}
+			size := int(data[i+1]) % 16
+			batch := op{kind: kind, threads: 1 + int(data[i])%4}
+			for j := 0; j < size && i+3 < len(data); j++ {
+				i += 2
+				query := tree_api.Query{Key: int(data[i+1]) % keySpace}
+				switch data[i] % 4 {
+				case 0:
+					query.Method = tree_api.MethodFind
+				case 1:
+					query.Method = tree_api.MethodInsert
+				case 2:
+					query.Method = tree_api.MethodUpsert
+				case 3:
+					query.Method = tree_api.MethodDelete
+				}
+				if query.Method == tree_api.MethodInsert || query.Method == tree_api.MethodUpsert {
+					query.Pointer = &tree_api.Record{Value: []byte(fmt.Sprint("b", i))}
+				}
+				batch.batch = append(batch.batch, query)
+			}
+			ops = append(ops, batch)
+		default:
+			ops = append(ops, op{kind: kind, key: key, value: value})
+		}
+	}
+	return order, ops
+}
+
+// run applies ops to tree and to a map, failing on the first difference.
+func run(t *testing.T, tree tree_api.BPTree, ops []op) {
+	model := make(map[int][]byte)
+	for step, o := range ops {
+		where := fmt.Sprintf("step %d (%+v)", step, o)
+		present := model[o.key] != nil
+		switch o.kind {
+		case opInsert:
+			err := tree.Insert(o.key, o.value)
+			if present {
+				expectErr(t, where, err, tree_api.ErrKeyExists)
+			} else {
+				expectErr(t, where, err, nil)
+				model[o.key] = o.value
+			}
+		case opUpsert:
+			expectErr(t, where, tree.Upsert(o.key, o.value), nil)
+			model[o.key] = o.value
+		case opUpdate:
+			err := tree.Update(o.key, o.value)
+			if present {
+				expectErr(t, where, err, nil)
+				model[o.key] = o.value
+			} else {
+				expectErr(t, where, err, tree_api.ErrKeyNotFound)
+			}
+		case opDelete:
+			err := tree.Delete(o.key)
+			if present {
+				expectErr(t, where, err, nil)
+				delete(model, o.key)
+			} else {
+				expectErr(t, where, err, tree_api.ErrKeyNotFound)
+			}
+		case opFind:
+			r, err := tree.Find(o.key, false)
+			if present {
+				expectErr(t, where, err, nil)
+				if r == nil || !bytes.Equal(r.Value, model[o.key]) {
+					t.Fatalf("%s: found %v, expected %s", where, r, model[o.key])
+				}
+			} else {
+				expectErr(t, where, err, tree_api.ErrKeyNotFound)
+			}
+		case opRange:
+			checkRange(t, where, tree, model, o.key, o.end)
+		case opRangeLimit:
+			checkRangeLimit(t, where, tree, model, o.key, o.end, o.limit, o.reverse)
+		case opCompareAndSwap:
+			old, _ := tree.Find(o.key, false)
+			if o.reverse && old != nil {
+				// A record with the same value that the tree never stored.
+				old = &tree_api.Record{Value: old.Value}
+			}
+			swapped, err := tree.CompareAndSwap(o.key, old, o.value)
+			if present {
+				expectErr(t, where, err, nil)
+				if swapped == o.reverse {
+					t.Fatalf("%s: swapped is %v with a stale record %v", where, swapped, o.reverse)
+				}
+				if swapped {
+					model[o.key] = o.value
+				}
+			} else {
+				expectErr(t, where, err, tree_api.ErrKeyNotFound)
+			}
+		case opSeek:
+			checkSeek(t, where, tree, model, o.key, o.limit)
+		case opBatch:
+			results := tree.Palm(o.batch, o.threads)
+			for i, q := range o.batch {
+				checkResult(t, fmt.Sprintf("%s query %d", where, i), q, results[i], model)
+			}
+		}
+		if err := tree.Validate(); err != nil {
+			t.Fatalf("%s: %s", where, err)
+		}
+	}
+	checkRange(t, "at the end", tree, model, math.MinInt, math.MaxInt)
+	checkIterator(t, tree, model)
+}
+
+// checkResult applies a Palm query to the model and compares its result.
+func checkResult(t *testing.T, where string, q tree_api.Query, result tree_api.Result, model map[int][]byte) {
+	value, present := model[q.Key]
+	if result.Found != present {
+		t.Fatalf("%s: Found is %v, expected %v", where, result.Found, present)
+	}
+	switch q.Method {
+	case tree_api.MethodFind:
+		if present {
+			expectErr(t, where, result.Err, nil)
+			if result.Record == nil || !bytes.Equal(result.Record.Value, value) {
+				t.Fatalf("%s: found %v, expected %s", where, result.Record, value)
+			}
+		} else {
+			expectErr(t, where, result.Err, tree_api.ErrKeyNotFound)
+		}
+	case tree_api.MethodInsert:
+		if present {
+			expectErr(t, where, result.Err, tree_api.ErrKeyExists)
+		} else {
+			expectErr(t, where, result.Err, nil)
+			model[q.Key] = q.Pointer.Value
+		}
+	case tree_api.MethodUpsert:
+		expectErr(t, where, result.Err, nil)
+		model[q.Key] = q.Pointer.Value
+	case tree_api.MethodDelete:
+		if present {
+			expectErr(t, where, result.Err, nil)
+			delete(model, q.Key)
+		} else {
+			expectErr(t, where, result.Err, tree_api.ErrKeyNotFound)
+		}
+	}
+}
+
+func checkRange(t *testing.T, where string, tree tree_api.BPTree, model map[int][]byte, start, end int) {
+	res, err := tree.Range(start, end)
+	expectErr(t, where, err, nil)
+	want := sortedKeys(model, start, end)
+	if len(res) != len(want) {
+		t.Fatalf("%s: range [%d, %d] returned %d keys, expected %d", where, start, end, len(res), len(want))
+	}
+	for i, kr := range res {
+		if kr.Key != want[i] || !bytes.Equal(kr.Record.Value, model[kr.Key]) {
+			t.Fatalf("%s: range [%d, %d] returned key %d value %s at %d, expected key %d value %s", where, start, end, kr.Key, kr.Record.Value, i, want[i], model[want[i]])
+		}
+	}
+}
+
+// checkRangeLimit compares RangeLimit against the keys of the model in
+// [start, end], in the requested direction and cut to limit.
+func checkRangeLimit(t *testing.T, where string, tree tree_api.BPTree, model map[int][]byte, start, end, limit int, reverse bool) {
+	res, err := tree.RangeLimit(start, end, limit, reverse)
+	expectErr(t, where, err, nil)
+	want := sortedKeys(model, start, end)
+	if reverse {
+		slices.Reverse(want)
+	}
+	if limit > 0 && len(want) > limit {
+		want = want[:limit]
+	}
+	got := []int{}
+	for _, kr := range res {
+		if !bytes.Equal(kr.Record.Value, model[kr.Key]) {
+			t.Fatalf("%s: key %d has value %s, expected %s", where, kr.Key, kr.Record.Value, model[kr.Key])
+		}
+		got = append(got, kr.Key)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("%s: RangeLimit(%d, %d, %d, %v) gave %v, expected %v", where, start, end, limit, reverse, got, want)
+	}
+}
+
+// checkSeek seeks to key and takes up to steps more keys with Next, comparing
+// them with the model.
+func checkSeek(t *testing.T, where string, tree tree_api.BPTree, model map[int][]byte, key, steps int) {
+	want := sortedKeys(model, key, math.MaxInt)
+	if len(want) > steps+1 {
+		want = want[:steps+1]
+	}
+	it := tree.NewIterator()
+	defer it.Close()
+	got := []int{}
+	for ok := it.Seek(key); ok && len(got) <= steps; ok = it.Next() {
+		if !bytes.Equal(it.Value().Value, model[it.Key()]) {
+			t.Fatalf("%s: iterator at key %d has value %s, expected %s", where, it.Key(), it.Value().Value, model[it.Key()])
+		}
+		got = append(got, it.Key())
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("%s: seeking %d and stepping %d gave %v, expected %v", where, key, steps, got, want)
+	}
+}
+
+// checkIterator walks the whole tree forwards and then backwards.
+func checkIterator(t *testing.T, tree tree_api.BPTree, model map[int][]byte) {
+	want := sortedKeys(model, math.MinInt, math.MaxInt)
+	forward := tree.NewIterator()
+	defer forward.Close()
+	got := []int{}
+	for forward.Next() {
+		got = append(got, forward.Key())
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("iterating forwards gave %v, expected %v", got, want)
+	}
+	backward := tree.NewIterator()
+	defer backward.Close()
+	got = got[:0]
+	for backward.Prev() {
+		got = append(got, backward.Key())
+	}
+	slices.Reverse(got)
+	if !slices.Equal(got, want) {
+		t.Fatalf("iterating backwards gave %v, expected %v", got, want)
+	}
+}
+
+// sortedKeys returns the keys of the model in [start, end] in ascending order.
+func sortedKeys(model map[int][]byte, start, end int) []int {
+	keys := []int{}
+	for key := range model {
+		if key >= start && key <= end {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func expectErr(t *testing.T, where string, err, want error) {
+	t.Helper()
+	if want == nil && err != nil || want != nil && !errors.Is(err, want) {
+		t.Fatalf("%s: got error %v, expected %v", where, err, want)
+	}
+}
+
+// addSeeds gives every target the same starting corpus: runs of inserts that
+// grow the tree a few levels, followed by deletes that shrink it again.
+func addSeeds(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0, 0, 1, 0, 2, 3, 1, 4, 1})
+	grow := []byte{1}
+	for k := 0; k < keySpace; k++ {
+		grow = append(grow, byte(opInsert), byte(k*37%keySpace))
+	}
+	shrink := slices.Clone(grow)
+	for k := 0; k < keySpace; k++ {
+		shrink = append(shrink, byte(opDelete), byte(k))
+	}
+	f.Add(grow)
+	f.Add(shrink)
+	batch := []byte{0, byte(opBatch), 15}
+	for k := 0; k < 15; k++ {
+		batch = append(batch, byte(k%4), byte(k*7))
+	}
+	f.Add(batch)
+	mixed := slices.Clone(grow)
+	for k := 0; k < keySpace; k += 4 {
+		mixed = append(mixed, byte(opRangeLimit), byte(k), byte(k%8), byte(k/4))
+		mixed = append(mixed, byte(opCompareAndSwap)+byte(k%2)*byte(opKinds), byte(k))
+		mixed = append(mixed, byte(opSeek)+byte(opKinds)*7, byte(k+1))
+		mixed = append(mixed, byte(opDelete), byte(k+2))
+	}
+	f.Add(mixed)
+}
+
+func fuzzTree(f *testing.F, newTree func(...tree_api.Option) tree_api.BPTree, minOrder int, palm bool) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		order, ops := decode(data, minOrder, palm)
+		run(t, newTree(tree_api.WithOrder(order)), ops)
+	})
+}
+
+func FuzzSeqTree(f *testing.F) {
+	fuzzTree(f, func(opts ...tree_api.Option) tree_api.BPTree { return seq_tree.NewTree(opts...) }, 3, false)
+}
+
+func FuzzCrabTree(f *testing.F) {
+	fuzzTree(f, crab.NewTree, 3, false)
+}
+
+func FuzzGlobalLockTree(f *testing.F) {
+	fuzzTree(f, global_lock_tree.NewTree, 3, false)
+}
+
+func FuzzRWGlobalLockTree(f *testing.F) {
+	fuzzTree(f, global_lock_tree.NewRWTree, 3, false)
+}
+
+func FuzzStripedGlobalLockTree(f *testing.F) {
+	fuzzTree(f, global_lock_tree.NewStripedTree, 3, false)
+}
+
+func FuzzFlatCombiningTree(f *testing.F) {
+	fuzzTree(f, flat_combining_tree.NewTree, 3, false)
+}
+
+func FuzzBLinkTree(f *testing.F) {
+	fuzzTree(f, blink_tree.NewTree, 3, false)
+}
+
+func FuzzBwTree(f *testing.F) {
+	fuzzTree(f, bw_tree.NewTree, 3, false)
+}
+
+func FuzzART(f *testing.F) {
+	fuzzTree(f, art.NewTree, 3, false)
+}
+
+func FuzzSkipList(f *testing.F) {
+	fuzzTree(f, skip_list.NewTree, 3, false)
+}
+
+func FuzzShardTree(f *testing.F) {
+	fuzzTree(f, newShardTree, 3, false)
+}
+
+// newShardTree rebalances every few operations, so that the short runs the
+// fuzzer tries split and merge shards.
+func newShardTree(opts ...tree_api.Option) tree_api.BPTree {
+	return shard_tree.NewTree(crab.NewTree, 4, 8, opts...)
+}
+
+func FuzzLockFreeTree(f *testing.F) {
+	fuzzTree(f, lock_free.NewTree, 3, true)
+}
+
+func FuzzOLCTree(f *testing.F) {
+	fuzzTree(f, olc_tree.NewTree, 4, false)
+}
@@ -0,0 +1,117 @@
+package global_lock_tree
+
+import (
+	"cmp"
+	"main/tree_api"
+)
+
+// IteratorOf wraps a seq_tree iterator. Each call takes the global lock
+// shared, and if the tree has been modified since the previous call the inner
+// iterator is re-seeked from the last key it returned rather than trusting a
+// leaf that may have been split or merged away.
+type IteratorOf[K cmp.Ordered, V any] struct {
+	tree    *GlobalLockTreeOf[K, V]
+	inner   tree_api.IteratorOf[K, V]
+	version uint64
+	valid   bool
+	key     K
+	record  *tree_api.RecordOf[V]
+	closed  bool
+}
+
+func (t *GlobalLockTreeOf[K, V]) NewIterator() tree_api.IteratorOf[K, V] {
+	defer t.lock.runlock(t.lock.rlock())
+	return &IteratorOf[K, V]{tree: t, inner: t.tree.NewIterator(), version: t.version}
+}
+
+func (it *IteratorOf[K, V]) Seek(key K) bool {
+	if it.closed {
+		return false
+	}
+	defer it.tree.lock.runlock(it.tree.lock.rlock())
+	it.inner = it.tree.tree.NewIterator()
+	it.version = it.tree.version
+	return it.capture(it.inner.Seek(key))
+}
+
+func (it *IteratorOf[K, V]) Next() bool {
+	if it.closed {
+		return false
+	}
+	defer it.tree.lock.runlock(it.tree.lock.rlock())
+	if it.valid && it.version != it.tree.version {
+		it.reposition()
+		if !it.valid {
+			return false
+		}
+		if it.inner.Key() > it.key {
+			// The key we were on was deleted; the seek already moved past it.
+			return it.capture(true)
+		}
+	}
+	return it.capture(it.inner.Next())
+}
+
+func (it *IteratorOf[K, V]) Prev() bool {
+	if it.closed {
+		return false
+	}
+	defer it.tree.lock.runlock(it.tree.lock.rlock())
+	if it.valid && it.version != it.tree.version {
+		it.reposition()
+		if !it.valid {
+			// Everything left in the tree sorts before the old key.
+			it.inner = it.tree.tree.NewIterator()
+		}
+	}
+	return it.capture(it.inner.Prev())
+}
+
+func (it *IteratorOf[K, V]) Key() K {
+	if !it.valid {
+		var zero K
+		return zero
+	}
+	return it.key
+}
+
+func (it *IteratorOf[K, V]) Value() *tree_api.RecordOf[V] {
+	if !it.valid {
+		return nil
+	}
+	return it.record
+}
+
+func (it *IteratorOf[K, V]) Err() error {
+	if it.closed {
+		return tree_api.ErrIteratorClosed
+	}
+	return nil
+}
+
+func (it *IteratorOf[K, V]) Close() error {
+	it.closed = true
+	it.valid = false
+	return it.inner.Close()
+}
+
+// reposition seeks a fresh inner iterator to the first key >= the last key
+// returned. Callers must hold the tree lock.
+func (it *IteratorOf[K, V]) reposition() {
+	it.inner = it.tree.tree.NewIterator()
+	it.version = it.tree.version
+	it.valid = it.inner.Seek(it.key)
+}
+
+// capture copies the inner iterator's position out while the lock is held, so
+// Key and Value don't need to touch the tree.
+func (it *IteratorOf[K, V]) capture(ok bool) bool {
+	it.valid = ok
+	if ok {
+		it.key = it.inner.Key()
+		it.record = it.inner.Value()
+	} else {
+		it.record = nil
+	}
+	return ok
+}
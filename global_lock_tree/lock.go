@@ -0,0 +1,47 @@
+package global_lock_tree
+
+import (
+	"main/striped_lock"
+	"sync"
+)
+
+// treeLock is the one lock a GlobalLockTree takes around every call:
+// exclusively to change the tree, shared to read it. rlock returns a token to
+// hand back to runlock.
+type treeLock interface {
+	lock()
+	unlock()
+	rlock() int
+	runlock(token int)
+}
+
+// mutexLock makes every call exclusive, reads included.
+type mutexLock struct {
+	mu sync.Mutex
+}
+
+func (l *mutexLock) lock()       { l.mu.Lock() }
+func (l *mutexLock) unlock()     { l.mu.Unlock() }
+func (l *mutexLock) rlock() int  { l.mu.Lock(); return 0 }
+func (l *mutexLock) runlock(int) { l.mu.Unlock() }
+
+// rwLock lets reads share an RWMutex.
+type rwLock struct {
+	mu sync.RWMutex
+}
+
+func (l *rwLock) lock()       { l.mu.Lock() }
+func (l *rwLock) unlock()     { l.mu.Unlock() }
+func (l *rwLock) rlock() int  { l.mu.RLock(); return 0 }
+func (l *rwLock) runlock(int) { l.mu.RUnlock() }
+
+// stripedLock lets reads share a striped_lock.RWMutex, which keeps readers
+// on different cores off each other's cache lines.
+type stripedLock struct {
+	mu *striped_lock.RWMutex
+}
+
+func (l *stripedLock) lock()         { l.mu.Lock() }
+func (l *stripedLock) unlock()       { l.mu.Unlock() }
+func (l *stripedLock) rlock() int    { return l.mu.RLock() }
+func (l *stripedLock) runlock(i int) { l.mu.RUnlock(i) }
@@ -0,0 +1,148 @@
+package global_lock_tree
+
+import (
+	"main/striped_lock"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sharedLocks are the locks that let readers in together.
+func sharedLocks() map[string]treeLock {
+	return map[string]treeLock{
+		"rw":      &rwLock{},
+		"striped": &stripedLock{mu: striped_lock.New()},
+	}
+}
+
+func allLocks() map[string]treeLock {
+	locks := sharedLocks()
+	locks["mutex"] = &mutexLock{}
+	return locks
+}
+
+// within fails the test if f does not return in time, which is how a lock
+// that deadlocks or starves a writer shows up.
+func within(t *testing.T, d time.Duration, what string, f func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+	select {
+	case <-done:
+	case <-time.After(d):
+		t.Fatalf("%s did not finish within %v", what, d)
+	}
+}
+
+// A writer updates two fields with a yield between them; no reader may see
+// one updated without the other. The fields are plain ints, so under -race a
+// lock that fails to order readers after writers is reported as well.
+func TestWriterExclusion(t *testing.T) {
+	for name, l := range allLocks() {
+		l := l
+		t.Run(name, func(t *testing.T) {
+			var a, b int
+			var stop atomic.Bool
+			var wg sync.WaitGroup
+			for w := 0; w < 2; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < 2000; i++ {
+						l.lock()
+						a += 1
+						runtime.Gosched()
+						b += 1
+						l.unlock()
+					}
+				}()
+			}
+			var readers sync.WaitGroup
+			for r := 0; r < 4; r++ {
+				readers.Add(1)
+				go func() {
+					defer readers.Done()
+					for !stop.Load() {
+						token := l.rlock()
+						if a != b {
+							t.Errorf("reader saw a partial write: %d and %d", a, b)
+						}
+						l.runlock(token)
+					}
+				}()
+			}
+			within(t, 30*time.Second, "writers", wg.Wait)
+			stop.Store(true)
+			readers.Wait()
+			if a != 4000 || b != 4000 {
+				t.Errorf("expected 4000 writes to each field, got %d and %d", a, b)
+			}
+		})
+	}
+}
+
+// Every reader takes the lock and then waits for all the others to have it
+// too, which only finishes if they can hold it at once.
+func TestReaderConcurrency(t *testing.T) {
+	const readers = 8
+	for name, l := range sharedLocks() {
+		l := l
+		t.Run(name, func(t *testing.T) {
+			var inside, done sync.WaitGroup
+			inside.Add(readers)
+			done.Add(readers)
+			for r := 0; r < readers; r++ {
+				go func() {
+					defer done.Done()
+					token := l.rlock()
+					inside.Done()
+					inside.Wait()
+					l.runlock(token)
+				}()
+			}
+			within(t, 10*time.Second, "readers holding the lock together", done.Wait)
+		})
+	}
+}
+
+// Readers take turns so that the lock is never free of them; a writer must
+// still get in.
+func TestWriterProgressUnderReaders(t *testing.T) {
+	for name, l := range allLocks() {
+		l := l
+		t.Run(name, func(t *testing.T) {
+			var stop atomic.Bool
+			var reads atomic.Int64
+			var readers sync.WaitGroup
+			for r := 0; r < 4; r++ {
+				readers.Add(1)
+				go func() {
+					defer readers.Done()
+					for !stop.Load() {
+						token := l.rlock()
+						reads.Add(1)
+						runtime.Gosched()
+						l.runlock(token)
+					}
+				}()
+			}
+			// Let the readers get going before the writer arrives.
+			for reads.Load() < 100 {
+				runtime.Gosched()
+			}
+			within(t, 10*time.Second, "writer", func() {
+				for i := 0; i < 100; i++ {
+					l.lock()
+					l.unlock()
+				}
+			})
+			stop.Store(true)
+			readers.Wait()
+		})
+	}
+}
@@ -1,66 +1,139 @@
 package global_lock_tree
 
 import (
+	"cmp"
 	"main/seq_tree"
+	"main/striped_lock"
 	"main/tree_api"
-	"sync"
 )
 
-type GlobalLockTree struct {
-	tree *seq_tree.Tree
-	lock sync.Mutex
+// GlobalLockTreeOf wraps a sequential tree in a single lock. Writes take it
+// exclusively; reads take it shared, which only lets them run together with a
+// lock built for that.
+type GlobalLockTreeOf[K cmp.Ordered, V any] struct {
+	tree *seq_tree.TreeOf[K, V]
+	lock treeLock
+	// Bumped by every Insert and Delete so iterators can tell when the leaf
+	// they were on may have moved.
+	version uint64
 }
 
-func NewTree() tree_api.BPTree {
-	return &GlobalLockTree{tree: seq_tree.NewTree(), lock: sync.Mutex{}}
+type GlobalLockTree = GlobalLockTreeOf[int, []byte]
+
+func NewTree(opts ...tree_api.Option) tree_api.BPTree {
+	return NewTreeOf[int, []byte](opts...)
+}
+
+// NewTreeOf builds a tree behind a sync.Mutex, so that even reads run one at a
+// time.
+func NewTreeOf[K cmp.Ordered, V any](opts ...tree_api.Option) tree_api.TreeOf[K, V] {
+	return &GlobalLockTreeOf[K, V]{tree: seq_tree.NewTreeOf[K, V](opts...), lock: &mutexLock{}}
+}
+
+func NewRWTree(opts ...tree_api.Option) tree_api.BPTree {
+	return NewRWTreeOf[int, []byte](opts...)
+}
+
+// NewRWTreeOf builds a tree behind a sync.RWMutex, so that reads run together.
+func NewRWTreeOf[K cmp.Ordered, V any](opts ...tree_api.Option) tree_api.TreeOf[K, V] {
+	return &GlobalLockTreeOf[K, V]{tree: seq_tree.NewTreeOf[K, V](opts...), lock: &rwLock{}}
+}
+
+func NewStripedTree(opts ...tree_api.Option) tree_api.BPTree {
+	return NewStripedTreeOf[int, []byte](opts...)
+}
+
+// NewStripedTreeOf builds a tree behind a reader-writer lock that counts its
+// readers on a stripe of counters, so that reads on different cores run
+// together without contending for one counter.
+func NewStripedTreeOf[K cmp.Ordered, V any](opts ...tree_api.Option) tree_api.TreeOf[K, V] {
+	return &GlobalLockTreeOf[K, V]{tree: seq_tree.NewTreeOf[K, V](opts...), lock: &stripedLock{mu: striped_lock.New()}}
+}
+
+func (t *GlobalLockTreeOf[K, V]) Insert(key K, value V) error {
+	t.lock.lock()
+	defer t.lock.unlock()
+	t.version++
+	return t.tree.Insert(key, value)
 }
 
-func (t *GlobalLockTree) Insert(key int, value []byte) error {
-	t.lock.Lock()
-	defer t.lock.Unlock()
+// Upsert, Update and CompareAndSwap only swap the record in a leaf slot, so
+// they leave the version alone.
+func (t *GlobalLockTreeOf[K, V]) Upsert(key K, value V) error {
+	t.lock.lock()
+	defer t.lock.unlock()
+	if err := t.tree.Update(key, value); err == nil {
+		return nil
+	}
+	t.version++
 	return t.tree.Insert(key, value)
 }
 
-func (t *GlobalLockTree) Delete(key int) error {
-	t.lock.Lock()
-	defer t.lock.Unlock()
+func (t *GlobalLockTreeOf[K, V]) Update(key K, value V) error {
+	t.lock.lock()
+	defer t.lock.unlock()
+	return t.tree.Update(key, value)
+}
+
+func (t *GlobalLockTreeOf[K, V]) CompareAndSwap(key K, old *tree_api.RecordOf[V], new V) (bool, error) {
+	t.lock.lock()
+	defer t.lock.unlock()
+	return t.tree.CompareAndSwap(key, old, new)
+}
+
+func (t *GlobalLockTreeOf[K, V]) Delete(key K) error {
+	t.lock.lock()
+	defer t.lock.unlock()
+	t.version++
 	return t.tree.Delete(key)
 }
 
-func (t *GlobalLockTree) Find(key int, verbose bool) (*tree_api.Record, error) {
-	t.lock.Lock()
-	defer t.lock.Unlock()
+func (t *GlobalLockTreeOf[K, V]) Find(key K, verbose bool) (*tree_api.RecordOf[V], error) {
+	defer t.lock.runlock(t.lock.rlock())
 	return t.tree.Find(key, verbose)
 }
 
-func (t *GlobalLockTree) PrintTree() {
-	t.lock.Lock()
-	defer t.lock.Unlock()
+func (t *GlobalLockTreeOf[K, V]) PrintTree() {
+	defer t.lock.runlock(t.lock.rlock())
 	t.tree.PrintTree()
 }
 
-func (t *GlobalLockTree) FindAndPrint(key int, verbose bool) {
-	t.lock.Lock()
-	defer t.lock.Unlock()
+func (t *GlobalLockTreeOf[K, V]) FindAndPrint(key K, verbose bool) {
+	defer t.lock.runlock(t.lock.rlock())
 	t.tree.FindAndPrint(key, verbose)
 }
 
-func (t *GlobalLockTree) FindAndPrintRange(key_start, key_end int, verbose bool) {
-	t.lock.Lock()
-	defer t.lock.Unlock()
+func (t *GlobalLockTreeOf[K, V]) FindAndPrintRange(key_start, key_end K, verbose bool) {
+	defer t.lock.runlock(t.lock.rlock())
 	t.tree.FindAndPrintRange(key_start, key_end, verbose)
 }
 
-func (t *GlobalLockTree) PrintLeaves() {
-	t.lock.Lock()
-	defer t.lock.Unlock()
+func (t *GlobalLockTreeOf[K, V]) Range(key_start, key_end K) ([]tree_api.KeyRecordOf[K, V], error) {
+	defer t.lock.runlock(t.lock.rlock())
+	return t.tree.Range(key_start, key_end)
+}
+
+func (t *GlobalLockTreeOf[K, V]) RangeLimit(key_start, key_end K, limit int, reverse bool) ([]tree_api.KeyRecordOf[K, V], error) {
+	defer t.lock.runlock(t.lock.rlock())
+	return t.tree.RangeLimit(key_start, key_end, limit, reverse)
+}
+
+func (t *GlobalLockTreeOf[K, V]) PrintLeaves() {
+	defer t.lock.runlock(t.lock.rlock())
 	t.tree.PrintLeaves()
 }
 
-func (t *GlobalLockTree) PalmBasic(key_count int, num_threads int) {
+// Validate checks the underlying tree while holding the lock shared, so it
+// may run alongside other operations.
+func (t *GlobalLockTreeOf[K, V]) Validate() error {
+	defer t.lock.runlock(t.lock.rlock())
+	return t.tree.Validate()
+}
+
+func (t *GlobalLockTreeOf[K, V]) PalmBasic(key_count int, num_threads int) {
 	panic("Not implemented for global lock tree")
 }
 
-func (t *GlobalLockTree) Palm(query []tree_api.Query, num_threads int) [][]*tree_api.Record {
+func (t *GlobalLockTreeOf[K, V]) Palm(query []tree_api.QueryOf[K, V], num_threads int) []tree_api.ResultOf[V] {
 	panic("Not implemented for global lock tree")
 }
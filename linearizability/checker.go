@@ -0,0 +1,203 @@
+package linearizability
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"main/tree_api"
+	"slices"
+	"strings"
+)
+
+var ErrNotLinearizable = errors.New("history is not linearizable")
+
+// Check reports whether history is linearizable against a map from keys to
+// values, comparing values with bytes.Equal.
+func Check(history []Operation) error {
+	return CheckOf(history, bytes.Equal)
+}
+
+// CheckOf reports whether history is linearizable against a map from keys to
+// values: whether every operation can be given a point between its call and
+// its return such that, taken in that order, each one returns what it would
+// on a map. Operations on different keys never constrain each other, so each
+// key's operations are checked on their own. If some key's history cannot be
+// linearized the error wraps ErrNotLinearizable and lists its operations.
+func CheckOf[K cmp.Ordered, V any](history []OperationOf[K, V], equal func(a, b V) bool) error {
+	byKey := make(map[K][]OperationOf[K, V])
+	keys := make([]K, 0)
+	for _, op := range history {
+		if _, ok := byKey[op.Key]; !ok {
+			keys = append(keys, op.Key)
+		}
+		byKey[op.Key] = append(byKey[op.Key], op)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		ops := byKey[key]
+		if !checkKey(ops, equal) {
+			return fmt.Errorf("%w: key %v:\n%s", ErrNotLinearizable, key, formatOperations(ops))
+		}
+	}
+	return nil
+}
+
+// entry is a call or return event of an operation in the doubly linked list
+// the search works through.
+type entry struct {
+	op     int
+	isCall bool
+	match  *entry // the return of a call
+	prev   *entry
+	next   *entry
+}
+
+// checkKey searches for a linearization of the operations on one key, after
+// Wing and Gong, with the memoization of Lowe. The list holds every event that
+// is not yet linearized in time order. The search linearizes the first call
+// that the model accepts and that leads to a configuration it has not tried
+// yet, and backtracks when it reaches a return, since that operation should
+// have taken effect by then.
+//
+// The model's state is the index of the operation that wrote the key's
+// current value, or -1 when the key is absent.
+func checkKey[K cmp.Ordered, V any](ops []OperationOf[K, V], equal func(a, b V) bool) bool {
+	events := make([]*entry, 0, 2*len(ops))
+	for i := range ops {
+		ret := &entry{op: i}
+		events = append(events, &entry{op: i, isCall: true, match: ret}, ret)
+	}
+	time := func(e *entry) int64 {
+		if e.isCall {
+			return ops[e.op].Call
+		}
+		return ops[e.op].Return
+	}
+	slices.SortStableFunc(events, func(a, b *entry) int {
+		if c := cmp.Compare(time(a), time(b)); c != 0 {
+			return c
+		}
+		// Operations whose call and return share a tick overlap.
+		if a.isCall != b.isCall {
+			if a.isCall {
+				return -1
+			}
+			return 1
+		}
+		return 0
+	})
+	head := &entry{}
+	prev := head
+	for _, e := range events {
+		prev.next = e
+		e.prev = prev
+		prev = e
+	}
+
+	type frame struct {
+		call  *entry
+		state int
+	}
+	stack := make([]frame, 0)
+	linearized := make([]uint64, (len(ops)+63)/64)
+	seen := make(map[string]bool)
+	state := -1
+
+	e := head.next
+	for head.next != nil {
+		if !e.isCall {
+			if len(stack) == 0 {
+				return false
+			}
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			state = top.state
+			linearized[top.call.op/64] &^= 1 << (top.call.op % 64)
+			unlift(top.call)
+			e = top.call.next
+			continue
+		}
+		if next, ok := step(ops, state, e.op, equal); ok {
+			linearized[e.op/64] |= 1 << (e.op % 64)
+			key := fmt.Sprint(linearized, next)
+			if !seen[key] {
+				seen[key] = true
+				stack = append(stack, frame{e, state})
+				state = next
+				lift(e)
+				e = head.next
+				continue
+			}
+			linearized[e.op/64] &^= 1 << (e.op % 64)
+		}
+		e = e.next
+	}
+	return true
+}
+
+// step applies operation op to the model in state and reports whether its
+// recorded outcome matches the model's, and the state it leaves behind.
+func step[K cmp.Ordered, V any](ops []OperationOf[K, V], state int, op int, equal func(a, b V) bool) (int, bool) {
+	o := ops[op]
+	switch o.Method {
+	case tree_api.MethodInsert:
+		if state < 0 {
+			return op, o.Err == nil
+		}
+		return state, errors.Is(o.Err, tree_api.ErrKeyExists)
+	case tree_api.MethodFind:
+		if state < 0 {
+			return state, errors.Is(o.Err, tree_api.ErrKeyNotFound)
+		}
+		return state, o.Err == nil && equal(ops[state].Value, o.Value)
+	case tree_api.MethodDelete:
+		if state < 0 {
+			return state, errors.Is(o.Err, tree_api.ErrKeyNotFound)
+		}
+		return -1, o.Err == nil
+	}
+	return state, false
+}
+
+// lift takes a call and its return out of the list.
+func lift(call *entry) {
+	call.prev.next = call.next
+	call.next.prev = call.prev
+	ret := call.match
+	ret.prev.next = ret.next
+	if ret.next != nil {
+		ret.next.prev = ret.prev
+	}
+}
+
+// unlift puts back a call and its return that lift took out.
+func unlift(call *entry) {
+	ret := call.match
+	ret.prev.next = ret
+	if ret.next != nil {
+		ret.next.prev = ret
+	}
+	call.prev.next = call
+	call.next.prev = call
+}
+
+func formatOperations[K cmp.Ordered, V any](ops []OperationOf[K, V]) string {
+	var b strings.Builder
+	names := map[tree_api.Method]string{
+		tree_api.MethodFind:   "Find",
+		tree_api.MethodInsert: "Insert",
+		tree_api.MethodDelete: "Delete",
+	}
+	for _, op := range ops {
+		fmt.Fprintf(&b, "  [%d, %d] client %d: %s(%v)", op.Call, op.Return, op.ClientId, names[op.Method], op.Key)
+		if op.Method != tree_api.MethodDelete {
+			fmt.Fprintf(&b, " value %v", op.Value)
+		}
+		if op.Err != nil {
+			fmt.Fprintf(&b, " err %v", op.Err)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,141 @@
+package linearizability
+
+import (
+	"errors"
+	"fmt"
+	"main/art"
+	"main/blink_tree"
+	"main/bw_tree"
+	"main/crab"
+	"main/flat_combining_tree"
+	"main/global_lock_tree"
+	"main/lock_free"
+	"main/olc_tree"
+	"main/shard_tree"
+	"main/skip_list"
+	"main/tree_api"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestCheckAcceptsOverlappingOperations(t *testing.T) {
+	// The Find overlaps the Insert, so it may see the key either way.
+	history := []Operation{
+		{ClientId: 0, Method: tree_api.MethodInsert, Key: 1, Value: []byte("a"), Call: 1, Return: 4},
+		{ClientId: 1, Method: tree_api.MethodFind, Key: 1, Value: []byte("a"), Call: 2, Return: 3},
+		{ClientId: 2, Method: tree_api.MethodFind, Key: 1, Err: tree_api.ErrKeyNotFound, Call: 2, Return: 3},
+	}
+	if err := Check(history); err != nil {
+		t.Errorf("%s", err)
+	}
+}
+
+func TestCheckRejectsStaleRead(t *testing.T) {
+	// The Find starts after the Delete returned but still sees the value.
+	history := []Operation{
+		{ClientId: 0, Method: tree_api.MethodInsert, Key: 1, Value: []byte("a"), Call: 1, Return: 2},
+		{ClientId: 0, Method: tree_api.MethodDelete, Key: 1, Call: 3, Return: 4},
+		{ClientId: 1, Method: tree_api.MethodFind, Key: 1, Value: []byte("a"), Call: 5, Return: 6},
+		{ClientId: 1, Method: tree_api.MethodFind, Key: 2, Err: tree_api.ErrKeyNotFound, Call: 7, Return: 8},
+	}
+	err := Check(history)
+	if !errors.Is(err, ErrNotLinearizable) {
+		t.Errorf("expected ErrNotLinearizable and got %v", err)
+	}
+}
+
+func TestCheckRejectsLostInsert(t *testing.T) {
+	// Two overlapping inserts of the same key cannot both succeed.
+	history := []Operation{
+		{ClientId: 0, Method: tree_api.MethodInsert, Key: 1, Value: []byte("a"), Call: 1, Return: 3},
+		{ClientId: 1, Method: tree_api.MethodInsert, Key: 1, Value: []byte("b"), Call: 2, Return: 4},
+	}
+	if err := Check(history); !errors.Is(err, ErrNotLinearizable) {
+		t.Errorf("expected ErrNotLinearizable and got %v", err)
+	}
+}
+
+func TestHistoryInReturnOrder(t *testing.T) {
+	// A client that took the later return tick may record its operation
+	// first.
+	r := NewRecorder(crab.NewTree())
+	r.record(Operation{ClientId: 0, Method: tree_api.MethodFind, Key: 1, Call: 1, Return: 4})
+	r.record(Operation{ClientId: 1, Method: tree_api.MethodFind, Key: 2, Call: 2, Return: 3})
+	history := r.History()
+	if history[0].Return != 3 || history[1].Return != 4 {
+		t.Errorf("expected operations in the order they returned and got %+v", history)
+	}
+}
+
+// runClients has clients goroutines make random Inserts, Finds and Deletes on
+// a handful of keys, so that operations on the same key overlap often. Every
+// other key is inserted first so the racing writes split and merge nodes
+// rather than only touching the root.
+func runClients(tree tree_api.BPTree, clients, opsPerClient, keyCount int, seed int64) []Operation {
+	recorder := NewRecorder(tree)
+	for key := 0; key < keyCount; key += 2 {
+		recorder.Insert(clients, key, []byte("init"))
+	}
+	var wg sync.WaitGroup
+	for c := 0; c < clients; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed + int64(c)))
+			for i := 0; i < opsPerClient; i++ {
+				key := r.Intn(keyCount)
+				switch r.Intn(3) {
+				case 0:
+					recorder.Insert(c, key, []byte(fmt.Sprint(c, "-", i)))
+				case 1:
+					recorder.Find(c, key)
+				case 2:
+					recorder.Delete(c, key)
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+	return recorder.History()
+}
+
+func TestTreesAreLinearizable(t *testing.T) {
+	trees := map[string]func(...tree_api.Option) tree_api.BPTree{
+		"crab":        crab.NewTree,
+		"lock_free":   lock_free.NewTree,
+		"global_lock": global_lock_tree.NewTree,
+		"rw_lock":     global_lock_tree.NewRWTree,
+		"striped":     global_lock_tree.NewStripedTree,
+		"combining":   flat_combining_tree.NewTree,
+		"olc":         olc_tree.NewTree,
+		"blink":       blink_tree.NewTree,
+		"bw":          bw_tree.NewTree,
+		"art":         art.NewTree,
+		"skip_list":   skip_list.NewTree,
+		// A small window lets the shard tree split and merge shards while
+		// the histories are recorded.
+		"shard": func(opts ...tree_api.Option) tree_api.BPTree {
+			return shard_tree.NewTree(crab.NewTree, 4, 8, opts...)
+		},
+	}
+	// The OLC tree needs room for a key to spare when it splits or merges
+	// nodes ahead of time, so it starts at order 4.
+	minOrders := map[string]int{"olc": 4}
+	for name, newTree := range trees {
+		for _, order := range []int{3, 4, 8} {
+			if order < minOrders[name] {
+				continue
+			}
+			t.Run(fmt.Sprintf("%s/order=%d", name, order), func(t *testing.T) {
+				for seed := int64(0); seed < 5; seed++ {
+					tree := newTree(tree_api.WithOrder(order))
+					history := runClients(tree, 8, 200, 64, seed*100)
+					if err := Check(history); err != nil {
+						t.Fatalf("seed %d: %s", seed, err)
+					}
+				}
+			})
+		}
+	}
+}
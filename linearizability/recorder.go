@@ -0,0 +1,92 @@
+package linearizability
+
+import (
+	"cmp"
+	"main/tree_api"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// OperationOf is one call made through a RecorderOf. Call and Return are
+// ticks of the recorder's logical clock taken just before the call reached
+// the tree and just after it came back, so one operation finished before
+// another started exactly when its Return is below the other's Call.
+type OperationOf[K cmp.Ordered, V any] struct {
+	ClientId int
+	Method   tree_api.Method
+	Key      K
+	// Value is the value written by an Insert, or the value a Find returned.
+	Value  V
+	Err    error
+	Call   int64
+	Return int64
+}
+
+type Operation = OperationOf[int, []byte]
+
+// RecorderOf wraps a tree and keeps a history of every Insert, Find and
+// Delete made through it, for Check to verify afterwards. It is safe for use
+// by many goroutines at once; each should pass its own client id.
+type RecorderOf[K cmp.Ordered, V any] struct {
+	tree    tree_api.TreeOf[K, V]
+	clock   atomic.Int64
+	lock    sync.Mutex
+	history []OperationOf[K, V]
+}
+
+type Recorder = RecorderOf[int, []byte]
+
+func NewRecorder(tree tree_api.BPTree) *Recorder {
+	return NewRecorderOf(tree)
+}
+
+func NewRecorderOf[K cmp.Ordered, V any](tree tree_api.TreeOf[K, V]) *RecorderOf[K, V] {
+	return &RecorderOf[K, V]{tree: tree}
+}
+
+func (r *RecorderOf[K, V]) Insert(clientId int, key K, value V) error {
+	call := r.clock.Add(1)
+	err := r.tree.Insert(key, value)
+	r.record(OperationOf[K, V]{clientId, tree_api.MethodInsert, key, value, err, call, r.clock.Add(1)})
+	return err
+}
+
+func (r *RecorderOf[K, V]) Find(clientId int, key K) (*tree_api.RecordOf[V], error) {
+	call := r.clock.Add(1)
+	record, err := r.tree.Find(key, false)
+	ret := r.clock.Add(1)
+	var value V
+	if record != nil {
+		value = record.Value
+	}
+	r.record(OperationOf[K, V]{clientId, tree_api.MethodFind, key, value, err, call, ret})
+	return record, err
+}
+
+func (r *RecorderOf[K, V]) Delete(clientId int, key K) error {
+	call := r.clock.Add(1)
+	err := r.tree.Delete(key)
+	var value V
+	r.record(OperationOf[K, V]{clientId, tree_api.MethodDelete, key, value, err, call, r.clock.Add(1)})
+	return err
+}
+
+// History returns a copy of the operations recorded so far, in the order they
+// returned. Operations are recorded after their return tick is taken, so they
+// may be recorded out of that order and are sorted here.
+func (r *RecorderOf[K, V]) History() []OperationOf[K, V] {
+	r.lock.Lock()
+	history := slices.Clone(r.history)
+	r.lock.Unlock()
+	slices.SortFunc(history, func(a, b OperationOf[K, V]) int {
+		return cmp.Compare(a.Return, b.Return)
+	})
+	return history
+}
+
+func (r *RecorderOf[K, V]) record(op OperationOf[K, V]) {
+	r.lock.Lock()
+	r.history = append(r.history, op)
+	r.lock.Unlock()
+}
@@ -0,0 +1,182 @@
+package lock_free
+
+import (
+	"cmp"
+	"errors"
+	"main/tree_api"
+	"sync"
+	"time"
+)
+
+var ErrBatcherClosed = errors.New("batcher is closed")
+
+// BatcherOf collects single-key operations from any number of goroutines into
+// batches and runs each batch through Palm. A batch is run as soon as it holds
+// maxBatch queries, or maxDelay after its first query arrived, whichever comes
+// first. Batches run one at a time, in the order their queries were accepted,
+// so operations submitted by one goroutine take effect in the order it made
+// them.
+//
+// Point operations made directly on the tree are safe alongside the batcher,
+// and never wait for a batch, but are not ordered with the batched ones.
+type BatcherOf[K cmp.Ordered, V any] struct {
+	tree     *LockFreeTreeOf[K, V]
+	maxBatch int
+	maxDelay time.Duration
+	threads  int
+
+	mu       sync.RWMutex // guards closed against sends on requests
+	closed   bool
+	requests chan batchRequestOf[K, V]
+	stopped  chan struct{}
+}
+
+type Batcher = BatcherOf[int, []byte]
+
+type batchRequestOf[K cmp.Ordered, V any] struct {
+	query  tree_api.QueryOf[K, V]
+	future *FutureOf[V]
+}
+
+// FutureOf is the pending result of an operation submitted to a batcher.
+type FutureOf[V any] struct {
+	done   chan struct{}
+	result tree_api.ResultOf[V]
+}
+
+type Future = FutureOf[[]byte]
+
+// Done is closed once the result is available.
+func (f *FutureOf[V]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the operation's batch has run and returns its result.
+func (f *FutureOf[V]) Wait() tree_api.ResultOf[V] {
+	<-f.done
+	return f.result
+}
+
+func (f *FutureOf[V]) complete(result tree_api.ResultOf[V]) {
+	f.result = result
+	close(f.done)
+}
+
+// NewBatcher starts a batcher that runs batches of at most maxBatch queries
+// on tree, waiting at most maxDelay to fill one, with threads Palm threads.
+func NewBatcher(tree *LockFreeTree, maxBatch int, maxDelay time.Duration, threads int) *Batcher {
+	return NewBatcherOf(tree, maxBatch, maxDelay, threads)
+}
+
+func NewBatcherOf[K cmp.Ordered, V any](tree *LockFreeTreeOf[K, V], maxBatch int, maxDelay time.Duration, threads int) *BatcherOf[K, V] {
+	if maxBatch < 1 {
+		panic("batcher needs room for at least one query per batch")
+	}
+	if threads < 1 {
+		panic("batcher needs at least one Palm thread")
+	}
+	b := &BatcherOf[K, V]{
+		tree:     tree,
+		maxBatch: maxBatch,
+		maxDelay: maxDelay,
+		threads:  threads,
+		requests: make(chan batchRequestOf[K, V], maxBatch),
+		stopped:  make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+func (b *BatcherOf[K, V]) Insert(key K, value V) *FutureOf[V] {
+	return b.submit(tree_api.MethodInsert, key, &tree_api.RecordOf[V]{Value: value})
+}
+
+func (b *BatcherOf[K, V]) Upsert(key K, value V) *FutureOf[V] {
+	return b.submit(tree_api.MethodUpsert, key, &tree_api.RecordOf[V]{Value: value})
+}
+
+func (b *BatcherOf[K, V]) Find(key K) *FutureOf[V] {
+	return b.submit(tree_api.MethodFind, key, nil)
+}
+
+func (b *BatcherOf[K, V]) Delete(key K) *FutureOf[V] {
+	return b.submit(tree_api.MethodDelete, key, nil)
+}
+
+// Close runs whatever has already been submitted and stops the batcher.
+// Operations submitted afterwards fail with ErrBatcherClosed. It is safe to
+// call more than once.
+func (b *BatcherOf[K, V]) Close() error {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.requests)
+	}
+	b.mu.Unlock()
+	<-b.stopped
+	return nil
+}
+
+func (b *BatcherOf[K, V]) submit(method tree_api.Method, key K, record *tree_api.RecordOf[V]) *FutureOf[V] {
+	future := &FutureOf[V]{done: make(chan struct{})}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		future.complete(tree_api.ResultOf[V]{Err: ErrBatcherClosed})
+		return future
+	}
+	b.requests <- batchRequestOf[K, V]{tree_api.QueryOf[K, V]{Method: method, Key: key, Pointer: record}, future}
+	return future
+}
+
+// run owns the pending batch. The deadline timer only runs while a batch is
+// pending, and is armed by the first query of each batch.
+func (b *BatcherOf[K, V]) run() {
+	defer close(b.stopped)
+	pending := make([]batchRequestOf[K, V], 0, b.maxBatch)
+	timer := time.NewTimer(b.maxDelay)
+	stopTimer(timer)
+	for {
+		select {
+		case r, ok := <-b.requests:
+			if !ok {
+				b.flush(pending)
+				return
+			}
+			if len(pending) == 0 {
+				timer.Reset(b.maxDelay)
+			}
+			pending = append(pending, r)
+			if len(pending) < b.maxBatch {
+				continue
+			}
+			stopTimer(timer)
+		case <-timer.C:
+		}
+		b.flush(pending)
+		pending = pending[:0]
+	}
+}
+
+// stopTimer stops an armed timer whose channel has not been read, draining it
+// if it already fired, so that the next Reset starts clean.
+func stopTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		<-timer.C
+	}
+}
+
+// flush runs one batch through Palm and hands every caller its own result.
+func (b *BatcherOf[K, V]) flush(pending []batchRequestOf[K, V]) {
+	if len(pending) == 0 {
+		return
+	}
+	queries := make([]tree_api.QueryOf[K, V], len(pending))
+	for i, r := range pending {
+		queries[i] = r.query
+	}
+	results := b.tree.Palm(queries, b.threads)
+	for i, r := range pending {
+		r.future.complete(results[i])
+	}
+}
@@ -0,0 +1,93 @@
+package lock_free
+
+import (
+	"errors"
+	"fmt"
+	"main/tree_api"
+	"main/tree_testing"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatcherConcurrentCallers(t *testing.T) {
+	const callers = 16
+	const keysPerCaller = 200
+	tree := NewTreeOf[int, []byte](tree_api.WithOrder(8)).(*LockFreeTree)
+	b := NewBatcher(tree, 64, time.Millisecond, 4)
+
+	var wg sync.WaitGroup
+	for c := 0; c < callers; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			for i := 0; i < keysPerCaller; i++ {
+				key := i*callers + c
+				if res := b.Insert(key, []byte(fmt.Sprint(key))).Wait(); res.Err != nil {
+					t.Errorf("insert %d: %s", key, res.Err)
+				}
+				res := b.Find(key).Wait()
+				if res.Err != nil || string(res.Record.Value) != fmt.Sprint(key) {
+					t.Errorf("find %d: %+v", key, res)
+				}
+				if i%2 == 0 {
+					if res := b.Delete(key).Wait(); res.Err != nil {
+						t.Errorf("delete %d: %s", key, res.Err)
+					}
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+	b.Close()
+
+	want := make(map[int]string)
+	for c := 0; c < callers; c++ {
+		for i := 1; i < keysPerCaller; i += 2 {
+			key := i*callers + c
+			want[key] = fmt.Sprint(key)
+		}
+	}
+	tree_testing.CheckContents(t, tree, want)
+}
+
+func TestBatcherDeadline(t *testing.T) {
+	tree := NewTreeOf[int, []byte]().(*LockFreeTree)
+	b := NewBatcher(tree, 1000, 5*time.Millisecond, 1)
+	defer b.Close()
+
+	// A lone query never fills its batch, so only the deadline can run it.
+	f := b.Insert(1, []byte("one"))
+	select {
+	case <-f.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch did not run after its deadline")
+	}
+	if res := f.Wait(); res.Err != nil {
+		t.Errorf("insert: %s", res.Err)
+	}
+	if res := b.Insert(1, []byte("again")).Wait(); !errors.Is(res.Err, tree_api.ErrKeyExists) {
+		t.Errorf("expected ErrKeyExists and got %v", res.Err)
+	}
+}
+
+func TestBatcherClose(t *testing.T) {
+	tree := NewTreeOf[int, []byte]().(*LockFreeTree)
+	b := NewBatcher(tree, 1000, time.Hour, 2)
+
+	// Close runs what is pending rather than waiting for the deadline.
+	futures := make([]*Future, 0)
+	for i := 0; i < 10; i++ {
+		futures = append(futures, b.Insert(i, []byte(fmt.Sprint(i))))
+	}
+	b.Close()
+	for i, f := range futures {
+		if res := f.Wait(); res.Err != nil {
+			t.Errorf("insert %d: %s", i, res.Err)
+		}
+	}
+	if res := b.Find(0).Wait(); !errors.Is(res.Err, ErrBatcherClosed) {
+		t.Errorf("expected ErrBatcherClosed and got %v", res.Err)
+	}
+	b.Close()
+}
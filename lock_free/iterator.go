@@ -0,0 +1,219 @@
+package lock_free
+
+import (
+	"cmp"
+	"main/tree_api"
+)
+
+// IteratorOf walks the keys of a LockFreeTree in order, without latches. It
+// keeps the contents of each node on the path from the root to its leaf as it
+// loaded them, so a move within a leaf sees that leaf as it was when the
+// iterator reached it, and a move to the next leaf loads it afresh. A node's
+// keys never leave the range its parent gives it, as point operations and
+// Palm split nodes by replacing them rather than moving keys between nodes,
+// and only drop leaves that are empty, so the iterator sees every key present
+// throughout the walk, in order.
+//
+// Nodes have no sibling pointers, so the iterator moves between leaves through
+// their common ancestor.
+type IteratorOf[K cmp.Ordered, V any] struct {
+	tree      *LockFreeTreeOf[K, V]
+	path      []frameOf[K, V]
+	started   bool
+	exhausted bool
+	closed    bool
+}
+
+// frameOf is one level of an iterator's path. For an internal node index is
+// the child the path continues through; for the leaf it is the current key.
+type frameOf[K cmp.Ordered, V any] struct {
+	contents *contentsOf[K, V]
+	index    int
+}
+
+func (t *LockFreeTreeOf[K, V]) NewIterator() tree_api.IteratorOf[K, V] {
+	return &IteratorOf[K, V]{tree: t}
+}
+
+func (it *IteratorOf[K, V]) Seek(key K) bool {
+	if it.closed {
+		return false
+	}
+	it.started = true
+	if !it.position(key) {
+		return it.exhaust()
+	}
+	return it.settleForward()
+}
+
+func (it *IteratorOf[K, V]) Next() bool {
+	if it.closed || it.exhausted {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		root := it.tree.root.Load()
+		if root == nil {
+			return it.exhaust()
+		}
+		it.path = it.path[:0]
+		it.descendFirst(root)
+		return it.settleForward()
+	}
+	it.leaf().index += 1
+	return it.settleForward()
+}
+
+func (it *IteratorOf[K, V]) Prev() bool {
+	if it.closed || it.exhausted {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		root := it.tree.root.Load()
+		if root == nil {
+			return it.exhaust()
+		}
+		it.path = it.path[:0]
+		it.descendLast(root)
+		return it.settleBackward()
+	}
+	it.leaf().index -= 1
+	return it.settleBackward()
+}
+
+func (it *IteratorOf[K, V]) Key() K {
+	if !it.valid() {
+		var zero K
+		return zero
+	}
+	return it.key()
+}
+
+func (it *IteratorOf[K, V]) Value() *tree_api.RecordOf[V] {
+	if !it.valid() {
+		return nil
+	}
+	f := it.leaf()
+	r, _ := f.contents.Pointers[f.index].(*tree_api.RecordOf[V])
+	return r
+}
+
+func (it *IteratorOf[K, V]) Err() error {
+	if it.closed {
+		return tree_api.ErrIteratorClosed
+	}
+	return nil
+}
+
+func (it *IteratorOf[K, V]) Close() error {
+	it.closed = true
+	it.path = nil
+	return nil
+}
+
+func (it *IteratorOf[K, V]) key() K {
+	f := it.leaf()
+	return f.contents.Keys[f.index]
+}
+
+func (it *IteratorOf[K, V]) leaf() *frameOf[K, V] {
+	return &it.path[len(it.path)-1]
+}
+
+func (it *IteratorOf[K, V]) valid() bool {
+	if it.closed || it.exhausted || len(it.path) == 0 {
+		return false
+	}
+	f := it.leaf()
+	return f.index >= 0 && f.index < len(f.contents.Keys)
+}
+
+func (it *IteratorOf[K, V]) exhaust() bool {
+	it.exhausted = true
+	it.path = it.path[:0]
+	return false
+}
+
+// position loads the path to the leaf for key, with the leaf's index on the
+// first key at or above key, which may be one past its last. It reports
+// false for an empty tree.
+func (it *IteratorOf[K, V]) position(key K) bool {
+	root := it.tree.root.Load()
+	if root == nil {
+		return false
+	}
+	it.path = it.path[:0]
+	n := root
+	for !n.IsLeaf {
+		c := n.load()
+		i := childIndex(c.Keys, key)
+		it.path = append(it.path, frameOf[K, V]{c, i})
+		n = c.Pointers[i].(*NodeOf[K, V])
+	}
+	c := n.load()
+	i := 0
+	for i < len(c.Keys) && c.Keys[i] < key {
+		i += 1
+	}
+	it.path = append(it.path, frameOf[K, V]{c, i})
+	return true
+}
+
+// descendFirst extends the path from n down to its leftmost key.
+func (it *IteratorOf[K, V]) descendFirst(n *NodeOf[K, V]) {
+	for !n.IsLeaf {
+		c := n.load()
+		it.path = append(it.path, frameOf[K, V]{c, 0})
+		n = c.Pointers[0].(*NodeOf[K, V])
+	}
+	it.path = append(it.path, frameOf[K, V]{n.load(), 0})
+}
+
+// descendLast extends the path from n down to its rightmost key.
+func (it *IteratorOf[K, V]) descendLast(n *NodeOf[K, V]) {
+	for !n.IsLeaf {
+		c := n.load()
+		it.path = append(it.path, frameOf[K, V]{c, len(c.Keys)})
+		n = c.Pointers[len(c.Keys)].(*NodeOf[K, V])
+	}
+	c := n.load()
+	it.path = append(it.path, frameOf[K, V]{c, len(c.Keys) - 1})
+}
+
+// settleForward moves past the end of exhausted leaves until the iterator
+// points at a key or runs off the end of the tree.
+func (it *IteratorOf[K, V]) settleForward() bool {
+	for it.leaf().index >= len(it.leaf().contents.Keys) {
+		it.path = it.path[:len(it.path)-1]
+		for len(it.path) > 0 && it.leaf().index == len(it.leaf().contents.Keys) {
+			it.path = it.path[:len(it.path)-1]
+		}
+		if len(it.path) == 0 {
+			return it.exhaust()
+		}
+		parent := it.leaf()
+		parent.index += 1
+		it.descendFirst(parent.contents.Pointers[parent.index].(*NodeOf[K, V]))
+	}
+	it.exhausted = false
+	return true
+}
+
+// settleBackward is settleForward in the other direction.
+func (it *IteratorOf[K, V]) settleBackward() bool {
+	for it.leaf().index < 0 {
+		it.path = it.path[:len(it.path)-1]
+		for len(it.path) > 0 && it.leaf().index == 0 {
+			it.path = it.path[:len(it.path)-1]
+		}
+		if len(it.path) == 0 {
+			return it.exhaust()
+		}
+		parent := it.leaf()
+		parent.index -= 1
+		it.descendLast(parent.contents.Pointers[parent.index].(*NodeOf[K, V]))
+	}
+	it.exhausted = false
+	return true
+}
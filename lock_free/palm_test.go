@@ -0,0 +1,197 @@
+package lock_free
+
+import (
+	"errors"
+	"fmt"
+	"main/tree_api"
+	"main/tree_testing"
+	"math/rand"
+	"testing"
+)
+
+func TestPalmResultsInInputOrder(t *testing.T) {
+	tree := NewTree().(*LockFreeTree)
+	for i := 0; i < 100; i++ {
+		err := tree.Insert(i, []byte("old"))
+		if err != nil {
+			t.Errorf("%s", err)
+		}
+	}
+
+	queries := []tree_api.Query{
+		{Method: tree_api.MethodFind, Key: 42},
+		{Method: tree_api.MethodFind, Key: 1000},
+		{Method: tree_api.MethodUpsert, Key: 7, Pointer: &tree_api.Record{Value: []byte("new")}},
+		{Method: tree_api.MethodInsert, Key: 9, Pointer: &tree_api.Record{Value: []byte("new")}},
+		{Method: tree_api.MethodDelete, Key: 2000},
+		{Method: tree_api.MethodFind, Key: 3},
+	}
+	results := tree.Palm(queries, 4)
+
+	if len(results) != len(queries) {
+		t.Fatalf("expected %d results and got %d", len(queries), len(results))
+	}
+	for i, q := range queries {
+		if !q.Done {
+			t.Errorf("query %d was not marked done", i)
+		}
+	}
+	expectFound := func(i int, key int, value string) {
+		r := results[i]
+		if !r.Found || r.Err != nil || r.Record == nil || string(r.Record.Value) != value {
+			t.Errorf("query %d: expected %d -> %s and got %+v", i, key, value, r)
+		}
+	}
+	expectFound(0, 42, "old")
+	expectFound(5, 3, "old")
+	if results[1].Found || !errors.Is(results[1].Err, tree_api.ErrKeyNotFound) {
+		t.Errorf("query 1: expected %v and got %+v", tree_api.ErrKeyNotFound, results[1])
+	}
+	if !results[2].Found || results[2].Err != nil || string(results[2].Record.Value) != "new" {
+		t.Errorf("query 2: expected an upsert and got %+v", results[2])
+	}
+	if !errors.Is(results[3].Err, tree_api.ErrKeyExists) || string(results[3].Record.Value) != "old" {
+		t.Errorf("query 3: expected %v and got %+v", tree_api.ErrKeyExists, results[3])
+	}
+	if !errors.Is(results[4].Err, tree_api.ErrKeyNotFound) {
+		t.Errorf("query 4: expected %v and got %+v", tree_api.ErrKeyNotFound, results[4])
+	}
+
+	r, err := tree.Find(7, false)
+	if err != nil || string(r.Value) != "new" {
+		t.Errorf("expected the upsert to be stored and got %v, %v", r, err)
+	}
+	r, err = tree.Find(9, false)
+	if err != nil || string(r.Value) != "old" {
+		t.Errorf("expected the duplicate insert to be ignored and got %v, %v", r, err)
+	}
+}
+
+func makeInsertQueries(keys []int) []tree_api.Query {
+	queries := make([]tree_api.Query, 0, len(keys))
+	for _, key := range keys {
+		queries = append(queries, tree_api.Query{Method: tree_api.MethodInsert, Key: key, Pointer: &tree_api.Record{Value: []byte(fmt.Sprint(key))}})
+	}
+	return queries
+}
+
+func TestPalmInsertsFreshKeys(t *testing.T) {
+	for _, order := range []int{3, 4, 16} {
+		tree := NewTree(tree_api.WithOrder(order)).(*LockFreeTree)
+		want := make(map[int]string)
+		keys := rand.New(rand.NewSource(int64(order))).Perm(1000)
+		for _, key := range keys {
+			want[key] = fmt.Sprint(key)
+		}
+
+		// Two batches, so the second one lands in a tree that already has
+		// structure above the leaves.
+		for _, batch := range [][]int{keys[:300], keys[300:]} {
+			results := tree.Palm(makeInsertQueries(batch), 8)
+			for i, r := range results {
+				if r.Err != nil || r.Found {
+					t.Errorf("order %d: insert of %d: %+v", order, batch[i], r)
+				}
+			}
+		}
+		tree_testing.CheckContents(t, tree, want)
+	}
+}
+
+func TestPalmConflictingQueries(t *testing.T) {
+	tree := NewTree().(*LockFreeTree)
+	record := func(value string) *tree_api.Record {
+		return &tree_api.Record{Value: []byte(value)}
+	}
+	queries := []tree_api.Query{
+		{Method: tree_api.MethodFind, Key: 5},
+		{Method: tree_api.MethodInsert, Key: 5, Pointer: record("a")},
+		{Method: tree_api.MethodFind, Key: 5},
+		{Method: tree_api.MethodInsert, Key: 5, Pointer: record("b")},
+		{Method: tree_api.MethodUpsert, Key: 5, Pointer: record("c")},
+		{Method: tree_api.MethodFind, Key: 5},
+		{Method: tree_api.MethodDelete, Key: 5},
+		{Method: tree_api.MethodDelete, Key: 5},
+		{Method: tree_api.MethodInsert, Key: 5, Pointer: record("d")},
+		{Method: tree_api.MethodInsert, Key: 1, Pointer: record("e")},
+	}
+	results := tree.Palm(queries, 4)
+
+	expected := []struct {
+		found bool
+		value string
+		err   error
+	}{
+		{false, "", tree_api.ErrKeyNotFound},
+		{false, "a", nil},
+		{true, "a", nil},
+		{true, "a", tree_api.ErrKeyExists},
+		{true, "c", nil},
+		{true, "c", nil},
+		{true, "c", nil},
+		{false, "", tree_api.ErrKeyNotFound},
+		{false, "d", nil},
+		{false, "e", nil},
+	}
+	for i, e := range expected {
+		r := results[i]
+		value := ""
+		if r.Record != nil {
+			value = string(r.Record.Value)
+		}
+		if r.Found != e.found || value != e.value || !errors.Is(r.Err, e.err) {
+			t.Errorf("query %d: expected %+v and got %+v", i, e, r)
+		}
+	}
+	tree_testing.CheckContents(t, tree, map[int]string{1: "e", 5: "d"})
+}
+
+func TestPalmDeletesKeepValues(t *testing.T) {
+	for _, order := range []int{3, 4, 16} {
+		tree := NewTree(tree_api.WithOrder(order)).(*LockFreeTree)
+		want := make(map[int]string)
+		keys := make([]int, 0)
+		for i := 0; i < 1000; i++ {
+			keys = append(keys, i)
+			want[i] = fmt.Sprint(i)
+		}
+		tree.Palm(makeInsertQueries(keys), 8)
+
+		// Deleting most keys empties many leaves, which Palm drops from the
+		// tree, and leaves the rest underfull.
+		queries := make([]tree_api.Query, 0)
+		for i := 0; i < 1000; i++ {
+			if i%7 != 0 {
+				queries = append(queries, tree_api.Query{Method: tree_api.MethodDelete, Key: i})
+				delete(want, i)
+			}
+		}
+		for i, r := range tree.Palm(queries, 8) {
+			if r.Err != nil || !r.Found {
+				t.Errorf("order %d: delete of %d: %+v", order, queries[i].Key, r)
+			}
+		}
+		tree_testing.CheckContents(t, tree, want)
+	}
+}
+
+// An insert of an absent key with no record has a zero result, but is still
+// applied and marked done.
+func TestPalmMarksNilRecordInsertsDone(t *testing.T) {
+	tree := NewTree().(*LockFreeTree)
+	queries := []tree_api.Query{
+		{Method: tree_api.MethodInsert, Key: 1},
+		{Method: tree_api.MethodUpsert, Key: 2},
+	}
+	results := tree.Palm(queries, 2)
+	for i, q := range queries {
+		if !q.Done {
+			t.Errorf("query %d was not marked done: %+v", i, results[i])
+		}
+	}
+	for _, key := range []int{1, 2} {
+		if r, err := tree.Find(key, false); err != nil || r != nil {
+			t.Errorf("expected %d to hold no record and got %v, %v", key, r, err)
+		}
+	}
+}
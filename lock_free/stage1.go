@@ -8,21 +8,23 @@ import (
 )
 
 // Evenly distributes queries across all threads, return slice corresponding to ith thread
-func (t *LockFreeTree) PartitionInput(Q []tree_api.Query, i int, num_threads int) []tree_api.Query {
+func (t *LockFreeTreeOf[K, V]) PartitionInput(Q []tree_api.QueryOf[K, V], i int, num_threads int) []tree_api.QueryOf[K, V] {
 	num_queries := len(Q)
-	start := i * (num_queries / num_threads) // because will never have 0 threads
-	end := start + (num_queries / num_threads)
+	// Spread the remainder so that every query lands in some partition
+	start := i * num_queries / num_threads // because will never have 0 threads
+	end := (i + 1) * num_queries / num_threads
 	res := Q[start:end]
 
 	return res
 }
 
-func (t *LockFreeTree) FindMultiple(Q []tree_api.Query) [](*Node) {
-	res := [](*Node){}
-	verbose := false // debugging purposes
-	for _, q := range Q {
-		key := q.Key
-		node := t.findLeaf(key, verbose)
+// FindMultiple finds the leaf for every query in Q, which starts at offset in
+// the whole batch, and records it in leafOf. It returns the distinct leaves.
+func (t *LockFreeTreeOf[K, V]) FindMultiple(Q []tree_api.QueryOf[K, V], offset int, leafOf []*NodeOf[K, V]) [](*NodeOf[K, V]) {
+	res := [](*NodeOf[K, V]){}
+	for idx, q := range Q {
+		node, _ := t.findLeaf(q.Key, false)
+		leafOf[offset+idx] = node
 		if !slices.Contains(res, node) {
 			res = append(res, node)
 		}
@@ -30,30 +32,34 @@ func (t *LockFreeTree) FindMultiple(Q []tree_api.Query) [](*Node) {
 	return res
 }
 
-func (t *LockFreeTree) Stage1Logic(Q []tree_api.Query, i int, num_threads int) []*Node {
+func (t *LockFreeTreeOf[K, V]) Stage1Logic(Q []tree_api.QueryOf[K, V], i int, num_threads int, leafOf []*NodeOf[K, V]) []*NodeOf[K, V] {
 	// Stage 1
 	Q_i := t.PartitionInput(Q, i, num_threads)
-	L_i := t.FindMultiple(Q_i)
+	L_i := t.FindMultiple(Q_i, i*len(Q)/num_threads, leafOf)
 	return L_i
 }
 
-func (t *LockFreeTree) modifySharedLeaves(index int, sharedLeafData [][]*Node, queries []tree_api.Query, palmMaxThreadCount int, wg *sync.WaitGroup) {
+func (t *LockFreeTreeOf[K, V]) modifySharedLeaves(index int, sharedLeafData [][]*NodeOf[K, V], queries []tree_api.QueryOf[K, V], leafOf []*NodeOf[K, V], palmMaxThreadCount int, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	res := t.Stage1Logic(queries, index, palmMaxThreadCount)
+	res := t.Stage1Logic(queries, index, palmMaxThreadCount, leafOf)
 	sharedLeafData[index] = res
 }
 
-func (t *LockFreeTree) Stage1(queries []tree_api.Query, palmMaxThreadCount int) [][]*Node {
+// Stage1 finds the leaf each query belongs to. Besides the leaves each thread
+// found, it returns the leaf of every query, indexed like queries, which is
+// where Stage 2 applies the query.
+func (t *LockFreeTreeOf[K, V]) Stage1(queries []tree_api.QueryOf[K, V], palmMaxThreadCount int) ([][]*NodeOf[K, V], []*NodeOf[K, V]) {
 	var wg1 sync.WaitGroup
 	dbg := false
-	sharedLeafData := make([][]*Node, palmMaxThreadCount)
+	sharedLeafData := make([][]*NodeOf[K, V], palmMaxThreadCount)
 	for i := 0; i < palmMaxThreadCount; i++ {
-		sharedLeafData[i] = make([]*Node, 0)
+		sharedLeafData[i] = make([]*NodeOf[K, V], 0)
 	}
+	leafOf := make([]*NodeOf[K, V], len(queries))
 	for i := 0; i < palmMaxThreadCount; i++ {
 		wg1.Add(1) // Increment the counter for each goroutine
-		go t.modifySharedLeaves(i, sharedLeafData, queries, palmMaxThreadCount, &wg1)
+		go t.modifySharedLeaves(i, sharedLeafData, queries, leafOf, palmMaxThreadCount, &wg1)
 	}
 	wg1.Wait()
 
@@ -63,15 +69,16 @@ func (t *LockFreeTree) Stage1(queries []tree_api.Query, palmMaxThreadCount int)
 			fmt.Printf("index: %d\n", idx)
 			for _, l := range L_i {
 				fmt.Printf("Leaf: ")
-				for i := 0; i < l.NumKeys; i++ {
+				c := l.load()
+				for i, key := range c.Keys {
 					if verbose_output {
-						fmt.Printf("%d \n", l.Pointers[i])
+						fmt.Printf("%d \n", c.Pointers[i])
 					}
-					fmt.Printf("%d ", l.Keys[i])
+					fmt.Printf("%v ", key)
 				}
 				fmt.Printf("\n")
 			}
 		}
 	}
-	return sharedLeafData
+	return sharedLeafData, leafOf
 }
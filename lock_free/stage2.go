@@ -1,166 +1,233 @@
 package lock_free
 
 import (
+	"cmp"
 	"fmt"
 	"main/tree_api"
 	"slices"
 	"sync"
 )
 
-func (t *LockFreeTree) PrintLeaf(l *Node, idx int) {
+func (t *LockFreeTreeOf[K, V]) PrintLeaf(l *NodeOf[K, V], idx int) {
 	if idx > -1 {
 		fmt.Printf("Leaf %d: ", idx)
 	} else {
 		fmt.Printf("Leaf: ")
 	}
-	for i := 0; i < l.NumKeys; i++ {
+	c := l.load()
+	for i, key := range c.Keys {
 		if verbose_output {
-			fmt.Printf("%d \n", l.Pointers[i])
+			fmt.Printf("%d \n", c.Pointers[i])
 		}
-		fmt.Printf("%d ", l.Keys[i])
+		fmt.Printf("%v ", key)
 	}
 	fmt.Printf("\n")
 }
 
-func (t *LockFreeTree) RedistributeWorkLeaves(index int, sharedLeafData [][]*Node) []*Node {
+// RedistributeWorkLeaves gives each leaf to the lowest numbered thread that
+// found it in Stage 1, so that every leaf is modified by exactly one thread.
+func (t *LockFreeTreeOf[K, V]) RedistributeWorkLeaves(index int, sharedLeafData [][]*NodeOf[K, V]) []*NodeOf[K, V] {
 	if index == 0 {
 		return sharedLeafData[index]
 	}
-	L_i_prime := make([]*Node, 0)
+	L_i_prime := make([]*NodeOf[K, V], 0)
 	curr_L_i := sharedLeafData[index]
 	for _, lam := range curr_L_i {
+		owned := true
 		for j := 0; j < index; j++ {
-			L_j := sharedLeafData[j]
-			if slices.Contains(L_j, lam) { // in L_i, not in any L_j prior
+			if slices.Contains(sharedLeafData[j], lam) { // in L_i, not in any L_j prior
+				owned = false
 				break
 			}
-			if !slices.Contains(L_i_prime, lam) { // might be an unnecessary check
-				L_i_prime = append(L_i_prime, lam)
-			}
-			// L_i_prime = append(L_i_prime, lam)
+		}
+		if owned {
+			L_i_prime = append(L_i_prime, lam)
 		}
 	}
 	return L_i_prime
 }
 
-func (t *LockFreeTree) ResolveHazards(L_i_prime []*Node, queries []tree_api.Query) ([]*tree_api.Record, map[*Node]([]tree_api.Query)) {
-	res := make([]*tree_api.Record, 0)
-	findQueries := make([]tree_api.Query, 0)
-	O_L_i := make(map[*Node]([]tree_api.Query))
+// ResolveHazards collects the queries that Stage 1 routed to this thread's
+// leaves. Queries are referred to by their index in the batch so their
+// results land in the matching slot. Each leaf's queries are ordered by key,
+// and queries on the same key keep their order in the batch, so conflicting
+// operations take effect in the order they were submitted.
+func (t *LockFreeTreeOf[K, V]) ResolveHazards(L_i_prime []*NodeOf[K, V], queries []tree_api.QueryOf[K, V], leafOf []*NodeOf[K, V]) map[*NodeOf[K, V]]([]int) {
+	O_L_i := make(map[*NodeOf[K, V]]([]int))
+	for _, node := range L_i_prime {
+		O_L_i[node] = make([]int, 0)
+	}
 
 	// Extract queries relevant to this (index-th) thread
-	for _, q := range queries {
-		// Iterate over *my* leaves
-		for _, node := range L_i_prime {
-			if slices.Contains(node.Keys, q.Key) {
-				// Found a query that affects one of this thread's leaves
-				if q.Method == tree_api.MethodFind {
-					findQueries = append(findQueries, q) // to be serviced here
-					break
-				} else if q.Method == tree_api.MethodInsert || q.Method == tree_api.MethodDelete {
-					// Add other queries into map, to be serviced later
-					val, ok := O_L_i[node]
-					if !ok {
-						val := make([]tree_api.Query, 0)
-						O_L_i[node] = append(val, q)
-					} else {
-						O_L_i[node] = append(val, q)
-					}
-					break
-				}
-			}
+	for idx, node := range leafOf {
+		if indices, ok := O_L_i[node]; ok {
+			O_L_i[node] = append(indices, idx)
 		}
 	}
-	// Service appropriate find queries
-	for _, q := range findQueries {
-		val, err := t.Find(q.Key, false)
-		if err == nil {
-			res = append(res, val)
-		}
+	for _, indices := range O_L_i {
+		slices.SortStableFunc(indices, func(a, b int) int {
+			return cmp.Compare(queries[a].Key, queries[b].Key)
+		})
 	}
-	return res, O_L_i
+	return O_L_i
 }
 
-func addModificationIntoList(node *Node, mod *Modification, M_i map[*Node]([]*Modification)) map[*Node]([]*Modification) {
-	val, ok := M_i[node]
-	if !ok {
-		val = make([]*Modification, 0)
-		M_i[node] = append(val, mod)
-	} else {
-		M_i[node] = append(val, mod)
+// resolve records the result of the idx-th query and marks it resolved. Each
+// query is resolved by exactly one thread. The queries themselves are shared
+// by all threads and are only marked Done once the batch is over.
+func resolve[V any](results []tree_api.ResultOf[V], resolved []bool, idx int, result tree_api.ResultOf[V]) {
+	results[idx] = result
+	resolved[idx] = true
+}
+
+// addModification adds the replacement of the frozen node child to M_i under
+// child's parent, or under nil if child is the root. A child that is no
+// longer in the tree has been replaced by a point operation already.
+func (t *LockFreeTreeOf[K, V]) addModification(child *NodeOf[K, V], frozen *contentsOf[K, V], M_i map[*NodeOf[K, V]]([]*ModificationOf[K, V])) {
+	parent, _, found := t.findParent(child, frozen.replacement.key)
+	if !found {
+		return
+	}
+	M_i[parent] = append(M_i[parent], &ModificationOf[K, V]{parent, child, frozen})
+}
+
+func (t *LockFreeTreeOf[K, V]) ModifyLeafNode(queries []tree_api.QueryOf[K, V], queriesToBeServiced map[*NodeOf[K, V]]([]int), results []tree_api.ResultOf[V], resolved []bool) map[*NodeOf[K, V]]([]*ModificationOf[K, V]) {
+	M_i := make(map[*NodeOf[K, V]]([]*ModificationOf[K, V]))
+	for node, indices := range queriesToBeServiced {
+		t.modifyLeaf(node, indices, queries, results, resolved, M_i)
 	}
 	return M_i
 }
 
-func (t *LockFreeTree) ModifyLeafNode(queriesToBeServiced map[*Node]([]tree_api.Query), L_i_prime []*Node) map[*Node]([]*Modification) {
-	M_i := make(map[*Node]([]*Modification))
-	for node, queries := range queriesToBeServiced {
-		for _, q := range queries {
-			if q.Method == tree_api.MethodInsert {
-				node.Keys = append(node.Keys, -1)
-				node.Pointers = append(node.Pointers, nil)
-				insertIntoLeaf(node, q.Key, q.Pointer)
-			} else if q.Method == tree_api.MethodDelete {
-				removeEntryFromNode(node, q.Key, q.Pointer)
+// modifyLeaf applies the queries at indices, which are ordered by key, to
+// node, and swaps in the leaf's new contents the way point writes do, reading
+// it again if a point operation got there first. A leaf that overflows, or is
+// left empty, is frozen and added to M_i for Stage 3 to replace. If the leaf
+// has been replaced since Stage 1 found it, the queries go to the leaves that
+// took its place.
+func (t *LockFreeTreeOf[K, V]) modifyLeaf(node *NodeOf[K, V], indices []int, queries []tree_api.QueryOf[K, V], results []tree_api.ResultOf[V], resolved []bool, M_i map[*NodeOf[K, V]]([]*ModificationOf[K, V])) {
+	batch := make([]tree_api.ResultOf[V], len(indices))
+	for {
+		c := node.load()
+		if c.replacement != nil {
+			t.help(node, c)
+			t.reroute(indices, queries, results, resolved, M_i)
+			return
+		}
+		keys, pointers := slices.Clone(c.Keys), slices.Clone(c.Pointers)
+		changed := false
+		for i, idx := range indices {
+			q := queries[idx]
+			at, found := slices.BinarySearch(keys, q.Key)
+			var existing *tree_api.RecordOf[V]
+			if found {
+				existing, _ = pointers[at].(*tree_api.RecordOf[V])
+			}
+			result := tree_api.ResultOf[V]{Record: existing, Found: found}
+			switch q.Method {
+			case tree_api.MethodFind:
+				if !found {
+					result.Err = tree_api.ErrKeyNotFound
+				}
+			case tree_api.MethodInsert, tree_api.MethodUpsert:
+				if !found {
+					keys = slices.Insert(keys, at, q.Key)
+					pointers = slices.Insert(pointers, at, interface{}(q.Pointer))
+					result.Record = q.Pointer
+					changed = true
+				} else if q.Method == tree_api.MethodUpsert {
+					pointers[at] = q.Pointer
+					result.Record = q.Pointer
+					changed = true
+				} else {
+					// Like Insert, a batched insert of a key that is already
+					// present leaves the stored record alone.
+					result.Err = tree_api.ErrKeyExists
+				}
+			case tree_api.MethodDelete:
+				if found {
+					keys = slices.Delete(keys, at, at+1)
+					pointers = slices.Delete(pointers, at, at+1)
+					changed = true
+				} else {
+					result.Err = tree_api.ErrKeyNotFound
+				}
 			}
+			batch[i] = result
+		}
+		next := c
+		switch {
+		case len(keys) > t.maxKeys():
+			next = t.freeze(true, c, keys, pointers)
+		case len(keys) == 0 && t.root.Load() != node:
+			// Reclaim the leaf, whether this batch emptied it or point
+			// deletes did.
+			next = t.emptied(c, queries[indices[0]].Key)
+		case changed:
+			next = &contentsOf[K, V]{Keys: keys, Pointers: pointers}
 		}
+		if next != c && !node.contents.CompareAndSwap(c, next) {
+			continue
+		}
+		for i, idx := range indices {
+			resolve(results, resolved, idx, batch[i])
+		}
+		if next.replacement != nil {
+			t.addModification(node, next, M_i)
+		}
+		return
 	}
-	for node, _ := range queriesToBeServiced {
-		if node.NumKeys > maxOrder {
-			// Split Case
-			newKeys, newNodes := bigSplit(node)
-			mod := &Modification{Split, node.Parent, &SplitData{newKeys, newNodes}, nil, nil}
-			M_i = addModificationIntoList(node, mod, M_i)
-		} else if node.NumKeys < minOrder {
-			// Underflow Case
-			leafKeys := node.Keys
-			keyToRemove := node.Keys[0]
-			childKeys := make([]int, 0)
-			childKeys = append(childKeys, keyToRemove)
-			childPtrs := make([]interface{}, 0)
-			childPtrs = append(childPtrs, node)
-			mod := &Modification{Underflow, node.Parent, nil, &UnderflowData{childKeys, childPtrs}, leafKeys}
-			M_i = addModificationIntoList(node, mod, M_i)
+}
+
+// reroute applies the queries at indices, whose leaf has been replaced, to
+// the leaves that hold their keys now. Queries on one key all go to the same
+// leaf, in the order they came in.
+func (t *LockFreeTreeOf[K, V]) reroute(indices []int, queries []tree_api.QueryOf[K, V], results []tree_api.ResultOf[V], resolved []bool, M_i map[*NodeOf[K, V]]([]*ModificationOf[K, V])) {
+	leaves := make([]*NodeOf[K, V], 0)
+	byLeaf := make(map[*NodeOf[K, V]]([]int))
+	for _, idx := range indices {
+		leaf, _ := t.findLeaf(queries[idx].Key, false)
+		if _, ok := byLeaf[leaf]; !ok {
+			leaves = append(leaves, leaf)
 		}
+		byLeaf[leaf] = append(byLeaf[leaf], idx)
+	}
+	for _, leaf := range leaves {
+		t.modifyLeaf(leaf, byLeaf[leaf], queries, results, resolved, M_i)
 	}
-	return M_i
 }
 
-func (t *LockFreeTree) Stage2Logic(i int, num_threads int, sharedLeafData [][]*Node, queries []tree_api.Query, R [][]*tree_api.Record) map[*Node]([]*Modification) {
+func (t *LockFreeTreeOf[K, V]) Stage2Logic(i int, num_threads int, sharedLeafData [][]*NodeOf[K, V], queries []tree_api.QueryOf[K, V], leafOf []*NodeOf[K, V], results []tree_api.ResultOf[V], resolved []bool) map[*NodeOf[K, V]]([]*ModificationOf[K, V]) {
 	// Redistribute Work
 	L_i_prime := t.RedistributeWorkLeaves(i, sharedLeafData)
-	res, O_L_i := t.ResolveHazards(L_i_prime, queries)
-	// Update shared results slice
-	R[i] = res
-	M_i := t.ModifyLeafNode(O_L_i, L_i_prime)
-	return M_i
+	O_L_i := t.ResolveHazards(L_i_prime, queries, leafOf)
 	// Modify leaves independently
+	M_i := t.ModifyLeafNode(queries, O_L_i, results, resolved)
+	return M_i
 }
 
-func (t *LockFreeTree) modifySharedModLists(index int, sharedLeafData [][]*Node, sharedModLists [](map[*Node]([]*Modification)), queries []tree_api.Query, R [][]*tree_api.Record, palmMaxThreadCount int, wg *sync.WaitGroup) {
+func (t *LockFreeTreeOf[K, V]) modifySharedModLists(index int, sharedLeafData [][]*NodeOf[K, V], sharedModLists [](map[*NodeOf[K, V]]([]*ModificationOf[K, V])), queries []tree_api.QueryOf[K, V], leafOf []*NodeOf[K, V], results []tree_api.ResultOf[V], resolved []bool, palmMaxThreadCount int, wg *sync.WaitGroup) {
 	defer wg.Done()
-	res := t.Stage2Logic(index, palmMaxThreadCount, sharedLeafData, queries, R)
+	res := t.Stage2Logic(index, palmMaxThreadCount, sharedLeafData, queries, leafOf, results, resolved)
 	sharedModLists[index] = res
 }
 
-func (t *LockFreeTree) Stage2(sharedLeafData [][]*Node, palmMaxThreadCount int, queries []tree_api.Query) ([](map[*Node]([]*Modification)), [][]*tree_api.Record) {
+// Stage2 applies the batch to the leaves and fills in results, which has one
+// slot per query, marking each query it resolves in resolved.
+func (t *LockFreeTreeOf[K, V]) Stage2(sharedLeafData [][]*NodeOf[K, V], palmMaxThreadCount int, queries []tree_api.QueryOf[K, V], leafOf []*NodeOf[K, V], results []tree_api.ResultOf[V], resolved []bool) [](map[*NodeOf[K, V]]([]*ModificationOf[K, V])) {
 	var wg2 sync.WaitGroup
 	dbg := false
 
 	// Set up
-	sharedModLists := make([]map[*Node]([]*Modification), palmMaxThreadCount)
-	for i := 0; i < palmMaxThreadCount; i++ {
-		sharedModLists[i] = make(map[*Node]([]*Modification))
-	}
-	R := make([][]*tree_api.Record, palmMaxThreadCount+1) // could potentially have off by 1 issues (just not using 0 i guess)
+	sharedModLists := make([]map[*NodeOf[K, V]]([]*ModificationOf[K, V]), palmMaxThreadCount)
 	for i := 0; i < palmMaxThreadCount; i++ {
-		R[i] = make([]*tree_api.Record, 0)
+		sharedModLists[i] = make(map[*NodeOf[K, V]]([]*ModificationOf[K, V]))
 	}
 
 	// Do threads
 	for i := 0; i < palmMaxThreadCount; i++ {
 		wg2.Add(1) // Increment the counter for each goroutine
-		go t.modifySharedModLists(i, sharedLeafData, sharedModLists, queries, R, palmMaxThreadCount, &wg2)
+		go t.modifySharedModLists(i, sharedLeafData, sharedModLists, queries, leafOf, results, resolved, palmMaxThreadCount, &wg2)
 	}
 	wg2.Wait()
 
@@ -169,16 +236,17 @@ func (t *LockFreeTree) Stage2(sharedLeafData [][]*Node, palmMaxThreadCount int,
 			fmt.Printf("index: %d\n", idx)
 			for _, l := range L_i {
 				fmt.Printf("Leaf: ")
-				for i := 0; i < l.NumKeys; i++ {
+				c := l.load()
+				for i, key := range c.Keys {
 					if verbose_output {
-						fmt.Printf("%d \n", l.Pointers[i])
+						fmt.Printf("%d \n", c.Pointers[i])
 					}
-					fmt.Printf("%d ", l.Keys[i])
+					fmt.Printf("%v ", key)
 				}
 				fmt.Printf("\n")
 			}
 		}
 	}
 
-	return sharedModLists, R
+	return sharedModLists
 }
@@ -1,109 +1,117 @@
 package lock_free
 
+import (
+	"slices"
+	"sync"
+)
+
 // import "fmt"
 
 // import "sync"
 
-func (t *LockFreeTree) getUpdatedModList(sharedModLists [](map[*Node]([]*Modification)), threadId int) map[*Node]([]*Modification) {
-	previousThreadNodes := make(map[*Node]bool)
-	updatedModList := make(map[*Node]([]*Modification))
+// getUpdatedModList returns the modifications this thread applies in the
+// current round. A node is handled by the lowest numbered thread holding
+// modifications for it, which also takes over the ones other threads hold.
+func (t *LockFreeTreeOf[K, V]) getUpdatedModList(sharedModLists [](map[*NodeOf[K, V]]([]*ModificationOf[K, V])), threadId int) map[*NodeOf[K, V]]([]*ModificationOf[K, V]) {
+	previousThreadNodes := make(map[*NodeOf[K, V]]bool)
+	updatedModList := make(map[*NodeOf[K, V]]([]*ModificationOf[K, V]))
 	for i := 0; i < threadId; i++ {
-		for node, _ := range sharedModLists[i] {
+		for node := range sharedModLists[i] {
 			previousThreadNodes[node] = true
 		}
 	}
 	for node, modList := range sharedModLists[threadId] {
 		if _, ok := previousThreadNodes[node]; !ok {
-			updatedModList[node] = modList
+			mods := slices.Clone(modList)
+			for j := threadId + 1; j < len(sharedModLists); j++ {
+				mods = append(mods, sharedModLists[j][node]...)
+			}
+			updatedModList[node] = mods
 		}
 	}
 	return updatedModList
 }
 
-func getLeafKeys(node *Node) []int {
-	if node.IsLeaf {
-		return node.Keys
-	}
-	leafKeys := make([]int, 0)
-	for i := 0; i < node.NumKeys+1; i++ {
-		leafKeys = append(leafKeys, getLeafKeys(node.Pointers[i].(*Node))...)
-	}
-	return leafKeys
-}
-
-func (t *LockFreeTree) modifyInternalNode(node *Node, mod *Modification) *Modification {
-	if mod.ModType == Split {
-		for i, updateKey := range mod.SplitData.NewKeys {
-			left_index := getLeftIndex(node, mod.SplitData.NewNodes[i].(*Node))
-			insertIntoNode(node, left_index, updateKey, mod.SplitData.NewNodes[i].(*Node))
+// modifyInternalNode puts the replacements in modList in place in node all at
+// once, the way help puts one in place. Replacements that a point operation
+// has put in place already are skipped. If node has itself been replaced
+// since, each replacement goes to the node that holds its frozen node now. A
+// node that overflows is frozen and added to M_i for the next level.
+func (t *LockFreeTreeOf[K, V]) modifyInternalNode(node *NodeOf[K, V], modList []*ModificationOf[K, V], M_i map[*NodeOf[K, V]]([]*ModificationOf[K, V])) {
+	for {
+		c := node.load()
+		if c.replacement != nil {
+			t.help(node, c)
+			parents := make(map[*NodeOf[K, V]]([]*ModificationOf[K, V]))
+			for _, mod := range modList {
+				t.addModification(mod.Child, mod.Frozen, parents)
+			}
+			for parent, mods := range parents {
+				t.modifyInternalNode(parent, mods, M_i)
+			}
+			return
+		}
+		keys, pointers := slices.Clone(c.Keys), slices.Clone(c.Pointers)
+		changed := false
+		for _, mod := range modList {
+			at := slices.Index(pointers, interface{}(mod.Child))
+			if at < 0 {
+				continue
+			}
+			keys, pointers = t.splice(keys, pointers, at, mod.Frozen.replacement)
+			changed = true
 		}
-	} else if mod.ModType == Underflow {
-		for i, updateKey := range mod.UnderflowData.ChildKeys {
-			removeEntryFromNode(node, updateKey, mod.UnderflowData.ChildPtrs[i])
+		if !changed {
+			return
 		}
+		next := &contentsOf[K, V]{Keys: keys, Pointers: pointers}
+		if len(keys) > t.maxKeys() {
+			next = t.freeze(false, c, keys, pointers)
+		}
+		if !node.contents.CompareAndSwap(c, next) {
+			continue
+		}
+		if next.replacement != nil {
+			t.addModification(node, next, M_i)
+		}
+		return
 	}
-	if node.NumKeys > maxOrder {
-		newKeys, newNodes := bigSplit(node)
-		return &Modification{Split, node.Parent, &SplitData{newKeys, newNodes}, nil, mod.OrphanedKeys}
-	} else if node.NumKeys < minOrder {
-		leafKeys := getLeafKeys(node)
-		keyToRemove := node.Keys[0]
-		childKeys := make([]int, 0)
-		childKeys = append(childKeys, keyToRemove)
-		childPtrs := make([]interface{}, 0)
-		childPtrs = append(childPtrs, node)
-		return &Modification{Underflow, node.Parent, nil, &UnderflowData{childKeys, childPtrs}, append(leafKeys, mod.OrphanedKeys...)}
-	}
-
-	return &Modification{NoMod, node.Parent, nil, nil, mod.OrphanedKeys}
 }
 
-func (t *LockFreeTree) stage3Thread(sharedModLists [](map[*Node]([]*Modification)), newSharedModLists [](map[*Node]([]*Modification)), threadId int, depth int, doneWithRound chan bool, doneCopying chan bool) {
-	for d := 1; d < depth; d++ {
-		updatedModList := t.getUpdatedModList(sharedModLists, threadId)
-		for node, modList := range updatedModList {
-			for _, mod := range modList {
-				newMod := t.modifyInternalNode(node, mod)
-				if newSharedModLists[threadId] == nil {
-					panic("huh")
-				}
-				if newMod != nil && newMod.Parent != nil {
-					newSharedModLists[threadId][newMod.Parent] = append(newSharedModLists[threadId][newMod.Parent], newMod)
-				}
-			}
-		}
-		doneWithRound <- true
-		<-doneCopying
+func (t *LockFreeTreeOf[K, V]) stage3Thread(sharedModLists [](map[*NodeOf[K, V]]([]*ModificationOf[K, V])), newSharedModLists [](map[*NodeOf[K, V]]([]*ModificationOf[K, V])), threadId int, wg *sync.WaitGroup) {
+	defer wg.Done()
+	updatedModList := t.getUpdatedModList(sharedModLists, threadId)
+	for node, modList := range updatedModList {
+		t.modifyInternalNode(node, modList, newSharedModLists[threadId])
 	}
-
 }
 
-func (t *LockFreeTree) Stage3(sharedModLists [](map[*Node]([]*Modification)), palmMaxThreadCount int) [](map[*Node]([]*Modification)) {
-	depth := t.height()
-	// spin off threads first, passing them sharedModLists and thread id
-	newSharedModLists := make([](map[*Node]([]*Modification)), palmMaxThreadCount)
-	for i := 0; i < palmMaxThreadCount; i++ {
-		newSharedModLists[i] = make(map[*Node]([]*Modification))
-	}
-	doneWithRound := make(chan bool)
-	doneCopying := make(chan bool)
-	for i := 0; i < palmMaxThreadCount; i++ {
-		go t.stage3Thread(sharedModLists, newSharedModLists, i, depth, doneWithRound, doneCopying)
-	}
-	// this loop just syncs after each loop iteration
-	// allocate a new sharedModList
-	for d := 1; d < depth; d++ {
-		for i := 0; i < palmMaxThreadCount; i++ {
-			<-doneWithRound
+// Stage3 puts the replacements of the nodes frozen in Stage 2 in place, one
+// level of the tree at a time, freezing the parents that overflow for the
+// level above. It returns the modifications of the root, which Stage 4
+// applies.
+func (t *LockFreeTreeOf[K, V]) Stage3(sharedModLists [](map[*NodeOf[K, V]]([]*ModificationOf[K, V])), palmMaxThreadCount int) []*ModificationOf[K, V] {
+	rootMods := make([]*ModificationOf[K, V], 0)
+	for {
+		pending := false
+		for _, modList := range sharedModLists {
+			rootMods = append(rootMods, modList[nil]...)
+			delete(modList, nil)
+			pending = pending || len(modList) > 0
+		}
+		if !pending {
+			return rootMods
 		}
-		// copy over newSharedModLists to sharedModLists
-		for j := 0; j < len(sharedModLists); j++ {
-			sharedModLists[j] = newSharedModLists[j]
-			newSharedModLists[j] = make(map[*Node]([]*Modification))
+		var wg3 sync.WaitGroup
+		newSharedModLists := make([](map[*NodeOf[K, V]]([]*ModificationOf[K, V])), palmMaxThreadCount)
+		for i := 0; i < palmMaxThreadCount; i++ {
+			newSharedModLists[i] = make(map[*NodeOf[K, V]]([]*ModificationOf[K, V]))
 		}
 		for i := 0; i < palmMaxThreadCount; i++ {
-			doneCopying <- true
+			wg3.Add(1)
+			go t.stage3Thread(sharedModLists, newSharedModLists, i, &wg3)
 		}
+		wg3.Wait()
+		sharedModLists = newSharedModLists
 	}
-	return nil
 }
@@ -2,419 +2,455 @@ package lock_free
 
 // Modified from https://github.com/collinglass/bptree
 import (
+	"cmp"
 	"errors"
 	"fmt"
 	"main/tree_api"
-	"reflect"
-	"sync"
+	"slices"
+	"sync/atomic"
 )
 
-var (
-	err error
-
+const (
 	defaultOrder = 4
 	minOrder     = 3
-	maxOrder     = 20
+	maxOrder     = 512
+)
+
+var (
+	err error
 
-	order          = defaultOrder
-	queue          *Node
 	verbose_output = false
 	version        = 0.1
 )
 
-type LockFreeTree struct {
-	Root *Node
-	lock sync.Mutex
+// LockFreeTreeOf is a B+ tree whose operations never block one another. A
+// node's contents are never modified once stored: a write builds new contents
+// for the one leaf it changes and swaps them in with a compare-and-swap on
+// that leaf, so writes to different leaves never conflict and a writer that
+// loses a race only reads its leaf again. Readers load each node's contents
+// once and never wait or retry.
+//
+// A node that overflows is frozen rather than changed: the swap that would
+// have overfilled it installs its old contents together with the nodes they
+// are to be split across, and the node is then swapped for those in its
+// parent the same way, which may freeze the parent in turn. Any operation
+// that meets a frozen node finishes the job before going on, so no operation
+// waits on another that has stalled halfway through a split.
+//
+// Palm writes nodes the same way, many at once, so point operations carry on
+// alongside it. Deletes remove keys without merging nodes, as in a B-link
+// tree, so leaves may be left underfull. A leaf left empty stays in the tree
+// until a Palm batch passes through it, which freezes it and drops it from
+// its parent.
+type LockFreeTreeOf[K cmp.Ordered, V any] struct {
+	root  atomic.Pointer[NodeOf[K, V]]
+	order int
+}
+
+type LockFreeTree = LockFreeTreeOf[int, []byte]
+
+// NodeOf is a node of the tree. Whether it is a leaf is fixed when it is made;
+// everything else it holds is in its contents. Nodes have no parent or
+// sibling pointers: writers find a node's parent by searching from the root.
+type NodeOf[K cmp.Ordered, V any] struct {
+	IsLeaf   bool
+	contents atomic.Pointer[contentsOf[K, V]]
 }
 
-type Node struct {
-	Pointers []interface{}
-	Keys     []int
-	Parent   *Node
-	IsLeaf   bool
-	NumKeys  int
-	Next     *Node
-	lock     sync.Mutex
+type Node = NodeOf[int, []byte]
+
+// contentsOf is what a node holds at one moment: its keys in order, and in a
+// leaf the record of each key, in an internal node the child to the left of
+// each key and one more to the right. Contents are never changed once stored
+// in a node.
+//
+// Contents with a replacement belong to a frozen node: they will not change
+// again, and the node is to be swapped in its parent for the replacement's
+// nodes.
+type contentsOf[K cmp.Ordered, V any] struct {
+	Keys        []K
+	Pointers    []interface{}
+	replacement *replacementOf[K, V]
 }
 
-type ModType int
+// replacementOf is what a frozen node is replaced by: nodes, in order, and the
+// separator keys between them. A replacement without nodes drops an empty
+// leaf. key is a key whose search passes through the frozen node for as long
+// as it is in the tree.
+type replacementOf[K cmp.Ordered, V any] struct {
+	key   K
+	keys  []K
+	nodes []interface{}
+}
 
-const (
-	Split ModType = iota
-	Underflow
-	NoMod
-)
+func (n *NodeOf[K, V]) load() *contentsOf[K, V] {
+	return n.contents.Load()
+}
 
-type SplitData struct {
-	NewKeys  []int
-	NewNodes []interface{}
+// ModificationOf is a node that Palm froze and whose replacement it has yet to
+// put in place in the node's parent.
+type ModificationOf[K cmp.Ordered, V any] struct {
+	Parent *NodeOf[K, V] // Node to be modified, nil for the root
+	Child  *NodeOf[K, V]
+	Frozen *contentsOf[K, V]
 }
-type UnderflowData struct {
-	ChildKeys []int
-	ChildPtrs []interface{}
+
+type Modification = ModificationOf[int, []byte]
+
+func NewTree(opts ...tree_api.Option) tree_api.BPTree {
+	return NewTreeOf[int, []byte](opts...)
 }
 
-type Modification struct {
-	ModType       ModType
-	Parent        *Node // Node to be modified
-	SplitData     *SplitData
-	UnderflowData *UnderflowData
-	OrphanedKeys  []int // keys of descendants to be re-inserted
+func NewTreeOf[K cmp.Ordered, V any](opts ...tree_api.Option) tree_api.TreeOf[K, V] {
+	o, err := tree_api.BuildOptions(defaultOrder, minOrder, maxOrder, opts)
+	if err != nil {
+		panic(err)
+	}
+	return &LockFreeTreeOf[K, V]{order: o.Order}
 }
 
-func NewTree() tree_api.BPTree {
-	return &LockFreeTree{}
+func (t *LockFreeTreeOf[K, V]) Order() int {
+	return t.order
 }
 
-func (t *LockFreeTree) Insert(key int, value []byte) error {
-	t.lock.Lock()
+func (t *LockFreeTreeOf[K, V]) Insert(key K, value V) error {
+	return t.insert(key, value, false)
+}
 
-	var pointer *tree_api.Record
-	var leaf *Node
+// Upsert inserts key, or replaces its record if it is already present.
+func (t *LockFreeTreeOf[K, V]) Upsert(key K, value V) error {
+	return t.insert(key, value, true)
+}
 
+// insert adds key to its leaf, or when replace is set gives an existing key a
+// new record.
+func (t *LockFreeTreeOf[K, V]) insert(key K, value V, replace bool) error {
 	pointer, err := makeRecord(value)
 	if err != nil {
-		defer t.lock.Unlock()
 		return err
 	}
-
-	if t.Root == nil {
-		defer t.lock.Unlock()
-		return t.startNewTree(key, pointer)
+	for {
+		leaf, c := t.findLeaf(key, false)
+		if leaf == nil {
+			if t.root.CompareAndSwap(nil, t.fresh(true, []K{key}, []interface{}{pointer})) {
+				return nil
+			}
+			continue
+		}
+		if c.replacement != nil {
+			t.help(leaf, c)
+			continue
+		}
+		keys, pointers := c.Keys, slices.Clone(c.Pointers)
+		at, found := slices.BinarySearch(keys, key)
+		if found {
+			if !replace {
+				return tree_api.ErrKeyExists
+			}
+			pointers[at] = pointer
+		} else {
+			keys = slices.Insert(slices.Clone(keys), at, key)
+			pointers = slices.Insert(pointers, at, interface{}(pointer))
+		}
+		if t.write(leaf, c, keys, pointers) {
+			return nil
+		}
 	}
+}
 
-	leaf, treeLocked, lockList := t.findLeafForInsert(key, false)
+// Update replaces the record of an existing key.
+func (t *LockFreeTreeOf[K, V]) Update(key K, value V) error {
+	_, err := t.swap(key, nil, value, false)
+	return err
+}
 
-	if leaf.NumKeys < order-1 {
-		if treeLocked {
-			panic("tree is locked but child is safe")
+// CompareAndSwap replaces the record of key if it is still old.
+func (t *LockFreeTreeOf[K, V]) CompareAndSwap(key K, old *tree_api.RecordOf[V], new V) (bool, error) {
+	return t.swap(key, old, new, true)
+}
+
+// swap gives an existing key a new record. With compare set it only does so
+// if the record in the leaf it read is old; if the leaf has changed by the
+// time it writes, it reads the key again.
+func (t *LockFreeTreeOf[K, V]) swap(key K, old *tree_api.RecordOf[V], value V, compare bool) (bool, error) {
+	pointer, err := makeRecord(value)
+	if err != nil {
+		return false, err
+	}
+	for {
+		leaf, c := t.findLeaf(key, false)
+		if leaf == nil {
+			return false, tree_api.ErrKeyNotFound
+		}
+		if c.replacement != nil {
+			t.help(leaf, c)
+			continue
+		}
+		at, found := slices.BinarySearch(c.Keys, key)
+		if !found {
+			return false, tree_api.ErrKeyNotFound
+		}
+		if compare && c.Pointers[at] != old {
+			return false, nil
 		}
-		if len(lockList) != 1 {
-			panic("lock list is not empty but child is safe")
+		pointers := slices.Clone(c.Pointers)
+		pointers[at] = pointer
+		if t.write(leaf, c, c.Keys, pointers) {
+			return true, nil
 		}
-		insertIntoLeaf(leaf, key, pointer)
-		leaf.lock.Unlock()
-		return nil
 	}
-	defer t.clearLockList(treeLocked, lockList)
-	return t.insertIntoLeafAfterSplitting(leaf, key, pointer)
 }
 
-func (t *LockFreeTree) find(key int, verbose bool) (*tree_api.Record, error) {
-	i := 0
-	c := t.findLeaf(key, verbose)
+func (t *LockFreeTreeOf[K, V]) find(key K, verbose bool) (*tree_api.RecordOf[V], error) {
+	_, c := t.findLeaf(key, verbose)
 	if c == nil {
-		return nil, errors.New("key not found")
+		return nil, tree_api.ErrKeyNotFound
 	}
-	for i = 0; i < c.NumKeys; i++ {
-		if c.Keys[i] == key {
-			break
-		}
-	}
-	if i == c.NumKeys {
-		return nil, errors.New("key not found")
+	at, found := slices.BinarySearch(c.Keys, key)
+	if !found {
+		return nil, tree_api.ErrKeyNotFound
 	}
-
-	r, _ := c.Pointers[i].(*tree_api.Record)
-
+	r, _ := c.Pointers[at].(*tree_api.RecordOf[V])
 	return r, nil
 }
 
-func (t *LockFreeTree) Find(key int, verbose bool) (*tree_api.Record, error) {
-	res, err := t.find(key, verbose)
-	if err != nil {
-		fmt.Println("Find key", key)
-	}
-	return res, err
+func (t *LockFreeTreeOf[K, V]) Find(key K, verbose bool) (*tree_api.RecordOf[V], error) {
+	return t.find(key, verbose)
 }
 
-func (t *LockFreeTree) FindAndPrint(key int, verbose bool) {
+func (t *LockFreeTreeOf[K, V]) FindAndPrint(key K, verbose bool) {
 	r, err := t.Find(key, verbose)
 
 	if err != nil || r == nil {
-		fmt.Printf("Record not found under key %d.\n", key)
+		fmt.Printf("Record not found under key %v.\n", key)
 	} else {
-		fmt.Printf("Record at %d -- key %d, value %s.\n", r, key, r.Value)
+		fmt.Printf("Record at %p -- key %v, value %s.\n", r, key, tree_api.FormatValue(r.Value))
 	}
 }
 
-func (t *LockFreeTree) FindAndPrintRange(key_start, key_end int, verbose bool) {
-	var i int
-	array_size := key_end - key_start + 1
-	returned_keys := make([]int, array_size)
-	returned_pointers := make([]interface{}, array_size)
-	num_found := t.findRange(key_start, key_end, verbose, returned_keys, returned_pointers)
-	if num_found == 0 {
-		fmt.Println("None found,")
-	} else {
-		for i = 0; i < num_found; i++ {
-			c, _ := returned_pointers[i].(*tree_api.Record)
-			fmt.Printf("Key: %d  Location: %d  Value: %s\n",
-				returned_keys[i],
-				returned_pointers[i],
-				c.Value)
-		}
+func (t *LockFreeTreeOf[K, V]) FindAndPrintRange(key_start, key_end K, verbose bool) {
+	results, _ := t.Range(key_start, key_end)
+	for _, kr := range results {
+		fmt.Printf("Key: %v  Location: %p  Value: %s\n",
+			kr.Key,
+			kr.Record,
+			tree_api.FormatValue(kr.Record.Value))
 	}
 }
 
-func (t *LockFreeTree) PrintTree() {
-	var n *Node
-	i := 0
-	rank := 0
-	new_rank := 0
+func (t *LockFreeTreeOf[K, V]) Range(key_start, key_end K) ([]tree_api.KeyRecordOf[K, V], error) {
+	return t.RangeLimit(key_start, key_end, 0, false)
+}
 
-	if t.Root == nil {
+func (t *LockFreeTreeOf[K, V]) RangeLimit(key_start, key_end K, limit int, reverse bool) ([]tree_api.KeyRecordOf[K, V], error) {
+	if key_start > key_end {
+		return nil, tree_api.ErrInvalidRange
+	}
+	return t.findRange(key_start, key_end, limit, reverse), nil
+}
+
+func (t *LockFreeTreeOf[K, V]) PrintTree() {
+	root := t.root.Load()
+	if root == nil {
 		fmt.Printf("Empty tree.\n")
 		return
 	}
-	queue = nil
-	enqueue(t.Root)
-	for queue != nil {
-		n = dequeue()
-		if n != nil {
-			if n.Parent != nil && n == n.Parent.Pointers[0] {
-				new_rank = t.pathToRoot(n)
-				if new_rank != rank {
-					fmt.Printf("\n")
-				}
-			}
+	level := []*NodeOf[K, V]{root}
+	for len(level) > 0 {
+		next := make([]*NodeOf[K, V], 0)
+		for _, n := range level {
+			c := n.load()
 			if verbose_output {
 				fmt.Print("(", n, ")")
 			}
-			for i = 0; i < n.NumKeys; i++ {
+			for i, key := range c.Keys {
 				if verbose_output {
-					fmt.Printf("%d ", n.Pointers[i])
+					fmt.Printf("%p ", c.Pointers[i])
 				}
-				fmt.Printf("%d ", n.Keys[i])
+				fmt.Printf("%v ", key)
 			}
 			if !n.IsLeaf {
-				for i = 0; i <= n.NumKeys; i++ {
-					c, _ := n.Pointers[i].(*Node)
-					enqueue(c)
+				for _, p := range c.Pointers {
+					next = append(next, p.(*NodeOf[K, V]))
 				}
-			}
-			if verbose_output {
-				if n.IsLeaf {
-					fmt.Printf("%d ", n.Pointers[order-1])
-				} else {
-					fmt.Printf("%d ", n.Pointers[n.NumKeys])
+				if verbose_output {
+					fmt.Printf("%p ", c.Pointers[len(c.Keys)])
 				}
 			}
 			fmt.Printf(" | ")
 		}
+		fmt.Printf("\n")
+		level = next
 	}
-	fmt.Printf("\n")
 }
 
-func (t *LockFreeTree) PrintLeaves() {
-	if t.Root == nil {
+func (t *LockFreeTreeOf[K, V]) PrintLeaves() {
+	root := t.root.Load()
+	if root == nil {
 		fmt.Printf("Empty tree.\n")
 		return
 	}
 
-	var i int
-	c := t.Root
-	for !c.IsLeaf {
-		c, _ = c.Pointers[0].(*Node)
-	}
-
-	for {
-		for i = 0; i < c.NumKeys; i++ {
-			if verbose_output {
-				fmt.Printf("%d ", c.Pointers[i])
+	first := true
+	var print func(n *NodeOf[K, V])
+	print = func(n *NodeOf[K, V]) {
+		c := n.load()
+		if !n.IsLeaf {
+			for _, p := range c.Pointers {
+				print(p.(*NodeOf[K, V]))
 			}
-			fmt.Printf("%d ", c.Keys[i])
+			return
 		}
-		if verbose_output {
-			fmt.Printf("%d ", c.Pointers[order-1])
-		}
-		if c.Pointers[order-1] != nil {
+		if !first {
 			fmt.Printf(" | ")
-			c, _ = c.Pointers[order-1].(*Node)
-		} else {
-			break
+		}
+		first = false
+		for i, key := range c.Keys {
+			if verbose_output {
+				fmt.Printf("%p ", c.Pointers[i])
+			}
+			fmt.Printf("%v ", key)
 		}
 	}
+	print(root)
 	fmt.Printf("\n")
 }
 
-func (t *LockFreeTree) Delete(key int) error {
-	key_record, err := t.Find(key, false)
-	if err != nil {
-		return err
-	}
-	key_leaf := t.findLeaf(key, false)
-	if key_record != nil && key_leaf != nil {
-		t.deleteEntry(key_leaf, key, key_record)
-	}
-	return nil
-}
-
-// Private Functions
-func enqueue(new_node *Node) {
-	var c *Node
-	if queue == nil {
-		queue = new_node
-		queue.Next = nil
-	} else {
-		c = queue
-		for c.Next != nil {
-			c = c.Next
+// Delete removes key from its leaf. Leaves are never merged, so the leaf may
+// be left underfull or empty.
+func (t *LockFreeTreeOf[K, V]) Delete(key K) error {
+	for {
+		leaf, c := t.findLeaf(key, false)
+		if leaf == nil {
+			return tree_api.ErrKeyNotFound
+		}
+		if c.replacement != nil {
+			t.help(leaf, c)
+			continue
+		}
+		at, found := slices.BinarySearch(c.Keys, key)
+		if !found {
+			return tree_api.ErrKeyNotFound
+		}
+		keys := slices.Delete(slices.Clone(c.Keys), at, at+1)
+		pointers := slices.Delete(slices.Clone(c.Pointers), at, at+1)
+		if t.write(leaf, c, keys, pointers) {
+			return nil
 		}
-		c.Next = new_node
-		new_node.Next = nil
 	}
 }
 
-func dequeue() *Node {
-	n := queue
-	queue = queue.Next
-	n.Next = nil
-	return n
-}
-
-func (t *LockFreeTree) height() int {
+// Private Functions
+func (t *LockFreeTreeOf[K, V]) height() int {
 	h := 0
-	c := t.Root
+	c := t.root.Load()
 	for !c.IsLeaf {
-		c, _ = c.Pointers[0].(*Node)
+		c, _ = c.load().Pointers[0].(*NodeOf[K, V])
 		h++
 	}
 	return h
 }
 
-func (t *LockFreeTree) pathToRoot(child *Node) int {
-	length := 0
-	c := child
-	for c != t.Root {
-		c = c.Parent
-		length += 1
+// findRange collects the keys in [key_start, key_end], walking the tree
+// backwards from key_end when reverse is set.
+func (t *LockFreeTreeOf[K, V]) findRange(key_start, key_end K, limit int, reverse bool) []tree_api.KeyRecordOf[K, V] {
+	results := []tree_api.KeyRecordOf[K, V]{}
+	root := t.root.Load()
+	if root == nil {
+		return results
 	}
-	return length
+	collectRange(root, key_start, key_end, limit, reverse, &results)
+	return results
 }
 
-func (t *LockFreeTree) findRange(key_start, key_end int, verbose bool, returned_keys []int, returned_pointers []interface{}) int {
-	var i int
-	num_found := 0
-
-	n := t.findLeaf(key_start, verbose)
-	if n == nil {
-		return 0
+// collectRange appends the keys under n that fall in [key_start, key_end] and
+// reports whether the scan should carry on past n.
+func collectRange[K cmp.Ordered, V any](n *NodeOf[K, V], key_start, key_end K, limit int, reverse bool, results *[]tree_api.KeyRecordOf[K, V]) bool {
+	full := func() bool {
+		return limit > 0 && len(*results) == limit
 	}
-	for i = 0; i < n.NumKeys && n.Keys[i] < key_start; i++ {
-		if i == n.NumKeys { // could be wrong
-			return 0
+	c := n.load()
+	if n.IsLeaf {
+		for j := range c.Keys {
+			i := j
+			if reverse {
+				i = len(c.Keys) - 1 - j
+			}
+			if c.Keys[i] < key_start || c.Keys[i] > key_end {
+				continue
+			}
+			if full() {
+				return false
+			}
+			r, _ := c.Pointers[i].(*tree_api.RecordOf[V])
+			*results = append(*results, tree_api.KeyRecordOf[K, V]{Key: c.Keys[i], Record: r})
 		}
+		return !full()
 	}
-	for n != nil {
-		for i = i; i < n.NumKeys && n.Keys[i] <= key_end; i++ {
-			returned_keys[num_found] = n.Keys[i]
-			returned_pointers[num_found] = n.Pointers[i]
-			num_found += 1
+	// Child i holds the keys in [Keys[i-1], Keys[i]).
+	first, last := childIndex(c.Keys, key_start), childIndex(c.Keys, key_end)
+	for j := 0; j <= last-first; j++ {
+		i := first + j
+		if reverse {
+			i = last - j
+		}
+		child, _ := c.Pointers[i].(*NodeOf[K, V])
+		if !collectRange(child, key_start, key_end, limit, reverse, results) {
+			return false
 		}
-		n, _ = n.Pointers[order-1].(*Node)
-		i = 0
 	}
-	return num_found
+	return true
 }
 
-func (t *LockFreeTree) clearLockList(treeLocked bool, lockList []*Node) []*Node {
-	if treeLocked {
-		t.lock.Unlock()
-	}
-	for _, node := range lockList {
-		node.lock.Unlock()
+// childIndex returns the index of the child whose subtree holds key, given
+// the keys of an internal node.
+func childIndex[K cmp.Ordered](keys []K, key K) int {
+	i, found := slices.BinarySearch(keys, key)
+	if found {
+		i++
 	}
-	return []*Node{}
+	return i
 }
 
-func (t *LockFreeTree) findLeafForInsert(key int, verbose bool) (*Node, bool, []*Node) {
-	i := 0
-	c := t.Root
-	lockList := []*Node{}
-	c.lock.Lock()
-	treeLocked := true
-	lockList = append(lockList, c)
-	if c.NumKeys < order-1 {
-		t.lock.Unlock()
-		treeLocked = false
-		// No need to maintain tree lock, the root will not split
-	}
-	for !c.IsLeaf {
-		if verbose {
-			fmt.Printf("[")
-			for i = 0; i < c.NumKeys-1; i++ {
-				fmt.Printf("%d ", c.Keys[i])
-			}
-			fmt.Printf("%d]", c.Keys[i])
-		}
-		i = 0
-		for i < c.NumKeys {
-			if key >= c.Keys[i] {
-				i += 1
-			} else {
-				break
-			}
-		}
-		if verbose {
-			fmt.Printf("%d ->\n", i)
-		}
-		c, _ = c.Pointers[i].(*Node)
-		c.lock.Lock()
-		if c.NumKeys < order-1 {
-			lockList = t.clearLockList(treeLocked, lockList)
-			treeLocked = false
-		}
-		lockList = append(lockList, c)
-	}
-	if verbose {
-		fmt.Printf("Leaf [")
-		for i = 0; i < c.NumKeys-1; i++ {
-			fmt.Printf("%d ", c.Keys[i])
+// findParent returns the parent of n, and the contents it read it from, by
+// searching for key, which must lead to n; the parent is nil if n is the
+// root. It reports false if n is no longer in the tree.
+func (t *LockFreeTreeOf[K, V]) findParent(n *NodeOf[K, V], key K) (*NodeOf[K, V], *contentsOf[K, V], bool) {
+	var parent *NodeOf[K, V]
+	var c *contentsOf[K, V]
+	for p := t.root.Load(); p != n; {
+		if p == nil || p.IsLeaf {
+			return nil, nil, false
 		}
-		fmt.Printf("%d] ->\n", c.Keys[i])
+		parent, c = p, p.load()
+		p, _ = c.Pointers[childIndex(c.Keys, key)].(*NodeOf[K, V])
 	}
-	return c, treeLocked, lockList
+	return parent, c, true
 }
 
-func (t *LockFreeTree) findLeaf(key int, verbose bool) *Node {
-	i := 0
-	c := t.Root
-	if c == nil {
+// findLeaf returns the leaf for key and the contents it holds, or nil for an
+// empty tree.
+func (t *LockFreeTreeOf[K, V]) findLeaf(key K, verbose bool) (*NodeOf[K, V], *contentsOf[K, V]) {
+	n := t.root.Load()
+	if n == nil {
 		if verbose {
 			fmt.Printf("Empty tree.\n")
 		}
-		return c
+		return nil, nil
 	}
-	for !c.IsLeaf {
-		if verbose {
-			fmt.Printf("[")
-			for i = 0; i < c.NumKeys-1; i++ {
-				fmt.Printf("%d ", c.Keys[i])
-			}
-			fmt.Printf("%d]", c.Keys[i])
-		}
-		i = 0
-		for i < c.NumKeys {
-			if key >= c.Keys[i] {
-				i += 1
-			} else {
-				break
-			}
-		}
+	c := n.load()
+	for !n.IsLeaf {
+		i := childIndex(c.Keys, key)
 		if verbose {
-			fmt.Printf("%d ->\n", i)
+			fmt.Printf("%v%d ->\n", c.Keys, i)
 		}
-		c, _ = c.Pointers[i].(*Node)
+		n, _ = c.Pointers[i].(*NodeOf[K, V])
+		c = n.load()
 	}
 	if verbose {
-		fmt.Printf("Leaf [")
-		for i = 0; i < c.NumKeys-1; i++ {
-			fmt.Printf("%d ", c.Keys[i])
-		}
-		fmt.Printf("%d] ->\n", c.Keys[i])
+		fmt.Printf("Leaf %v ->\n", c.Keys)
 	}
-	return c
+	return n, c
 }
 
 func cut(length int) int {
@@ -426,8 +462,8 @@ func cut(length int) int {
 }
 
 // INSERTION
-func makeRecord(value []byte) (*tree_api.Record, error) {
-	new_record := new(tree_api.Record)
+func makeRecord[V any](value V) (*tree_api.RecordOf[V], error) {
+	new_record := new(tree_api.RecordOf[V])
 	if new_record == nil {
 		return nil, errors.New("Error: Record creation.")
 	} else {
@@ -436,513 +472,168 @@ func makeRecord(value []byte) (*tree_api.Record, error) {
 	return new_record, nil
 }
 
-func makeNode() (*Node, error) {
-	new_node := new(Node)
-	if new_node == nil {
-		return nil, errors.New("Error: Node creation.")
-	}
-	new_node.Keys = make([]int, order-1)
-	if new_node.Keys == nil {
-		return nil, errors.New("Error: New node keys array.")
-	}
-	new_node.Pointers = make([]interface{}, order)
-	if new_node.Keys == nil {
-		return nil, errors.New("Error: New node pointers array.")
-	}
-	new_node.IsLeaf = false
-	new_node.NumKeys = 0
-	new_node.Parent = nil
-	new_node.Next = nil
-	return new_node, nil
-}
-
-func makeLeaf() (*Node, error) {
-	leaf, err := makeNode()
-	if err != nil {
-		return nil, err
-	}
-	leaf.IsLeaf = true
-	return leaf, nil
-}
-
-func getLeftIndex(parent, left *Node) int {
-	left_index := 0
-	for left_index <= parent.NumKeys && parent.Pointers[left_index] != left {
-		left_index += 1
-	}
-	return left_index
-}
-
-func insertIntoLeaf(leaf *Node, key int, pointer *tree_api.Record) {
-	var i, insertion_point int
-
-	for insertion_point < leaf.NumKeys && leaf.Keys[insertion_point] < key {
-		insertion_point += 1
-	}
-
-	for i = leaf.NumKeys; i > insertion_point; i-- {
-		leaf.Keys[i] = leaf.Keys[i-1]
-		leaf.Pointers[i] = leaf.Pointers[i-1]
-	}
-	leaf.Keys[insertion_point] = key
-	leaf.Pointers[insertion_point] = pointer
-	leaf.NumKeys += 1
-	return
-}
-
-func (t *LockFreeTree) insertIntoLeafAfterSplitting(leaf *Node, key int, pointer *tree_api.Record) error {
-	var new_leaf *Node
-	var insertion_index, split, new_key, i, j int
-	var err error
-
-	new_leaf, err = makeLeaf()
-	if err != nil {
-		return nil
-	}
-
-	temp_keys := make([]int, order)
-	if temp_keys == nil {
-		return errors.New("Error: Temporary keys array.")
-	}
-
-	temp_pointers := make([]interface{}, order)
-	if temp_pointers == nil {
-		return errors.New("Error: Temporary pointers array.")
-	}
-
-	for insertion_index < order-1 && leaf.Keys[insertion_index] < key {
-		insertion_index += 1
-	}
-
-	for i = 0; i < leaf.NumKeys; i++ {
-		if j == insertion_index {
-			j += 1
-		}
-		temp_keys[j] = leaf.Keys[i]
-		temp_pointers[j] = leaf.Pointers[i]
-		j += 1
-	}
-
-	temp_keys[insertion_index] = key
-	temp_pointers[insertion_index] = pointer
-
-	leaf.NumKeys = 0
-
-	split = cut(order - 1)
-
-	for i = 0; i < split; i++ {
-		leaf.Pointers[i] = temp_pointers[i]
-		leaf.Keys[i] = temp_keys[i]
-		leaf.NumKeys += 1
-	}
-
-	j = 0
-	for i = split; i < order; i++ {
-		new_leaf.Pointers[j] = temp_pointers[i]
-		new_leaf.Keys[j] = temp_keys[i]
-		new_leaf.NumKeys += 1
-		j += 1
-	}
-
-	new_leaf.Pointers[order-1] = leaf.Pointers[order-1]
-	leaf.Pointers[order-1] = new_leaf
-
-	for i = leaf.NumKeys; i < order-1; i++ {
-		leaf.Pointers[i] = nil
-	}
-	for i = new_leaf.NumKeys; i < order-1; i++ {
-		new_leaf.Pointers[i] = nil
-	}
-
-	new_leaf.Parent = leaf.Parent
-	new_key = new_leaf.Keys[0]
-
-	return t.insertIntoParent(leaf, new_key, new_leaf)
-}
-
-func insertIntoNode(n *Node, left_index, key int, right *Node) {
-	var i int
-	for i = n.NumKeys; i > left_index; i-- {
-		n.Pointers[i+1] = n.Pointers[i]
-		n.Keys[i] = n.Keys[i-1]
-	}
-	n.Pointers[left_index+1] = right
-	n.Keys[left_index] = key
-	n.NumKeys += 1
+// fresh returns a new node holding the given entries.
+func (t *LockFreeTreeOf[K, V]) fresh(isLeaf bool, keys []K, pointers []interface{}) *NodeOf[K, V] {
+	n := &NodeOf[K, V]{IsLeaf: isLeaf}
+	n.contents.Store(&contentsOf[K, V]{Keys: slices.Clone(keys), Pointers: slices.Clone(pointers)})
+	return n
 }
 
-func (t *LockFreeTree) insertIntoNodeAfterSplitting(old_node *Node, left_index, key int, right *Node) error {
-	var i, j, split, k_prime int
-	var new_node, child *Node
-	var temp_keys []int
-	var temp_pointers []interface{}
-	var err error
+// COPY-ON-WRITE
 
-	temp_pointers = make([]interface{}, order+1)
-	if temp_pointers == nil {
-		return errors.New("Error: Temporary pointers array for splitting nodes.")
-	}
-
-	temp_keys = make([]int, order)
-	if temp_keys == nil {
-		return errors.New("Error: Temporary keys array for splitting nodes.")
-	}
-
-	for i = 0; i < old_node.NumKeys+1; i++ {
-		if j == left_index+1 {
-			j += 1
-		}
-		temp_pointers[j] = old_node.Pointers[i]
-		j += 1
-	}
-
-	j = 0
-	for i = 0; i < old_node.NumKeys; i++ {
-		if j == left_index {
-			j += 1
-		}
-		temp_keys[j] = old_node.Keys[i]
-		j += 1
-	}
-
-	temp_pointers[left_index+1] = right
-	temp_keys[left_index] = key
-
-	split = cut(order)
-	new_node, err = makeNode()
-	if err != nil {
-		return err
+// write swaps new contents holding keys and pointers into n in place of c,
+// and reports whether it got there first. Entries that do not fit in one node
+// freeze n instead, and write goes on to replace n in its parent before
+// returning.
+func (t *LockFreeTreeOf[K, V]) write(n *NodeOf[K, V], c *contentsOf[K, V], keys []K, pointers []interface{}) bool {
+	next := &contentsOf[K, V]{Keys: keys, Pointers: pointers}
+	if len(keys) > t.maxKeys() {
+		next = t.freeze(n.IsLeaf, c, keys, pointers)
 	}
-	old_node.NumKeys = 0
-	for i = 0; i < split-1; i++ {
-		old_node.Pointers[i] = temp_pointers[i]
-		old_node.Keys[i] = temp_keys[i]
-		old_node.NumKeys += 1
+	if !n.contents.CompareAndSwap(c, next) {
+		return false
 	}
-	old_node.Pointers[i] = temp_pointers[i]
-	k_prime = temp_keys[split-1]
-	j = 0
-	for i += 1; i < order; i++ {
-		new_node.Pointers[j] = temp_pointers[i]
-		new_node.Keys[j] = temp_keys[i]
-		new_node.NumKeys += 1
-		j += 1
+	if next.replacement != nil {
+		t.help(n, next)
 	}
-	new_node.Pointers[j] = temp_pointers[i]
-	new_node.Parent = old_node.Parent
-	for i = 0; i <= new_node.NumKeys; i++ {
-		child, _ = new_node.Pointers[i].(*Node)
-		child.Parent = new_node
-	}
-
-	return t.insertIntoParent(old_node, k_prime, new_node)
-}
-
-func (t *LockFreeTree) insertIntoParent(left *Node, key int, right *Node) error {
-	var left_index int
-	parent := left.Parent
-
-	if parent == nil {
-		return t.insertIntoNewRoot(left, key, right)
-	}
-	left_index = getLeftIndex(parent, left)
-
-	if parent.NumKeys < order-1 {
-		insertIntoNode(parent, left_index, key, right)
-		return nil
-	}
-
-	return t.insertIntoNodeAfterSplitting(parent, left_index, key, right)
+	return true
 }
 
-func (t *LockFreeTree) insertIntoNewRoot(left *Node, key int, right *Node) error {
-	t.Root, err = makeNode()
-	if err != nil {
-		return err
+// freeze returns the contents that freeze a node holding c which is to hold
+// keys and pointers, too many for one node: c itself, which readers go on
+// seeing until the node is replaced, and new nodes that share the entries
+// out between them.
+func (t *LockFreeTreeOf[K, V]) freeze(isLeaf bool, c *contentsOf[K, V], keys []K, pointers []interface{}) *contentsOf[K, V] {
+	// The first separator is one of the node's keys, so its search leads to
+	// the node.
+	separators, nodes := t.split(isLeaf, keys, pointers)
+	return &contentsOf[K, V]{
+		Keys:        c.Keys,
+		Pointers:    c.Pointers,
+		replacement: &replacementOf[K, V]{key: separators[0], keys: separators, nodes: nodes},
 	}
-	t.Root.Keys[0] = key
-	t.Root.Pointers[0] = left
-	t.Root.Pointers[1] = right
-	t.Root.NumKeys += 1
-	t.Root.Parent = nil
-	left.Parent = t.Root
-	right.Parent = t.Root
-	return nil
 }
 
-func (t *LockFreeTree) startNewTree(key int, pointer *tree_api.Record) error {
-	t.Root, err = makeLeaf()
-	if err != nil {
-		return err
+// emptied returns the contents that freeze a leaf holding c which is to hold
+// no keys at all, so that it is dropped from its parent. Readers go on seeing
+// c until it is. key is a key whose search leads to the leaf.
+func (t *LockFreeTreeOf[K, V]) emptied(c *contentsOf[K, V], key K) *contentsOf[K, V] {
+	return &contentsOf[K, V]{
+		Keys:        c.Keys,
+		Pointers:    c.Pointers,
+		replacement: &replacementOf[K, V]{key: key},
 	}
-	t.Root.Keys[0] = key
-	t.Root.Pointers[0] = pointer
-	t.Root.Pointers[order-1] = nil
-	t.Root.Parent = nil
-	t.Root.NumKeys += 1
-	return nil
 }
 
-func getNeighbourIndex(n *Node) int {
-	var i int
-
-	for i = 0; i <= n.Parent.NumKeys; i++ {
-		if reflect.DeepEqual(n.Parent.Pointers[i], n) {
-			return i - 1
+// help replaces the frozen node n, whose contents are frozen, by the nodes of
+// its replacement, unless that has been done already. A frozen parent is
+// replaced first, and a parent that overflows is frozen and replaced in turn,
+// so the tree is whole again once help returns.
+func (t *LockFreeTreeOf[K, V]) help(n *NodeOf[K, V], frozen *contentsOf[K, V]) {
+	r := frozen.replacement
+	for {
+		parent, c, found := t.findParent(n, r.key)
+		if !found {
+			return
+		}
+		if parent == nil {
+			// Only leaves are dropped, and never the root.
+			if t.root.CompareAndSwap(n, t.newRoot(r.keys, r.nodes)) {
+				return
+			}
+			continue
 		}
-	}
-
-	return i
-}
-
-func removeEntryFromNode(n *Node, key int, pointer interface{}) *Node {
-	var i, num_pointers int
-
-	for i < len(n.Keys) && n.Keys[i] != key {
-		i += 1
-		// if i == len(n.Keys) {
-		// 	return n
-		// }
-	}
-
-	for i += 1; i < n.NumKeys; i++ {
-		n.Keys[i-1] = n.Keys[i]
-	}
-
-	if n.IsLeaf {
-		num_pointers = n.NumKeys
-	} else {
-		num_pointers = n.NumKeys + 1
-	}
-
-	i = 0
-	for i < len(n.Pointers) && n.Pointers[i] != pointer {
-		i += 1
-	}
-	for i += 1; i < num_pointers; i++ {
-		n.Pointers[i-1] = n.Pointers[i]
-	}
-	n.NumKeys -= 1
-
-	if n.IsLeaf {
-		for i = n.NumKeys; i < order-1; i++ {
-			n.Pointers[i] = nil
+		if c.replacement != nil {
+			t.help(parent, c)
+			continue
 		}
-	} else {
-		for i = n.NumKeys + 1; i < order; i++ {
-			n.Pointers[i] = nil
+		at := slices.Index(c.Pointers, interface{}(n))
+		keys, pointers := t.splice(slices.Clone(c.Keys), slices.Clone(c.Pointers), at, r)
+		if t.write(parent, c, keys, pointers) {
+			return
 		}
 	}
-
-	return n
 }
 
-func (t *LockFreeTree) adjustRoot() {
-	var new_root *Node
-
-	if t.Root.NumKeys > 0 {
-		return
+// splice returns the entries of a parent holding keys and pointers once its
+// child at index at has been swapped for the nodes of the child's replacement
+// r. An internal node keeps at least two children, so an empty leaf that its
+// parent cannot do without is swapped for a new empty leaf rather than
+// dropped.
+func (t *LockFreeTreeOf[K, V]) splice(keys []K, pointers []interface{}, at int, r *replacementOf[K, V]) ([]K, []interface{}) {
+	if len(r.nodes) > 0 {
+		return slices.Insert(keys, at, r.keys...), slices.Replace(pointers, at, at+1, r.nodes...)
 	}
-
-	if !t.Root.IsLeaf {
-		new_root, _ = t.Root.Pointers[0].(*Node)
-		new_root.Parent = nil
-	} else {
-		new_root = nil
+	if len(pointers) <= 2 {
+		pointers[at] = t.fresh(true, nil, nil)
+		return keys, pointers
 	}
-	t.Root = new_root
-
-	return
-}
-
-func (t *LockFreeTree) coalesceNodes(n, neighbour *Node, neighbour_index, k_prime int) {
-	var i, j, neighbour_insertion_index, n_end int
-	var tmp *Node
-
-	if neighbour_index == -1 {
-		tmp = n
-		n = neighbour
-		neighbour = tmp
+	// The separator on one side of the child goes with it, so a neighbour
+	// takes over its range.
+	pointers = slices.Delete(pointers, at, at+1)
+	if at > 0 {
+		at--
 	}
-
-	neighbour_insertion_index = neighbour.NumKeys
-
-	if !n.IsLeaf {
-		neighbour.Keys[neighbour_insertion_index] = k_prime
-		neighbour.NumKeys += 1
-
-		n_end = n.NumKeys
-		i = neighbour_insertion_index + 1
-		for j = 0; j < n_end; j++ {
-			neighbour.Keys[i] = n.Keys[j]
-			neighbour.Pointers[i] = n.Pointers[j]
-			neighbour.NumKeys += 1
-			n.NumKeys -= 1
-			i += 1
-		}
-		neighbour.Pointers[i] = n.Pointers[j]
-
-		for i = 0; i < neighbour.NumKeys+1; i++ {
-			tmp, _ = neighbour.Pointers[i].(*Node)
-			tmp.Parent = neighbour
-		}
-	} else {
-		i = neighbour_insertion_index
-		for j = 0; j < n.NumKeys; j++ {
-			neighbour.Keys[i] = n.Keys[j]
-			n.Pointers[i] = n.Pointers[j]
-			neighbour.NumKeys += 1
-		}
-		neighbour.Pointers[order-1] = n.Pointers[order-1]
-	}
-
-	t.deleteEntry(n.Parent, k_prime, n)
+	return slices.Delete(keys, at, at+1), pointers
 }
 
-func (t *LockFreeTree) redistributeNodes(n, neighbour *Node, neighbour_index, k_prime_index, k_prime int) {
-	var i int
-	var tmp *Node
-
-	if neighbour_index != -1 {
-		if !n.IsLeaf {
-			n.Pointers[n.NumKeys+1] = n.Pointers[n.NumKeys]
-		}
-		for i = n.NumKeys; i > 0; i-- {
-			n.Keys[i] = n.Keys[i-1]
-			n.Pointers[i] = n.Pointers[i-1]
-		}
-		if !n.IsLeaf { // why the second if !n.IsLeaf
-			n.Pointers[0] = neighbour.Pointers[neighbour.NumKeys]
-			tmp, _ = n.Pointers[0].(*Node)
-			tmp.Parent = n
-			neighbour.Pointers[neighbour.NumKeys] = nil
-			n.Keys[0] = k_prime
-			n.Parent.Keys[k_prime_index] = neighbour.Keys[neighbour.NumKeys-1]
-		} else {
-			n.Pointers[0] = neighbour.Pointers[neighbour.NumKeys-1]
-			neighbour.Pointers[neighbour.NumKeys-1] = nil
-			n.Keys[0] = neighbour.Keys[neighbour.NumKeys-1]
-			n.Parent.Keys[k_prime_index] = n.Keys[0]
-		}
-	} else {
-		if n.IsLeaf {
-			n.Keys[n.NumKeys] = neighbour.Keys[0]
-			n.Pointers[n.NumKeys] = neighbour.Pointers[0]
-			n.Parent.Keys[k_prime_index] = neighbour.Keys[1]
-		} else {
-			n.Keys[n.NumKeys] = k_prime
-			n.Pointers[n.NumKeys+1] = neighbour.Pointers[0]
-			tmp, _ = n.Pointers[n.NumKeys+1].(*Node)
-			tmp.Parent = n
-			n.Parent.Keys[k_prime_index] = neighbour.Keys[0]
-		}
-		for i = 0; i < neighbour.NumKeys-1; i++ {
-			neighbour.Keys[i] = neighbour.Keys[i+1]
-			neighbour.Pointers[i] = neighbour.Pointers[i+1]
-		}
-		if !n.IsLeaf {
-			neighbour.Pointers[i] = neighbour.Pointers[i+1]
-		}
+// newRoot returns a root over nodes, with keys between them, adding as many
+// levels as it takes for them to fit.
+func (t *LockFreeTreeOf[K, V]) newRoot(keys []K, nodes []interface{}) *NodeOf[K, V] {
+	for len(nodes) > t.order {
+		keys, nodes = t.split(false, keys, nodes)
 	}
-	n.NumKeys += 1
-	neighbour.NumKeys -= 1
-
-	return
+	return t.fresh(false, keys, nodes)
 }
 
-func (t *LockFreeTree) deleteEntry(n *Node, key int, pointer interface{}) {
-	var min_keys, neighbour_index, k_prime_index, k_prime, capacity int
-	var neighbour *Node
-
-	n = removeEntryFromNode(n, key, pointer)
-
-	if n == t.Root {
-		t.adjustRoot()
-		return
-	}
-
-	if n.IsLeaf {
-		min_keys = cut(order - 1)
-	} else {
-		min_keys = cut(order) - 1
-	}
-
-	if n.NumKeys >= min_keys {
-		return
-	}
-
-	neighbour_index = getNeighbourIndex(n)
-
-	if neighbour_index == -1 {
-		k_prime_index = 0
-	} else {
-		k_prime_index = neighbour_index
+func (t *LockFreeTreeOf[K, V]) PalmBasic(palmKeyCount int, palmMaxThreadCount int) {
+	// PalmBasic runs a fixed batch over the keys 0..palmKeyCount-1, so it only
+	// makes sense for int keys and byte values.
+	var key K
+	var value V
+	if _, ok := any(key).(int); !ok {
+		panic("PalmBasic is only implemented for int keys")
 	}
-
-	k_prime = n.Parent.Keys[k_prime_index]
-
-	if neighbour_index == -1 {
-		neighbour, _ = n.Parent.Pointers[1].(*Node)
-	} else {
-		neighbour, _ = n.Parent.Pointers[neighbour_index].(*Node)
+	if _, ok := any(value).([]byte); !ok {
+		panic("PalmBasic is only implemented for []byte values")
 	}
-
-	if n.IsLeaf {
-		capacity = order
-	} else {
-		capacity = order - 1
-	}
-
-	if neighbour.NumKeys+n.NumKeys < capacity {
-		t.coalesceNodes(n, neighbour, neighbour_index, k_prime)
-		return
-	} else {
-		t.redistributeNodes(n, neighbour, neighbour_index, k_prime_index, k_prime)
-		return
-	}
-
-}
-
-func (t *LockFreeTree) PalmBasic(palmKeyCount int, palmMaxThreadCount int) {
-	queries := make([]tree_api.Query, 0)
+	queries := make([]tree_api.QueryOf[K, V], 0)
 	for i := 0; i < palmKeyCount; i++ {
-		queries = append(queries, tree_api.Query{tree_api.MethodFind, i, false, nil})
+		queries = append(queries, tree_api.QueryOf[K, V]{Method: tree_api.MethodFind, Key: any(i).(K)})
 	}
 	for i := 0; i < palmKeyCount; i++ {
-		record, _ := makeRecord([]byte("hello"))
-		queries = append(queries, tree_api.Query{tree_api.MethodInsert, i, false, record})
+		record, _ := makeRecord(any([]byte("hello")).(V))
+		queries = append(queries, tree_api.QueryOf[K, V]{Method: tree_api.MethodInsert, Key: any(i).(K), Pointer: record})
 	}
 	for i := 0; i < palmKeyCount; i++ {
-		queries = append(queries, tree_api.Query{tree_api.MethodDelete, i, false, nil})
-	}
-	// fmt.Println("Starting Palm stage 1")
-	sharedLeafData := t.Stage1(queries, palmMaxThreadCount) // L
-	// fmt.Println("Finished Palm stage 1")
-	sharedModLists, R := t.Stage2(sharedLeafData, palmMaxThreadCount, queries) // M
-	// fmt.Println("Finished Palm stage 2")
-	finalModList := t.Stage3(sharedModLists, palmMaxThreadCount)
-	// fmt.Println("Finished Palm stage 3")
-	t.Stage4(finalModList, palmMaxThreadCount)
-	// fmt.Println("Finished Palm stage 4")
-
-	if false {
-		print(R)
+		queries = append(queries, tree_api.QueryOf[K, V]{Method: tree_api.MethodDelete, Key: any(i).(K)})
 	}
+	t.Palm(queries, palmMaxThreadCount)
 }
 
-func (t *LockFreeTree) Palm(queries []tree_api.Query, palmMaxThreadCount int) [][]*tree_api.Record {
+// Palm applies a batch of queries with palmMaxThreadCount threads. It writes
+// every node it changes the way point operations do, so they never wait for
+// it.
+func (t *LockFreeTreeOf[K, V]) Palm(queries []tree_api.QueryOf[K, V], palmMaxThreadCount int) []tree_api.ResultOf[V] {
+	results := make([]tree_api.ResultOf[V], len(queries))
+	if len(queries) == 0 {
+		return results
+	}
+	// Give Stage 1 a leaf to route to.
+	t.root.CompareAndSwap(nil, t.fresh(true, nil, nil))
+	resolved := make([]bool, len(queries))
 	// fmt.Println("Starting Palm stage 1")
-	sharedLeafData := t.Stage1(queries, palmMaxThreadCount) // L
+	sharedLeafData, leafOf := t.Stage1(queries, palmMaxThreadCount) // L
 	// fmt.Println("Finished Palm stage 1")
-	sharedModLists, R := t.Stage2(sharedLeafData, palmMaxThreadCount, queries) // M
+	sharedModLists := t.Stage2(sharedLeafData, palmMaxThreadCount, queries, leafOf, results, resolved) // M
 	// fmt.Println("Finished Palm stage 2")
-	finalModList := t.Stage3(sharedModLists, palmMaxThreadCount)
+	rootMods := t.Stage3(sharedModLists, palmMaxThreadCount)
 	// fmt.Println("Finished Palm stage 3")
-	t.Stage4(finalModList, palmMaxThreadCount)
+	t.Stage4(rootMods)
 	// fmt.Println("Finished Palm stage 4")
 
-	if false {
-		print(R)
+	for idx := range queries {
+		queries[idx].Done = resolved[idx]
 	}
-	return R
+	return results
 }
@@ -0,0 +1,306 @@
+package lock_free
+
+import (
+	"fmt"
+	"main/tree_api"
+	"main/tree_testing"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentPointOps(t *testing.T) {
+	for _, order := range []int{3, 4, 16} {
+		t.Run(fmt.Sprintf("order=%d", order), func(t *testing.T) {
+			tree_testing.ConcurrentPointOps(t, NewTreeOf[int, []byte](tree_api.WithOrder(order)))
+		})
+	}
+}
+
+func TestPointOpsEmptyTree(t *testing.T) {
+	tree := NewTreeOf[int, []byte](tree_api.WithOrder(3)).(*LockFreeTree)
+	for i := 0; i < 50; i++ {
+		if err := tree.Insert(i, []byte(fmt.Sprint(i))); err != nil {
+			t.Fatalf("insert %d: %s", i, err)
+		}
+	}
+	for i := 0; i < 50; i++ {
+		if err := tree.Delete(i); err != nil {
+			t.Fatalf("delete %d: %s", i, err)
+		}
+	}
+	if err := tree.Delete(0); err != tree_api.ErrKeyNotFound {
+		t.Errorf("expected ErrKeyNotFound and got %v", err)
+	}
+	tree_testing.CheckContents(t, tree, map[int]string{})
+
+	// The emptied leaves are still there to take keys again.
+	for i := 0; i < 50; i += 7 {
+		if err := tree.Insert(i, []byte(fmt.Sprint(i))); err != nil {
+			t.Fatalf("insert %d: %s", i, err)
+		}
+	}
+	tree_testing.CheckContents(t, tree, map[int]string{0: "0", 7: "7", 14: "14", 21: "21", 28: "28", 35: "35", 42: "42", 49: "49"})
+}
+
+// A writer that freezes a leaf and then stalls before replacing it in its
+// parent must not hold anyone up: the next operation on that leaf finishes
+// the split for it.
+func TestStalledSplitIsFinishedByOthers(t *testing.T) {
+	tree := NewTreeOf[int, []byte](tree_api.WithOrder(3)).(*LockFreeTree)
+	want := make(map[int]string)
+	for i := 0; i < 40; i += 2 {
+		if err := tree.Insert(i, []byte(fmt.Sprint(i))); err != nil {
+			t.Fatalf("insert %d: %s", i, err)
+		}
+		want[i] = fmt.Sprint(i)
+	}
+
+	// Do by hand what insert does for key 21 up to the freeze, with the leaf
+	// topped up first so that 21 overflows it.
+	leaf, c := tree.findLeaf(21, false)
+	for len(c.Keys) < tree.maxKeys() {
+		key := c.Keys[len(c.Keys)-1] + 1
+		if key == 21 {
+			key = c.Keys[0] + 1
+		}
+		if err := tree.Insert(key, []byte(fmt.Sprint(key))); err != nil {
+			t.Fatalf("insert %d: %s", key, err)
+		}
+		want[key] = fmt.Sprint(key)
+		leaf, c = tree.findLeaf(21, false)
+	}
+	record, _ := makeRecord([]byte("21"))
+	at, _ := slices.BinarySearch(c.Keys, 21)
+	keys := slices.Insert(slices.Clone(c.Keys), at, 21)
+	pointers := slices.Insert(slices.Clone(c.Pointers), at, interface{}(record))
+	if !leaf.contents.CompareAndSwap(c, tree.freeze(true, c, keys, pointers)) {
+		t.Fatalf("could not freeze the leaf")
+	}
+
+	// Until the split is finished the stalled insert has not happened.
+	if _, err := tree.Find(21, false); err != tree_api.ErrKeyNotFound {
+		t.Errorf("expected 21 to be absent until the split is done and got %v", err)
+	}
+	if err := tree.Upsert(c.Keys[0], []byte("u")); err != nil {
+		t.Fatalf("upsert %d: %s", c.Keys[0], err)
+	}
+	want[c.Keys[0]] = "u"
+	want[21] = "21"
+	if l, _ := tree.findLeaf(21, false); l == leaf {
+		t.Errorf("expected the frozen leaf to have been replaced")
+	}
+	tree_testing.CheckContents(t, tree, want)
+}
+
+// Palm batches and point operations write the same leaves at once. Every
+// write must land, and keys that are never deleted must be found throughout,
+// while leaves in the upper half of the key space are emptied and dropped.
+func TestPalmAlongsidePointOps(t *testing.T) {
+	tree := NewTreeOf[int, []byte](tree_api.WithOrder(4)).(*LockFreeTree)
+	const writers = 4
+	const keysPerWriter = 200
+	const batches = 20
+	const batchSize = writers * keysPerWriter / batches
+	// Keys 3k are stable, 3k+1 belong to the writers and 3k+2 to Palm, so
+	// that they all share leaves.
+	want := make(map[int]string)
+	for k := 0; k < writers*keysPerWriter/2; k++ {
+		key := 3 * k
+		if err := tree.Insert(key, []byte(fmt.Sprint(key))); err != nil {
+			t.Fatalf("insert %d: %s", key, err)
+		}
+		want[key] = fmt.Sprint(key)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < keysPerWriter; i++ {
+				key := 3*(i*writers+w) + 1
+				if err := tree.Insert(key, []byte(fmt.Sprint(key))); err != nil {
+					t.Errorf("insert %d: %s", key, err)
+				}
+				if i%2 == 1 {
+					if err := tree.Delete(key); err != nil {
+						t.Errorf("delete %d: %s", key, err)
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// Each batch inserts keys of its own, deletes half of the previous
+		// batch's and looks up stable keys.
+		for b := 0; b < batches; b++ {
+			queries := make([]tree_api.Query, 0)
+			for k := b * batchSize; k < (b+1)*batchSize; k++ {
+				key := 3*k + 2
+				queries = append(queries, tree_api.Query{Method: tree_api.MethodInsert, Key: key, Pointer: &tree_api.Record{Value: []byte(fmt.Sprint(key))}})
+				if k%2 == 1 && b > 0 {
+					queries = append(queries, tree_api.Query{Method: tree_api.MethodDelete, Key: key - 3*batchSize})
+				}
+				if k < writers*keysPerWriter/2 {
+					queries = append(queries, tree_api.Query{Method: tree_api.MethodFind, Key: 3 * k})
+				}
+			}
+			for i, r := range tree.Palm(queries, 4) {
+				if r.Err != nil || (queries[i].Method != tree_api.MethodInsert) != r.Found {
+					t.Errorf("batch %d: %v of %d: %+v", b, queries[i].Method, queries[i].Key, r)
+				}
+			}
+		}
+	}()
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			for k := 0; k < writers*keysPerWriter/2; k += 7 {
+				if _, err := tree.Find(3*k, false); err != nil {
+					t.Errorf("find %d: %s", 3*k, err)
+					return
+				}
+			}
+		}
+	}()
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+
+	for w := 0; w < writers; w++ {
+		for i := 0; i < keysPerWriter; i += 2 {
+			key := 3*(i*writers+w) + 1
+			want[key] = fmt.Sprint(key)
+		}
+	}
+	for k := 0; k < batches*batchSize; k++ {
+		if k%2 == 0 || k >= (batches-1)*batchSize {
+			want[3*k+2] = fmt.Sprint(3*k + 2)
+		}
+	}
+	tree_testing.CheckContents(t, tree, want)
+}
+
+// Palm drops the leaves it finds empty, whether its own deletes emptied them
+// or point deletes did, unless their parent cannot do without them.
+func TestPalmDropsEmptyLeaves(t *testing.T) {
+	tree := NewTreeOf[int, []byte](tree_api.WithOrder(4)).(*LockFreeTree)
+	for i := 0; i < 300; i++ {
+		if err := tree.Insert(i, []byte(fmt.Sprint(i))); err != nil {
+			t.Fatalf("insert %d: %s", i, err)
+		}
+	}
+	for i := 0; i < 200; i++ {
+		if err := tree.Delete(i); err != nil {
+			t.Fatalf("delete %d: %s", i, err)
+		}
+	}
+	leaves := func() (all, empty int) {
+		var walk func(n *Node)
+		walk = func(n *Node) {
+			c := n.load()
+			if !n.IsLeaf {
+				for _, p := range c.Pointers {
+					walk(p.(*Node))
+				}
+				return
+			}
+			all++
+			if len(c.Keys) == 0 {
+				empty++
+			}
+		}
+		walk(tree.root.Load())
+		return all, empty
+	}
+	before, emptyBefore := leaves()
+	if emptyBefore == 0 {
+		t.Fatalf("expected point deletes to leave empty leaves")
+	}
+
+	queries := make([]tree_api.Query, 0)
+	for i := 0; i < 250; i++ {
+		method := tree_api.MethodFind
+		if i >= 200 {
+			method = tree_api.MethodDelete
+		}
+		queries = append(queries, tree_api.Query{Method: method, Key: i})
+	}
+	tree.Palm(queries, 4)
+
+	after, emptyAfter := leaves()
+	if after >= before || emptyAfter >= emptyBefore {
+		t.Errorf("expected Palm to drop empty leaves: %d leaves, %d empty before and %d, %d after", before, emptyBefore, after, emptyAfter)
+	}
+	want := make(map[int]string)
+	for i := 250; i < 300; i++ {
+		want[i] = fmt.Sprint(i)
+	}
+	tree_testing.CheckContents(t, tree, want)
+}
+
+// An iterator carries on in order across Palm batches that split nodes all
+// over the tree, and sees every key present throughout. Keys written after it
+// loaded a leaf may or may not be seen.
+func TestIteratorAcrossPalm(t *testing.T) {
+	tree := NewTreeOf[int, []byte](tree_api.WithOrder(3)).(*LockFreeTree)
+	for i := 0; i < 100; i += 2 {
+		if err := tree.Insert(i, []byte(fmt.Sprint(i))); err != nil {
+			t.Fatalf("insert %d: %s", i, err)
+		}
+	}
+	it := tree.NewIterator()
+	defer it.Close()
+	for i := 0; i < 10; i++ {
+		it.Next()
+	}
+	if it.Key() != 18 {
+		t.Fatalf("expected to be on 18 and am on %d", it.Key())
+	}
+
+	// Odd keys all over the tree make Palm split nodes everywhere.
+	odd := []int{}
+	for i := 1; i < 100; i += 2 {
+		odd = append(odd, i)
+	}
+	tree.Palm(makeInsertQueries(odd), 4)
+
+	seen := []int{}
+	for it.Next() {
+		seen = append(seen, it.Key())
+	}
+	if !slices.IsSorted(seen) || slices.Contains(seen, 18) {
+		t.Errorf("expected keys above 18 in order and got %v", seen)
+	}
+	for want := 20; want < 100; want += 2 {
+		if !slices.Contains(seen, want) {
+			t.Errorf("expected to see %d and got %v", want, seen)
+		}
+	}
+
+	back := tree.NewIterator()
+	defer back.Close()
+	back.Seek(50)
+	tree.Palm([]tree_api.Query{{Method: tree_api.MethodDelete, Key: 49}}, 1)
+	seen = seen[:0]
+	for back.Prev() {
+		seen = append(seen, back.Key())
+	}
+	if len(seen) != 49 && len(seen) != 48 || seen[0] < 48 || seen[len(seen)-1] != 0 {
+		t.Errorf("expected the keys below 50 but for 49, which may be gone, and got %v", seen)
+	}
+	if !slices.IsSortedFunc(seen, func(a, b int) int { return b - a }) {
+		t.Errorf("expected keys in descending order and got %v", seen)
+	}
+}
@@ -1,29 +1,59 @@
 package lock_free
 
-func bigSplit(node *Node) ([]int, []interface{}) {
-	newKeys := make([]int, 0)
-	newNodes := make([]interface{}, 0)
-	newNodeCount := ((node.NumKeys + minOrder - 1) / minOrder) - 1
-	assert(newNodeCount > 0)
-	currIndex := minOrder
-	for nodeNum := 1; nodeNum < newNodeCount; nodeNum++ {
-		newNode, _ := makeNode()
-		newNode.Parent = node.Parent
-		newNode.NumKeys = minOrder - 1
-		for j := 0; j < minOrder; j++ {
-			newNode.Keys[j] = node.Keys[j+currIndex]
+// maxKeys is the most keys a node of this tree can hold.
+func (t *LockFreeTreeOf[K, V]) maxKeys() int {
+	return t.order - 1
+}
+
+// chunkEntries spreads entries that overflow one node across as few nodes as
+// the tree's order allows, keeping them as even as possible. It returns the
+// entries of each chunk and the separator keys a parent needs between them.
+func (t *LockFreeTreeOf[K, V]) chunkEntries(isLeaf bool, keys []K, pointers []interface{}) ([][]K, [][]interface{}, []K) {
+	chunkKeys := make([][]K, 0)
+	chunkPointers := make([][]interface{}, 0)
+	separators := make([]K, 0)
+
+	// Leaves hold one pointer per key; internal nodes one more pointer than
+	// keys, and the key between two chunks moves up into the parent.
+	units, capacity := len(keys), t.maxKeys()
+	if !isLeaf {
+		units, capacity = len(pointers), t.order
+	}
+	count := (units + capacity - 1) / capacity
+	assert(count > 1)
+
+	start := 0
+	for i := 0; i < count; i++ {
+		end := start + units/count
+		if i < units%count {
+			end++
 		}
-		for j := 0; j < minOrder; j++ {
-			newNode.Pointers[j] = node.Pointers[j+minOrder]
+		if isLeaf {
+			if i > 0 {
+				separators = append(separators, keys[start])
+			}
+			chunkKeys = append(chunkKeys, keys[start:end])
+		} else {
+			if i > 0 {
+				separators = append(separators, keys[start-1])
+			}
+			chunkKeys = append(chunkKeys, keys[start:end-1])
 		}
-		newKeys = append(newKeys, newNode.Keys[nodeNum*minOrder])
-		newNodes = append(newNodes, newNode)
-		currIndex += minOrder
+		chunkPointers = append(chunkPointers, pointers[start:end])
+		start = end
+	}
+	return chunkKeys, chunkPointers, separators
+}
+
+// split shares out entries that overflow one node across new nodes, which it
+// returns with the separator keys between them.
+func (t *LockFreeTreeOf[K, V]) split(isLeaf bool, keys []K, pointers []interface{}) ([]K, []interface{}) {
+	chunkKeys, chunkPointers, separators := t.chunkEntries(isLeaf, keys, pointers)
+	nodes := make([]interface{}, len(chunkKeys))
+	for i := range chunkKeys {
+		nodes[i] = t.fresh(isLeaf, chunkKeys[i], chunkPointers[i])
 	}
-	node.NumKeys = minOrder - 1
-	node.Keys = node.Keys[:node.NumKeys]
-	node.Pointers = node.Pointers[:node.NumKeys+1]
-	return newKeys, newNodes
+	return separators, nodes
 }
 
 func assert(condition bool) {
@@ -0,0 +1,107 @@
+package lock_free
+
+import (
+	"cmp"
+	"fmt"
+	"main/tree_api"
+)
+
+// Validate checks that the tree is well formed: keys are sorted within every
+// node and fall between the separators above them, every node has a pointer
+// per key, and an internal node one more, none holds more keys than the order
+// allows, internal nodes below the root are not empty, and all leaves are at
+// the same depth. Leaves may be underfull or empty, as deletes never merge
+// them. Nodes have no parent or sibling pointers to check. It returns an error
+// wrapping tree_api.ErrInvalidTree that names the path from the root to the
+// first node found to be broken, or nil if the tree is well formed.
+//
+// Validate loads each node's contents once, so it may run alongside point
+// operations and Palm, and a node frozen by a split under way is checked as it
+// was before the split.
+func (t *LockFreeTreeOf[K, V]) Validate() error {
+	if t.order < minOrder || t.order > maxOrder {
+		return fmt.Errorf("%w: order %d is outside [%d, %d]", tree_api.ErrInvalidTree, t.order, minOrder, maxOrder)
+	}
+	root := t.root.Load()
+	if root == nil {
+		return nil
+	}
+	v := &validatorOf[K, V]{tree: t, root: root, leafDepth: -1}
+	return v.check(root, []int{}, nil, nil)
+}
+
+type validatorOf[K cmp.Ordered, V any] struct {
+	tree      *LockFreeTreeOf[K, V]
+	root      *NodeOf[K, V]
+	leafDepth int
+}
+
+// check validates the subtree under n, whose keys must lie in [low, high); a
+// nil bound is open.
+func (v *validatorOf[K, V]) check(n *NodeOf[K, V], path []int, low, high *K) error {
+	t := v.tree
+	fail := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s: %s", tree_api.ErrInvalidTree, tree_api.FormatPath(path), fmt.Sprintf(format, args...))
+	}
+	c := n.load()
+	if c == nil {
+		return fail("has no contents")
+	}
+	numPointers := len(c.Keys)
+	if !n.IsLeaf {
+		numPointers++
+	}
+	if len(c.Pointers) != numPointers {
+		return fail("has %d keys and %d pointers, expected %d pointers", len(c.Keys), len(c.Pointers), numPointers)
+	}
+	if len(c.Keys) > t.maxKeys() {
+		return fail("holds %d keys, more than the maximum of %d", len(c.Keys), t.maxKeys())
+	}
+	if !n.IsLeaf && len(c.Keys) == 0 && n != v.root {
+		return fail("internal node has no keys")
+	}
+	for i, key := range c.Keys {
+		if i > 0 && c.Keys[i-1] >= key {
+			return fail("key %v at %d is not above key %v before it", key, i, c.Keys[i-1])
+		}
+		if low != nil && key < *low {
+			return fail("key %v at %d is below the separator %v", key, i, *low)
+		}
+		if high != nil && key >= *high {
+			return fail("key %v at %d is not below the separator %v", key, i, *high)
+		}
+	}
+
+	if n.IsLeaf {
+		for i, p := range c.Pointers {
+			if _, ok := p.(*tree_api.RecordOf[V]); !ok {
+				return fail("pointer %d is not a record", i)
+			}
+		}
+		depth := len(path)
+		if v.leafDepth < 0 {
+			v.leafDepth = depth
+		} else if depth != v.leafDepth {
+			return fail("leaf is at depth %d, other leaves are at %d", depth, v.leafDepth)
+		}
+		return nil
+	}
+
+	for i, p := range c.Pointers {
+		child, ok := p.(*NodeOf[K, V])
+		if !ok || child == nil {
+			return fail("child %d is missing", i)
+		}
+		childLow, childHigh := low, high
+		if i > 0 {
+			childLow = &c.Keys[i-1]
+		}
+		if i < len(c.Keys) {
+			childHigh = &c.Keys[i]
+		}
+		if err := v.check(child, append(path, i), childLow, childHigh); err != nil {
+			return err
+		}
+	}
+	return nil
+}
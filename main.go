@@ -1,12 +1,20 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"main/art"
 	"main/benchmark"
+	"main/blink_tree"
+	"main/bw_tree"
 	"main/crab"
+	"main/flat_combining_tree"
 	"main/global_lock_tree"
 	"main/lock_free"
+	"main/olc_tree"
 	"main/seq_tree"
+	"main/shard_tree"
+	"main/skip_list"
 	"main/tree_api"
 	"time"
 )
@@ -20,40 +28,104 @@ func runSpeedup(trees []tree_api.BPTree, keyCount int, threadCount int, benchmar
 	}
 }
 
-func runBenchmark(benchmarkName string, benchmarkFunc func(tree_api.BPTree, int, int) (time.Duration, float64), seqTree tree_api.BPTree, globalLockTrees []tree_api.BPTree, crabTrees []tree_api.BPTree, keyCount int, maxThreadCount int) {
+// treeList is one tree per thread count of the speedup runs, from the most
+// threads down to one.
+type treeList struct {
+	name  string
+	trees []tree_api.BPTree
+}
+
+func runBenchmark(benchmarkName string, benchmarkFunc func(tree_api.BPTree, int, int) (time.Duration, float64), seqTree tree_api.BPTree, treeLists []treeList, keyCount int, maxThreadCount int) {
 	fmt.Printf("Benchmark %s\n", benchmarkName)
 	fmt.Printf("Sequential Tree %s Benchmark\n", benchmarkName)
 	benchmarkFunc(seqTree, keyCount, 1)
-	fmt.Printf("Global Lock Tree %s Benchmark\n", benchmarkName)
-	runSpeedup(globalLockTrees, keyCount, maxThreadCount, benchmarkFunc)
-	fmt.Printf("Crab Tree %s Benchmark\n", benchmarkName)
-	runSpeedup(crabTrees, keyCount, maxThreadCount, benchmarkFunc)
+	for _, list := range treeLists {
+		fmt.Printf("%s %s Benchmark\n", list.name, benchmarkName)
+		runSpeedup(list.trees, keyCount, maxThreadCount, benchmarkFunc)
+	}
 }
 
-func makeTreeList(threadCount int, treeConstructor func() tree_api.BPTree) []tree_api.BPTree {
+func makeTreeList(threadCount int, treeConstructor func(...tree_api.Option) tree_api.BPTree, opts ...tree_api.Option) []tree_api.BPTree {
 	trees := []tree_api.BPTree{}
 	for i := threadCount; i > 0; i /= 2 {
-		trees = append(trees, treeConstructor())
+		trees = append(trees, treeConstructor(opts...))
 	}
 	return trees
 }
 
+// newShardedGlobalLockTree spreads keys over up to 64 global lock trees, one
+// per core of the machines the benchmarks run on.
+func newShardedGlobalLockTree(opts ...tree_api.Option) tree_api.BPTree {
+	return shard_tree.NewTree(global_lock_tree.NewTree, 64, shard_tree.DefaultWindow, opts...)
+}
+
+func newSeqTree(opts ...tree_api.Option) tree_api.BPTree {
+	return seq_tree.NewTree(opts...)
+}
+
+// sweptTree is a tree whose nodes have a fixed fan-out, and the number of
+// threads to benchmark it with.
+type sweptTree struct {
+	name        string
+	constructor func(...tree_api.Option) tree_api.BPTree
+	threadCount int
+}
+
+// runOrderSweep benchmarks each of trees at each of orders, so that fan-outs
+// can be compared side by side. The ART and the skip list accept WithOrder
+// but ignore it, so they have nothing to sweep and are left out.
+func runOrderSweep(trees []sweptTree, orders []int, keyCount int) {
+	for _, tree := range trees {
+		for _, order := range orders {
+			fmt.Printf("%s Order %d Insert/Find Benchmark\n", tree.name, order)
+			t := tree.constructor(tree_api.WithOrder(order))
+			benchmark.RunInsertBenchmark(t, keyCount, tree.threadCount)
+			benchmark.RunFindBenchmark(t, keyCount, tree.threadCount)
+		}
+	}
+}
+
 func main() {
+	orderSweep := flag.Bool("order-sweep", false, "benchmark the fixed fan-out trees at orders 8 through 256")
+	flag.Parse()
 
 	// Set up trees
 	keyCount := 1000000
 	seqTree := seq_tree.NewTree()
 	maxThreadCount := 128
-	globalLockTrees := makeTreeList(maxThreadCount, global_lock_tree.NewTree)
-	crabTrees := makeTreeList(maxThreadCount, crab.NewTree)
+	treeLists := []treeList{
+		{"Global Lock Tree", makeTreeList(maxThreadCount, global_lock_tree.NewTree)},
+		{"RW Lock Tree", makeTreeList(maxThreadCount, global_lock_tree.NewRWTree)},
+		{"Striped Lock Tree", makeTreeList(maxThreadCount, global_lock_tree.NewStripedTree)},
+		{"Flat Combining Tree", makeTreeList(maxThreadCount, flat_combining_tree.NewTree)},
+		{"Crab Tree", makeTreeList(maxThreadCount, crab.NewTree)},
+		{"OLC Tree", makeTreeList(maxThreadCount, olc_tree.NewTree)},
+		{"B-link Tree", makeTreeList(maxThreadCount, blink_tree.NewTree)},
+		{"Bw-Tree", makeTreeList(maxThreadCount, bw_tree.NewTree)},
+		{"ART", makeTreeList(maxThreadCount, art.NewTree)},
+		{"Skip List", makeTreeList(maxThreadCount, skip_list.NewTree)},
+		{"Sharded Global Lock Tree", makeTreeList(maxThreadCount, newShardedGlobalLockTree)},
+	}
 
 	FLAG_run_benchmarks := true
 	FLAG_test_palm := true
 
 	if FLAG_run_benchmarks {
-		runBenchmark("Insert", benchmark.RunInsertBenchmark, seqTree, globalLockTrees, crabTrees, keyCount, maxThreadCount)
-		runBenchmark("Find", benchmark.RunFindBenchmark, seqTree, globalLockTrees, crabTrees, keyCount, maxThreadCount)
-		runBenchmark("Delete", benchmark.RunDeleteBenchmark, seqTree, globalLockTrees, crabTrees, keyCount, maxThreadCount)
+		runBenchmark("Insert", benchmark.RunInsertBenchmark, seqTree, treeLists, keyCount, maxThreadCount)
+		runBenchmark("Find", benchmark.RunFindBenchmark, seqTree, treeLists, keyCount, maxThreadCount)
+		runBenchmark("Delete", benchmark.RunDeleteBenchmark, seqTree, treeLists, keyCount, maxThreadCount)
+	}
+
+	if *orderSweep {
+		sweptTrees := []sweptTree{
+			{"Sequential Tree", newSeqTree, 1},
+			{"Crab Tree", crab.NewTree, 8},
+			{"Lock Free Tree", lock_free.NewTree, 8},
+			{"OLC Tree", olc_tree.NewTree, 8},
+			{"B-link Tree", blink_tree.NewTree, 8},
+			{"Bw-Tree", bw_tree.NewTree, 8},
+		}
+		runOrderSweep(sweptTrees, []int{8, 16, 32, 64, 128, 256}, keyCount)
 	}
 
 	if FLAG_test_palm {
@@ -0,0 +1,134 @@
+package olc_tree
+
+import (
+	"cmp"
+	"main/tree_api"
+	"slices"
+)
+
+// IteratorOf walks the keys of an OLCTree in order. It holds no locks: it
+// keeps the contents of the leaf it is on as they were when it arrived there,
+// and moves to a neighbouring leaf by descending again from the separator
+// that bounds the current one. It sees every key that is present throughout
+// the walk, and sees the writes made to a leaf since it last moved onto it.
+type IteratorOf[K cmp.Ordered, V any] struct {
+	tree      *OLCTreeOf[K, V]
+	leaf      leafOf[K, V]
+	index     int
+	started   bool
+	exhausted bool
+	closed    bool
+}
+
+func (t *OLCTreeOf[K, V]) NewIterator() tree_api.IteratorOf[K, V] {
+	return &IteratorOf[K, V]{tree: t}
+}
+
+func (it *IteratorOf[K, V]) Seek(key K) bool {
+	if it.closed {
+		return false
+	}
+	it.started = true
+	it.leaf = it.tree.findLeaf(key, false)
+	it.index, _ = slices.BinarySearch(it.leaf.contents.keys, key)
+	return it.settleForward()
+}
+
+func (it *IteratorOf[K, V]) Next() bool {
+	if it.closed || it.exhausted {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		it.leaf = it.tree.findLeafBy(func(keys []K) int { return 0 })
+		it.index = 0
+		return it.settleForward()
+	}
+	it.index += 1
+	return it.settleForward()
+}
+
+func (it *IteratorOf[K, V]) Prev() bool {
+	if it.closed || it.exhausted {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		it.leaf = it.tree.findLeafBy(func(keys []K) int { return len(keys) })
+		it.index = len(it.leaf.contents.keys) - 1
+		return it.settleBackward()
+	}
+	it.index -= 1
+	return it.settleBackward()
+}
+
+func (it *IteratorOf[K, V]) Key() K {
+	if !it.valid() {
+		var zero K
+		return zero
+	}
+	return it.leaf.contents.keys[it.index]
+}
+
+func (it *IteratorOf[K, V]) Value() *tree_api.RecordOf[V] {
+	if !it.valid() {
+		return nil
+	}
+	return it.leaf.contents.records[it.index]
+}
+
+func (it *IteratorOf[K, V]) Err() error {
+	if it.closed {
+		return tree_api.ErrIteratorClosed
+	}
+	return nil
+}
+
+func (it *IteratorOf[K, V]) Close() error {
+	it.closed = true
+	it.leaf = leafOf[K, V]{}
+	return nil
+}
+
+func (it *IteratorOf[K, V]) valid() bool {
+	return !it.closed && !it.exhausted && it.leaf.contents != nil &&
+		it.index >= 0 && it.index < len(it.leaf.contents.keys)
+}
+
+func (it *IteratorOf[K, V]) exhaust() bool {
+	it.exhausted = true
+	return false
+}
+
+// settleForward moves on to the following leaves while the iterator is past
+// the end of the one it is on. Keys in the next leaf are at least the current
+// leaf's upper separator.
+func (it *IteratorOf[K, V]) settleForward() bool {
+	for it.index >= len(it.leaf.contents.keys) {
+		if !it.leaf.hasHigh {
+			return it.exhaust()
+		}
+		bound := it.leaf.high
+		it.leaf = it.tree.findLeaf(bound, false)
+		it.index, _ = slices.BinarySearch(it.leaf.contents.keys, bound)
+	}
+	it.exhausted = false
+	return true
+}
+
+// settleBackward moves back to the preceding leaves while the iterator is
+// before the start of the one it is on. Keys in the previous leaf are below
+// the current leaf's lower separator.
+func (it *IteratorOf[K, V]) settleBackward() bool {
+	for it.index < 0 {
+		if !it.leaf.hasLow {
+			return it.exhaust()
+		}
+		bound := it.leaf.low
+		it.leaf = it.tree.findLeaf(bound, true)
+		it.index, _ = slices.BinarySearch(it.leaf.contents.keys, bound)
+		it.index -= 1
+	}
+	it.exhausted = false
+	return true
+}
@@ -0,0 +1,171 @@
+package olc_tree
+
+import (
+	"cmp"
+	"main/tree_api"
+	"runtime"
+	"slices"
+	"sync/atomic"
+)
+
+// The version word of a node counts its modifications in steps of four and
+// keeps two flags in the low bits: lockedBit while a writer holds the node,
+// and obsoleteBit once the node has been merged away or replaced as the root.
+// Locking adds lockedBit and unlocking adds it again, so the carry clears the
+// flag and bumps the count in one step.
+const (
+	obsoleteBit = 1
+	lockedBit   = 2
+)
+
+// NodeOf is a node of an OLCTree. Its contents are never modified in place: a
+// writer holding the node's lock builds new contents and publishes them with
+// one atomic store. Readers can therefore copy the contents pointer without
+// taking any lock and without racing with the writer, and use the version to
+// find out whether what they read was still current.
+type NodeOf[K cmp.Ordered, V any] struct {
+	version  atomic.Uint64
+	contents atomic.Pointer[contentsOf[K, V]]
+	isLeaf   bool
+}
+
+type Node = NodeOf[int, []byte]
+
+// contentsOf is an immutable snapshot of a node. Internal nodes have one more
+// child than keys; leaves have one record per key.
+type contentsOf[K cmp.Ordered, V any] struct {
+	keys     []K
+	children []*NodeOf[K, V]
+	records  []*tree_api.RecordOf[V]
+}
+
+func newNode[K cmp.Ordered, V any](isLeaf bool, c *contentsOf[K, V]) *NodeOf[K, V] {
+	n := &NodeOf[K, V]{isLeaf: isLeaf}
+	n.contents.Store(c)
+	return n
+}
+
+// readLock waits until no writer holds n and returns its version. It reports
+// false if n is obsolete, and the reader must restart from the root.
+func (n *NodeOf[K, V]) readLock() (uint64, bool) {
+	for {
+		v := n.version.Load()
+		if v&lockedBit == 0 {
+			return v, v&obsoleteBit == 0
+		}
+		runtime.Gosched()
+	}
+}
+
+// validate reports whether n is unchanged since readLock returned v.
+func (n *NodeOf[K, V]) validate(v uint64) bool {
+	return n.version.Load() == v
+}
+
+// upgrade locks n if it is unchanged since readLock returned v.
+func (n *NodeOf[K, V]) upgrade(v uint64) bool {
+	return n.version.CompareAndSwap(v, v+lockedBit)
+}
+
+// tryLock locks n if it is neither locked nor obsolete. Writers never wait for
+// a lock while holding one, so locks can be taken in any order.
+func (n *NodeOf[K, V]) tryLock() bool {
+	v := n.version.Load()
+	return v&(lockedBit|obsoleteBit) == 0 && n.upgrade(v)
+}
+
+// unlock releases n and returns its new version.
+func (n *NodeOf[K, V]) unlock() uint64 {
+	return n.version.Add(lockedBit)
+}
+
+func (n *NodeOf[K, V]) unlockObsolete() {
+	n.version.Add(lockedBit + obsoleteBit)
+}
+
+// childIndex returns the child of an internal node that covers key: keys equal
+// to a separator belong to its right.
+func childIndex[K cmp.Ordered](keys []K, key K) int {
+	i, found := slices.BinarySearch(keys, key)
+	if found {
+		i++
+	}
+	return i
+}
+
+// The methods below build new contents from c, leaving c untouched.
+
+func (c *contentsOf[K, V]) withRecord(i int, record *tree_api.RecordOf[V]) *contentsOf[K, V] {
+	records := slices.Clone(c.records)
+	records[i] = record
+	return &contentsOf[K, V]{keys: c.keys, records: records}
+}
+
+func (c *contentsOf[K, V]) insertRecord(i int, key K, record *tree_api.RecordOf[V]) *contentsOf[K, V] {
+	return &contentsOf[K, V]{
+		keys:    slices.Insert(slices.Clip(c.keys), i, key),
+		records: slices.Insert(slices.Clip(c.records), i, record),
+	}
+}
+
+func (c *contentsOf[K, V]) removeRecord(i int) *contentsOf[K, V] {
+	return &contentsOf[K, V]{
+		keys:    slices.Delete(slices.Clone(c.keys), i, i+1),
+		records: slices.Delete(slices.Clone(c.records), i, i+1),
+	}
+}
+
+// insertChild adds right, split off the child to the left of separator, to an
+// internal node.
+func (c *contentsOf[K, V]) insertChild(separator K, right *NodeOf[K, V]) *contentsOf[K, V] {
+	i := childIndex(c.keys, separator)
+	return &contentsOf[K, V]{
+		keys:     slices.Insert(slices.Clip(c.keys), i, separator),
+		children: slices.Insert(slices.Clip(c.children), i+1, right),
+	}
+}
+
+// split divides full contents into two halves and the separator between them.
+// A leaf's separator is the first key of the right half; an internal node's
+// moves up and is in neither half.
+func (c *contentsOf[K, V]) split(isLeaf bool) (*contentsOf[K, V], K, *contentsOf[K, V]) {
+	mid := len(c.keys) / 2
+	if isLeaf {
+		left := &contentsOf[K, V]{keys: slices.Clone(c.keys[:mid]), records: slices.Clone(c.records[:mid])}
+		right := &contentsOf[K, V]{keys: slices.Clone(c.keys[mid:]), records: slices.Clone(c.records[mid:])}
+		return left, c.keys[mid], right
+	}
+	left := &contentsOf[K, V]{keys: slices.Clone(c.keys[:mid]), children: slices.Clone(c.children[:mid+1])}
+	right := &contentsOf[K, V]{keys: slices.Clone(c.keys[mid+1:]), children: slices.Clone(c.children[mid+1:])}
+	return left, c.keys[mid], right
+}
+
+// merge joins c with right, its sibling across separator.
+func (c *contentsOf[K, V]) merge(separator K, right *contentsOf[K, V], isLeaf bool) *contentsOf[K, V] {
+	if isLeaf {
+		return &contentsOf[K, V]{
+			keys:    append(slices.Clone(c.keys), right.keys...),
+			records: append(slices.Clone(c.records), right.records...),
+		}
+	}
+	keys := append(slices.Clone(c.keys), separator)
+	return &contentsOf[K, V]{
+		keys:     append(keys, right.keys...),
+		children: append(slices.Clone(c.children), right.children...),
+	}
+}
+
+// removeChild drops separator i and the child to its right from an internal
+// node.
+func (c *contentsOf[K, V]) removeChild(i int) *contentsOf[K, V] {
+	return &contentsOf[K, V]{
+		keys:     slices.Delete(slices.Clone(c.keys), i, i+1),
+		children: slices.Delete(slices.Clone(c.children), i+1, i+2),
+	}
+}
+
+func (c *contentsOf[K, V]) withKey(i int, key K) *contentsOf[K, V] {
+	keys := slices.Clone(c.keys)
+	keys[i] = key
+	return &contentsOf[K, V]{keys: keys, children: c.children}
+}
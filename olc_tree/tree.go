@@ -0,0 +1,576 @@
+package olc_tree
+
+import (
+	"cmp"
+	"fmt"
+	"main/tree_api"
+	"runtime"
+	"slices"
+	"sync/atomic"
+)
+
+const (
+	defaultOrder = 4
+	// Nodes are split and merged on the way down, before the node being
+	// fixed is full or at its minimum, which needs every internal node to keep
+	// at least one key after a split. Order 3 would leave single-child nodes.
+	minOrder = 4
+	maxOrder = 512
+)
+
+// OLCTreeOf is a B+ tree synchronised with optimistic lock coupling. Every
+// node carries a version word; readers descend without locking anything,
+// checking at each step that the parent's version has not moved since they
+// read it, and restart from the root if it has. Readers never write to shared
+// memory, so they do not contend with each other on cache lines at the top of
+// the tree.
+//
+// Writers descend the same way and lock only the nodes they change, by
+// swapping the version they read for a locked one. Full nodes are split and
+// minimal ones topped up on the way down, locking the node, its parent and,
+// for a merge, a sibling; the descent then restarts. A change therefore never
+// has to travel back up the tree, and a writer never waits for one lock while
+// holding another.
+type OLCTreeOf[K cmp.Ordered, V any] struct {
+	root  atomic.Pointer[NodeOf[K, V]]
+	order int
+}
+
+type OLCTree = OLCTreeOf[int, []byte]
+
+func NewTree(opts ...tree_api.Option) tree_api.BPTree {
+	return NewTreeOf[int, []byte](opts...)
+}
+
+func NewTreeOf[K cmp.Ordered, V any](opts ...tree_api.Option) tree_api.TreeOf[K, V] {
+	o, err := tree_api.BuildOptions(defaultOrder, minOrder, maxOrder, opts)
+	if err != nil {
+		panic(err)
+	}
+	t := &OLCTreeOf[K, V]{order: o.Order}
+	t.root.Store(newNode[K, V](true, &contentsOf[K, V]{}))
+	return t
+}
+
+func (t *OLCTreeOf[K, V]) Order() int {
+	return t.order
+}
+
+// minKeys is the fewest keys a node other than the root may hold.
+func (t *OLCTreeOf[K, V]) minKeys(isLeaf bool) int {
+	if isLeaf {
+		return (t.order - 1) / 2
+	}
+	return (t.order - 2) / 2
+}
+
+// retry runs attempt until it reports that it is done, yielding between tries
+// so that the writer it collided with can finish.
+func retry(attempt func() bool) {
+	for !attempt() {
+		runtime.Gosched()
+	}
+}
+
+// readRoot returns the root and its version.
+func (t *OLCTreeOf[K, V]) readRoot() (*NodeOf[K, V], uint64, bool) {
+	n := t.root.Load()
+	v, ok := n.readLock()
+	if !ok || t.root.Load() != n {
+		return nil, 0, false
+	}
+	return n, v, true
+}
+
+// leafOf is a leaf reached by descend, with the version it had and the
+// contents it held at that version. Its keys lie in [low, high); a bound that
+// is not set is open.
+type leafOf[K cmp.Ordered, V any] struct {
+	node     *NodeOf[K, V]
+	version  uint64
+	contents *contentsOf[K, V]
+	low      K
+	high     K
+	hasLow   bool
+	hasHigh  bool
+}
+
+// descend makes one optimistic descent to a leaf, following the child that
+// pick chooses at each internal node. It reports false if a writer got in the
+// way and the descent must restart.
+func (t *OLCTreeOf[K, V]) descend(pick func(keys []K) int) (leafOf[K, V], bool) {
+	l := leafOf[K, V]{}
+	n, v, ok := t.readRoot()
+	if !ok {
+		return l, false
+	}
+	for {
+		c := n.contents.Load()
+		if n.isLeaf {
+			if !n.validate(v) {
+				return l, false
+			}
+			l.node, l.version, l.contents = n, v, c
+			return l, true
+		}
+		i := pick(c.keys)
+		if i > 0 {
+			l.low, l.hasLow = c.keys[i-1], true
+		}
+		if i < len(c.keys) {
+			l.high, l.hasHigh = c.keys[i], true
+		}
+		child := c.children[i]
+		cv, ok := child.readLock()
+		if !ok || !n.validate(v) {
+			return l, false
+		}
+		n, v = child, cv
+	}
+}
+
+// findLeaf descends to the leaf covering key, or, with below set, to the leaf
+// that would hold the largest key less than key, restarting until it gets
+// there.
+func (t *OLCTreeOf[K, V]) findLeaf(key K, below bool) leafOf[K, V] {
+	return t.findLeafBy(func(keys []K) int {
+		if below {
+			i, _ := slices.BinarySearch(keys, key)
+			return i
+		}
+		return childIndex(keys, key)
+	})
+}
+
+func (t *OLCTreeOf[K, V]) findLeafBy(pick func(keys []K) int) leafOf[K, V] {
+	var l leafOf[K, V]
+	retry(func() bool {
+		var ok bool
+		l, ok = t.descend(pick)
+		return ok
+	})
+	return l
+}
+
+func (t *OLCTreeOf[K, V]) Find(key K, verbose bool) (*tree_api.RecordOf[V], error) {
+	c := t.findLeaf(key, false).contents
+	if i, found := slices.BinarySearch(c.keys, key); found {
+		return c.records[i], nil
+	}
+	return nil, tree_api.ErrKeyNotFound
+}
+
+func (t *OLCTreeOf[K, V]) FindAndPrint(key K, verbose bool) {
+	r, err := t.Find(key, verbose)
+
+	if err != nil || r == nil {
+		fmt.Printf("Record not found under key %v.\n", key)
+	} else {
+		fmt.Printf("Record at %p -- key %v, value %s.\n", r, key, tree_api.FormatValue(r.Value))
+	}
+}
+
+func (t *OLCTreeOf[K, V]) FindAndPrintRange(key_start, key_end K, verbose bool) {
+	results, _ := t.Range(key_start, key_end)
+	if len(results) == 0 {
+		fmt.Println("None found,")
+	} else {
+		for _, kr := range results {
+			fmt.Printf("Key: %v  Location: %p  Value: %s\n",
+				kr.Key,
+				kr.Record,
+				tree_api.FormatValue(kr.Record.Value))
+		}
+	}
+}
+
+func (t *OLCTreeOf[K, V]) Insert(key K, value V) error {
+	return t.insert(key, &tree_api.RecordOf[V]{Value: value}, false)
+}
+
+// Upsert inserts key, or replaces its record if it is already present.
+func (t *OLCTreeOf[K, V]) Upsert(key K, value V) error {
+	return t.insert(key, &tree_api.RecordOf[V]{Value: value}, true)
+}
+
+func (t *OLCTreeOf[K, V]) insert(key K, record *tree_api.RecordOf[V], replace bool) error {
+	var err error
+	retry(func() bool {
+		var done bool
+		done, err = t.tryInsert(key, record, replace)
+		return done
+	})
+	return err
+}
+
+// tryInsert makes one attempt at an insert. It splits every full node on its
+// way down, so by the time it reaches the leaf the leaf has room. It reports
+// whether it finished, or ran into another writer and must try again.
+//
+// After a split it carries on from the parent rather than from the root, so
+// that a delete merging the halves again on its own way down cannot undo the
+// split before this insert gets past it. Mixed inserts and deletes near the
+// top of a small tree grow and collapse the root often, and start from the
+// new root without yielding.
+func (t *OLCTreeOf[K, V]) tryInsert(key K, record *tree_api.RecordOf[V], replace bool) (bool, error) {
+	var parent *NodeOf[K, V]
+	var pv uint64
+	n, v, ok := t.readRoot()
+	if !ok {
+		return false, nil
+	}
+	for {
+		c := n.contents.Load()
+		if len(c.keys) == t.order-1 {
+			if parent == nil {
+				if !n.upgrade(v) {
+					return false, nil
+				}
+				t.split(nil, n)
+				n.unlock()
+				if n, v, ok = t.readRoot(); !ok {
+					return false, nil
+				}
+				continue
+			}
+			if !parent.upgrade(pv) {
+				return false, nil
+			}
+			if !n.upgrade(v) {
+				parent.unlock()
+				return false, nil
+			}
+			t.split(parent, n)
+			n.unlock()
+			pv = parent.unlock()
+			if n, v, ok = t.child(parent, pv, key); !ok {
+				return false, nil
+			}
+			continue
+		}
+		if n.isLeaf {
+			if !n.upgrade(v) {
+				return false, nil
+			}
+			defer n.unlock()
+			i, found := slices.BinarySearch(c.keys, key)
+			if found {
+				if !replace {
+					return true, tree_api.ErrKeyExists
+				}
+				n.contents.Store(c.withRecord(i, record))
+				return true, nil
+			}
+			n.contents.Store(c.insertRecord(i, key, record))
+			return true, nil
+		}
+		child, cv, ok := t.child(n, v, key)
+		if !ok {
+			return false, nil
+		}
+		parent, pv = n, v
+		n, v = child, cv
+	}
+}
+
+// child returns the child of n that covers key and its version, provided n is
+// unchanged since it had version v.
+func (t *OLCTreeOf[K, V]) child(n *NodeOf[K, V], v uint64, key K) (*NodeOf[K, V], uint64, bool) {
+	c := n.contents.Load()
+	child := c.children[childIndex(c.keys, key)]
+	cv, ok := child.readLock()
+	if !ok || !n.validate(v) {
+		return nil, 0, false
+	}
+	return child, cv, true
+}
+
+// split splits the full node n, whose parent is not full. Both are locked. A
+// root has no parent, and gets a new root above it.
+func (t *OLCTreeOf[K, V]) split(parent, n *NodeOf[K, V]) {
+	left, separator, right := n.contents.Load().split(n.isLeaf)
+	sibling := newNode(n.isLeaf, right)
+	n.contents.Store(left)
+	if parent == nil {
+		t.root.Store(newNode(false, &contentsOf[K, V]{
+			keys:     []K{separator},
+			children: []*NodeOf[K, V]{n, sibling},
+		}))
+		return
+	}
+	parent.contents.Store(parent.contents.Load().insertChild(separator, sibling))
+}
+
+// Update replaces the record of an existing key.
+func (t *OLCTreeOf[K, V]) Update(key K, value V) error {
+	_, err := t.swap(key, nil, value, false)
+	return err
+}
+
+// CompareAndSwap replaces the record of key if it is still old.
+func (t *OLCTreeOf[K, V]) CompareAndSwap(key K, old *tree_api.RecordOf[V], new V) (bool, error) {
+	return t.swap(key, old, new, true)
+}
+
+// swap gives an existing key a new record, locking only its leaf. With compare
+// set it only does so if the current record is old.
+func (t *OLCTreeOf[K, V]) swap(key K, old *tree_api.RecordOf[V], value V, compare bool) (bool, error) {
+	record := &tree_api.RecordOf[V]{Value: value}
+	var swapped bool
+	var err error
+	retry(func() bool {
+		l, ok := t.descend(func(keys []K) int { return childIndex(keys, key) })
+		if !ok || !l.node.upgrade(l.version) {
+			return false
+		}
+		defer l.node.unlock()
+		i, found := slices.BinarySearch(l.contents.keys, key)
+		if !found {
+			swapped, err = false, tree_api.ErrKeyNotFound
+			return true
+		}
+		if compare && l.contents.records[i] != old {
+			swapped, err = false, nil
+			return true
+		}
+		l.node.contents.Store(l.contents.withRecord(i, record))
+		swapped, err = true, nil
+		return true
+	})
+	return swapped, err
+}
+
+func (t *OLCTreeOf[K, V]) Delete(key K) error {
+	var err error
+	retry(func() bool {
+		var done bool
+		done, err = t.tryDelete(key)
+		return done
+	})
+	return err
+}
+
+// tryDelete makes one attempt at a delete. It tops up every node at its
+// minimum on its way down, by borrowing from or merging with a sibling, so by
+// the time it reaches the leaf the leaf can lose a key. Like tryInsert it
+// carries on from the parent afterwards. It reports whether it finished.
+func (t *OLCTreeOf[K, V]) tryDelete(key K) (bool, error) {
+	n, v, ok := t.readRoot()
+	if !ok {
+		return false, nil
+	}
+	for {
+		c := n.contents.Load()
+		if n.isLeaf {
+			if !n.upgrade(v) {
+				return false, nil
+			}
+			defer n.unlock()
+			i, found := slices.BinarySearch(c.keys, key)
+			if !found {
+				return true, tree_api.ErrKeyNotFound
+			}
+			n.contents.Store(c.removeRecord(i))
+			return true, nil
+		}
+		i := childIndex(c.keys, key)
+		child := c.children[i]
+		cv, ok := child.readLock()
+		if !ok {
+			return false, nil
+		}
+		cc := child.contents.Load()
+		if !n.validate(v) {
+			return false, nil
+		}
+		if len(cc.keys) > t.minKeys(child.isLeaf) {
+			n, v = child, cv
+			continue
+		}
+
+		if !n.upgrade(v) {
+			return false, nil
+		}
+		if !child.upgrade(cv) {
+			n.unlock()
+			return false, nil
+		}
+		j := i - 1
+		if i == 0 {
+			j = i + 1
+		}
+		sibling := c.children[j]
+		if !sibling.tryLock() {
+			child.unlock()
+			n.unlock()
+			return false, nil
+		}
+		if j < i {
+			ok = t.rebalance(n, sibling, child, j)
+		} else {
+			ok = t.rebalance(n, child, sibling, i)
+		}
+		if !ok {
+			if n, v, ok = t.readRoot(); !ok {
+				return false, nil
+			}
+			continue
+		}
+		v = n.unlock()
+		if n, v, ok = t.child(n, v, key); !ok {
+			return false, nil
+		}
+	}
+}
+
+// rebalance evens out the neighbours left and right, the children of parent
+// on either side of separator i, one of which is at its minimum. They merge
+// if they fit in one node, and otherwise the smaller borrows an entry from the
+// larger. All three are locked on entry, and left and right are unlocked on
+// return. A root left without keys is replaced by its only child and unlocked
+// as obsolete, and rebalance reports false; otherwise parent stays locked.
+func (t *OLCTreeOf[K, V]) rebalance(parent, left, right *NodeOf[K, V], i int) bool {
+	pc, lc, rc := parent.contents.Load(), left.contents.Load(), right.contents.Load()
+	separator := pc.keys[i]
+	merged := len(lc.keys) + len(rc.keys)
+	if !left.isLeaf {
+		merged++
+	}
+
+	if merged <= t.order-1 {
+		left.contents.Store(lc.merge(separator, rc, left.isLeaf))
+		right.unlockObsolete()
+		pc = pc.removeChild(i)
+		if len(pc.keys) == 0 {
+			t.root.Store(left)
+			left.unlock()
+			parent.unlockObsolete()
+			return false
+		}
+		parent.contents.Store(pc)
+		left.unlock()
+		return true
+	}
+
+	var nl, nr *contentsOf[K, V]
+	switch {
+	case left.isLeaf && len(lc.keys) < len(rc.keys):
+		nl = &contentsOf[K, V]{
+			keys:    append(slices.Clone(lc.keys), rc.keys[0]),
+			records: append(slices.Clone(lc.records), rc.records[0]),
+		}
+		nr = &contentsOf[K, V]{keys: slices.Clone(rc.keys[1:]), records: slices.Clone(rc.records[1:])}
+		separator = nr.keys[0]
+	case left.isLeaf:
+		last := len(lc.keys) - 1
+		nl = &contentsOf[K, V]{keys: slices.Clone(lc.keys[:last]), records: slices.Clone(lc.records[:last])}
+		nr = &contentsOf[K, V]{
+			keys:    slices.Insert(slices.Clip(rc.keys), 0, lc.keys[last]),
+			records: slices.Insert(slices.Clip(rc.records), 0, lc.records[last]),
+		}
+		separator = lc.keys[last]
+	case len(lc.keys) < len(rc.keys):
+		nl = &contentsOf[K, V]{
+			keys:     append(slices.Clone(lc.keys), separator),
+			children: append(slices.Clone(lc.children), rc.children[0]),
+		}
+		nr = &contentsOf[K, V]{keys: slices.Clone(rc.keys[1:]), children: slices.Clone(rc.children[1:])}
+		separator = rc.keys[0]
+	default:
+		last := len(lc.keys) - 1
+		nl = &contentsOf[K, V]{keys: slices.Clone(lc.keys[:last]), children: slices.Clone(lc.children[:last+1])}
+		nr = &contentsOf[K, V]{
+			keys:     slices.Insert(slices.Clip(rc.keys), 0, separator),
+			children: slices.Insert(slices.Clip(rc.children), 0, lc.children[last+1]),
+		}
+		separator = lc.keys[last]
+	}
+	left.contents.Store(nl)
+	right.contents.Store(nr)
+	parent.contents.Store(pc.withKey(i, separator))
+	right.unlock()
+	left.unlock()
+	return true
+}
+
+func (t *OLCTreeOf[K, V]) Range(key_start, key_end K) ([]tree_api.KeyRecordOf[K, V], error) {
+	return t.RangeLimit(key_start, key_end, 0, false)
+}
+
+// RangeLimit reads one leaf at a time, each as it was at some moment during
+// the call, and finds the next leaf by descending again from the separator
+// that bounds the last one. The result is sorted and holds every key that was
+// present throughout the call, but is not a snapshot of the whole range.
+func (t *OLCTreeOf[K, V]) RangeLimit(key_start, key_end K, limit int, reverse bool) ([]tree_api.KeyRecordOf[K, V], error) {
+	if key_start > key_end {
+		return nil, tree_api.ErrInvalidRange
+	}
+	results := []tree_api.KeyRecordOf[K, V]{}
+	full := func() bool { return limit > 0 && len(results) == limit }
+
+	if !reverse {
+		l := t.findLeaf(key_start, false)
+		for {
+			c := l.contents
+			i, _ := slices.BinarySearch(c.keys, key_start)
+			for ; i < len(c.keys); i++ {
+				if c.keys[i] > key_end || full() {
+					return results, nil
+				}
+				results = append(results, tree_api.KeyRecordOf[K, V]{Key: c.keys[i], Record: c.records[i]})
+			}
+			if !l.hasHigh || l.high > key_end {
+				return results, nil
+			}
+			key_start = l.high
+			l = t.findLeaf(key_start, false)
+		}
+	}
+
+	l := t.findLeaf(key_end, false)
+	c := l.contents
+	i, found := slices.BinarySearch(c.keys, key_end)
+	if found {
+		i++
+	}
+	for {
+		for i--; i >= 0; i-- {
+			if c.keys[i] < key_start || full() {
+				return results, nil
+			}
+			results = append(results, tree_api.KeyRecordOf[K, V]{Key: c.keys[i], Record: c.records[i]})
+		}
+		if !l.hasLow || l.low <= key_start {
+			return results, nil
+		}
+		bound := l.low
+		l = t.findLeaf(bound, true)
+		c = l.contents
+		i, _ = slices.BinarySearch(c.keys, bound)
+	}
+}
+
+func (t *OLCTreeOf[K, V]) PrintTree() {
+	level := []*NodeOf[K, V]{t.root.Load()}
+	for len(level) > 0 {
+		next := []*NodeOf[K, V]{}
+		for _, n := range level {
+			c := n.contents.Load()
+			for _, k := range c.keys {
+				fmt.Printf("%v ", k)
+			}
+			fmt.Printf(" | ")
+			next = append(next, c.children...)
+		}
+		fmt.Printf("\n")
+		level = next
+	}
+}
+
+func (t *OLCTreeOf[K, V]) PalmBasic(key_count int, num_threads int) {
+	panic("not implemented for OLCTree")
+}
+
+func (t *OLCTreeOf[K, V]) Palm(queries []tree_api.QueryOf[K, V], num_threads int) []tree_api.ResultOf[V] {
+	panic("not implemented for OLCTree")
+}
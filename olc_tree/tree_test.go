@@ -0,0 +1,114 @@
+package olc_tree
+
+import (
+	"fmt"
+	"main/tree_api"
+	"main/tree_testing"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentPointOps(t *testing.T) {
+	for _, order := range []int{4, 5, 16} {
+		t.Run(fmt.Sprintf("order=%d", order), func(t *testing.T) {
+			tree_testing.ConcurrentPointOps(t, NewTreeOf[int, []byte](tree_api.WithOrder(order)))
+		})
+	}
+}
+
+// A reader that is between a parent and its child when a writer splits the
+// child sees the parent's version move, and restarts rather than settle in the
+// half that no longer covers its key.
+func TestDescentRestartsAcrossSplit(t *testing.T) {
+	tree := NewTreeOf[int, []byte](tree_api.WithOrder(4)).(*OLCTree)
+	for _, key := range []int{0, 10, 20, 30} {
+		tree.Insert(key, []byte(fmt.Sprint(key)))
+	}
+	// The root now has two leaves, the right one full with 10, 20 and 30.
+	splits := 0
+	pick := func(keys []int) int {
+		if splits == 0 {
+			splits++
+			// Split the full leaf behind the reader's back.
+			if err := tree.Insert(25, []byte("25")); err != nil {
+				t.Fatalf("insert 25: %s", err)
+			}
+		}
+		return childIndex(keys, 25)
+	}
+	if _, ok := tree.descend(pick); ok {
+		t.Fatalf("descent finished although the leaf under it was split")
+	}
+	l := tree.findLeafBy(pick)
+	if _, found := slices.BinarySearch(l.contents.keys, 25); !found {
+		t.Errorf("restarted descent reached a leaf holding %v, without 25", l.contents.keys)
+	}
+	if !l.hasLow || l.low > 25 || l.hasHigh && l.high <= 25 {
+		t.Errorf("restarted descent reached a leaf for [%d, %d)", l.low, l.high)
+	}
+	tree_testing.CheckContents(t, tree, map[int]string{0: "0", 10: "10", 20: "20", 25: "25", 30: "30"})
+}
+
+// Keys that are present throughout are always found, while other inserts keep
+// splitting the nodes on the way to them.
+func TestFindDuringSplits(t *testing.T) {
+	tree := NewTreeOf[int, []byte](tree_api.WithOrder(4)).(*OLCTree)
+	for key := 0; key < 4000; key += 10 {
+		tree.Insert(key, []byte(fmt.Sprint(key)))
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for key := w + 1; key < 4000; key += 10 {
+				tree.Insert(key, []byte(fmt.Sprint(key)))
+			}
+		}(w)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		for key := 0; key < 4000; key += 10 {
+			if r, err := tree.Find(key, false); err != nil || string(r.Value) != fmt.Sprint(key) {
+				t.Fatalf("find %d during splits: %v %v", key, r, err)
+			}
+		}
+	}
+	if err := tree.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeleteEverything(t *testing.T) {
+	tree := NewTreeOf[int, []byte](tree_api.WithOrder(4)).(*OLCTree)
+	for i := 0; i < 200; i++ {
+		if err := tree.Insert(i, []byte(fmt.Sprint(i))); err != nil {
+			t.Fatalf("insert %d: %s", i, err)
+		}
+	}
+	for i := 0; i < 200; i++ {
+		if err := tree.Delete(i); err != nil {
+			t.Fatalf("delete %d: %s", i, err)
+		}
+		if err := tree.Validate(); err != nil {
+			t.Fatalf("after deleting %d: %s", i, err)
+		}
+	}
+	if root := tree.root.Load(); !root.isLeaf || len(root.contents.Load().keys) != 0 {
+		t.Errorf("expected an empty tree to be a single empty leaf")
+	}
+	if err := tree.Delete(0); err != tree_api.ErrKeyNotFound {
+		t.Errorf("expected ErrKeyNotFound and got %v", err)
+	}
+	tree_testing.CheckContents(t, tree, map[int]string{})
+}
@@ -0,0 +1,112 @@
+package olc_tree
+
+import (
+	"cmp"
+	"fmt"
+	"main/tree_api"
+)
+
+// Validate checks that the tree is well formed: keys are sorted within every
+// node and fall between the separators above them, every internal node has
+// one more child than keys and every leaf one record per key, no node is over-
+// or underfull, all leaves are at the same depth, and no node is left locked
+// or obsolete. Nodes have no parent or sibling pointers to check. It returns
+// an error wrapping tree_api.ErrInvalidTree that names the path from the root
+// to the first node found to be broken, or nil if the tree is well formed.
+//
+// Validate reads each node's contents once, but does not check versions, so
+// operations under way must have finished.
+func (t *OLCTreeOf[K, V]) Validate() error {
+	if t.order < minOrder || t.order > maxOrder {
+		return fmt.Errorf("%w: order %d is outside [%d, %d]", tree_api.ErrInvalidTree, t.order, minOrder, maxOrder)
+	}
+	root := t.root.Load()
+	if root == nil {
+		return fmt.Errorf("%w: root is missing", tree_api.ErrInvalidTree)
+	}
+	v := &validatorOf[K, V]{tree: t, root: root, leafDepth: -1}
+	return v.check(root, []int{}, nil, nil)
+}
+
+type validatorOf[K cmp.Ordered, V any] struct {
+	tree      *OLCTreeOf[K, V]
+	root      *NodeOf[K, V]
+	leafDepth int
+}
+
+// check validates the subtree under n, whose keys must lie in [low, high); a
+// nil bound is open.
+func (v *validatorOf[K, V]) check(n *NodeOf[K, V], path []int, low, high *K) error {
+	t := v.tree
+	fail := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s: %s", tree_api.ErrInvalidTree, tree_api.FormatPath(path), fmt.Sprintf(format, args...))
+	}
+	if version := n.version.Load(); version&lockedBit != 0 {
+		return fail("is still locked")
+	} else if version&obsoleteBit != 0 {
+		return fail("is obsolete")
+	}
+	c := n.contents.Load()
+	if c == nil {
+		return fail("has no contents")
+	}
+	if len(c.keys) > t.order-1 {
+		return fail("holds %d keys, more than the maximum of %d", len(c.keys), t.order-1)
+	}
+	if n != v.root {
+		if len(c.keys) < t.minKeys(n.isLeaf) {
+			return fail("holds %d keys, fewer than the minimum of %d", len(c.keys), t.minKeys(n.isLeaf))
+		}
+	} else if !n.isLeaf && len(c.keys) == 0 {
+		return fail("root is an internal node without keys")
+	}
+	for i, key := range c.keys {
+		if i > 0 && c.keys[i-1] >= key {
+			return fail("key %v at %d is not above key %v before it", key, i, c.keys[i-1])
+		}
+		if low != nil && key < *low {
+			return fail("key %v at %d is below the separator %v", key, i, *low)
+		}
+		if high != nil && key >= *high {
+			return fail("key %v at %d is not below the separator %v", key, i, *high)
+		}
+	}
+
+	if n.isLeaf {
+		if len(c.records) != len(c.keys) || len(c.children) != 0 {
+			return fail("leaf has %d keys, %d records and %d children", len(c.keys), len(c.records), len(c.children))
+		}
+		for i, r := range c.records {
+			if r == nil {
+				return fail("record %d is missing", i)
+			}
+		}
+		depth := len(path)
+		if v.leafDepth < 0 {
+			v.leafDepth = depth
+		} else if depth != v.leafDepth {
+			return fail("leaf is at depth %d, other leaves are at %d", depth, v.leafDepth)
+		}
+		return nil
+	}
+
+	if len(c.children) != len(c.keys)+1 || len(c.records) != 0 {
+		return fail("internal node has %d keys, %d children and %d records", len(c.keys), len(c.children), len(c.records))
+	}
+	for i, child := range c.children {
+		if child == nil {
+			return fail("child %d is missing", i)
+		}
+		childLow, childHigh := low, high
+		if i > 0 {
+			childLow = &c.keys[i-1]
+		}
+		if i < len(c.keys) {
+			childHigh = &c.keys[i]
+		}
+		if err := v.check(child, append(path, i), childLow, childHigh); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package seq_tree
+
+import (
+	"cmp"
+	"main/tree_api"
+)
+
+// IteratorOf walks the leaves of a Tree through the sibling pointer in
+// Pointers[order-1]. The tree must not be modified while an iterator is in
+// use.
+type IteratorOf[K cmp.Ordered, V any] struct {
+	tree      *TreeOf[K, V]
+	leaf      *NodeOf[K, V]
+	index     int
+	started   bool
+	exhausted bool
+	closed    bool
+}
+
+func (t *TreeOf[K, V]) NewIterator() tree_api.IteratorOf[K, V] {
+	return &IteratorOf[K, V]{tree: t}
+}
+
+func (it *IteratorOf[K, V]) Seek(key K) bool {
+	if it.closed {
+		return false
+	}
+	it.started = true
+	it.leaf = it.tree.findLeaf(key, false)
+	it.index = 0
+	if it.leaf == nil {
+		return it.exhaust()
+	}
+	for it.index < it.leaf.NumKeys && it.leaf.Keys[it.index] < key {
+		it.index += 1
+	}
+	return it.settleForward()
+}
+
+func (it *IteratorOf[K, V]) Next() bool {
+	if it.closed || it.exhausted {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		it.leaf = it.tree.firstLeaf()
+		it.index = 0
+		if it.leaf == nil {
+			return it.exhaust()
+		}
+		return it.settleForward()
+	}
+	it.index += 1
+	return it.settleForward()
+}
+
+func (it *IteratorOf[K, V]) Prev() bool {
+	if it.closed || it.exhausted {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		it.leaf = it.tree.lastLeaf()
+		if it.leaf == nil || it.leaf.NumKeys == 0 {
+			return it.exhaust()
+		}
+		it.index = it.leaf.NumKeys - 1
+		return true
+	}
+	if it.index > 0 {
+		it.index -= 1
+		return true
+	}
+	// There are no back pointers between leaves, so find the predecessor by
+	// descending from the root again.
+	it.leaf, it.index = it.tree.findLast(it.leaf.Keys[0], false)
+	if it.leaf == nil {
+		return it.exhaust()
+	}
+	return true
+}
+
+func (it *IteratorOf[K, V]) Key() K {
+	if !it.valid() {
+		var zero K
+		return zero
+	}
+	return it.leaf.Keys[it.index]
+}
+
+func (it *IteratorOf[K, V]) Value() *tree_api.RecordOf[V] {
+	if !it.valid() {
+		return nil
+	}
+	r, _ := it.leaf.Pointers[it.index].(*tree_api.RecordOf[V])
+	return r
+}
+
+func (it *IteratorOf[K, V]) Err() error {
+	if it.closed {
+		return tree_api.ErrIteratorClosed
+	}
+	return nil
+}
+
+func (it *IteratorOf[K, V]) Close() error {
+	it.closed = true
+	it.leaf = nil
+	return nil
+}
+
+func (it *IteratorOf[K, V]) valid() bool {
+	return !it.closed && !it.exhausted && it.leaf != nil && it.index < it.leaf.NumKeys
+}
+
+func (it *IteratorOf[K, V]) exhaust() bool {
+	it.exhausted = true
+	it.leaf = nil
+	return false
+}
+
+// settleForward moves past the end of exhausted leaves until the iterator
+// points at a key or runs off the end of the chain.
+func (it *IteratorOf[K, V]) settleForward() bool {
+	for it.index >= it.leaf.NumKeys {
+		it.leaf, _ = it.leaf.Pointers[it.tree.order-1].(*NodeOf[K, V])
+		it.index = 0
+		if it.leaf == nil {
+			return it.exhaust()
+		}
+	}
+	it.exhausted = false
+	return true
+}
+
+func (t *TreeOf[K, V]) firstLeaf() *NodeOf[K, V] {
+	c := t.Root
+	if c == nil {
+		return nil
+	}
+	for !c.IsLeaf {
+		c, _ = c.Pointers[0].(*NodeOf[K, V])
+	}
+	return c
+}
+
+func (t *TreeOf[K, V]) lastLeaf() *NodeOf[K, V] {
+	c := t.Root
+	if c == nil {
+		return nil
+	}
+	for !c.IsLeaf {
+		c, _ = c.Pointers[c.NumKeys].(*NodeOf[K, V])
+	}
+	return c
+}
@@ -4,48 +4,67 @@ package seq_tree
 
 // From https://github.com/collinglass/bptree
 import (
+	"cmp"
 	"errors"
 	"fmt"
 	"main/tree_api"
 	"reflect"
 )
 
-var (
-	err error
-
+const (
 	defaultOrder = 4
 	minOrder     = 3
-	maxOrder     = 20
+	maxOrder     = 512
+)
+
+var (
+	err error
 
-	order          = defaultOrder
-	queue          *Node
 	verbose_output = false
 	version        = 0.1
 )
 
-type Tree struct {
-	Root *Node
+type TreeOf[K cmp.Ordered, V any] struct {
+	Root  *NodeOf[K, V]
+	order int
 }
 
-type Node struct {
+// Tree is the int-keyed, byte-valued tree the benchmarks and tests use.
+type Tree = TreeOf[int, []byte]
+
+type NodeOf[K cmp.Ordered, V any] struct {
 	Pointers []interface{}
-	Keys     []int
-	Parent   *Node
+	Keys     []K
+	Parent   *NodeOf[K, V]
 	IsLeaf   bool
 	NumKeys  int
-	Next     *Node
+	Next     *NodeOf[K, V]
+}
+
+type Node = NodeOf[int, []byte]
+
+func NewTree(opts ...tree_api.Option) *Tree {
+	return NewTreeOf[int, []byte](opts...)
 }
 
-func NewTree() *Tree {
-	return &Tree{}
+func NewTreeOf[K cmp.Ordered, V any](opts ...tree_api.Option) *TreeOf[K, V] {
+	o, err := tree_api.BuildOptions(defaultOrder, minOrder, maxOrder, opts)
+	if err != nil {
+		panic(err)
+	}
+	return &TreeOf[K, V]{order: o.Order}
 }
 
-func (t *Tree) Insert(key int, value []byte) error {
-	var pointer *tree_api.Record
-	var leaf *Node
+func (t *TreeOf[K, V]) Order() int {
+	return t.order
+}
+
+func (t *TreeOf[K, V]) Insert(key K, value V) error {
+	var pointer *tree_api.RecordOf[V]
+	var leaf *NodeOf[K, V]
 
 	if _, err := t.Find(key, false); err == nil {
-		return errors.New("key already exists")
+		return tree_api.ErrKeyExists
 	}
 
 	pointer, err := makeRecord(value)
@@ -59,7 +78,7 @@ func (t *Tree) Insert(key int, value []byte) error {
 
 	leaf = t.findLeaf(key, false)
 
-	if leaf.NumKeys < order-1 {
+	if leaf.NumKeys < t.order-1 {
 		insertIntoLeaf(leaf, key, pointer)
 		return nil
 	}
@@ -67,11 +86,40 @@ func (t *Tree) Insert(key int, value []byte) error {
 	return t.insertIntoLeafAfterSplitting(leaf, key, pointer)
 }
 
-func (t *Tree) Find(key int, verbose bool) (*tree_api.Record, error) {
+// Upsert inserts key, or replaces its record if it is already present.
+func (t *TreeOf[K, V]) Upsert(key K, value V) error {
+	if leaf, i := t.lookup(key); leaf != nil {
+		return replaceRecord(leaf, i, value)
+	}
+	return t.Insert(key, value)
+}
+
+// Update replaces the record of an existing key.
+func (t *TreeOf[K, V]) Update(key K, value V) error {
+	leaf, i := t.lookup(key)
+	if leaf == nil {
+		return tree_api.ErrKeyNotFound
+	}
+	return replaceRecord(leaf, i, value)
+}
+
+// CompareAndSwap replaces the record of key if it is still old.
+func (t *TreeOf[K, V]) CompareAndSwap(key K, old *tree_api.RecordOf[V], new V) (bool, error) {
+	leaf, i := t.lookup(key)
+	if leaf == nil {
+		return false, tree_api.ErrKeyNotFound
+	}
+	if leaf.Pointers[i] != old {
+		return false, nil
+	}
+	return true, replaceRecord(leaf, i, new)
+}
+
+func (t *TreeOf[K, V]) Find(key K, verbose bool) (*tree_api.RecordOf[V], error) {
 	i := 0
 	c := t.findLeaf(key, verbose)
 	if c == nil {
-		return nil, errors.New("key not found")
+		return nil, tree_api.ErrKeyNotFound
 	}
 	for i = 0; i < c.NumKeys; i++ {
 		if c.Keys[i] == key {
@@ -79,45 +127,54 @@ func (t *Tree) Find(key int, verbose bool) (*tree_api.Record, error) {
 		}
 	}
 	if i == c.NumKeys {
-		return nil, errors.New("key not found")
+		return nil, tree_api.ErrKeyNotFound
 	}
 
-	r, _ := c.Pointers[i].(*tree_api.Record)
+	r, _ := c.Pointers[i].(*tree_api.RecordOf[V])
 
 	return r, nil
 }
 
-func (t *Tree) FindAndPrint(key int, verbose bool) {
+func (t *TreeOf[K, V]) FindAndPrint(key K, verbose bool) {
 	r, err := t.Find(key, verbose)
 
 	if err != nil || r == nil {
-		fmt.Printf("Record not found under key %d.\n", key)
+		fmt.Printf("Record not found under key %v.\n", key)
 	} else {
-		fmt.Printf("Record at %d -- key %d, value %s.\n", r, key, r.Value)
+		fmt.Printf("Record at %p -- key %v, value %s.\n", r, key, tree_api.FormatValue(r.Value))
 	}
 }
 
-func (t *Tree) FindAndPrintRange(key_start, key_end int, verbose bool) {
-	var i int
-	array_size := key_end - key_start + 1
-	returned_keys := make([]int, array_size)
-	returned_pointers := make([]interface{}, array_size)
-	num_found := t.findRange(key_start, key_end, verbose, returned_keys, returned_pointers)
-	if num_found == 0 {
+func (t *TreeOf[K, V]) FindAndPrintRange(key_start, key_end K, verbose bool) {
+	results := t.findRange(key_start, key_end, 0, verbose)
+	if len(results) == 0 {
 		fmt.Println("None found,")
 	} else {
-		for i = 0; i < num_found; i++ {
-			c, _ := returned_pointers[i].(*tree_api.Record)
-			fmt.Printf("Key: %d  Location: %d  Value: %s\n",
-				returned_keys[i],
-				returned_pointers[i],
-				c.Value)
+		for _, kr := range results {
+			fmt.Printf("Key: %v  Location: %p  Value: %s\n",
+				kr.Key,
+				kr.Record,
+				tree_api.FormatValue(kr.Record.Value))
 		}
 	}
 }
 
-func (t *Tree) PrintTree() {
-	var n *Node
+func (t *TreeOf[K, V]) Range(key_start, key_end K) ([]tree_api.KeyRecordOf[K, V], error) {
+	return t.RangeLimit(key_start, key_end, 0, false)
+}
+
+func (t *TreeOf[K, V]) RangeLimit(key_start, key_end K, limit int, reverse bool) ([]tree_api.KeyRecordOf[K, V], error) {
+	if key_start > key_end {
+		return nil, tree_api.ErrInvalidRange
+	}
+	if reverse {
+		return t.findRangeReverse(key_start, key_end, limit), nil
+	}
+	return t.findRange(key_start, key_end, limit, false), nil
+}
+
+func (t *TreeOf[K, V]) PrintTree() {
+	var n *NodeOf[K, V]
 	i := 0
 	rank := 0
 	new_rank := 0
@@ -126,10 +183,10 @@ func (t *Tree) PrintTree() {
 		fmt.Printf("Empty tree.\n")
 		return
 	}
-	queue = nil
-	enqueue(t.Root)
+	var queue *NodeOf[K, V]
+	enqueue(&queue, t.Root)
 	for queue != nil {
-		n = dequeue()
+		n = dequeue(&queue)
 		if n != nil {
 			if n.Parent != nil && n == n.Parent.Pointers[0] {
 				new_rank = t.pathToRoot(n)
@@ -144,17 +201,17 @@ func (t *Tree) PrintTree() {
 				if verbose_output {
 					fmt.Printf("%d ", n.Pointers[i])
 				}
-				fmt.Printf("%d ", n.Keys[i])
+				fmt.Printf("%v ", n.Keys[i])
 			}
 			if !n.IsLeaf {
 				for i = 0; i <= n.NumKeys; i++ {
-					c, _ := n.Pointers[i].(*Node)
-					enqueue(c)
+					c, _ := n.Pointers[i].(*NodeOf[K, V])
+					enqueue(&queue, c)
 				}
 			}
 			if verbose_output {
 				if n.IsLeaf {
-					fmt.Printf("%d ", n.Pointers[order-1])
+					fmt.Printf("%d ", n.Pointers[t.order-1])
 				} else {
 					fmt.Printf("%d ", n.Pointers[n.NumKeys])
 				}
@@ -165,7 +222,7 @@ func (t *Tree) PrintTree() {
 	fmt.Printf("\n")
 }
 
-func (t *Tree) PrintLeaves() {
+func (t *TreeOf[K, V]) PrintLeaves() {
 	if t.Root == nil {
 		fmt.Printf("Empty tree.\n")
 		return
@@ -174,7 +231,7 @@ func (t *Tree) PrintLeaves() {
 	var i int
 	c := t.Root
 	for !c.IsLeaf {
-		c, _ = c.Pointers[0].(*Node)
+		c, _ = c.Pointers[0].(*NodeOf[K, V])
 	}
 
 	for {
@@ -182,14 +239,14 @@ func (t *Tree) PrintLeaves() {
 			if verbose_output {
 				fmt.Printf("%d ", c.Pointers[i])
 			}
-			fmt.Printf("%d ", c.Keys[i])
+			fmt.Printf("%v ", c.Keys[i])
 		}
 		if verbose_output {
-			fmt.Printf("%d ", c.Pointers[order-1])
+			fmt.Printf("%d ", c.Pointers[t.order-1])
 		}
-		if c.Pointers[order-1] != nil {
+		if c.Pointers[t.order-1] != nil {
 			fmt.Printf(" | ")
-			c, _ = c.Pointers[order-1].(*Node)
+			c, _ = c.Pointers[t.order-1].(*NodeOf[K, V])
 		} else {
 			break
 		}
@@ -197,7 +254,7 @@ func (t *Tree) PrintLeaves() {
 	fmt.Printf("\n")
 }
 
-func (t *Tree) Delete(key int) error {
+func (t *TreeOf[K, V]) Delete(key K) error {
 	key_record, err := t.Find(key, false)
 	if err != nil {
 		return err
@@ -210,13 +267,13 @@ func (t *Tree) Delete(key int) error {
 }
 
 // Private Functions
-func enqueue(new_node *Node) {
-	var c *Node
-	if queue == nil {
-		queue = new_node
-		queue.Next = nil
+func enqueue[K cmp.Ordered, V any](queue **NodeOf[K, V], new_node *NodeOf[K, V]) {
+	var c *NodeOf[K, V]
+	if *queue == nil {
+		*queue = new_node
+		new_node.Next = nil
 	} else {
-		c = queue
+		c = *queue
 		for c.Next != nil {
 			c = c.Next
 		}
@@ -225,24 +282,24 @@ func enqueue(new_node *Node) {
 	}
 }
 
-func dequeue() *Node {
-	n := queue
-	queue = queue.Next
+func dequeue[K cmp.Ordered, V any](queue **NodeOf[K, V]) *NodeOf[K, V] {
+	n := *queue
+	*queue = n.Next
 	n.Next = nil
 	return n
 }
 
-func (t *Tree) height() int {
+func (t *TreeOf[K, V]) height() int {
 	h := 0
 	c := t.Root
 	for !c.IsLeaf {
-		c, _ = c.Pointers[0].(*Node)
+		c, _ = c.Pointers[0].(*NodeOf[K, V])
 		h++
 	}
 	return h
 }
 
-func (t *Tree) pathToRoot(child *Node) int {
+func (t *TreeOf[K, V]) pathToRoot(child *NodeOf[K, V]) int {
 	length := 0
 	c := child
 	for c != t.Root {
@@ -252,32 +309,94 @@ func (t *Tree) pathToRoot(child *Node) int {
 	return length
 }
 
-func (t *Tree) findRange(key_start, key_end int, verbose bool, returned_keys []int, returned_pointers []interface{}) int {
+func (t *TreeOf[K, V]) findRange(key_start, key_end K, limit int, verbose bool) []tree_api.KeyRecordOf[K, V] {
 	var i int
-	num_found := 0
+	results := []tree_api.KeyRecordOf[K, V]{}
 
 	n := t.findLeaf(key_start, verbose)
 	if n == nil {
-		return 0
+		return results
 	}
 	for i = 0; i < n.NumKeys && n.Keys[i] < key_start; i++ {
-		if i == n.NumKeys { // could be wrong
-			return 0
-		}
 	}
 	for n != nil {
-		for i = i; i < n.NumKeys && n.Keys[i] <= key_end; i++ {
-			returned_keys[num_found] = n.Keys[i]
-			returned_pointers[num_found] = n.Pointers[i]
-			num_found += 1
+		for ; i < n.NumKeys; i++ {
+			if n.Keys[i] > key_end || (limit > 0 && len(results) == limit) {
+				return results
+			}
+			r, _ := n.Pointers[i].(*tree_api.RecordOf[V])
+			results = append(results, tree_api.KeyRecordOf[K, V]{Key: n.Keys[i], Record: r})
 		}
-		n, _ = n.Pointers[order-1].(*Node)
+		n, _ = n.Pointers[t.order-1].(*NodeOf[K, V])
 		i = 0
 	}
-	return num_found
+	return results
+}
+
+// findRangeReverse collects the keys in [key_start, key_end] from the top
+// down, stopping after limit of them. Leaves are only linked left to right,
+// so each step back to the previous leaf is a descent from the root.
+func (t *TreeOf[K, V]) findRangeReverse(key_start, key_end K, limit int) []tree_api.KeyRecordOf[K, V] {
+	results := []tree_api.KeyRecordOf[K, V]{}
+
+	n, i := t.findLast(key_end, true)
+	for n != nil {
+		if n.Keys[i] < key_start || (limit > 0 && len(results) == limit) {
+			return results
+		}
+		r, _ := n.Pointers[i].(*tree_api.RecordOf[V])
+		results = append(results, tree_api.KeyRecordOf[K, V]{Key: n.Keys[i], Record: r})
+		if i > 0 {
+			i -= 1
+		} else {
+			n, i = t.findLast(n.Keys[0], false)
+		}
+	}
+	return results
+}
+
+// findLast returns the leaf and index holding the largest key strictly less
+// than key, or at most key if inclusive. The descent routes key the same way,
+// and if the leaf it lands on has nothing that qualifies the predecessor must
+// lie below the leaf's lower separator, so we retry from there.
+func (t *TreeOf[K, V]) findLast(key K, inclusive bool) (*NodeOf[K, V], int) {
+	var i int
+	var low K
+	var bounded bool
+
+	below := func(k K) bool {
+		return k < key || (inclusive && k == key)
+	}
+	for {
+		c := t.Root
+		if c == nil {
+			return nil, 0
+		}
+		bounded = false
+		for !c.IsLeaf {
+			i = 0
+			for i < c.NumKeys && below(c.Keys[i]) {
+				i += 1
+			}
+			if i > 0 {
+				low = c.Keys[i-1]
+				bounded = true
+			}
+			c, _ = c.Pointers[i].(*NodeOf[K, V])
+		}
+		for i = c.NumKeys - 1; i >= 0; i-- {
+			if below(c.Keys[i]) {
+				return c, i
+			}
+		}
+		if !bounded {
+			return nil, 0
+		}
+		key, inclusive = low, false
+	}
 }
 
-func (t *Tree) findLeaf(key int, verbose bool) *Node {
+func (t *TreeOf[K, V]) findLeaf(key K, verbose bool) *NodeOf[K, V] {
 	i := 0
 	c := t.Root
 	if c == nil {
@@ -290,9 +409,9 @@ func (t *Tree) findLeaf(key int, verbose bool) *Node {
 		if verbose {
 			fmt.Printf("[")
 			for i = 0; i < c.NumKeys-1; i++ {
-				fmt.Printf("%d ", c.Keys[i])
+				fmt.Printf("%v ", c.Keys[i])
 			}
-			fmt.Printf("%d]", c.Keys[i])
+			fmt.Printf("%v]", c.Keys[i])
 		}
 		i = 0
 		for i < c.NumKeys {
@@ -305,14 +424,14 @@ func (t *Tree) findLeaf(key int, verbose bool) *Node {
 		if verbose {
 			fmt.Printf("%d ->\n", i)
 		}
-		c, _ = c.Pointers[i].(*Node)
+		c, _ = c.Pointers[i].(*NodeOf[K, V])
 	}
 	if verbose {
 		fmt.Printf("Leaf [")
 		for i = 0; i < c.NumKeys-1; i++ {
-			fmt.Printf("%d ", c.Keys[i])
+			fmt.Printf("%v ", c.Keys[i])
 		}
-		fmt.Printf("%d] ->\n", c.Keys[i])
+		fmt.Printf("%v] ->\n", c.Keys[i])
 	}
 	return c
 }
@@ -326,8 +445,8 @@ func cut(length int) int {
 }
 
 // INSERTION
-func makeRecord(value []byte) (*tree_api.Record, error) {
-	new_record := new(tree_api.Record)
+func makeRecord[V any](value V) (*tree_api.RecordOf[V], error) {
+	new_record := new(tree_api.RecordOf[V])
 	if new_record == nil {
 		return nil, errors.New("Error: Record creation.")
 	} else {
@@ -336,16 +455,42 @@ func makeRecord(value []byte) (*tree_api.Record, error) {
 	return new_record, nil
 }
 
-func makeNode() (*Node, error) {
-	new_node := new(Node)
+// lookup returns the leaf holding key and its index there, or nil if key is
+// absent.
+func (t *TreeOf[K, V]) lookup(key K) (*NodeOf[K, V], int) {
+	leaf := t.findLeaf(key, false)
+	if leaf == nil {
+		return nil, -1
+	}
+	for i := 0; i < leaf.NumKeys; i++ {
+		if leaf.Keys[i] == key {
+			return leaf, i
+		}
+	}
+	return nil, -1
+}
+
+// replaceRecord points slot i of leaf at a fresh record holding value, leaving
+// the old record untouched for anyone still holding it.
+func replaceRecord[K cmp.Ordered, V any](leaf *NodeOf[K, V], i int, value V) error {
+	pointer, err := makeRecord(value)
+	if err != nil {
+		return err
+	}
+	leaf.Pointers[i] = pointer
+	return nil
+}
+
+func (t *TreeOf[K, V]) makeNode() (*NodeOf[K, V], error) {
+	new_node := new(NodeOf[K, V])
 	if new_node == nil {
 		return nil, errors.New("Error: Node creation.")
 	}
-	new_node.Keys = make([]int, order-1)
+	new_node.Keys = make([]K, t.order-1)
 	if new_node.Keys == nil {
 		return nil, errors.New("Error: New node keys array.")
 	}
-	new_node.Pointers = make([]interface{}, order)
+	new_node.Pointers = make([]interface{}, t.order)
 	if new_node.Keys == nil {
 		return nil, errors.New("Error: New node pointers array.")
 	}
@@ -356,8 +501,8 @@ func makeNode() (*Node, error) {
 	return new_node, nil
 }
 
-func makeLeaf() (*Node, error) {
-	leaf, err := makeNode()
+func (t *TreeOf[K, V]) makeLeaf() (*NodeOf[K, V], error) {
+	leaf, err := t.makeNode()
 	if err != nil {
 		return nil, err
 	}
@@ -365,7 +510,7 @@ func makeLeaf() (*Node, error) {
 	return leaf, nil
 }
 
-func getLeftIndex(parent, left *Node) int {
+func getLeftIndex[K cmp.Ordered, V any](parent, left *NodeOf[K, V]) int {
 	left_index := 0
 	for left_index <= parent.NumKeys && parent.Pointers[left_index] != left {
 		left_index += 1
@@ -373,7 +518,7 @@ func getLeftIndex(parent, left *Node) int {
 	return left_index
 }
 
-func insertIntoLeaf(leaf *Node, key int, pointer *tree_api.Record) {
+func insertIntoLeaf[K cmp.Ordered, V any](leaf *NodeOf[K, V], key K, pointer *tree_api.RecordOf[V]) {
 	var i, insertion_point int
 
 	for insertion_point < leaf.NumKeys && leaf.Keys[insertion_point] < key {
@@ -390,27 +535,28 @@ func insertIntoLeaf(leaf *Node, key int, pointer *tree_api.Record) {
 	return
 }
 
-func (t *Tree) insertIntoLeafAfterSplitting(leaf *Node, key int, pointer *tree_api.Record) error {
-	var new_leaf *Node
-	var insertion_index, split, new_key, i, j int
+func (t *TreeOf[K, V]) insertIntoLeafAfterSplitting(leaf *NodeOf[K, V], key K, pointer *tree_api.RecordOf[V]) error {
+	var new_leaf *NodeOf[K, V]
+	var insertion_index, split, i, j int
+	var new_key K
 	var err error
 
-	new_leaf, err = makeLeaf()
+	new_leaf, err = t.makeLeaf()
 	if err != nil {
 		return nil
 	}
 
-	temp_keys := make([]int, order)
+	temp_keys := make([]K, t.order)
 	if temp_keys == nil {
 		return errors.New("Error: Temporary keys array.")
 	}
 
-	temp_pointers := make([]interface{}, order)
+	temp_pointers := make([]interface{}, t.order)
 	if temp_pointers == nil {
 		return errors.New("Error: Temporary pointers array.")
 	}
 
-	for insertion_index < order-1 && leaf.Keys[insertion_index] < key {
+	for insertion_index < t.order-1 && leaf.Keys[insertion_index] < key {
 		insertion_index += 1
 	}
 
@@ -428,7 +574,7 @@ func (t *Tree) insertIntoLeafAfterSplitting(leaf *Node, key int, pointer *tree_a
 
 	leaf.NumKeys = 0
 
-	split = cut(order - 1)
+	split = cut(t.order - 1)
 
 	for i = 0; i < split; i++ {
 		leaf.Pointers[i] = temp_pointers[i]
@@ -437,20 +583,20 @@ func (t *Tree) insertIntoLeafAfterSplitting(leaf *Node, key int, pointer *tree_a
 	}
 
 	j = 0
-	for i = split; i < order; i++ {
+	for i = split; i < t.order; i++ {
 		new_leaf.Pointers[j] = temp_pointers[i]
 		new_leaf.Keys[j] = temp_keys[i]
 		new_leaf.NumKeys += 1
 		j += 1
 	}
 
-	new_leaf.Pointers[order-1] = leaf.Pointers[order-1]
-	leaf.Pointers[order-1] = new_leaf
+	new_leaf.Pointers[t.order-1] = leaf.Pointers[t.order-1]
+	leaf.Pointers[t.order-1] = new_leaf
 
-	for i = leaf.NumKeys; i < order-1; i++ {
+	for i = leaf.NumKeys; i < t.order-1; i++ {
 		leaf.Pointers[i] = nil
 	}
-	for i = new_leaf.NumKeys; i < order-1; i++ {
+	for i = new_leaf.NumKeys; i < t.order-1; i++ {
 		new_leaf.Pointers[i] = nil
 	}
 
@@ -460,7 +606,7 @@ func (t *Tree) insertIntoLeafAfterSplitting(leaf *Node, key int, pointer *tree_a
 	return t.insertIntoParent(leaf, new_key, new_leaf)
 }
 
-func insertIntoNode(n *Node, left_index, key int, right *Node) {
+func insertIntoNode[K cmp.Ordered, V any](n *NodeOf[K, V], left_index int, key K, right *NodeOf[K, V]) {
 	var i int
 	for i = n.NumKeys; i > left_index; i-- {
 		n.Pointers[i+1] = n.Pointers[i]
@@ -471,19 +617,20 @@ func insertIntoNode(n *Node, left_index, key int, right *Node) {
 	n.NumKeys += 1
 }
 
-func (t *Tree) insertIntoNodeAfterSplitting(old_node *Node, left_index, key int, right *Node) error {
-	var i, j, split, k_prime int
-	var new_node, child *Node
-	var temp_keys []int
+func (t *TreeOf[K, V]) insertIntoNodeAfterSplitting(old_node *NodeOf[K, V], left_index int, key K, right *NodeOf[K, V]) error {
+	var i, j, split int
+	var k_prime K
+	var new_node, child *NodeOf[K, V]
+	var temp_keys []K
 	var temp_pointers []interface{}
 	var err error
 
-	temp_pointers = make([]interface{}, order+1)
+	temp_pointers = make([]interface{}, t.order+1)
 	if temp_pointers == nil {
 		return errors.New("Error: Temporary pointers array for splitting nodes.")
 	}
 
-	temp_keys = make([]int, order)
+	temp_keys = make([]K, t.order)
 	if temp_keys == nil {
 		return errors.New("Error: Temporary keys array for splitting nodes.")
 	}
@@ -508,8 +655,8 @@ func (t *Tree) insertIntoNodeAfterSplitting(old_node *Node, left_index, key int,
 	temp_pointers[left_index+1] = right
 	temp_keys[left_index] = key
 
-	split = cut(order)
-	new_node, err = makeNode()
+	split = cut(t.order)
+	new_node, err = t.makeNode()
 	if err != nil {
 		return err
 	}
@@ -522,7 +669,7 @@ func (t *Tree) insertIntoNodeAfterSplitting(old_node *Node, left_index, key int,
 	old_node.Pointers[i] = temp_pointers[i]
 	k_prime = temp_keys[split-1]
 	j = 0
-	for i += 1; i < order; i++ {
+	for i += 1; i < t.order; i++ {
 		new_node.Pointers[j] = temp_pointers[i]
 		new_node.Keys[j] = temp_keys[i]
 		new_node.NumKeys += 1
@@ -531,14 +678,14 @@ func (t *Tree) insertIntoNodeAfterSplitting(old_node *Node, left_index, key int,
 	new_node.Pointers[j] = temp_pointers[i]
 	new_node.Parent = old_node.Parent
 	for i = 0; i <= new_node.NumKeys; i++ {
-		child, _ = new_node.Pointers[i].(*Node)
+		child, _ = new_node.Pointers[i].(*NodeOf[K, V])
 		child.Parent = new_node
 	}
 
 	return t.insertIntoParent(old_node, k_prime, new_node)
 }
 
-func (t *Tree) insertIntoParent(left *Node, key int, right *Node) error {
+func (t *TreeOf[K, V]) insertIntoParent(left *NodeOf[K, V], key K, right *NodeOf[K, V]) error {
 	var left_index int
 	parent := left.Parent
 
@@ -547,7 +694,7 @@ func (t *Tree) insertIntoParent(left *Node, key int, right *Node) error {
 	}
 	left_index = getLeftIndex(parent, left)
 
-	if parent.NumKeys < order-1 {
+	if parent.NumKeys < t.order-1 {
 		insertIntoNode(parent, left_index, key, right)
 		return nil
 	}
@@ -555,11 +702,12 @@ func (t *Tree) insertIntoParent(left *Node, key int, right *Node) error {
 	return t.insertIntoNodeAfterSplitting(parent, left_index, key, right)
 }
 
-func (t *Tree) insertIntoNewRoot(left *Node, key int, right *Node) error {
-	t.Root, err = makeNode()
+func (t *TreeOf[K, V]) insertIntoNewRoot(left *NodeOf[K, V], key K, right *NodeOf[K, V]) error {
+	root, err := t.makeNode()
 	if err != nil {
 		return err
 	}
+	t.Root = root
 	t.Root.Keys[0] = key
 	t.Root.Pointers[0] = left
 	t.Root.Pointers[1] = right
@@ -570,20 +718,21 @@ func (t *Tree) insertIntoNewRoot(left *Node, key int, right *Node) error {
 	return nil
 }
 
-func (t *Tree) startNewTree(key int, pointer *tree_api.Record) error {
-	t.Root, err = makeLeaf()
+func (t *TreeOf[K, V]) startNewTree(key K, pointer *tree_api.RecordOf[V]) error {
+	root, err := t.makeLeaf()
 	if err != nil {
 		return err
 	}
+	t.Root = root
 	t.Root.Keys[0] = key
 	t.Root.Pointers[0] = pointer
-	t.Root.Pointers[order-1] = nil
+	t.Root.Pointers[t.order-1] = nil
 	t.Root.Parent = nil
 	t.Root.NumKeys += 1
 	return nil
 }
 
-func getNeighbourIndex(n *Node) int {
+func getNeighbourIndex[K cmp.Ordered, V any](n *NodeOf[K, V]) int {
 	var i int
 
 	for i = 0; i <= n.Parent.NumKeys; i++ {
@@ -595,7 +744,7 @@ func getNeighbourIndex(n *Node) int {
 	return i
 }
 
-func removeEntryFromNode(n *Node, key int, pointer interface{}) *Node {
+func (t *TreeOf[K, V]) removeEntryFromNode(n *NodeOf[K, V], key K, pointer interface{}) *NodeOf[K, V] {
 	var i, num_pointers int
 
 	for n.Keys[i] != key {
@@ -622,11 +771,11 @@ func removeEntryFromNode(n *Node, key int, pointer interface{}) *Node {
 	n.NumKeys -= 1
 
 	if n.IsLeaf {
-		for i = n.NumKeys; i < order-1; i++ {
+		for i = n.NumKeys; i < t.order-1; i++ {
 			n.Pointers[i] = nil
 		}
 	} else {
-		for i = n.NumKeys + 1; i < order; i++ {
+		for i = n.NumKeys + 1; i < t.order; i++ {
 			n.Pointers[i] = nil
 		}
 	}
@@ -634,15 +783,15 @@ func removeEntryFromNode(n *Node, key int, pointer interface{}) *Node {
 	return n
 }
 
-func (t *Tree) adjustRoot() {
-	var new_root *Node
+func (t *TreeOf[K, V]) adjustRoot() {
+	var new_root *NodeOf[K, V]
 
 	if t.Root.NumKeys > 0 {
 		return
 	}
 
 	if !t.Root.IsLeaf {
-		new_root, _ = t.Root.Pointers[0].(*Node)
+		new_root, _ = t.Root.Pointers[0].(*NodeOf[K, V])
 		new_root.Parent = nil
 	} else {
 		new_root = nil
@@ -652,9 +801,9 @@ func (t *Tree) adjustRoot() {
 	return
 }
 
-func (t *Tree) coalesceNodes(n, neighbour *Node, neighbour_index, k_prime int) {
+func (t *TreeOf[K, V]) coalesceNodes(n, neighbour *NodeOf[K, V], neighbour_index int, k_prime K) {
 	var i, j, neighbour_insertion_index, n_end int
-	var tmp *Node
+	var tmp *NodeOf[K, V]
 
 	if neighbour_index == -1 {
 		tmp = n
@@ -680,25 +829,26 @@ func (t *Tree) coalesceNodes(n, neighbour *Node, neighbour_index, k_prime int) {
 		neighbour.Pointers[i] = n.Pointers[j]
 
 		for i = 0; i < neighbour.NumKeys+1; i++ {
-			tmp, _ = neighbour.Pointers[i].(*Node)
+			tmp, _ = neighbour.Pointers[i].(*NodeOf[K, V])
 			tmp.Parent = neighbour
 		}
 	} else {
 		i = neighbour_insertion_index
 		for j = 0; j < n.NumKeys; j++ {
 			neighbour.Keys[i] = n.Keys[j]
-			n.Pointers[i] = n.Pointers[j]
+			neighbour.Pointers[i] = n.Pointers[j]
 			neighbour.NumKeys += 1
+			i += 1
 		}
-		neighbour.Pointers[order-1] = n.Pointers[order-1]
+		neighbour.Pointers[t.order-1] = n.Pointers[t.order-1]
 	}
 
 	t.deleteEntry(n.Parent, k_prime, n)
 }
 
-func (t *Tree) redistributeNodes(n, neighbour *Node, neighbour_index, k_prime_index, k_prime int) {
+func (t *TreeOf[K, V]) redistributeNodes(n, neighbour *NodeOf[K, V], neighbour_index, k_prime_index int, k_prime K) {
 	var i int
-	var tmp *Node
+	var tmp *NodeOf[K, V]
 
 	if neighbour_index != -1 {
 		if !n.IsLeaf {
@@ -710,7 +860,7 @@ func (t *Tree) redistributeNodes(n, neighbour *Node, neighbour_index, k_prime_in
 		}
 		if !n.IsLeaf { // why the second if !n.IsLeaf
 			n.Pointers[0] = neighbour.Pointers[neighbour.NumKeys]
-			tmp, _ = n.Pointers[0].(*Node)
+			tmp, _ = n.Pointers[0].(*NodeOf[K, V])
 			tmp.Parent = n
 			neighbour.Pointers[neighbour.NumKeys] = nil
 			n.Keys[0] = k_prime
@@ -729,7 +879,7 @@ func (t *Tree) redistributeNodes(n, neighbour *Node, neighbour_index, k_prime_in
 		} else {
 			n.Keys[n.NumKeys] = k_prime
 			n.Pointers[n.NumKeys+1] = neighbour.Pointers[0]
-			tmp, _ = n.Pointers[n.NumKeys+1].(*Node)
+			tmp, _ = n.Pointers[n.NumKeys+1].(*NodeOf[K, V])
 			tmp.Parent = n
 			n.Parent.Keys[k_prime_index] = neighbour.Keys[0]
 		}
@@ -747,11 +897,12 @@ func (t *Tree) redistributeNodes(n, neighbour *Node, neighbour_index, k_prime_in
 	return
 }
 
-func (t *Tree) deleteEntry(n *Node, key int, pointer interface{}) {
-	var min_keys, neighbour_index, k_prime_index, k_prime, capacity int
-	var neighbour *Node
+func (t *TreeOf[K, V]) deleteEntry(n *NodeOf[K, V], key K, pointer interface{}) {
+	var min_keys, neighbour_index, k_prime_index, capacity int
+	var k_prime K
+	var neighbour *NodeOf[K, V]
 
-	n = removeEntryFromNode(n, key, pointer)
+	n = t.removeEntryFromNode(n, key, pointer)
 
 	if n == t.Root {
 		t.adjustRoot()
@@ -759,9 +910,9 @@ func (t *Tree) deleteEntry(n *Node, key int, pointer interface{}) {
 	}
 
 	if n.IsLeaf {
-		min_keys = cut(order - 1)
+		min_keys = cut(t.order - 1)
 	} else {
-		min_keys = cut(order) - 1
+		min_keys = cut(t.order) - 1
 	}
 
 	if n.NumKeys >= min_keys {
@@ -779,15 +930,15 @@ func (t *Tree) deleteEntry(n *Node, key int, pointer interface{}) {
 	k_prime = n.Parent.Keys[k_prime_index]
 
 	if neighbour_index == -1 {
-		neighbour, _ = n.Parent.Pointers[1].(*Node)
+		neighbour, _ = n.Parent.Pointers[1].(*NodeOf[K, V])
 	} else {
-		neighbour, _ = n.Parent.Pointers[neighbour_index].(*Node)
+		neighbour, _ = n.Parent.Pointers[neighbour_index].(*NodeOf[K, V])
 	}
 
 	if n.IsLeaf {
-		capacity = order
+		capacity = t.order
 	} else {
-		capacity = order - 1
+		capacity = t.order - 1
 	}
 
 	if neighbour.NumKeys+n.NumKeys < capacity {
@@ -800,10 +951,10 @@ func (t *Tree) deleteEntry(n *Node, key int, pointer interface{}) {
 
 }
 
-func (t *Tree) PalmBasic(key_count int, num_threads int) {
+func (t *TreeOf[K, V]) PalmBasic(key_count int, num_threads int) {
 	panic("Not implemented for Seq Tree")
 }
 
-func (t *Tree) Palm(queries []tree_api.Query, num_threads int) [][]*tree_api.Record {
+func (t *TreeOf[K, V]) Palm(queries []tree_api.QueryOf[K, V], num_threads int) []tree_api.ResultOf[V] {
 	panic("Not implemented for Seq Tree")
 }
@@ -1,8 +1,11 @@
 package seq_tree
 
 import (
+	"errors"
 	"fmt"
+	"main/tree_api"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -130,6 +133,126 @@ func TestInsertSameValueTwice(t *testing.T) {
 	}
 }
 
+func TestUpsert(t *testing.T) {
+	tree := NewTree()
+
+	key := 1
+	value := []byte("test")
+
+	err := tree.Upsert(key, value)
+	if err != nil {
+		t.Errorf("%s", err)
+	}
+
+	first, err := tree.Find(key, false)
+	if err != nil {
+		t.Errorf("%s\n", err)
+	}
+
+	newValue := []byte("world")
+	err = tree.Upsert(key, newValue)
+	if err != nil {
+		t.Errorf("%s", err)
+	}
+
+	r, err := tree.Find(key, false)
+	if err != nil {
+		t.Errorf("%s\n", err)
+	}
+
+	if !reflect.DeepEqual(r.Value, newValue) {
+		t.Errorf("expected %v and got %v \n", newValue, r.Value)
+	}
+
+	if !reflect.DeepEqual(first.Value, value) {
+		t.Errorf("expected the old record to keep %v and got %v \n", value, first.Value)
+	}
+
+	if tree.Root.NumKeys > 1 {
+		t.Errorf("expected 1 key and got %d", tree.Root.NumKeys)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	tree := NewTree()
+
+	key := 1
+	value := []byte("test")
+
+	err := tree.Update(key, value)
+	if !errors.Is(err, tree_api.ErrKeyNotFound) {
+		t.Errorf("expected %v and got %v", tree_api.ErrKeyNotFound, err)
+	}
+
+	err = tree.Insert(key, value)
+	if err != nil {
+		t.Errorf("%s", err)
+	}
+
+	newValue := []byte("world")
+	err = tree.Update(key, newValue)
+	if err != nil {
+		t.Errorf("%s", err)
+	}
+
+	r, err := tree.Find(key, false)
+	if err != nil {
+		t.Errorf("%s\n", err)
+	}
+
+	if !reflect.DeepEqual(r.Value, newValue) {
+		t.Errorf("expected %v and got %v \n", newValue, r.Value)
+	}
+
+	err = tree.Update(key+1, newValue)
+	if !errors.Is(err, tree_api.ErrKeyNotFound) {
+		t.Errorf("expected %v and got %v", tree_api.ErrKeyNotFound, err)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	tree := NewTree()
+
+	key := 1
+	value := []byte("test")
+
+	swapped, err := tree.CompareAndSwap(key, nil, value)
+	if swapped || !errors.Is(err, tree_api.ErrKeyNotFound) {
+		t.Errorf("expected %v and got %v, %v", tree_api.ErrKeyNotFound, swapped, err)
+	}
+
+	err = tree.Insert(key, value)
+	if err != nil {
+		t.Errorf("%s", err)
+	}
+
+	old, err := tree.Find(key, false)
+	if err != nil {
+		t.Errorf("%s\n", err)
+	}
+
+	newValue := []byte("world")
+	swapped, err = tree.CompareAndSwap(key, old, newValue)
+	if !swapped || err != nil {
+		t.Errorf("expected a swap and got %v, %v", swapped, err)
+	}
+
+	// old is stale now, so a second swap against it must fail.
+	swapped, err = tree.CompareAndSwap(key, old, []byte("again"))
+	if swapped || err != nil {
+		t.Errorf("expected no swap and got %v, %v", swapped, err)
+	}
+
+	r, err := tree.Find(key, false)
+	if err != nil {
+		t.Errorf("%s\n", err)
+	}
+
+	if !reflect.DeepEqual(r.Value, newValue) {
+		t.Errorf("expected %v and got %v \n", newValue, r.Value)
+	}
+}
+
 func TestFindNilRoot(t *testing.T) {
 	tree := NewTree()
 
@@ -398,3 +521,298 @@ func TestMultiInsertMultiDelete(t *testing.T) {
 		t.Errorf("returned struct after delete - %v \n", r)
 	}
 }
+
+func TestRange(t *testing.T) {
+	tree := NewTree()
+
+	for key := 0; key < 100; key += 2 {
+		err := tree.Insert(key, []byte(fmt.Sprintf("test%d", key)))
+		if err != nil {
+			t.Errorf("%s", err)
+		}
+	}
+
+	res, err := tree.Range(9, 21)
+	if err != nil {
+		t.Errorf("%s\n", err)
+	}
+	expected := []int{10, 12, 14, 16, 18, 20}
+	if len(res) != len(expected) {
+		t.Fatalf("expected %d results and got %d", len(expected), len(res))
+	}
+	for i, kr := range res {
+		if kr.Key != expected[i] {
+			t.Errorf("expected key %d and got %d", expected[i], kr.Key)
+		}
+		if !reflect.DeepEqual(kr.Record.Value, []byte(fmt.Sprintf("test%d", kr.Key))) {
+			t.Errorf("wrong value %s for key %d", kr.Record.Value, kr.Key)
+		}
+	}
+
+	res, err = tree.Range(200, 300)
+	if err != nil {
+		t.Errorf("%s\n", err)
+	}
+	if len(res) != 0 {
+		t.Errorf("expected no results and got %d", len(res))
+	}
+
+	_, err = tree.Range(10, 0)
+	if err == nil {
+		t.Errorf("expected error and got nil")
+	}
+}
+
+func TestRangeLimit(t *testing.T) {
+	tree := NewTree()
+
+	for key := 0; key < 100; key++ {
+		err := tree.Insert(key, []byte("test"))
+		if err != nil {
+			t.Errorf("%s", err)
+		}
+	}
+
+	res, err := tree.RangeLimit(10, 50, 3, false)
+	if err != nil {
+		t.Errorf("%s\n", err)
+	}
+	if len(res) != 3 || res[0].Key != 10 || res[2].Key != 12 {
+		t.Errorf("unexpected forward results %v", res)
+	}
+
+	res, err = tree.RangeLimit(10, 50, 3, true)
+	if err != nil {
+		t.Errorf("%s\n", err)
+	}
+	if len(res) != 3 || res[0].Key != 50 || res[2].Key != 48 {
+		t.Errorf("unexpected reverse results %v", res)
+	}
+
+	res, err = tree.RangeLimit(90, 200, 0, true)
+	if err != nil {
+		t.Errorf("%s\n", err)
+	}
+	if len(res) != 10 || res[0].Key != 99 || res[9].Key != 90 {
+		t.Errorf("unexpected reverse results %v", res)
+	}
+}
+
+func TestReverseRangeLimitAcrossLeaves(t *testing.T) {
+	tree := NewTree()
+
+	for key := 0; key < 200; key += 2 {
+		err := tree.Insert(key, []byte("test"))
+		if err != nil {
+			t.Errorf("%s", err)
+		}
+	}
+
+	// Bounds between keys, a limit that stops mid-leaf, and a range that
+	// runs off the low end of the tree.
+	cases := []struct{ start, end, limit int }{
+		{11, 151, 0},
+		{11, 151, 7},
+		{-5, 9, 0},
+		{0, 500, 3},
+		{51, 51, 0},
+	}
+	for _, c := range cases {
+		res, err := tree.RangeLimit(c.start, c.end, c.limit, true)
+		if err != nil {
+			t.Errorf("%s\n", err)
+		}
+		var want []int
+		for key := 198; key >= 0; key -= 2 {
+			if key >= c.start && key <= c.end && (c.limit == 0 || len(want) < c.limit) {
+				want = append(want, key)
+			}
+		}
+		if len(res) != len(want) {
+			t.Fatalf("RangeLimit(%d, %d, %d, true) returned %d keys, want %d", c.start, c.end, c.limit, len(res), len(want))
+		}
+		for i := range want {
+			if res[i].Key != want[i] {
+				t.Errorf("RangeLimit(%d, %d, %d, true)[%d] = %d, want %d", c.start, c.end, c.limit, i, res[i].Key, want[i])
+			}
+		}
+	}
+}
+
+func TestIterator(t *testing.T) {
+	tree := NewTree()
+
+	it := tree.NewIterator()
+	if it.Next() {
+		t.Errorf("expected empty tree iterator to be exhausted")
+	}
+
+	for key := 0; key < 200; key += 2 {
+		err := tree.Insert(key, []byte(fmt.Sprintf("test%d", key)))
+		if err != nil {
+			t.Errorf("%s", err)
+		}
+	}
+
+	it = tree.NewIterator()
+	expected := 0
+	for it.Next() {
+		if it.Key() != expected {
+			t.Fatalf("expected key %d and got %d", expected, it.Key())
+		}
+		if !reflect.DeepEqual(it.Value().Value, []byte(fmt.Sprintf("test%d", expected))) {
+			t.Errorf("wrong value %s for key %d", it.Value().Value, it.Key())
+		}
+		expected += 2
+	}
+	if expected != 200 {
+		t.Errorf("expected to visit 100 keys and stopped at %d", expected)
+	}
+
+	it = tree.NewIterator()
+	expected = 198
+	for it.Prev() {
+		if it.Key() != expected {
+			t.Fatalf("expected key %d and got %d", expected, it.Key())
+		}
+		expected -= 2
+	}
+	if expected != -2 {
+		t.Errorf("expected to visit 100 keys backwards and stopped at %d", expected)
+	}
+
+	if !it.Seek(51) || it.Key() != 52 {
+		t.Errorf("expected seek to land on 52 and got %d", it.Key())
+	}
+	if !it.Prev() || it.Key() != 50 {
+		t.Errorf("expected 50 before 52 and got %d", it.Key())
+	}
+	if !it.Next() || !it.Next() || it.Key() != 54 {
+		t.Errorf("expected 54 and got %d", it.Key())
+	}
+	if it.Seek(199) {
+		t.Errorf("expected seek past the last key to fail")
+	}
+
+	it.Close()
+	if it.Next() || it.Err() == nil {
+		t.Errorf("expected closed iterator to fail")
+	}
+}
+
+func TestStringKeys(t *testing.T) {
+	tree := NewTreeOf[string, int]()
+
+	words := []string{"pear", "apple", "fig", "kiwi", "banana", "cherry", "date", "grape", "lemon", "mango"}
+	for i, word := range words {
+		err := tree.Insert(word, i)
+		if err != nil {
+			t.Errorf("%s", err)
+		}
+	}
+
+	r, err := tree.Find("kiwi", false)
+	if err != nil {
+		t.Errorf("%s\n", err)
+	}
+	if r == nil || r.Value != 3 {
+		t.Errorf("expected 3 and got %v", r)
+	}
+
+	res, err := tree.Range("b", "g")
+	if err != nil {
+		t.Errorf("%s\n", err)
+	}
+	expected := []string{"banana", "cherry", "date", "fig"}
+	if len(res) != len(expected) {
+		t.Fatalf("expected %d results and got %d", len(expected), len(res))
+	}
+	for i, kr := range res {
+		if kr.Key != expected[i] {
+			t.Errorf("expected key %s and got %s", expected[i], kr.Key)
+		}
+	}
+}
+
+func TestWithOrder(t *testing.T) {
+	small := NewTree(tree_api.WithOrder(3))
+	large := NewTree(tree_api.WithOrder(64))
+	if small.Order() != 3 || large.Order() != 64 {
+		t.Fatalf("expected orders 3 and 64 and got %d and %d", small.Order(), large.Order())
+	}
+
+	for _, tree := range []*Tree{small, large} {
+		for i := 0; i < 1000; i++ {
+			key := (i * 7919) % 1000
+			err := tree.Insert(key, []byte(fmt.Sprint(key)))
+			if err != nil {
+				t.Errorf("%s", err)
+			}
+		}
+		for i := 0; i < 1000; i += 2 {
+			err := tree.Delete(i)
+			if err != nil {
+				t.Errorf("%s", err)
+			}
+		}
+		res, err := tree.Range(0, 999)
+		if err != nil {
+			t.Errorf("%s\n", err)
+		}
+		if len(res) != 500 {
+			t.Fatalf("order %d: expected 500 results and got %d", tree.Order(), len(res))
+		}
+		for i, kr := range res {
+			if kr.Key != 2*i+1 {
+				t.Errorf("order %d: expected key %d and got %d", tree.Order(), 2*i+1, kr.Key)
+			}
+		}
+	}
+}
+
+func TestWithOrderOutOfRange(t *testing.T) {
+	for _, order := range []int{0, 2, maxOrder + 1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected NewTree to panic for order %d", order)
+				}
+			}()
+			NewTree(tree_api.WithOrder(order))
+		}()
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tree := NewTree(tree_api.WithOrder(4))
+	if err := tree.Validate(); err != nil {
+		t.Errorf("empty tree: %s", err)
+	}
+	for i := 0; i < 100; i++ {
+		tree.Insert(i, []byte(fmt.Sprint(i)))
+		if err := tree.Validate(); err != nil {
+			t.Fatalf("after inserting %d: %s", i, err)
+		}
+	}
+	for i := 0; i < 100; i += 3 {
+		tree.Delete(i)
+		if err := tree.Validate(); err != nil {
+			t.Fatalf("after deleting %d: %s", i, err)
+		}
+	}
+
+	// Swap two keys in the leftmost leaf so it is no longer sorted.
+	leaf := tree.Root
+	for !leaf.IsLeaf {
+		leaf, _ = leaf.Pointers[0].(*Node)
+	}
+	leaf.Keys[0], leaf.Keys[1] = leaf.Keys[1], leaf.Keys[0]
+	err := tree.Validate()
+	if !errors.Is(err, tree_api.ErrInvalidTree) {
+		t.Fatalf("expected ErrInvalidTree and got %v", err)
+	}
+	want := "root" + strings.Repeat(" -> 0", tree.height())
+	if !strings.Contains(err.Error(), want+":") {
+		t.Errorf("expected the error to name %q and got %q", want, err)
+	}
+}
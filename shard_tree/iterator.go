@@ -0,0 +1,175 @@
+package shard_tree
+
+import (
+	"cmp"
+	"main/tree_api"
+)
+
+// IteratorOf walks the keys of a ShardTree in order. It holds no gate between
+// calls: it keeps the key and record it is on, and each move finds the shard
+// next to that key again and seeks in it, passing on to the neighbouring
+// shard when this one has no more keys in that direction. It sees every key
+// that is present throughout the walk, across splits and merges.
+type IteratorOf[K cmp.Ordered, V any] struct {
+	tree      *ShardTreeOf[K, V]
+	key       K
+	record    *tree_api.RecordOf[V]
+	started   bool
+	exhausted bool
+	closed    bool
+}
+
+func (t *ShardTreeOf[K, V]) NewIterator() tree_api.IteratorOf[K, V] {
+	return &IteratorOf[K, V]{tree: t}
+}
+
+func (it *IteratorOf[K, V]) Seek(key K) bool {
+	if it.closed {
+		return false
+	}
+	it.started = true
+	return it.forward(key, true, true)
+}
+
+func (it *IteratorOf[K, V]) Next() bool {
+	if it.closed || it.exhausted {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		return it.forward(it.key, false, true)
+	}
+	return it.forward(it.key, true, false)
+}
+
+func (it *IteratorOf[K, V]) Prev() bool {
+	if it.closed || it.exhausted {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		return it.backward(it.key, false)
+	}
+	return it.backward(it.key, true)
+}
+
+// forward moves the iterator to the first key at or above from, or above it
+// unless inclusive. Without hasFrom it moves to the first key of all.
+func (it *IteratorOf[K, V]) forward(from K, hasFrom, inclusive bool) bool {
+	for {
+		r := it.tree.router.Load()
+		s := r.shards[0]
+		if hasFrom {
+			s = r.shards[r.locate(from)]
+		}
+		s.gate.RLock()
+		if s.retired {
+			s.gate.RUnlock()
+			continue
+		}
+		inner := s.tree.NewIterator()
+		var ok bool
+		if hasFrom {
+			ok = inner.Seek(from)
+			if ok && !inclusive && inner.Key() == from {
+				ok = inner.Next()
+			}
+		} else {
+			ok = inner.Next()
+		}
+		if ok {
+			it.settle(inner.Key(), s.outer(inner.Key(), inner.Value()))
+		}
+		inner.Close()
+		s.gate.RUnlock()
+
+		if ok {
+			return true
+		}
+		if !s.hasHigh {
+			return it.exhaust()
+		}
+		from, hasFrom, inclusive = s.high, true, true
+	}
+}
+
+// backward moves the iterator to the last key below bound. Without hasBound
+// it moves to the last key of all.
+func (it *IteratorOf[K, V]) backward(bound K, hasBound bool) bool {
+	for {
+		r := it.tree.router.Load()
+		s := r.shards[len(r.shards)-1]
+		if hasBound {
+			s = r.shards[r.locateBelow(bound)]
+		}
+		s.gate.RLock()
+		if s.retired {
+			s.gate.RUnlock()
+			continue
+		}
+		// An iterator that runs off the top on Seek is exhausted, so a fresh
+		// one is needed to step back from the end of the shard.
+		inner := s.tree.NewIterator()
+		if !hasBound || !inner.Seek(bound) {
+			inner.Close()
+			inner = s.tree.NewIterator()
+		}
+		ok := inner.Prev()
+		if ok {
+			it.settle(inner.Key(), s.outer(inner.Key(), inner.Value()))
+		}
+		inner.Close()
+		s.gate.RUnlock()
+
+		if ok {
+			return true
+		}
+		if !s.hasLow {
+			return it.exhaust()
+		}
+		bound, hasBound = s.low, true
+	}
+}
+
+func (it *IteratorOf[K, V]) settle(key K, record *tree_api.RecordOf[V]) {
+	it.key, it.record = key, record
+	it.exhausted = false
+}
+
+func (it *IteratorOf[K, V]) exhaust() bool {
+	it.exhausted = true
+	it.record = nil
+	return false
+}
+
+func (it *IteratorOf[K, V]) Key() K {
+	if !it.valid() {
+		var zero K
+		return zero
+	}
+	return it.key
+}
+
+func (it *IteratorOf[K, V]) Value() *tree_api.RecordOf[V] {
+	if !it.valid() {
+		return nil
+	}
+	return it.record
+}
+
+func (it *IteratorOf[K, V]) Err() error {
+	if it.closed {
+		return tree_api.ErrIteratorClosed
+	}
+	return nil
+}
+
+func (it *IteratorOf[K, V]) Close() error {
+	it.closed = true
+	it.record = nil
+	return nil
+}
+
+func (it *IteratorOf[K, V]) valid() bool {
+	return !it.closed && !it.exhausted && it.record != nil
+}
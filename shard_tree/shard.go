@@ -0,0 +1,96 @@
+package shard_tree
+
+import (
+	"cmp"
+	"main/tree_api"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// shardOf is one partition of the key space, [low, high), held in an inner
+// tree. A missing bound is unbounded. Operations on the shard hold gate for
+// reading; a split or merge holds it for writing while it moves keys out,
+// then retires the shard for good, so an operation that finds the shard
+// retired looks its key up again in the new router.
+//
+// Moving a key to another shard gives it a new record in the inner tree
+// there. So that callers keep the record they got from Find, adopted maps each
+// key whose inner record is not the one callers know to an adoptedOf.
+type shardOf[K cmp.Ordered, V any] struct {
+	low, high       K
+	hasLow, hasHigh bool
+	tree            tree_api.TreeOf[K, V]
+	adopted         sync.Map
+	gate            sync.RWMutex
+	retired         bool
+	ops             atomic.Int64 // sampled operations since the last rebalance
+}
+
+// adoptedOf pairs the record an inner tree made for a key with the record
+// callers know the key by. Once the key is written again its inner record
+// changes and the pair no longer applies.
+type adoptedOf[V any] struct {
+	inner, outer *tree_api.RecordOf[V]
+}
+
+// outer returns the record callers know key by, given its record r in the
+// inner tree.
+func (s *shardOf[K, V]) outer(key K, r *tree_api.RecordOf[V]) *tree_api.RecordOf[V] {
+	if a, ok := s.adopted.Load(key); ok && a.(adoptedOf[V]).inner == r {
+		return a.(adoptedOf[V]).outer
+	}
+	return r
+}
+
+// adopt inserts key into the shard's inner tree under record, which callers
+// know it by.
+func (s *shardOf[K, V]) adopt(key K, record *tree_api.RecordOf[V]) {
+	s.tree.Insert(key, record.Value)
+	s.remember(key, record)
+}
+
+// remember notes that callers know key, which is in the shard's inner tree,
+// by record.
+func (s *shardOf[K, V]) remember(key K, record *tree_api.RecordOf[V]) {
+	if r, _ := s.tree.Find(key, false); r != record {
+		s.adopted.Store(key, adoptedOf[V]{inner: r, outer: record})
+	}
+}
+
+// covers reports whether key falls in [low, high).
+func (s *shardOf[K, V]) covers(key K) bool {
+	return (!s.hasLow || s.low <= key) && (!s.hasHigh || key < s.high)
+}
+
+// routerOf is the list of shards, sorted by key and covering every key
+// between them. It is never modified: a split or merge stores a new one.
+type routerOf[K cmp.Ordered, V any] struct {
+	shards []*shardOf[K, V]
+}
+
+// locate returns the index of the shard that covers key.
+func (r *routerOf[K, V]) locate(key K) int {
+	return sort.Search(len(r.shards), func(i int) bool {
+		s := r.shards[i]
+		return !s.hasHigh || key < s.high
+	})
+}
+
+// locateBelow returns the index of the shard that covers the keys just below
+// bound.
+func (r *routerOf[K, V]) locateBelow(bound K) int {
+	return sort.Search(len(r.shards), func(i int) bool {
+		s := r.shards[i]
+		return !s.hasHigh || bound <= s.high
+	})
+}
+
+// replace returns a router with the shards from i to j replaced by with.
+func (r *routerOf[K, V]) replace(i, j int, with ...*shardOf[K, V]) *routerOf[K, V] {
+	shards := make([]*shardOf[K, V], 0, len(r.shards)-(j-i)+len(with))
+	shards = append(shards, r.shards[:i]...)
+	shards = append(shards, with...)
+	shards = append(shards, r.shards[j:]...)
+	return &routerOf[K, V]{shards: shards}
+}
@@ -0,0 +1,397 @@
+package shard_tree
+
+import (
+	"cmp"
+	"fmt"
+	"main/tree_api"
+	"math/rand"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultWindow is how many operations a shard sees before the tree looks at
+// whether to rebalance, for trees that have no reason to pick another.
+const DefaultWindow = 1 << 12
+
+// samplesPerWindow is how many operations a window counts. Every operation on
+// a busy shard bumping one counter would bounce its cache line between every
+// core, so each operation is counted with probability samplesPerWindow/window
+// instead; the counts still estimate each shard's share of the load.
+const samplesPerWindow = 64
+
+// ShardTreeOf partitions the key space by range across up to maxShards inner
+// trees. A router, swapped atomically, maps each key to its shard; point
+// operations go to one shard, and range scans visit the shards in key order.
+// The tree starts with one shard and rebalances as it is used: a shard that
+// takes more than its share of the operations is split at its median key, and
+// a pair of neighbouring shards that together see little traffic is merged,
+// to make room for the next split. Splits and merges block only the shards
+// they move keys between.
+//
+// Any tree can serve as a shard, which lets a coarse-grained tree such as
+// GlobalLockTree scale across cores for as long as the load spreads across
+// shards.
+type ShardTreeOf[K cmp.Ordered, V any] struct {
+	router      atomic.Pointer[routerOf[K, V]]
+	newShard    func(...tree_api.Option) tree_api.TreeOf[K, V]
+	opts        []tree_api.Option
+	maxShards   int
+	window      int64 // samples that start a rebalance
+	sampleRate  int   // operations per sample, on average
+	rebalancing sync.Mutex
+}
+
+type ShardTree = ShardTreeOf[int, []byte]
+
+// NewTree builds a tree of at most maxShards shards, each built by newShard
+// with opts, that looks at rebalancing once a shard has seen window
+// operations, e.g.
+//
+//	shard_tree.NewTree(crab.NewTree, 64, shard_tree.DefaultWindow)
+//
+// A small window makes the tree split and merge shards after only a few
+// operations, which tests use to exercise rebalancing.
+func NewTree(newShard func(...tree_api.Option) tree_api.BPTree, maxShards int, window int, opts ...tree_api.Option) tree_api.BPTree {
+	return NewTreeOf[int, []byte](newShard, maxShards, window, opts...)
+}
+
+func NewTreeOf[K cmp.Ordered, V any](newShard func(...tree_api.Option) tree_api.TreeOf[K, V], maxShards int, window int, opts ...tree_api.Option) tree_api.TreeOf[K, V] {
+	if maxShards < 1 {
+		panic(fmt.Sprintf("maxShards %d is less than 1", maxShards))
+	}
+	if window < 1 {
+		panic(fmt.Sprintf("window %d is less than 1", window))
+	}
+	rate := max(1, window/samplesPerWindow)
+	t := &ShardTreeOf[K, V]{newShard: newShard, opts: opts, maxShards: maxShards, window: int64(window / rate), sampleRate: rate}
+	t.router.Store(&routerOf[K, V]{shards: []*shardOf[K, V]{{tree: newShard(opts...)}}})
+	return t
+}
+
+// acquire returns the shard that covers key, holding its gate for reading.
+func (t *ShardTreeOf[K, V]) acquire(key K) *shardOf[K, V] {
+	for {
+		r := t.router.Load()
+		s := r.shards[r.locate(key)]
+		s.gate.RLock()
+		if !s.retired {
+			return s
+		}
+		s.gate.RUnlock()
+	}
+}
+
+// release lets go of a shard from acquire and samples the operation, starting
+// a rebalance once the shard has seen a window's worth.
+func (t *ShardTreeOf[K, V]) release(s *shardOf[K, V]) {
+	s.gate.RUnlock()
+	if t.sampleRate > 1 && rand.Intn(t.sampleRate) != 0 {
+		return
+	}
+	if s.ops.Add(1) == t.window {
+		t.rebalance()
+	}
+}
+
+// rebalance merges the quietest pair of neighbouring shards if together they
+// took less than half a share of the operations in the window, and then
+// splits, busiest first, every shard that took more than a share, while there
+// is room; a share is 1/maxShards of the operations. Merging first frees a
+// slot for a split once the tree is at maxShards, and splitting every busy
+// shard at once lets an evenly loaded tree double its shards each window.
+// The counts then start again. Only one rebalance runs at a time: an
+// operation that starts one while another runs leaves it to that one.
+func (t *ShardTreeOf[K, V]) rebalance() {
+	if !t.rebalancing.TryLock() {
+		return
+	}
+	defer t.rebalancing.Unlock()
+
+	r := t.router.Load()
+	counts := make(map[*shardOf[K, V]]int64, len(r.shards))
+	var total int64
+	for _, s := range r.shards {
+		counts[s] = s.ops.Load()
+		total += counts[s]
+	}
+	share := int64(t.maxShards)
+	if len(r.shards) > 1 {
+		pair := func(i int) int64 { return counts[r.shards[i]] + counts[r.shards[i+1]] }
+		cold := 0
+		for i := 1; i+1 < len(r.shards); i++ {
+			if pair(i) < pair(cold) {
+				cold = i
+			}
+		}
+		if pair(cold)*2*share < total {
+			t.merge(cold)
+		}
+	}
+
+	busy := slices.Clone(r.shards)
+	slices.SortFunc(busy, func(a, b *shardOf[K, V]) int { return cmp.Compare(counts[b], counts[a]) })
+	for _, s := range busy {
+		r = t.router.Load()
+		if counts[s]*share <= total || len(r.shards) >= t.maxShards {
+			break
+		}
+		if i := slices.Index(r.shards, s); i >= 0 {
+			t.split(i)
+		}
+	}
+	for _, s := range t.router.Load().shards {
+		s.ops.Store(0)
+	}
+}
+
+// split moves the upper half of shard i's keys into a new shard. The lower
+// half stays in the old inner tree under a new shard, since a retired shard
+// is never revived. A shard of fewer than two keys is left alone.
+func (t *ShardTreeOf[K, V]) split(i int) {
+	r := t.router.Load()
+	s := r.shards[i]
+	s.gate.Lock()
+	defer s.gate.Unlock()
+
+	keys, records := s.entries()
+	if len(keys) < 2 {
+		return
+	}
+
+	mid := len(keys) / 2
+	left := &shardOf[K, V]{low: s.low, hasLow: s.hasLow, high: keys[mid], hasHigh: true, tree: s.tree}
+	right := &shardOf[K, V]{low: keys[mid], hasLow: true, high: s.high, hasHigh: s.hasHigh, tree: t.newShard(t.opts...)}
+	for j := 0; j < mid; j++ {
+		left.remember(keys[j], records[j])
+	}
+	for j := mid; j < len(keys); j++ {
+		right.adopt(keys[j], records[j])
+		s.tree.Delete(keys[j])
+	}
+	t.router.Store(r.replace(i, i+1, left, right))
+	s.retired = true
+}
+
+// entries returns the keys of s in order and the records callers know them by.
+// The caller holds the gate of s for writing.
+func (s *shardOf[K, V]) entries() ([]K, []*tree_api.RecordOf[V]) {
+	var keys []K
+	var records []*tree_api.RecordOf[V]
+	it := s.tree.NewIterator()
+	defer it.Close()
+	for it.Next() {
+		keys = append(keys, it.Key())
+		records = append(records, s.outer(it.Key(), it.Value()))
+	}
+	return keys, records
+}
+
+// merge moves the keys of shard i+1 into shard i's inner tree, under a new
+// shard covering both.
+func (t *ShardTreeOf[K, V]) merge(i int) {
+	r := t.router.Load()
+	a, b := r.shards[i], r.shards[i+1]
+	a.gate.Lock()
+	defer a.gate.Unlock()
+	b.gate.Lock()
+	defer b.gate.Unlock()
+
+	merged := &shardOf[K, V]{low: a.low, hasLow: a.hasLow, high: b.high, hasHigh: b.hasHigh, tree: a.tree}
+	keys, records := a.entries()
+	for j := range keys {
+		merged.remember(keys[j], records[j])
+	}
+	keys, records = b.entries()
+	for j := range keys {
+		merged.adopt(keys[j], records[j])
+	}
+	t.router.Store(r.replace(i, i+2, merged))
+	a.retired, b.retired = true, true
+}
+
+func (t *ShardTreeOf[K, V]) Find(key K, verbose bool) (*tree_api.RecordOf[V], error) {
+	s := t.acquire(key)
+	defer t.release(s)
+	r, err := s.tree.Find(key, verbose)
+	if err != nil {
+		return nil, err
+	}
+	return s.outer(key, r), nil
+}
+
+func (t *ShardTreeOf[K, V]) FindAndPrint(key K, verbose bool) {
+	r, err := t.Find(key, verbose)
+
+	if err != nil || r == nil {
+		fmt.Printf("Record not found under key %v.\n", key)
+	} else {
+		fmt.Printf("Record at %p -- key %v, value %s.\n", r, key, tree_api.FormatValue(r.Value))
+	}
+}
+
+func (t *ShardTreeOf[K, V]) FindAndPrintRange(key_start, key_end K, verbose bool) {
+	results, _ := t.Range(key_start, key_end)
+	if len(results) == 0 {
+		fmt.Println("None found,")
+	} else {
+		for _, kr := range results {
+			fmt.Printf("Key: %v  Location: %p  Value: %s\n",
+				kr.Key,
+				kr.Record,
+				tree_api.FormatValue(kr.Record.Value))
+		}
+	}
+}
+
+func (t *ShardTreeOf[K, V]) Insert(key K, value V) error {
+	s := t.acquire(key)
+	defer t.release(s)
+	return s.tree.Insert(key, value)
+}
+
+// Upsert inserts key, or replaces its record if it is already present.
+func (t *ShardTreeOf[K, V]) Upsert(key K, value V) error {
+	s := t.acquire(key)
+	defer t.release(s)
+	return s.tree.Upsert(key, value)
+}
+
+// Update replaces the record of an existing key.
+func (t *ShardTreeOf[K, V]) Update(key K, value V) error {
+	s := t.acquire(key)
+	defer t.release(s)
+	return s.tree.Update(key, value)
+}
+
+// CompareAndSwap replaces the record of key if it is still old. The shard
+// compares its own record, which old may stand for, so a swap that loses to
+// another writer there checks old again.
+func (t *ShardTreeOf[K, V]) CompareAndSwap(key K, old *tree_api.RecordOf[V], new V) (bool, error) {
+	s := t.acquire(key)
+	defer t.release(s)
+	for {
+		r, err := s.tree.Find(key, false)
+		if err != nil {
+			return false, err
+		}
+		if s.outer(key, r) != old {
+			return false, nil
+		}
+		if swapped, err := s.tree.CompareAndSwap(key, r, new); swapped || err != nil {
+			return swapped, err
+		}
+	}
+}
+
+func (t *ShardTreeOf[K, V]) Delete(key K) error {
+	s := t.acquire(key)
+	defer t.release(s)
+	return s.tree.Delete(key)
+}
+
+func (t *ShardTreeOf[K, V]) Range(key_start, key_end K) ([]tree_api.KeyRecordOf[K, V], error) {
+	return t.RangeLimit(key_start, key_end, 0, false)
+}
+
+// RangeLimit scans one shard at a time in key order, each under its gate,
+// carrying on from the bound of the last shard it scanned. If a shard is split
+// or merged before the scan reaches it, the scan carries on in the new shards
+// from the same bound. The result is sorted and holds every key that was
+// present throughout the call, but is only a snapshot of each shard.
+func (t *ShardTreeOf[K, V]) RangeLimit(key_start, key_end K, limit int, reverse bool) ([]tree_api.KeyRecordOf[K, V], error) {
+	if key_start > key_end {
+		return nil, tree_api.ErrInvalidRange
+	}
+	results := []tree_api.KeyRecordOf[K, V]{}
+	remaining := func() int {
+		if limit <= 0 {
+			return 0
+		}
+		return limit - len(results)
+	}
+
+	// Forwards, the scan is at [bound, key_end]; backwards, at
+	// [key_start, bound], or [key_start, bound) unless inclusive.
+	bound, inclusive := key_start, true
+	if reverse {
+		bound = key_end
+	}
+	for limit <= 0 || len(results) < limit {
+		r := t.router.Load()
+		var s *shardOf[K, V]
+		if inclusive {
+			s = r.shards[r.locate(bound)]
+		} else {
+			s = r.shards[r.locateBelow(bound)]
+		}
+		s.gate.RLock()
+		if s.retired {
+			s.gate.RUnlock()
+			continue
+		}
+		var res []tree_api.KeyRecordOf[K, V]
+		if !reverse {
+			res, _ = s.tree.RangeLimit(bound, key_end, remaining(), false)
+		} else {
+			// A shard found below bound may have been merged with the one
+			// above it, so it may hold bound itself; ask for one more key
+			// in case it has to be dropped.
+			n := remaining()
+			if n > 0 && !inclusive {
+				n++
+			}
+			res, _ = s.tree.RangeLimit(key_start, bound, n, true)
+			if !inclusive && len(res) > 0 && res[0].Key == bound {
+				res = res[1:]
+			}
+			if n := remaining(); n > 0 && len(res) > n {
+				res = res[:n]
+			}
+		}
+		for _, kr := range res {
+			results = append(results, tree_api.KeyRecordOf[K, V]{Key: kr.Key, Record: s.outer(kr.Key, kr.Record)})
+		}
+		s.gate.RUnlock()
+
+		if !reverse {
+			if !s.hasHigh || s.high > key_end {
+				break
+			}
+			bound = s.high
+		} else {
+			if !s.hasLow || s.low <= key_start {
+				break
+			}
+			bound, inclusive = s.low, false
+		}
+	}
+	return results, nil
+}
+
+// PrintTree prints each shard's bounds followed by its inner tree, if the
+// inner tree can print itself.
+func (t *ShardTreeOf[K, V]) PrintTree() {
+	for i, s := range t.router.Load().shards {
+		fmt.Printf("Shard %d [", i)
+		if s.hasLow {
+			fmt.Printf("%v", s.low)
+		}
+		fmt.Printf(", ")
+		if s.hasHigh {
+			fmt.Printf("%v", s.high)
+		}
+		fmt.Printf(")\n")
+		if p, ok := s.tree.(interface{ PrintTree() }); ok {
+			p.PrintTree()
+		}
+	}
+}
+
+func (t *ShardTreeOf[K, V]) PalmBasic(key_count int, num_threads int) {
+	panic("not implemented for ShardTree")
+}
+
+func (t *ShardTreeOf[K, V]) Palm(queries []tree_api.QueryOf[K, V], num_threads int) []tree_api.ResultOf[V] {
+	panic("not implemented for ShardTree")
+}
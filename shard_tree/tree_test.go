@@ -0,0 +1,86 @@
+package shard_tree
+
+import (
+	"fmt"
+	"main/crab"
+	"main/global_lock_tree"
+	"main/tree_api"
+	"main/tree_testing"
+	"testing"
+)
+
+// newTestTree builds a tree of crab shards that rebalances every few
+// operations, so that tests see it split and merge.
+func newTestTree(maxShards int, window int) *ShardTree {
+	return NewTree(crab.NewTree, maxShards, window).(*ShardTree)
+}
+
+func TestSplitAndMerge(t *testing.T) {
+	tree := newTestTree(4, 64)
+	want := make(map[int]string)
+	for i := 0; i < 1000; i++ {
+		key := i * 7919 % 1000
+		tree.Insert(key, []byte(fmt.Sprint(key)))
+		want[key] = fmt.Sprint(key)
+	}
+	if n := len(tree.router.Load().shards); n != 4 {
+		t.Fatalf("expected spread inserts to split the tree into 4 shards, got %d", n)
+	}
+	tree_testing.CheckContents(t, tree, want)
+
+	// Records keep their identity when their key moves to another shard.
+	old, _ := tree.Find(999, false)
+
+	// Traffic on the low keys alone merges the quiet shards above them and
+	// splits the busy one.
+	for round := 0; round < 100; round++ {
+		for i := 0; i < 64; i++ {
+			tree.Find(i, false)
+		}
+	}
+	shards := tree.router.Load().shards
+	if len(shards) != 4 || !shards[1].hasHigh || shards[1].high > 64 {
+		t.Errorf("expected the low keys to be spread over the first shards, got %d shards", len(shards))
+	}
+	if ok, err := tree.CompareAndSwap(999, old, []byte("moved")); !ok || err != nil {
+		t.Errorf("compare and swap of a moved key: %v %v", ok, err)
+	}
+	want[999] = "moved"
+	tree_testing.CheckContents(t, tree, want)
+
+	for _, limit := range []int{1, 63, 64, 65} {
+		for _, reverse := range []bool{false, true} {
+			res, _ := tree.RangeLimit(0, 999, limit, reverse)
+			if len(res) != limit {
+				t.Errorf("limit %d reverse %v: expected %d keys and got %d", limit, reverse, limit, len(res))
+			} else if first := res[0].Key; (first == 0) == reverse {
+				t.Errorf("limit %d reverse %v: range started at %d", limit, reverse, first)
+			}
+		}
+	}
+}
+
+// With the default window only some operations are counted, which should
+// still be enough to notice that one shard takes all the load.
+func TestSampledWindowSplits(t *testing.T) {
+	tree := newTestTree(4, DefaultWindow)
+	for i := 0; i < 8*DefaultWindow; i++ {
+		tree.Upsert(i*7919%(8*DefaultWindow), []byte("v"))
+	}
+	if n := len(tree.router.Load().shards); n < 2 {
+		t.Errorf("expected spread inserts to split the tree, got %d shards", n)
+	}
+}
+
+func TestConcurrentPointOps(t *testing.T) {
+	shards := map[string]func(...tree_api.Option) tree_api.BPTree{
+		"crab":        crab.NewTree,
+		"global_lock": global_lock_tree.NewTree,
+	}
+	for name, newShard := range shards {
+		newShard := newShard
+		t.Run(name, func(t *testing.T) {
+			tree_testing.ConcurrentPointOps(t, NewTree(newShard, 8, 32, tree_api.WithOrder(4)))
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package shard_tree
+
+import (
+	"fmt"
+	"main/tree_api"
+)
+
+// Validate checks that the tree is well formed: the shards cover the whole
+// key space in order, each picking up at the bound where the one before it
+// ends; none is retired or has its gate held; each inner tree is itself valid;
+// and every key sits in the shard that covers it, under a record. It returns
+// an error wrapping tree_api.ErrInvalidTree that names the first shard found
+// to be broken, or nil if the tree is well formed.
+//
+// Validate holds each gate only while checking it, so splits, merges and
+// other operations under way must have finished.
+func (t *ShardTreeOf[K, V]) Validate() error {
+	r := t.router.Load()
+	if r == nil || len(r.shards) == 0 {
+		return fmt.Errorf("%w: router has no shards", tree_api.ErrInvalidTree)
+	}
+	if len(r.shards) > t.maxShards {
+		return fmt.Errorf("%w: router has %d shards, more than the maximum of %d", tree_api.ErrInvalidTree, len(r.shards), t.maxShards)
+	}
+	for i, s := range r.shards {
+		fail := func(format string, args ...any) error {
+			return fmt.Errorf("%w: shard %d: %s", tree_api.ErrInvalidTree, i, fmt.Sprintf(format, args...))
+		}
+		if i == 0 && s.hasLow {
+			return fail("has a lower bound of %v but is the first shard", s.low)
+		}
+		if i == len(r.shards)-1 && s.hasHigh {
+			return fail("has an upper bound of %v but is the last shard", s.high)
+		}
+		if i > 0 {
+			prev := r.shards[i-1]
+			if !s.hasLow || !prev.hasHigh || s.low != prev.high {
+				return fail("does not start where shard %d ends", i-1)
+			}
+		}
+		if s.hasLow && s.hasHigh && s.low >= s.high {
+			return fail("has bounds [%v, %v) out of order", s.low, s.high)
+		}
+		if !s.gate.TryLock() {
+			return fail("has its gate held")
+		}
+		err := t.checkShard(s, fail)
+		s.gate.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkShard validates the inner tree of s and the keys in it. The caller
+// holds the gate of s.
+func (t *ShardTreeOf[K, V]) checkShard(s *shardOf[K, V], fail func(string, ...any) error) error {
+	if s.retired {
+		return fail("is retired but still routed to")
+	}
+	if err := s.tree.Validate(); err != nil {
+		return fail("%s", err)
+	}
+	it := s.tree.NewIterator()
+	defer it.Close()
+	for it.Next() {
+		if !s.covers(it.Key()) {
+			return fail("holds key %v outside its bounds", it.Key())
+		}
+		if it.Value() == nil {
+			return fail("holds key %v without a record", it.Key())
+		}
+	}
+	return nil
+}
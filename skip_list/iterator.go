@@ -0,0 +1,105 @@
+package skip_list
+
+import (
+	"cmp"
+	"main/tree_api"
+)
+
+// IteratorOf walks the keys of a SkipList in order. It keeps the node it is
+// on and the record it read there. Next follows the bottom level from that
+// node, which still leads forwards once the node is unlinked; Prev searches
+// for the predecessor of its key. It sees every key that is present
+// throughout the walk.
+type IteratorOf[K cmp.Ordered, V any] struct {
+	tree      *SkipListOf[K, V]
+	node      *NodeOf[K, V]
+	record    *tree_api.RecordOf[V]
+	started   bool
+	exhausted bool
+	closed    bool
+}
+
+func (t *SkipListOf[K, V]) NewIterator() tree_api.IteratorOf[K, V] {
+	return &IteratorOf[K, V]{tree: t}
+}
+
+func (it *IteratorOf[K, V]) Seek(key K) bool {
+	if it.closed {
+		return false
+	}
+	it.started = true
+	return it.settleForward(it.tree.search(key))
+}
+
+func (it *IteratorOf[K, V]) Next() bool {
+	if it.closed || it.exhausted {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		return it.settleForward(it.tree.head.next[0].Load().node)
+	}
+	return it.settleForward(it.node.next[0].Load().node)
+}
+
+func (it *IteratorOf[K, V]) Prev() bool {
+	if it.closed || it.exhausted {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		var zero K
+		return it.settle(it.tree.last(zero, false, false))
+	}
+	return it.settle(it.tree.last(it.node.key, true, false))
+}
+
+// settleForward moves the iterator to the first node from n on that is not
+// deleted.
+func (it *IteratorOf[K, V]) settleForward(n *NodeOf[K, V]) bool {
+	for ; n != nil; n = n.next[0].Load().node {
+		if r := n.record.Load(); r != nil {
+			return it.settle(n, r)
+		}
+	}
+	return it.settle(nil, nil)
+}
+
+// settle moves the iterator to n, or exhausts it if n is nil.
+func (it *IteratorOf[K, V]) settle(n *NodeOf[K, V], r *tree_api.RecordOf[V]) bool {
+	it.node, it.record = n, r
+	it.exhausted = n == nil
+	return !it.exhausted
+}
+
+func (it *IteratorOf[K, V]) Key() K {
+	if !it.valid() {
+		var zero K
+		return zero
+	}
+	return it.node.key
+}
+
+func (it *IteratorOf[K, V]) Value() *tree_api.RecordOf[V] {
+	if !it.valid() {
+		return nil
+	}
+	return it.record
+}
+
+func (it *IteratorOf[K, V]) Err() error {
+	if it.closed {
+		return tree_api.ErrIteratorClosed
+	}
+	return nil
+}
+
+func (it *IteratorOf[K, V]) Close() error {
+	it.closed = true
+	it.node, it.record = nil, nil
+	return nil
+}
+
+func (it *IteratorOf[K, V]) valid() bool {
+	return !it.closed && !it.exhausted && it.node != nil
+}
@@ -0,0 +1,62 @@
+package skip_list
+
+import (
+	"cmp"
+	"main/tree_api"
+	"math/bits"
+	"math/rand"
+	"sync/atomic"
+)
+
+// maxLevel bounds the height of a tower. Each level holds about half the nodes
+// of the one below, so 32 levels index far more keys than fit in memory.
+const maxLevel = 32
+
+// linkOf is a node's successor at one level, and whether the node has been
+// marked for removal at that level. A link is never modified: changing it
+// swaps in a new one, so the successor and the mark change together.
+type linkOf[K cmp.Ordered, V any] struct {
+	node   *NodeOf[K, V] // nil past the last node
+	marked bool
+}
+
+// NodeOf is one key of a SkipList, with a tower of links of random height.
+// The record goes to nil when the key is deleted, which is the moment the
+// delete takes effect; the links are marked afterwards, from the top down,
+// and the node is then unlinked at every level by the next search that passes
+// it.
+type NodeOf[K cmp.Ordered, V any] struct {
+	key    K
+	record atomic.Pointer[tree_api.RecordOf[V]]
+	next   []atomic.Pointer[linkOf[K, V]]
+}
+
+type Node = NodeOf[int, []byte]
+
+func newNode[K cmp.Ordered, V any](key K, record *tree_api.RecordOf[V], height int) *NodeOf[K, V] {
+	n := &NodeOf[K, V]{key: key, next: make([]atomic.Pointer[linkOf[K, V]], height)}
+	n.record.Store(record)
+	for i := range n.next {
+		n.next[i].Store(&linkOf[K, V]{})
+	}
+	return n
+}
+
+// randomHeight draws a tower height, each extra level half as likely as the
+// one before.
+func randomHeight() int {
+	return 1 + bits.TrailingZeros64(rand.Uint64()|1<<(maxLevel-1))
+}
+
+// mark marks every link of n, from the top down, so that no node can be linked
+// in after it at any level.
+func (n *NodeOf[K, V]) mark() {
+	for level := len(n.next) - 1; level >= 0; level-- {
+		for {
+			l := n.next[level].Load()
+			if l.marked || n.next[level].CompareAndSwap(l, &linkOf[K, V]{node: l.node, marked: true}) {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package skip_list
+
+import (
+	"cmp"
+	"fmt"
+	"main/tree_api"
+)
+
+// A skip list has no nodes of fixed fan-out, so the order a list is built
+// with is only checked, to keep the constructor interchangeable with the
+// B+ trees'.
+const (
+	defaultOrder = 4
+	minOrder     = 3
+	maxOrder     = 512
+)
+
+// SkipListOf is a lock-free skip list in the style of Fraser and of Herlihy
+// and Shavit, as a baseline ordered map to compare the trees against. Every
+// change is a compare-and-swap on one node's record or one link. A node is
+// inserted by linking it in at the bottom level, which is when the insert
+// takes effect, and then at each level of its tower in turn. Readers follow
+// links without writing anything; writers unlink the marked nodes they come
+// across as they search.
+//
+// Forward scans follow the bottom level. There are no backward links, so
+// reverse scans and Prev search the towers again for each predecessor.
+type SkipListOf[K cmp.Ordered, V any] struct {
+	head *NodeOf[K, V] // a sentinel below every key, as tall as a tower can be
+}
+
+type SkipList = SkipListOf[int, []byte]
+
+func NewTree(opts ...tree_api.Option) tree_api.BPTree {
+	return NewTreeOf[int, []byte](opts...)
+}
+
+// NewTreeOf accepts the options every tree does, but WithOrder is only
+// checked against the usual bounds and otherwise ignored, as towers have
+// random heights rather than a fan-out: lists built with different orders are
+// the same. Order sweeps leave the skip list out for that reason.
+func NewTreeOf[K cmp.Ordered, V any](opts ...tree_api.Option) tree_api.TreeOf[K, V] {
+	if _, err := tree_api.BuildOptions(defaultOrder, minOrder, maxOrder, opts); err != nil {
+		panic(err)
+	}
+	var zero K
+	return &SkipListOf[K, V]{head: newNode[K, V](zero, nil, maxLevel)}
+}
+
+// windowOf is where a search for a key ended at each level: the last node
+// before the key and the link it had to the first node at or after it.
+type windowOf[K cmp.Ordered, V any] struct {
+	preds [maxLevel]*NodeOf[K, V]
+	links [maxLevel]*linkOf[K, V]
+}
+
+// find fills w for key, unlinking every marked node it passes, and reports
+// whether a node for key follows at the bottom level. It starts again from
+// the head if a node it stands on is marked under it.
+func (t *SkipListOf[K, V]) find(key K, w *windowOf[K, V]) bool {
+retry:
+	for {
+		pred := t.head
+		for level := maxLevel - 1; level >= 0; level-- {
+			l := pred.next[level].Load()
+			if l.marked {
+				continue retry
+			}
+			for l.node != nil {
+				curr := l.node
+				cl := curr.next[level].Load()
+				if cl.marked {
+					unlinked := &linkOf[K, V]{node: cl.node}
+					if !pred.next[level].CompareAndSwap(l, unlinked) {
+						continue retry
+					}
+					l = unlinked
+					continue
+				}
+				if curr.key >= key {
+					break
+				}
+				pred, l = curr, cl
+			}
+			w.preds[level], w.links[level] = pred, l
+		}
+		succ := w.links[0].node
+		return succ != nil && succ.key == key
+	}
+}
+
+// search returns the first node at the bottom level with a key of at least
+// key, or nil. It writes nothing, and may return a node that is being
+// deleted.
+func (t *SkipListOf[K, V]) search(key K) *NodeOf[K, V] {
+	pred := t.head
+	var curr *NodeOf[K, V]
+	for level := maxLevel - 1; level >= 0; level-- {
+		curr = pred.next[level].Load().node
+		for curr != nil && curr.key < key {
+			pred = curr
+			curr = curr.next[level].Load().node
+		}
+	}
+	return curr
+}
+
+// last returns the node with the largest key below bound, or at most bound
+// with inclusive set, that is not deleted, with its record. Without hasBound
+// there is no bound. It returns nil if there is no such node.
+func (t *SkipListOf[K, V]) last(bound K, hasBound, inclusive bool) (*NodeOf[K, V], *tree_api.RecordOf[V]) {
+	for {
+		pred := t.head
+		for level := maxLevel - 1; level >= 0; level-- {
+			curr := pred.next[level].Load().node
+			for curr != nil && (!hasBound || curr.key < bound || (inclusive && curr.key == bound)) {
+				pred = curr
+				curr = curr.next[level].Load().node
+			}
+		}
+		if pred == t.head {
+			return nil, nil
+		}
+		if r := pred.record.Load(); r != nil {
+			return pred, r
+		}
+		bound, hasBound, inclusive = pred.key, true, false
+	}
+}
+
+// Find reports the key absent if its node has been deleted. A node can only
+// be reached while it is linked, and a new node for the same key is only
+// linked once the old one is gone, so the key was absent at some moment while
+// Find ran.
+func (t *SkipListOf[K, V]) Find(key K, verbose bool) (*tree_api.RecordOf[V], error) {
+	if n := t.search(key); n != nil && n.key == key {
+		if r := n.record.Load(); r != nil {
+			return r, nil
+		}
+	}
+	return nil, tree_api.ErrKeyNotFound
+}
+
+func (t *SkipListOf[K, V]) FindAndPrint(key K, verbose bool) {
+	r, err := t.Find(key, verbose)
+
+	if err != nil || r == nil {
+		fmt.Printf("Record not found under key %v.\n", key)
+	} else {
+		fmt.Printf("Record at %p -- key %v, value %s.\n", r, key, tree_api.FormatValue(r.Value))
+	}
+}
+
+func (t *SkipListOf[K, V]) FindAndPrintRange(key_start, key_end K, verbose bool) {
+	results, _ := t.Range(key_start, key_end)
+	if len(results) == 0 {
+		fmt.Println("None found,")
+	} else {
+		for _, kr := range results {
+			fmt.Printf("Key: %v  Location: %p  Value: %s\n",
+				kr.Key,
+				kr.Record,
+				tree_api.FormatValue(kr.Record.Value))
+		}
+	}
+}
+
+func (t *SkipListOf[K, V]) Insert(key K, value V) error {
+	return t.insert(key, &tree_api.RecordOf[V]{Value: value}, false)
+}
+
+// Upsert inserts key, or replaces its record if it is already present.
+func (t *SkipListOf[K, V]) Upsert(key K, value V) error {
+	return t.insert(key, &tree_api.RecordOf[V]{Value: value}, true)
+}
+
+// insert links a new node in for key, or finds key's node and, with replace
+// set, swaps in record. A node that is found deleted but still linked is
+// unlinked first, so that two nodes for one key are never linked at once.
+func (t *SkipListOf[K, V]) insert(key K, record *tree_api.RecordOf[V], replace bool) error {
+	var w windowOf[K, V]
+	for {
+		if t.find(key, &w) {
+			n := w.links[0].node
+			r := n.record.Load()
+			if r == nil {
+				t.unlink(n)
+				continue
+			}
+			if !replace {
+				return tree_api.ErrKeyExists
+			}
+			if n.record.CompareAndSwap(r, record) {
+				return nil
+			}
+			continue
+		}
+		n := newNode(key, record, randomHeight())
+		for level := range n.next {
+			n.next[level].Store(&linkOf[K, V]{node: w.links[level].node})
+		}
+		if w.preds[0].next[0].CompareAndSwap(w.links[0], &linkOf[K, V]{node: n}) {
+			t.linkTower(n, &w)
+			return nil
+		}
+	}
+}
+
+// linkTower links n, which is linked at the bottom level, into the upper
+// levels of its tower, searching again whenever a neighbour changes. It
+// gives up once n is marked, since a deleted node must not be linked in any
+// further; if n is marked just after being linked at a level, the delete may
+// already have made its last pass, so linkTower searches once more to unlink
+// it.
+func (t *SkipListOf[K, V]) linkTower(n *NodeOf[K, V], w *windowOf[K, V]) {
+	for level := 1; level < len(n.next); level++ {
+		for {
+			l := n.next[level].Load()
+			if l.marked {
+				return
+			}
+			succ := w.links[level].node
+			if l.node != succ && !n.next[level].CompareAndSwap(l, &linkOf[K, V]{node: succ}) {
+				continue
+			}
+			if w.preds[level].next[level].CompareAndSwap(w.links[level], &linkOf[K, V]{node: n}) {
+				break
+			}
+			if !t.find(n.key, w) || w.links[0].node != n {
+				return
+			}
+		}
+		if n.next[level].Load().marked {
+			t.find(n.key, w)
+			return
+		}
+	}
+}
+
+// unlink marks n, whose record is already nil, and searches for its key so
+// that it is removed from every level.
+func (t *SkipListOf[K, V]) unlink(n *NodeOf[K, V]) {
+	n.mark()
+	var w windowOf[K, V]
+	t.find(n.key, &w)
+}
+
+// Update replaces the record of an existing key.
+func (t *SkipListOf[K, V]) Update(key K, value V) error {
+	_, err := t.swap(key, nil, value, false)
+	return err
+}
+
+// CompareAndSwap replaces the record of key if it is still old.
+func (t *SkipListOf[K, V]) CompareAndSwap(key K, old *tree_api.RecordOf[V], new V) (bool, error) {
+	return t.swap(key, old, new, true)
+}
+
+// swap gives an existing key a new record. With compare set it only does so
+// if the current record is old.
+func (t *SkipListOf[K, V]) swap(key K, old *tree_api.RecordOf[V], value V, compare bool) (bool, error) {
+	record := &tree_api.RecordOf[V]{Value: value}
+	n := t.search(key)
+	if n == nil || n.key != key {
+		return false, tree_api.ErrKeyNotFound
+	}
+	for {
+		r := n.record.Load()
+		if r == nil {
+			return false, tree_api.ErrKeyNotFound
+		}
+		if compare && r != old {
+			return false, nil
+		}
+		if n.record.CompareAndSwap(r, record) {
+			return true, nil
+		}
+	}
+}
+
+func (t *SkipListOf[K, V]) Delete(key K) error {
+	var w windowOf[K, V]
+	for {
+		if !t.find(key, &w) {
+			return tree_api.ErrKeyNotFound
+		}
+		n := w.links[0].node
+		r := n.record.Load()
+		if r != nil && n.record.CompareAndSwap(r, nil) {
+			t.unlink(n)
+			return nil
+		}
+		if r == nil {
+			t.unlink(n)
+		}
+	}
+}
+
+func (t *SkipListOf[K, V]) Range(key_start, key_end K) ([]tree_api.KeyRecordOf[K, V], error) {
+	return t.RangeLimit(key_start, key_end, 0, false)
+}
+
+// RangeLimit walks the bottom level forwards, skipping deleted nodes, and
+// searches for each predecessor in turn backwards. The result is sorted and
+// holds every key that was present throughout the call, but is not a
+// snapshot of the whole range.
+func (t *SkipListOf[K, V]) RangeLimit(key_start, key_end K, limit int, reverse bool) ([]tree_api.KeyRecordOf[K, V], error) {
+	if key_start > key_end {
+		return nil, tree_api.ErrInvalidRange
+	}
+	results := []tree_api.KeyRecordOf[K, V]{}
+	full := func() bool { return limit > 0 && len(results) == limit }
+
+	if !reverse {
+		for n := t.search(key_start); n != nil && n.key <= key_end && !full(); n = n.next[0].Load().node {
+			if r := n.record.Load(); r != nil {
+				results = append(results, tree_api.KeyRecordOf[K, V]{Key: n.key, Record: r})
+			}
+		}
+		return results, nil
+	}
+
+	n, r := t.last(key_end, true, true)
+	for n != nil && n.key >= key_start && !full() {
+		results = append(results, tree_api.KeyRecordOf[K, V]{Key: n.key, Record: r})
+		n, r = t.last(n.key, true, false)
+	}
+	return results, nil
+}
+
+// PrintTree prints the keys of each level, from the highest level in use
+// down to the bottom.
+func (t *SkipListOf[K, V]) PrintTree() {
+	for level := maxLevel - 1; level >= 0; level-- {
+		n := t.head.next[level].Load().node
+		if n == nil {
+			continue
+		}
+		for ; n != nil; n = n.next[level].Load().node {
+			fmt.Printf("%v ", n.key)
+		}
+		fmt.Printf("\n")
+	}
+}
+
+func (t *SkipListOf[K, V]) PalmBasic(key_count int, num_threads int) {
+	panic("not implemented for SkipList")
+}
+
+func (t *SkipListOf[K, V]) Palm(queries []tree_api.QueryOf[K, V], num_threads int) []tree_api.ResultOf[V] {
+	panic("not implemented for SkipList")
+}
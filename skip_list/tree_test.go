@@ -0,0 +1,189 @@
+package skip_list
+
+import (
+	"errors"
+	"fmt"
+	"main/tree_api"
+	"main/tree_testing"
+	"sync"
+	"testing"
+)
+
+func TestHalfDeletedNodeIsSkipped(t *testing.T) {
+	tree := NewTreeOf[int, []byte]().(*SkipList)
+	for i := 0; i < 100; i++ {
+		tree.Insert(i, []byte(fmt.Sprint(i)))
+	}
+
+	// Delete 50 as far as its record, as if the deleting goroutine had
+	// stalled before marking and unlinking the node.
+	n := tree.search(50)
+	n.record.Store(nil)
+	if _, err := tree.Find(50, false); err != tree_api.ErrKeyNotFound {
+		t.Errorf("expected a deleted key to be absent, got %v", err)
+	}
+	for _, reverse := range []bool{false, true} {
+		res, _ := tree.RangeLimit(49, 51, 0, reverse)
+		if len(res) != 2 {
+			t.Errorf("expected the range to skip the deleted key, got %v", res)
+		}
+	}
+	if err := tree.Validate(); !errors.Is(err, tree_api.ErrInvalidTree) {
+		t.Errorf("expected a deleted but linked node to be invalid, got %v", err)
+	}
+
+	// Inserting the key again finishes the stalled delete first.
+	if err := tree.Insert(50, []byte("again")); err != nil {
+		t.Fatalf("insert 50: %s", err)
+	}
+	if tree.search(50) == n {
+		t.Errorf("expected the deleted node to be unlinked")
+	}
+	want := make(map[int]string)
+	for i := 0; i < 100; i++ {
+		want[i] = fmt.Sprint(i)
+	}
+	want[50] = "again"
+	tree_testing.CheckContents(t, tree, want)
+}
+
+func TestConcurrentPointOps(t *testing.T) {
+	tree_testing.ConcurrentPointOps(t, NewTreeOf[int, []byte]())
+}
+
+// linkedAt reports the levels at which n can be reached from the head.
+func linkedAt(tree *SkipList, n *Node) []int {
+	levels := []int{}
+	for level := 0; level < maxLevel; level++ {
+		for m := tree.head.next[level].Load().node; m != nil; m = m.next[level].Load().node {
+			if m == n {
+				levels = append(levels, level)
+				break
+			}
+		}
+	}
+	return levels
+}
+
+// tallNode returns a node of tree whose tower is at least height tall.
+func tallNode(t *testing.T, tree *SkipList, height int) *Node {
+	for n := tree.head.next[0].Load().node; n != nil; n = n.next[0].Load().node {
+		if len(n.next) >= height {
+			return n
+		}
+	}
+	t.Fatalf("no tower of height %d", height)
+	return nil
+}
+
+// TestPartlyMarkedTower stops a delete after it has marked the upper levels
+// of a tall tower but not the bottom one. Searches passing the tower unlink
+// it from the marked levels only, and keys around it stay reachable; the
+// next delete of the key finishes the job.
+func TestPartlyMarkedTower(t *testing.T) {
+	tree := NewTreeOf[int, []byte]().(*SkipList)
+	want := make(map[int]string)
+	for i := 0; i < 1000; i++ {
+		tree.Insert(i, []byte(fmt.Sprint(i)))
+		want[i] = fmt.Sprint(i)
+	}
+	n := tallNode(t, tree, 3)
+	height := len(n.next)
+	n.record.Store(nil)
+	for level := height - 1; level >= 1; level-- {
+		l := n.next[level].Load()
+		n.next[level].Store(&linkOf[int, []byte]{node: l.node, marked: true})
+	}
+	delete(want, n.key)
+
+	for key, value := range want {
+		if r, err := tree.Find(key, false); err != nil || string(r.Value) != value {
+			t.Fatalf("key %d next to a marked tower: %v %v", key, r, err)
+		}
+	}
+	if got := linkedAt(tree, n); len(got) != height {
+		t.Errorf("expected readers to leave the tower linked at all %d levels, it is at %v", height, got)
+	}
+	// Writers unlink the marked levels as they pass.
+	tree.Upsert(n.key+1, []byte("next"))
+	want[n.key+1] = "next"
+	if got := linkedAt(tree, n); len(got) != 1 || got[0] != 0 {
+		t.Errorf("expected the tower to be left at the bottom level only, it is at %v", got)
+	}
+	if err := tree.Validate(); !errors.Is(err, tree_api.ErrInvalidTree) {
+		t.Errorf("expected a deleted but linked node to be invalid, got %v", err)
+	}
+
+	if err := tree.Delete(n.key); err != tree_api.ErrKeyNotFound {
+		t.Errorf("expected deleting the key again to find it absent, got %v", err)
+	}
+	if got := linkedAt(tree, n); len(got) != 0 {
+		t.Errorf("expected the tower to be gone, it is at %v", got)
+	}
+	tree_testing.CheckContents(t, tree, want)
+}
+
+// TestTowerDeletedWhileLinking links a tall node at the bottom level, as an
+// insert does first, and deletes it before the insert builds the rest of its
+// tower. The insert then finds the tower marked and links no more of it.
+func TestTowerDeletedWhileLinking(t *testing.T) {
+	tree := NewTreeOf[int, []byte]().(*SkipList)
+	for i := 0; i < 100; i += 2 {
+		tree.Insert(i, []byte(fmt.Sprint(i)))
+	}
+	var w windowOf[int, []byte]
+	if tree.find(51, &w) {
+		t.Fatalf("51 is already present")
+	}
+	n := newNode(51, &tree_api.Record{Value: []byte("51")}, 4)
+	for level := range n.next {
+		n.next[level].Store(&linkOf[int, []byte]{node: w.links[level].node})
+	}
+	if !w.preds[0].next[0].CompareAndSwap(w.links[0], &linkOf[int, []byte]{node: n}) {
+		t.Fatalf("could not link 51 at the bottom level")
+	}
+	if err := tree.Delete(51); err != nil {
+		t.Fatalf("delete 51: %s", err)
+	}
+	tree.linkTower(n, &w)
+	if got := linkedAt(tree, n); len(got) != 0 {
+		t.Errorf("expected the deleted tower to stay unlinked, it is at %v", got)
+	}
+	if err := tree.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestInsertDeleteChurn has goroutines insert and delete the same few keys,
+// so that towers are marked while they are still being linked in, and
+// searches race to unlink them. Afterwards no marked tower may be left
+// linked at any level.
+func TestInsertDeleteChurn(t *testing.T) {
+	tree := NewTreeOf[int, []byte]().(*SkipList)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				key := (i/2 + g) % 16
+				if i%2 == 0 {
+					tree.Insert(key, []byte(fmt.Sprint(key)))
+				} else {
+					tree.Delete(key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	want := make(map[int]string)
+	for key := 0; key < 16; key++ {
+		if _, err := tree.Find(key, false); err == nil {
+			want[key] = fmt.Sprint(key)
+		}
+	}
+	tree_testing.CheckContents(t, tree, want)
+}
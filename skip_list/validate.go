@@ -0,0 +1,68 @@
+package skip_list
+
+import (
+	"fmt"
+	"main/tree_api"
+)
+
+// Validate checks that the list is well formed: the head is a full-height
+// tower; every level holds its keys in strictly ascending order; no linked
+// node is marked or deleted; and every node at the bottom level is linked at
+// every level of its tower and at no level above it. It returns an error
+// wrapping tree_api.ErrInvalidTree that names the level and key of the first
+// node found to be broken, or nil if the list is well formed.
+//
+// Validate follows links without synchronizing with writers, so operations
+// under way must have finished.
+func (t *SkipListOf[K, V]) Validate() error {
+	if t.head == nil || len(t.head.next) != maxLevel {
+		return fmt.Errorf("%w: head is not a tower of height %d", tree_api.ErrInvalidTree, maxLevel)
+	}
+
+	linked := make([]map[*NodeOf[K, V]]bool, maxLevel)
+	for level := maxLevel - 1; level >= 0; level-- {
+		linked[level] = make(map[*NodeOf[K, V]]bool)
+		if t.head.next[level].Load().marked {
+			return fmt.Errorf("%w: head is marked at level %d", tree_api.ErrInvalidTree, level)
+		}
+		var prev *NodeOf[K, V]
+		for n := t.head.next[level].Load().node; n != nil; n = n.next[level].Load().node {
+			fail := func(format string, args ...any) error {
+				return fmt.Errorf("%w: level %d, key %v: %s", tree_api.ErrInvalidTree, level, n.key, fmt.Sprintf(format, args...))
+			}
+			if linked[level][n] {
+				return fail("is linked twice")
+			}
+			linked[level][n] = true
+			if len(n.next) <= level {
+				return fail("is linked above its tower of height %d", len(n.next))
+			}
+			if n.next[level].Load().marked {
+				return fail("is marked but still linked")
+			}
+			if n.record.Load() == nil {
+				return fail("is deleted but still linked")
+			}
+			if prev != nil && prev.key >= n.key {
+				return fail("comes after key %v", prev.key)
+			}
+			prev = n
+		}
+	}
+
+	for n := range linked[0] {
+		for level := 1; level < len(n.next); level++ {
+			if !linked[level][n] {
+				return fmt.Errorf("%w: level %d, key %v: is missing from its tower", tree_api.ErrInvalidTree, level, n.key)
+			}
+		}
+	}
+	for level := 1; level < maxLevel; level++ {
+		for n := range linked[level] {
+			if !linked[0][n] {
+				return fmt.Errorf("%w: level %d, key %v: is not linked at the bottom level", tree_api.ErrInvalidTree, level, n.key)
+			}
+		}
+	}
+	return nil
+}
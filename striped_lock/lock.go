@@ -0,0 +1,68 @@
+package striped_lock
+
+import (
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// RWMutex is a reader-writer lock whose readers announce themselves on one of
+// several counters, each on cache lines of its own, rather than all on the one
+// reader count of a sync.RWMutex, which every reader on every core writes to.
+// A writer raises a flag and then waits for every counter to drain. A reader
+// that sees the flag once it has announced itself backs out and waits for the
+// writer on the writers' mutex before trying again, so writers are not
+// starved.
+//
+// RLock returns the counter the reader announced itself on, to be handed back
+// to RUnlock.
+type RWMutex struct {
+	writers sync.Mutex
+	writing atomic.Bool
+	stripes []stripe
+}
+
+type stripe struct {
+	readers atomic.Int64
+	_       [120]byte // keeps neighbouring counters off each other's lines
+}
+
+// New gives the lock a counter per processor the scheduler runs goroutines
+// on. Readers pick a counter at random, as Go does not say which processor
+// they are on.
+func New() *RWMutex {
+	return &RWMutex{stripes: make([]stripe, runtime.GOMAXPROCS(0))}
+}
+
+func (l *RWMutex) Lock() {
+	l.writers.Lock()
+	l.writing.Store(true)
+	for i := range l.stripes {
+		for l.stripes[i].readers.Load() != 0 {
+			runtime.Gosched()
+		}
+	}
+}
+
+func (l *RWMutex) Unlock() {
+	l.writing.Store(false)
+	l.writers.Unlock()
+}
+
+func (l *RWMutex) RLock() int {
+	for {
+		i := rand.Intn(len(l.stripes))
+		l.stripes[i].readers.Add(1)
+		if !l.writing.Load() {
+			return i
+		}
+		l.stripes[i].readers.Add(-1)
+		l.writers.Lock()
+		l.writers.Unlock()
+	}
+}
+
+func (l *RWMutex) RUnlock(i int) {
+	l.stripes[i].readers.Add(-1)
+}
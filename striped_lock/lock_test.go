@@ -0,0 +1,118 @@
+package striped_lock
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewHasAStripePerProcessor(t *testing.T) {
+	l := New()
+	if len(l.stripes) != runtime.GOMAXPROCS(0) {
+		t.Errorf("expected %d stripes and got %d", runtime.GOMAXPROCS(0), len(l.stripes))
+	}
+}
+
+// A reader counts itself on the stripe RLock returns, and only there.
+func TestRLockCountsOnItsStripe(t *testing.T) {
+	l := &RWMutex{stripes: make([]stripe, 4)}
+	for n := 0; n < 20; n++ {
+		i := l.RLock()
+		for j := range l.stripes {
+			want := int64(0)
+			if j == i {
+				want = 1
+			}
+			if got := l.stripes[j].readers.Load(); got != want {
+				t.Errorf("stripe %d: expected %d readers and got %d", j, want, got)
+			}
+		}
+		l.RUnlock(i)
+		if got := l.stripes[i].readers.Load(); got != 0 {
+			t.Errorf("stripe %d: expected no readers after RUnlock and got %d", i, got)
+		}
+	}
+}
+
+// A writer waits for a reader that holds the lock, and a reader that arrives
+// while the writer holds it waits in turn without leaving a count behind.
+func TestWriterAndReaderWaitForEachOther(t *testing.T) {
+	l := &RWMutex{stripes: make([]stripe, 4)}
+	i := l.RLock()
+	var locked atomic.Bool
+	done := make(chan struct{})
+	go func() {
+		l.Lock()
+		locked.Store(true)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if locked.Load() {
+		t.Fatalf("writer got the lock while a reader held it")
+	}
+	l.RUnlock(i)
+	<-done
+
+	var read atomic.Bool
+	readDone := make(chan struct{})
+	go func() {
+		l.RUnlock(l.RLock())
+		read.Store(true)
+		close(readDone)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if read.Load() {
+		t.Fatalf("reader got the lock while a writer held it")
+	}
+	for j := range l.stripes {
+		if got := l.stripes[j].readers.Load(); got != 0 {
+			t.Errorf("stripe %d: expected the waiting reader to have backed out and got %d readers", j, got)
+		}
+	}
+	l.Unlock()
+	<-readDone
+}
+
+// Writers update two fields with a yield between them while readers check
+// that they match; under -race this also checks that readers are ordered
+// after writers.
+func TestWritersExcludeReaders(t *testing.T) {
+	l := New()
+	var a, b int
+	var stop atomic.Bool
+	var writers, readers sync.WaitGroup
+	for w := 0; w < 2; w++ {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			for n := 0; n < 1000; n++ {
+				l.Lock()
+				a++
+				runtime.Gosched()
+				b++
+				l.Unlock()
+			}
+		}()
+	}
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for !stop.Load() {
+				i := l.RLock()
+				if a != b {
+					t.Errorf("reader saw a partial write: %d and %d", a, b)
+				}
+				l.RUnlock(i)
+			}
+		}()
+	}
+	writers.Wait()
+	stop.Store(true)
+	readers.Wait()
+	if a != 2000 || b != 2000 {
+		t.Errorf("expected 2000 writes to each field, got %d and %d", a, b)
+	}
+}
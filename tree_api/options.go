@@ -0,0 +1,34 @@
+package tree_api
+
+import "fmt"
+
+// Options are the construction-time settings shared by every tree. Each
+// package supplies its own defaults and bounds.
+type Options struct {
+	// Order is the fan-out of a node: internal nodes hold up to Order children
+	// and every node holds up to Order-1 keys.
+	Order int
+}
+
+type Option func(*Options)
+
+// WithOrder sets the node fan-out. Constructors panic if it falls outside the
+// bounds the implementation supports.
+func WithOrder(order int) Option {
+	return func(o *Options) {
+		o.Order = order
+	}
+}
+
+// BuildOptions applies opts on top of the defaults and validates the result
+// against [minOrder, maxOrder].
+func BuildOptions(defaultOrder, minOrder, maxOrder int, opts []Option) (Options, error) {
+	o := Options{Order: defaultOrder}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.Order < minOrder || o.Order > maxOrder {
+		return o, fmt.Errorf("order %d is outside the supported range [%d, %d]", o.Order, minOrder, maxOrder)
+	}
+	return o, nil
+}
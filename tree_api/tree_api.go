@@ -1,30 +1,152 @@
 package tree_api
 
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"strings"
+)
+
 // All B+ trees in this repo implement this interface.
+//
+// The trees are generic over any ordered key type K and any value type V.
+// Keys that aren't cmp.Ordered themselves (UUIDs, composite keys) can be
+// indexed through an order-preserving string encoding, e.g. string(uuid[:]).
+// The un-suffixed names are the int/[]byte instantiation that the benchmarks
+// use; Go stencils int separately, so that path compiles down to plain integer
+// comparisons.
+
+var (
+	ErrKeyNotFound    = errors.New("key not found")
+	ErrKeyExists      = errors.New("key already exists")
+	ErrInvalidRange   = errors.New("invalid range: start is greater than end")
+	ErrIteratorClosed = errors.New("iterator is closed")
+	ErrInvalidTree    = errors.New("invalid tree")
+)
+
+type RecordOf[V any] struct {
+	Value V
+}
+
+type Record = RecordOf[[]byte]
 
-type Record struct {
-	Value []byte
+// KeyRecordOf is a single result of a range scan.
+type KeyRecordOf[K cmp.Ordered, V any] struct {
+	Key    K
+	Record *RecordOf[V]
 }
 
+type KeyRecord = KeyRecordOf[int, []byte]
+
 type Method int
 
 const (
 	MethodFind Method = iota
 	MethodInsert
 	MethodDelete
+	MethodUpsert
 )
 
-type Query struct {
+type QueryOf[K cmp.Ordered, V any] struct {
 	Method  Method
-	Key     int
+	Key     K
 	Done    bool
-	Pointer *Record
+	Pointer *RecordOf[V]
+}
+
+type Query = QueryOf[int, []byte]
+
+// ResultOf is the outcome of one query in a Palm batch.
+type ResultOf[V any] struct {
+	// Record is the record the query found, stored or removed.
+	Record *RecordOf[V]
+	// Found reports whether the key was present when the query ran.
+	Found bool
+	// Err is ErrKeyNotFound for a Find or Delete of an absent key and
+	// ErrKeyExists for an Insert of a key that is already present.
+	Err error
 }
 
-type BPTree interface {
-	Insert(key int, value []byte) error
-	Delete(key int) error
-	Find(key int, verbose bool) (*Record, error)
+type Result = ResultOf[[]byte]
+
+// Every tree keeps at most one record per key. Writes never modify a stored
+// record in place: Upsert, Update and CompareAndSwap store a fresh record, so a
+// record returned by Find is an immutable snapshot and its pointer identifies
+// the version of the value that was read.
+type TreeOf[K cmp.Ordered, V any] interface {
+	// Insert adds key and fails with ErrKeyExists if it is already present.
+	Insert(key K, value V) error
+	// Upsert adds key, or replaces its value if it is already present.
+	Upsert(key K, value V) error
+	// Update replaces the value of key and fails with ErrKeyNotFound if it is
+	// absent.
+	Update(key K, value V) error
+	// CompareAndSwap replaces the value of key only if the record stored under
+	// it is still old, a record previously returned by Find. It reports whether
+	// the swap happened, and fails with ErrKeyNotFound if key is absent.
+	CompareAndSwap(key K, old *RecordOf[V], new V) (bool, error)
+	// Delete removes key and fails if it is absent.
+	Delete(key K) error
+	Find(key K, verbose bool) (*RecordOf[V], error)
+	// Range returns every key in [start, end] in ascending order.
+	Range(start, end K) ([]KeyRecordOf[K, V], error)
+	// RangeLimit is Range capped at limit results (limit <= 0 means no cap).
+	// When reverse is set the results are in descending order, starting from
+	// end.
+	RangeLimit(start, end K, limit int, reverse bool) ([]KeyRecordOf[K, V], error)
+	// NewIterator returns an unpositioned cursor over the tree. It must be
+	// closed when the caller is done with it.
+	NewIterator() IteratorOf[K, V]
+	// Validate checks the tree's structural invariants and returns an error
+	// wrapping ErrInvalidTree that locates the first violation it finds. It is
+	// meant for checking a tree once concurrent work on it has finished.
+	Validate() error
 	PalmBasic(key_count int, num_threads int)
-	Palm(queries []Query, num_threads int) [][]*Record
+	// Palm runs a batch of queries and returns one result per query, in the
+	// same order as queries. Each query is marked Done once it has been
+	// applied. The batch behaves as if its queries ran one at a time in the
+	// order given, so a query sees the effect of every earlier query on the
+	// same key.
+	Palm(queries []QueryOf[K, V], num_threads int) []ResultOf[V]
+}
+
+type BPTree = TreeOf[int, []byte]
+
+// IteratorOf is a cursor that walks the tree's keys in order along the leaf
+// chain. A new iterator is unpositioned: Next moves it to the first key and
+// Prev to the last. Once Next or Prev runs off either end the iterator is
+// exhausted and only Seek can reposition it. Key and Value are only meaningful
+// after a call that returned true.
+type IteratorOf[K cmp.Ordered, V any] interface {
+	// Seek positions the iterator at the first key >= key.
+	Seek(key K) bool
+	Next() bool
+	Prev() bool
+	Key() K
+	Value() *RecordOf[V]
+	Err() error
+	// Close releases anything the iterator holds on to. It is safe to call
+	// more than once.
+	Close() error
+}
+
+type Iterator = IteratorOf[int, []byte]
+
+// FormatPath describes a node for Validate by the child indices leading to it
+// from the root, e.g. "root -> 2 -> 0".
+func FormatPath(path []int) string {
+	parts := []string{"root"}
+	for _, i := range path {
+		parts = append(parts, fmt.Sprint(i))
+	}
+	return strings.Join(parts, " -> ")
+}
+
+// FormatValue renders a record value for the Print helpers: byte slices as
+// text, anything else the way fmt would.
+func FormatValue(value any) string {
+	if b, ok := value.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(value)
 }
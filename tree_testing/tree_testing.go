@@ -0,0 +1,148 @@
+// Package tree_testing holds checks that the tests of several tree packages
+// share. Each takes a tree through tree_api.BPTree, so it exercises only the
+// behaviour every tree promises; tests of one design's internals stay in its
+// own package.
+package tree_testing
+
+import (
+	"fmt"
+	"main/tree_api"
+	"math"
+	"sync"
+	"testing"
+)
+
+// CheckContents checks that tree is valid and holds exactly the keys of want,
+// with their values, and that RangeLimit returns them in order both ways.
+func CheckContents(t testing.TB, tree tree_api.BPTree, want map[int]string) {
+	t.Helper()
+	if err := tree.Validate(); err != nil {
+		t.Errorf("%s", err)
+	}
+	for key, value := range want {
+		r, err := tree.Find(key, false)
+		if err != nil {
+			t.Errorf("key %d: %s", key, err)
+		} else if string(r.Value) != value {
+			t.Errorf("key %d: expected %s and got %s", key, value, r.Value)
+		}
+	}
+	for _, reverse := range []bool{false, true} {
+		res, err := tree.RangeLimit(math.MinInt, math.MaxInt, 0, reverse)
+		if err != nil {
+			t.Errorf("%s", err)
+		}
+		if len(res) != len(want) {
+			t.Errorf("expected %d keys and got %d", len(want), len(res))
+		}
+		for i := 1; i < len(res); i++ {
+			if (res[i-1].Key >= res[i].Key) != reverse {
+				t.Errorf("keys out of order: %d before %d", res[i-1].Key, res[i].Key)
+			}
+		}
+	}
+}
+
+// ConcurrentPointOps has 8 writers insert 300 keys each into an empty tree
+// and then delete, upsert or compare-and-swap every one of them, while two
+// readers check that iterators and reverse range scans stay sorted as the
+// tree changes shape underneath them. Once everyone is done it checks the
+// tree holds what the writers left.
+func ConcurrentPointOps(t *testing.T, tree tree_api.BPTree) {
+	const writers = 8
+	const keysPerWriter = 300
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+
+	for r := 0; r < 2; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				it := tree.NewIterator()
+				prev, first := 0, true
+				for it.Next() {
+					if !first && it.Key() <= prev {
+						t.Errorf("iterator saw %d after %d", it.Key(), prev)
+					}
+					prev, first = it.Key(), false
+				}
+				it.Close()
+				res, _ := tree.RangeLimit(100, 1000, 0, true)
+				for i := 1; i < len(res); i++ {
+					if res[i-1].Key <= res[i].Key {
+						t.Errorf("reverse range saw %d after %d", res[i].Key, res[i-1].Key)
+					}
+				}
+			}
+		}()
+	}
+
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < keysPerWriter; i++ {
+				key := i*writers + w
+				if err := tree.Insert(key, []byte(fmt.Sprint(key))); err != nil {
+					t.Errorf("insert %d: %s", key, err)
+				}
+			}
+			for i := 0; i < keysPerWriter; i++ {
+				key := i*writers + w
+				switch i % 3 {
+				case 0:
+					if err := tree.Delete(key); err != nil {
+						t.Errorf("delete %d: %s", key, err)
+					}
+				case 1:
+					if err := tree.Upsert(key, []byte(fmt.Sprint("u", key))); err != nil {
+						t.Errorf("upsert %d: %s", key, err)
+					}
+				case 2:
+					r, err := tree.Find(key, false)
+					if err != nil {
+						t.Errorf("find %d: %s", key, err)
+						continue
+					}
+					if ok, err := tree.CompareAndSwap(key, r, []byte(fmt.Sprint("c", key))); !ok || err != nil {
+						t.Errorf("compare and swap %d: %v %v", key, ok, err)
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+
+	want := make(map[int]string)
+	for w := 0; w < writers; w++ {
+		for i := 0; i < keysPerWriter; i++ {
+			key := i*writers + w
+			switch i % 3 {
+			case 1:
+				want[key] = fmt.Sprint("u", key)
+			case 2:
+				want[key] = fmt.Sprint("c", key)
+			}
+		}
+	}
+	CheckContents(t, tree, want)
+
+	it := tree.NewIterator()
+	count := 0
+	for it.Prev() {
+		count++
+	}
+	it.Close()
+	if count != len(want) {
+		t.Errorf("backwards iteration saw %d keys, expected %d", count, len(want))
+	}
+}